@@ -4,12 +4,21 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	app "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/backup"
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
 	db "github.com/luisguve/cheroapi/internal/pkg/bolt/contents"
+	"github.com/luisguve/cheroapi/internal/pkg/moderation"
+	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	"github.com/luisguve/cheroapi/internal/pkg/reactions"
 	server "github.com/luisguve/cheroapi/internal/pkg/server/contents"
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
 	pbUsers "github.com/luisguve/cheroproto-go/userapi"
+	"github.com/robfig/cron/v3"
 	"google.golang.org/grpc"
 )
 
@@ -17,14 +26,114 @@ type grpcConfig struct {
 	BindAddress string `toml:"bind_address"`
 }
 
+// qaConfig holds the thresholds for archiving threads on every Quality
+// Assurance.
+type qaConfig struct {
+	MinAgeHours         int `toml:"min_age_hours"`
+	MinInteractions     int `toml:"min_interactions"`
+	MaxAvgUpdateMinutes int `toml:"max_avg_update_minutes"`
+	MinScore            int `toml:"min_score"`
+}
+
+func (c qaConfig) thresholds() app.QAThresholds {
+	return app.QAThresholds{
+		MinAge:           time.Duration(c.MinAgeHours) * time.Hour,
+		MinInteractions:  uint32(c.MinInteractions),
+		MaxAvgUpdateTime: time.Duration(c.MaxAvgUpdateMinutes) * time.Minute,
+		MinScore:         c.MinScore,
+	}
+}
+
+// retentionConfig holds how long contents are kept after being deleted or
+// archived before they're purged. Zero keeps them forever.
+type retentionConfig struct {
+	DeletedDays  int `toml:"deleted_days"`
+	ArchivedDays int `toml:"archived_days"`
+}
+
+func (c retentionConfig) validate() error {
+	if c.DeletedDays < 0 {
+		return fmt.Errorf("Retention deleted days cannot be negative.")
+	}
+	if c.ArchivedDays < 0 {
+		return fmt.Errorf("Retention archived days cannot be negative.")
+	}
+	return nil
+}
+
+func (c retentionConfig) retention() app.Retention {
+	day := 24 * time.Hour
+	return app.Retention{
+		Deleted:  time.Duration(c.DeletedDays) * day,
+		Archived: time.Duration(c.ArchivedDays) * day,
+	}
+}
+
+// backupConfig sets where and when snapshots of the section database are
+// written.
+type backupConfig struct {
+	Dir      string `toml:"dir"`
+	Schedule string `toml:"schedule"` // Cron expression; empty disables them.
+	Keep     int    `toml:"keep"`     // Newest snapshots to keep; 0 keeps all.
+}
+
+func (c backupConfig) validate() error {
+	if c.Schedule != "" {
+		if c.Dir == "" {
+			return fmt.Errorf("Missing backup dir.")
+		}
+		if _, err := cron.ParseStandard(c.Schedule); err != nil {
+			return fmt.Errorf("Invalid backup schedule: %v.", err)
+		}
+	}
+	if c.Keep < 0 {
+		return fmt.Errorf("Backup keep cannot be negative.")
+	}
+	return nil
+}
+
 type cheroapiConfig struct {
-	SectionId    string     `toml:"section_id"`
-	SectionName  string     `toml:"section_name"`
-	DBdir        string     `toml:"db_dir"`
-	SrvConf      grpcConfig `toml:"contents_grpc_config"`
-	UsersSrvConf grpcConfig `toml:"users_grpc_config"`
-	LogDir       string     `toml:"log_dir"`
-	DoQA         bool       `toml:"schedule_qa"`
+	SectionId    string                     `toml:"section_id"`
+	SectionName  string                     `toml:"section_name"`
+	DBdir        string                     `toml:"db_dir"`
+	SrvConf      grpcConfig                 `toml:"contents_grpc_config"`
+	UsersSrvConf grpcConfig                 `toml:"users_grpc_config"`
+	LogDir       string                     `toml:"log_dir"`
+	DoQA         bool                       `toml:"schedule_qa"`
+	QASchedule   string                     `toml:"qa_schedule"`
+	QA           qaConfig                   `toml:"qa_thresholds"`
+	Retention    retentionConfig            `toml:"retention"`
+	Backup       backupConfig               `toml:"backup"`
+	Relevance    patillator.RelevanceConfig `toml:"relevance"`
+	Feed         patillator.FeedConfig      `toml:"feed"`
+	Admins       []string                   `toml:"admins"`
+	RestoreGrace int                        `toml:"restore_grace_period_hours"`
+	IdemKeyTTL   int                        `toml:"idempotency_key_ttl_hours"`
+	IdemPending  int                        `toml:"idempotency_pending_seconds"`
+	MaxTags      int                        `toml:"max_tags"`
+	Reactions    []string                   `toml:"reactions"`
+	MaxPinned    int                        `toml:"max_pinned"`
+}
+
+// defaultConfig returns the config with the values that the settings not set in
+// the config file keep.
+func defaultConfig() cheroapiConfig {
+	defaults := app.DefaultQAThresholds
+	return cheroapiConfig{
+		QA: qaConfig{
+			MinAgeHours:         int(defaults.MinAge.Hours()),
+			MinInteractions:     int(defaults.MinInteractions),
+			MaxAvgUpdateMinutes: int(defaults.MaxAvgUpdateTime.Minutes()),
+			MinScore:            defaults.MinScore,
+		},
+		Feed:         patillator.DefaultFeedConfig(),
+		RestoreGrace: int(server.DefaultRestoreGracePeriod.Hours()),
+		IdemKeyTTL:   int(server.DefaultIdempotencyKeyTTL.Hours()),
+		IdemPending:  int(server.DefaultIdempotencyPending.Seconds()),
+		MaxTags:      tags.DefaultMaxTags,
+		Reactions:    reactions.DefaultTypes,
+		MaxPinned:    moderation.DefaultMaxPinned,
+	}
 }
 
 func (c cheroapiConfig) preventDefault() error {
@@ -46,20 +155,230 @@ func (c cheroapiConfig) preventDefault() error {
 	if c.UsersSrvConf.BindAddress == "" {
 		return fmt.Errorf("Missing users service bind address.")
 	}
-	return nil
+	if c.QASchedule != "" {
+		if _, err := cron.ParseStandard(c.QASchedule); err != nil {
+			return fmt.Errorf("Invalid qa schedule: %v.", err)
+		}
+	}
+	if c.QA.MinAgeHours < 0 {
+		return fmt.Errorf("QA min age hours cannot be negative.")
+	}
+	if c.QA.MinInteractions < 0 {
+		return fmt.Errorf("QA min interactions cannot be negative.")
+	}
+	if c.QA.MaxAvgUpdateMinutes <= 0 {
+		return fmt.Errorf("QA max average update minutes must be greater than 0.")
+	}
+	if err := c.Retention.validate(); err != nil {
+		return err
+	}
+	if err := c.Backup.validate(); err != nil {
+		return err
+	}
+	if c.RestoreGrace <= 0 {
+		return fmt.Errorf("Restore grace period hours must be greater than 0.")
+	}
+	if c.IdemKeyTTL <= 0 {
+		return fmt.Errorf("Idempotency key ttl hours must be greater than 0.")
+	}
+	if c.IdemPending <= 0 {
+		return fmt.Errorf("Idempotency pending seconds must be greater than 0.")
+	}
+	if c.MaxTags <= 0 {
+		return fmt.Errorf("Max tags must be greater than 0.")
+	}
+	if len(c.Reactions) == 0 {
+		return fmt.Errorf("At least one reaction must be set.")
+	}
+	for _, r := range c.Reactions {
+		if !reactions.ValidName(r) {
+			return fmt.Errorf("Invalid reaction %q.", r)
+		}
+	}
+	if c.MaxPinned <= 0 {
+		return fmt.Errorf("Max pinned must be greater than 0.")
+	}
+	if err := c.Relevance.Validate(); err != nil {
+		return err
+	}
+	return c.Feed.Validate()
+}
+
+// runQA runs the Quality Assurance on the section database right away and
+// prints the summary. If dryRun is true, it only prints what it would do.
+func runQA(dbHandler app.Handler, dryRun bool) {
+	var (
+		summary string
+		err     error
+	)
+	if dryRun {
+		summary, err = dbHandler.DryRunQA()
+	} else {
+		summary, err = dbHandler.QA()
+	}
+	fmt.Print(summary)
+	if err != nil {
+		log.Fatal("QA returned error: ", err)
+	}
+}
+
+// runPurge permanently removes the expired contents from the section database
+// right away and prints the summary.
+func runPurge(dbHandler app.Handler, r app.Retention) {
+	summary, err := dbHandler.Purge(r)
+	fmt.Print(summary)
+	if err != nil {
+		log.Fatal("Purge returned error: ", err)
+	}
+}
+
+// runFsck checks the references between the section database and the users
+// service and prints the report. If repair is true, it also fixes them.
+func runFsck(dbHandler app.Handler, repair bool) {
+	summary, err := dbHandler.Fsck(repair)
+	fmt.Print(summary)
+	if err != nil {
+		log.Fatal("Fsck returned error: ", err)
+	}
+}
+
+// runReindex indexes every content of the section database for search again
+// and prints the number of contents indexed.
+func runReindex(dbHandler app.Handler) {
+	n, err := dbHandler.RebuildSearchIndex()
+	if err != nil {
+		log.Fatal("Could not rebuild search index: ", err)
+	}
+	fmt.Printf("Indexed %d contents\n", n)
+}
+
+// manifest returns the manifest identifying the snapshots of the section
+// database.
+func (c cheroapiConfig) manifest() backup.Manifest {
+	return backup.Manifest{
+		Service:   "contents",
+		SectionId: c.SectionId,
+	}
+}
+
+// runBackup writes a snapshot of the section database to the backup dir right
+// away and prints its path.
+func runBackup(dbHandler app.Handler, c cheroapiConfig) {
+	if c.Backup.Dir == "" {
+		log.Fatal("Missing backup dir.")
+	}
+	path, err := backup.Write(c.Backup.Dir, dbHandler, c.manifest(), c.Backup.Keep)
+	if err != nil {
+		log.Fatal("Could not write snapshot: ", err)
+	}
+	fmt.Println("Wrote snapshot", path)
+}
+
+// runRestore verifies the given snapshot and swaps it in place of the section
+// database.
+func runRestore(snapshot string, c cheroapiConfig) {
+	if snapshot == "" {
+		log.Fatal("The snapshot to restore must be set with -from.")
+	}
+	m, err := backup.Restore(snapshot, db.DBFile(c.DBdir, c.SectionId), c.manifest())
+	if err != nil {
+		log.Fatal("Could not restore snapshot: ", err)
+	}
+	fmt.Printf("Restored snapshot taken at %v\n", time.Unix(m.Created, 0).Format(time.RubyDate))
+}
+
+// runExport writes the dump of the section database to the given file, or to
+// the standard output if it's empty.
+func runExport(dbHandler app.Handler, out string) {
+	w := os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			log.Fatal("Could not create dump file: ", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := dbHandler.Export(w); err != nil {
+		log.Fatal("Could not export section: ", err)
+	}
+}
+
+// runImport rebuilds the section database from the given dump.
+func runImport(dump string, c cheroapiConfig) {
+	if dump == "" {
+		log.Fatal("The dump to import must be set with -from.")
+	}
+	f, err := os.Open(dump)
+	if err != nil {
+		log.Fatal("Could not open dump: ", err)
+	}
+	defer f.Close()
+	n, err := db.Import(c.DBdir, c.SectionId, f)
+	if err != nil {
+		log.Fatal("Could not import section: ", err)
+	}
+	fmt.Printf("Imported %d entries into section %s\n", n, c.SectionId)
 }
 
 func main() {
 	var configFile string
 	flag.StringVar(&configFile, "config", "", "Absolute path of .toml config file.")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s -config file [qa [-dry-run] | purge | fsck [-repair] | reindex |\n\tbackup | restore -from snapshot | export [-o file] | import -from file]\n\n", os.Args[0])
+		fmt.Fprintln(out, "With no command, it runs the section service.")
+		fmt.Fprintln(out, "The qa command runs the Quality Assurance on the section database and exits.")
+		fmt.Fprintln(out, "The purge command removes the expired deleted and archived contents and exits.")
+		fmt.Fprintln(out, "The fsck command checks the references between the section database and the users service.")
+		fmt.Fprintln(out, "The reindex command rebuilds the search index of the section database.")
+		fmt.Fprintln(out, "The backup command writes a snapshot of the section database to the backup dir and exits.")
+		fmt.Fprintln(out, "The restore command verifies the given snapshot and swaps it in place of the section database.")
+		fmt.Fprintln(out, "The export command writes every content of the section database as JSON lines.")
+		fmt.Fprintln(out, "The import command rebuilds a new section database from the given export.")
+		fmt.Fprintln(out, "The section service must not be running.")
+		fmt.Fprintln(out)
+		flag.PrintDefaults()
+	}
 
 	flag.Parse()
 
+	var (
+		cmd        = flag.Arg(0)
+		qaCmd      = flag.NewFlagSet("qa", flag.ExitOnError)
+		dryRun     = qaCmd.Bool("dry-run", false, "Report what would be archived without doing it.")
+		restoreCmd = flag.NewFlagSet("restore", flag.ExitOnError)
+		from       = restoreCmd.String("from", "", "Path of the snapshot to restore.")
+		exportCmd  = flag.NewFlagSet("export", flag.ExitOnError)
+		exportOut  = exportCmd.String("o", "", "Path of the file to write to; standard output by default.")
+		importCmd  = flag.NewFlagSet("import", flag.ExitOnError)
+		importFrom = importCmd.String("from", "", "Path of the export to import.")
+		fsckCmd    = flag.NewFlagSet("fsck", flag.ExitOnError)
+		repair     = fsckCmd.Bool("repair", false, "Fix the references found broken.")
+	)
+	switch cmd {
+	case "":
+	case "qa":
+		qaCmd.Parse(flag.Args()[1:])
+	case "purge", "reindex", "backup":
+	case "restore":
+		restoreCmd.Parse(flag.Args()[1:])
+	case "export":
+		exportCmd.Parse(flag.Args()[1:])
+	case "import":
+		importCmd.Parse(flag.Args()[1:])
+	case "fsck":
+		fsckCmd.Parse(flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	if configFile == "" {
 		log.Fatal("Absolute path of .toml config file must be set.")
 	}
 
-	config := cheroapiConfig{}
+	config := defaultConfig()
 	if _, err := toml.DecodeFile(configFile, &config); err != nil {
 		log.Fatal(err)
 	}
@@ -68,6 +387,17 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if cmd == "restore" {
+		runRestore(*from, config)
+		return
+	}
+	if cmd == "import" {
+		runImport(*importFrom, config)
+		return
+	}
+
+	patillator.SetRelevanceModel(config.Relevance.RelevanceModel())
+
 	// Establish connection with users gRPC service.
 	conn, err := grpc.Dial(config.UsersSrvConf.BindAddress, grpc.WithInsecure())
 	if err != nil {
@@ -78,12 +408,61 @@ func main() {
 	// Create users gRPC crud client.
 	usersClient := pbUsers.NewCrudUsersClient(conn)
 
-	dbHandler, err := db.New(config.DBdir, config.SectionId, config.SectionName, usersClient)
+	dbHandler, err := db.New(config.DBdir, config.SectionId, config.SectionName, usersClient,
+		config.QA.thresholds())
 	if err != nil {
 		log.Fatal("Could not setup database:", err)
 	}
-	srv := server.New(dbHandler)
+	if cmd == "qa" {
+		defer dbHandler.Close()
+		runQA(dbHandler, *dryRun)
+		return
+	}
+	if cmd == "purge" {
+		defer dbHandler.Close()
+		runPurge(dbHandler, config.Retention.retention())
+		return
+	}
+	if cmd == "fsck" {
+		defer dbHandler.Close()
+		runFsck(dbHandler, *repair)
+		return
+	}
+	if cmd == "reindex" {
+		defer dbHandler.Close()
+		runReindex(dbHandler)
+		return
+	}
+	if cmd == "backup" {
+		defer dbHandler.Close()
+		runBackup(dbHandler, config)
+		return
+	}
+	if cmd == "export" {
+		defer dbHandler.Close()
+		runExport(dbHandler, *exportOut)
+		return
+	}
+	if config.Backup.Schedule != "" {
+		err = backup.Schedule(config.Backup.Schedule, dbHandler, config.Backup.Dir, config.manifest(), config.Backup.Keep)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	srv := server.New(dbHandler, server.Options{
+		SectionId:          config.SectionId,
+		Filler:             config.Feed.FillerOptions(),
+		Admins:             config.Admins,
+		RestoreGracePeriod: time.Duration(config.RestoreGrace) * time.Hour,
+		Retention:          config.Retention.retention(),
+		IdempotencyKeyTTL:  time.Duration(config.IdemKeyTTL) * time.Hour,
+		IdempotencyPending: time.Duration(config.IdemPending) * time.Second,
+		MaxTags:            config.MaxTags,
+		Reactions:          config.Reactions,
+		MaxPinned:          config.MaxPinned,
+		Bans:               bans.NewClient(conn),
+	})
 	// Start App.
-	a := app.New(srv, config.LogDir)
+	a := app.New(srv, config.LogDir, config.QASchedule)
 	log.Fatal(a.Run(config.SrvConf.BindAddress, config.SectionName, config.DoQA))
 }
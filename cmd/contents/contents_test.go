@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+// sampleConfig returns the config of the sample section file of the repository.
+func sampleConfig(t *testing.T) cheroapiConfig {
+	t.Helper()
+	config := defaultConfig()
+	if _, err := toml.DecodeFile("../../section_mylife.toml", &config); err != nil {
+		t.Fatalf("Could not decode sample config: %v\n", err)
+	}
+	return config
+}
+
+func TestPreventDefault(t *testing.T) {
+	if err := sampleConfig(t).preventDefault(); err != nil {
+		t.Fatalf("Got %v validating the sample config, want nil\n", err)
+	}
+	tests := []struct {
+		name   string
+		modify func(c *cheroapiConfig)
+		want   string
+	}{
+		{"negative min age", func(c *cheroapiConfig) { c.QA.MinAgeHours = -1 }, "QA min age hours cannot be negative."},
+		{"negative min interactions", func(c *cheroapiConfig) { c.QA.MinInteractions = -1 }, "QA min interactions cannot be negative."},
+		{"zero max avg update", func(c *cheroapiConfig) { c.QA.MaxAvgUpdateMinutes = 0 }, "QA max average update minutes must be greater than 0."},
+		{"invalid qa schedule", func(c *cheroapiConfig) { c.QASchedule = "every night" }, "Invalid qa schedule"},
+		{"backup without dir", func(c *cheroapiConfig) { c.Backup.Schedule, c.Backup.Dir = "0 3 * * *", "" }, "Missing backup dir."},
+		{"negative retention", func(c *cheroapiConfig) { c.Retention.DeletedDays = -1 }, "Retention deleted days cannot be negative."},
+		{"no reactions", func(c *cheroapiConfig) { c.Reactions = nil }, "At least one reaction must be set."},
+		{"invalid reaction", func(c *cheroapiConfig) { c.Reactions = []string{"Thumbs Up"} }, `Invalid reaction "Thumbs Up".`},
+		{"zero max pinned", func(c *cheroapiConfig) { c.MaxPinned = 0 }, "Max pinned must be greater than 0."},
+	}
+	for _, test := range tests {
+		config := sampleConfig(t)
+		test.modify(&config)
+		err := config.preventDefault()
+		if (err == nil) || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q\n", test.name, err, test.want)
+		}
+	}
+	// Threads can be evaluated as soon as they are published, however many
+	// interactions they have.
+	config := sampleConfig(t)
+	config.QA.MinAgeHours, config.QA.MinInteractions = 0, 0
+	if err := config.preventDefault(); err != nil {
+		t.Errorf("Got %v validating zero thresholds, want nil\n", err)
+	}
+}
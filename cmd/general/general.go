@@ -7,7 +7,11 @@ import (
 
 	"github.com/BurntSushi/toml"
 	app "github.com/luisguve/cheroapi/internal/app/general"
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
+	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	"github.com/luisguve/cheroapi/internal/pkg/search"
 	server "github.com/luisguve/cheroapi/internal/pkg/server/general"
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
 	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
 	pbUsers "github.com/luisguve/cheroproto-go/userapi"
 	"google.golang.org/grpc"
@@ -24,9 +28,11 @@ type sectionConfig struct {
 }
 
 type cheroapiConfig struct {
-	SrvConf      grpcConfig      `toml:"general_grpc_config"`
-	UsersSrvConf grpcConfig      `toml:"users_grpc_config"`
-	Sections     []sectionConfig `toml:"sections"`
+	SrvConf      grpcConfig                 `toml:"general_grpc_config"`
+	UsersSrvConf grpcConfig                 `toml:"users_grpc_config"`
+	Sections     []sectionConfig            `toml:"sections"`
+	Relevance    patillator.RelevanceConfig `toml:"relevance"`
+	Feed         patillator.FeedConfig      `toml:"feed"`
 }
 
 func (c cheroapiConfig) preventDefault() error {
@@ -50,7 +56,10 @@ func (c cheroapiConfig) preventDefault() error {
 			return fmt.Errorf("Missing name in one or more sections.")
 		}
 	}
-	return nil
+	if err := c.Relevance.Validate(); err != nil {
+		return err
+	}
+	return c.Feed.Validate()
 }
 
 func main() {
@@ -63,7 +72,9 @@ func main() {
 		log.Fatal("Absolute path of .toml config file must be set.")
 	}
 
-	config := cheroapiConfig{}
+	config := cheroapiConfig{
+		Feed: patillator.DefaultFeedConfig(),
+	}
 	if _, err := toml.DecodeFile(configFile, &config); err != nil {
 		log.Fatal(err)
 	}
@@ -72,6 +83,8 @@ func main() {
 		log.Fatal(err)
 	}
 
+	patillator.SetRelevanceModel(config.Relevance.RelevanceModel())
+
 	// Establish connection with users gRPC service.
 	conn, err := grpc.Dial(config.UsersSrvConf.BindAddress, grpc.WithInsecure())
 	if err != nil {
@@ -81,6 +94,8 @@ func main() {
 
 	// Create users gRPC crud client.
 	usersClient := pbUsers.NewCrudUsersClient(conn)
+	// Create client of the bans service of the users service.
+	bansClient := bans.NewClient(conn)
 
 	// Establish connection with section grpc services.
 	var sections []server.Section
@@ -95,13 +110,15 @@ func main() {
 		sectionClient := pbApi.NewCrudCheropatillaClient(conn)
 		section := server.Section{
 			Client: sectionClient,
+			Search: search.NewClient(conn),
+			Tags:   tags.NewClient(conn),
 			Id:     s.Id,
 			Name:   s.Name,
 		}
 		sections = append(sections, section)
 	}
 
-	srv := server.New(sections, usersClient)
+	srv := server.New(sections, usersClient, bansClient, config.Feed.FillerOptions())
 	// Start App.
 	a := app.New(srv)
 	log.Fatal(a.Run(config.SrvConf.BindAddress))
@@ -4,20 +4,49 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	app "github.com/luisguve/cheroapi/internal/app/userapi"
+	"github.com/luisguve/cheroapi/internal/pkg/backup"
 	bolt "github.com/luisguve/cheroapi/internal/pkg/bolt/users"
 	server "github.com/luisguve/cheroapi/internal/pkg/server/users"
+	"github.com/robfig/cron/v3"
 )
 
 type grpcConfig struct {
 	BindAddress string `toml:"bind_address"`
 }
 
+// backupConfig sets where and when snapshots of the database of users are
+// written.
+type backupConfig struct {
+	Dir      string `toml:"dir"`
+	Schedule string `toml:"schedule"` // Cron expression; empty disables them.
+	Keep     int    `toml:"keep"`     // Newest snapshots to keep; 0 keeps all.
+}
+
+func (c backupConfig) validate() error {
+	if c.Schedule != "" {
+		if c.Dir == "" {
+			return fmt.Errorf("Missing backup dir.")
+		}
+		if _, err := cron.ParseStandard(c.Schedule); err != nil {
+			return fmt.Errorf("Invalid backup schedule: %v.", err)
+		}
+	}
+	if c.Keep < 0 {
+		return fmt.Errorf("Backup keep cannot be negative.")
+	}
+	return nil
+}
+
 type cheroapiConfig struct {
-	DBdir   string     `toml:"db_dir"`
-	SrvConf grpcConfig `toml:"users_grpc_config"`
+	DBdir   string       `toml:"db_dir"`
+	Admins  []string     `toml:"admins"`
+	SrvConf grpcConfig   `toml:"users_grpc_config"`
+	Backup  backupConfig `toml:"backup"`
 }
 
 func (c cheroapiConfig) preventDefault() error {
@@ -27,15 +56,68 @@ func (c cheroapiConfig) preventDefault() error {
 	if c.SrvConf.BindAddress == "" {
 		return fmt.Errorf("Missing users service bind address.")
 	}
-	return nil
+	return c.Backup.validate()
+}
+
+// usersManifest identifies the snapshots of the database of users.
+var usersManifest = backup.Manifest{Service: "users"}
+
+// runBackup writes a snapshot of the database of users to the backup dir right
+// away and prints its path.
+func runBackup(dbHandler app.Handler, c cheroapiConfig) {
+	if c.Backup.Dir == "" {
+		log.Fatal("Missing backup dir.")
+	}
+	path, err := backup.Write(c.Backup.Dir, dbHandler, usersManifest, c.Backup.Keep)
+	if err != nil {
+		log.Fatal("Could not write snapshot: ", err)
+	}
+	fmt.Println("Wrote snapshot", path)
+}
+
+// runRestore verifies the given snapshot and swaps it in place of the database
+// of users.
+func runRestore(snapshot string, c cheroapiConfig) {
+	if snapshot == "" {
+		log.Fatal("The snapshot to restore must be set with -from.")
+	}
+	m, err := backup.Restore(snapshot, bolt.DBFile(c.DBdir), usersManifest)
+	if err != nil {
+		log.Fatal("Could not restore snapshot: ", err)
+	}
+	fmt.Printf("Restored snapshot taken at %v\n", time.Unix(m.Created, 0).Format(time.RubyDate))
 }
 
 func main() {
 	var configFile string
 	flag.StringVar(&configFile, "config", "", "Absolute path of .toml config file.")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s -config file [backup | restore -from snapshot]\n\n", os.Args[0])
+		fmt.Fprintln(out, "With no command, it runs the users service.")
+		fmt.Fprintln(out, "The backup command writes a snapshot of the database of users to the backup dir and exits.")
+		fmt.Fprintln(out, "The restore command verifies the given snapshot and swaps it in place of the database of users.")
+		fmt.Fprintln(out, "The users service must not be running.")
+		fmt.Fprintln(out)
+		flag.PrintDefaults()
+	}
 
 	flag.Parse()
 
+	var (
+		cmd        = flag.Arg(0)
+		restoreCmd = flag.NewFlagSet("restore", flag.ExitOnError)
+		from       = restoreCmd.String("from", "", "Path of the snapshot to restore.")
+	)
+	switch cmd {
+	case "", "backup":
+	case "restore":
+		restoreCmd.Parse(flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	if configFile == "" {
 		log.Fatal("Absolute path of .toml config file must be set.")
 	}
@@ -49,11 +131,30 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if cmd == "restore" {
+		runRestore(*from, config)
+		return
+	}
+
 	dbHandler, err := bolt.New(config.DBdir)
 	if err != nil {
 		log.Fatalf("Could not setup database: %v\n", err)
 	}
-	srv := server.New(dbHandler)
+	if cmd == "backup" {
+		defer dbHandler.Close()
+		runBackup(dbHandler, config)
+		return
+	}
+	if config.Backup.Schedule != "" {
+		err = backup.Schedule(config.Backup.Schedule, dbHandler, config.Backup.Dir,
+			usersManifest, config.Backup.Keep)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	srv := server.New(dbHandler, server.Options{
+		Admins: config.Admins,
+	})
 	// Start App.
 	a := app.New(srv)
 	log.Fatal(a.Run(config.SrvConf.BindAddress))
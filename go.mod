@@ -4,12 +4,13 @@ go 1.14
 
 require (
 	github.com/BurntSushi/toml v0.3.1
-	github.com/go-co-op/gocron v0.3.1
 	github.com/golang/protobuf v1.4.2
 	github.com/luisguve/cheroproto-go v0.0.0-20200904212122-403adca09ee8
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/satori/go.uuid v1.2.0
 	github.com/sirupsen/logrus v1.6.0
 	go.etcd.io/bbolt v1.3.5
 	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
 	google.golang.org/grpc v1.32.0
+	google.golang.org/protobuf v1.23.0
 )
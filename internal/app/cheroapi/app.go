@@ -8,34 +8,66 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
 
-	"github.com/go-co-op/gocron"
+	"github.com/luisguve/cheroapi/internal/pkg/admin"
+	"github.com/luisguve/cheroapi/internal/pkg/edits"
+	"github.com/luisguve/cheroapi/internal/pkg/moderation"
+	"github.com/luisguve/cheroapi/internal/pkg/polls"
+	"github.com/luisguve/cheroapi/internal/pkg/reactions"
+	"github.com/luisguve/cheroapi/internal/pkg/restore"
+	"github.com/luisguve/cheroapi/internal/pkg/search"
+	"github.com/luisguve/cheroapi/internal/pkg/snapshots"
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
+	"github.com/luisguve/cheroapi/internal/pkg/votes"
 	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
 	"google.golang.org/grpc"
 )
 
 type Server interface {
 	pbApi.CrudCheropatillaServer
+	search.Server
+	edits.Server
+	restore.Server
+	tags.Server
+	polls.Server
+	reactions.Server
+	votes.Server
+	moderation.Server
+	admin.Server
+	snapshots.Server
 	QA() (string, error)
+	Purge() (string, error)
 }
 
-func New(s Server, logPath string) *App {
+// DefaultQASchedule is the cron expression of the schedule of the Quality
+// Assurance when none is given: every day at midnight, UTC.
+const DefaultQASchedule = "0 0 * * *"
+
+// New returns an App that runs the Quality Assurance on the schedule described
+// by the given cron expression, or DefaultQASchedule if it's empty.
+func New(s Server, logPath, qaSchedule string) *App {
+	if qaSchedule == "" {
+		qaSchedule = DefaultQASchedule
+	}
 	return &App{
-		logFile: filepath.Join(logPath, "QA.log"),
-		srv:     s,
+		logFile:    filepath.Join(logPath, "QA.log"),
+		qaSchedule: qaSchedule,
+		srv:        s,
 	}
 }
 
 type App struct {
-	logFile string
-	srv     Server
+	logFile    string
+	qaSchedule string // Cron expression.
+	srv        Server
 }
 
-func (a *App) scheduleQA() {
-	// Run the Quality Assurance on the databases every day.
-	QAscheduler := gocron.NewScheduler(time.UTC)
-	QAscheduler.Every(1).Day().Do(func() {
+func (a *App) scheduleQA() error {
+	// Run the Quality Assurance on the databases on schedule.
+	QAscheduler := cron.New(cron.WithLocation(time.UTC))
+	jobId, err := QAscheduler.AddFunc(a.qaSchedule, func() {
 		defaultLog.Println("Starting QA")
 
 		logger := log.New()
@@ -50,6 +82,9 @@ func (a *App) scheduleQA() {
 				"function": "scheduled QA",
 			}).Errorf("Could not open log file: %v. Writing to stderr.\n", err)
 		}
+		// Purge expired contents right after the QA, whatever its result.
+		defer a.purge(logger)
+
 		summary, err := a.srv.QA()
 		if err != nil {
 			logger.WithFields(log.Fields{
@@ -75,10 +110,12 @@ func (a *App) scheduleQA() {
 
 		defaultLog.Println("Finished QA")
 	})
-	// QAscheduler.StartAt(time.Now().Add(10 * time.Second))
-	QAscheduler.StartAsync()
+	if err != nil {
+		return fmt.Errorf("Invalid QA schedule %q: %v", a.qaSchedule, err)
+	}
+	QAscheduler.Start()
 
-	_, nextQA := QAscheduler.NextRun()
+	nextQA := QAscheduler.Entry(jobId).Next
 	now := time.Now()
 	diff := nextQA.Sub(now)
 	hoursLeft := int(diff.Hours())
@@ -87,6 +124,31 @@ func (a *App) scheduleQA() {
 
 	defaultLog.Printf("Next QA: %v (in %v hours, %v minutes, %v seconds)",
 		nextQA.Format(time.RubyDate), hoursLeft, minutesLeft, secondsLeft)
+	return nil
+}
+
+// purge permanently removes expired contents and writes the summary to the
+// given logger.
+func (a *App) purge(logger *log.Logger) {
+	defaultLog.Println("Starting purge")
+
+	summary, err := a.srv.Purge()
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"package":  "cheroapi",
+			"file":     "app.go",
+			"function": "scheduled purge",
+		}).Errorf("Purge returned error: %v\n", err)
+	}
+	if summary != "" {
+		logger.WithFields(log.Fields{
+			"package":  "cheroapi",
+			"file":     "app.go",
+			"function": "scheduled purge",
+		}).Infof("Result of purge: %v\n", summary)
+	}
+
+	defaultLog.Println("Finished purge")
 }
 
 func (a *App) Run(addr, sectionName string, doQA bool) error {
@@ -97,9 +159,21 @@ func (a *App) Run(addr, sectionName string, doQA bool) error {
 	s := grpc.NewServer()
 
 	pbApi.RegisterCrudCheropatillaServer(s, a.srv.(pbApi.CrudCheropatillaServer))
+	search.Register(s, a.srv)
+	edits.Register(s, a.srv)
+	restore.Register(s, a.srv)
+	tags.Register(s, a.srv)
+	polls.Register(s, a.srv)
+	reactions.Register(s, a.srv)
+	votes.Register(s, a.srv)
+	moderation.Register(s, a.srv)
+	admin.Register(s, a.srv)
+	snapshots.Register(s, a.srv)
 
 	if doQA {
-		a.scheduleQA()
+		if err = a.scheduleQA(); err != nil {
+			return err
+		}
 	}
 	defaultLog.Println("Running section", sectionName)
 	return s.Serve(lis)
@@ -2,6 +2,8 @@ package cheroapi
 
 import (
 	"errors"
+	"io"
+	"time"
 
 	pbTime "github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/luisguve/cheroapi/internal/pkg/patillator"
@@ -12,17 +14,25 @@ import (
 
 type UpdateUserFunc func(*pbDataFormat.User) *pbDataFormat.User
 
+// HiddenFunc reports whether the contents of the given author must be left out
+// of an overview.
+type HiddenFunc func(authorId string) bool
+
 // Handler defines the set of available CRUD operations to perform on the
 // database.
 type Handler interface {
 	// Get metadata of all the active threads in a section.
 	GetActiveThreadsOverview(...patillator.SetSDF) ([]patillator.SegregateDiscarderFinder, error)
+	// Get metadata of the active threads in a section tagged with the given
+	// tag.
+	GetTaggedThreadsOverview(string, ...patillator.SetSDF) ([]patillator.SegregateDiscarderFinder, error)
 	// Get metadata of the given thread ids in a section.
 	GetThreadsOverview([]string, ...patillator.SetSDF) ([]patillator.SegregateDiscarderFinder, error)
 	// Get content of the given thread ids in a section.
 	GetThreads([]patillator.Id) ([]*pbApi.ContentRule, error)
-	// Get metadata of comments in a thread.
-	GetCommentsOverview(*pbContext.Thread) ([]patillator.SegregateDiscarderFinder, error)
+	// Get metadata of comments in a thread, leaving out those whose author is
+	// hidden.
+	GetCommentsOverview(*pbContext.Thread, HiddenFunc) ([]patillator.SegregateDiscarderFinder, error)
 	// Get content of the given comment ids in a thread.
 	GetComments(*pbContext.Thread, []patillator.Id) ([]*pbApi.ContentRule, error)
 	// Get a single ContentRule containing a thread.
@@ -62,18 +72,140 @@ type Handler interface {
 	ReplyThread(thread *pbContext.Thread, r Reply) (*pbApi.NotifyUser, error)
 	// Post a comment on a comment.
 	ReplyComment(comment *pbContext.Comment, r Reply) ([]*pbApi.NotifyUser, error)
-	// Create a new thread, save it and return its permalink.
-	CreateThread(content *pbApi.Content, author string) (string, error)
+	// Create a new thread with the given tags and poll, save it and return its
+	// permalink.
+	CreateThread(content *pbApi.Content, author string, t NewThread) (string, error)
 	// Delete the given thread and the contents associated to it.
 	DeleteThread(thread *pbContext.Thread, userId string) error
 	// Delete the given comment and the contents associated to it.
 	DeleteComment(thread *pbContext.Comment, userId string) error
 	// Delete the given subcomment and the contents associated to it.
 	DeleteSubcomment(thread *pbContext.Subcomment, userId string) error
+	// Put the given deleted thread back into the active contents.
+	RestoreThread(thread *pbContext.Thread, r Restore) error
+	// Replace the content of the given thread and keep the previous one as a
+	// revision.
+	UpdateThread(thread *pbContext.Thread, e Edit) error
+	// Replace the content of the given comment and keep the previous one as a
+	// revision.
+	UpdateComment(comment *pbContext.Comment, e Edit) error
+	// Replace the content of the given subcomment and keep the previous one as
+	// a revision.
+	UpdateSubcomment(subcomment *pbContext.Subcomment, e Edit) error
+	// Get the previous versions of the given content, from oldest to newest.
+	GetRevisions(content *pbContext.Context) ([]*Revision, error)
+	// Get the previous version number n of the given content.
+	GetRevision(content *pbContext.Context, n int) (*Revision, error)
+	// Get the last time the given content was edited, which is 0 if it was
+	// never edited.
+	GetEditTime(content *pbContext.Context) (int64, error)
 	// Return the last time a clean up was done.
 	LastQA() int64
 	// Clean up every section database.
 	QA() (string, error)
+	// Report what a clean up would do, without doing it.
+	DryRunQA() (string, error)
+	// Get the summaries of the last n clean ups, from newest to oldest.
+	QAHistory(n int) ([]*QASummary, error)
+	// Permanently remove the deleted and archived contents that expired
+	// according to the given retention.
+	Purge(r Retention) (string, error)
+	// Get the summaries of the last n purges, from newest to oldest.
+	PurgeHistory(n int) ([]*PurgeSummary, error)
+	// Write a consistent copy of the whole section database to w.
+	Snapshot(w io.Writer) (int64, error)
+	// Write every content and bucket of the section database to w as JSON
+	// lines.
+	Export(w io.Writer) error
+	// Check the references between the section database and the users
+	// service and, if repair is true, fix them.
+	Fsck(repair bool) (string, error)
+	// Claim the given idempotency key for a write operation and return the
+	// result saved under it by a previous request, if any. Keys are kept for
+	// ttl since they were claimed, and a key whose request did not save its
+	// result is held for pending before it can be claimed again.
+	ClaimIdempotencyKey(key string, ttl, pending time.Duration) (*IdempotentResult, error)
+	// Save the result of the write operation that claimed the given key.
+	SaveIdempotentResult(key string, r *IdempotentResult) error
+	// Release the given idempotency key after the write operation failed.
+	ReleaseIdempotencyKey(key string) error
+	// Get a page of the contents matching the given query, from the most
+	// relevant.
+	Search(q SearchQuery) (*SearchResults, error)
+	// Index every content of the section again and return the number of
+	// contents indexed.
+	RebuildSearchIndex() (int, error)
+	// Submit the vote of the given user id on the poll of a thread and return
+	// the results.
+	VotePoll(thread *pbContext.Thread, userId string, choices []int) (*PollResults, error)
+	// Replace the vote of the given user id on the poll of a thread and return
+	// the results.
+	ChangePollVote(thread *pbContext.Thread, userId string, choices []int) (*PollResults, error)
+	// Get the results of the poll of a thread, along with the choices of the
+	// given user id, if any.
+	GetPollResults(thread *pbContext.Thread, userId string) (*PollResults, error)
+	// Add a reaction of the given user id to a content and return a list of
+	// users and the notifications for them and an error.
+	AddReaction(content *pbContext.Context, userId, reaction string) ([]*pbApi.NotifyUser, error)
+	// Remove a reaction of the given user id from a content.
+	RemoveReaction(content *pbContext.Context, userId, reaction string) error
+	// Get the number of users who added each reaction to a content and the
+	// reactions of the given user id.
+	GetReactions(content *pbContext.Context, userId string) (*Reactions, error)
+	// Submit downvote on a content from the given user id and return its votes.
+	Downvote(content *pbContext.Context, userId string) (*Votes, error)
+	// Undo downvote on a content from the given user id and return its votes.
+	UndoDownvote(content *pbContext.Context, userId string) (*Votes, error)
+	// Get the upvotes, downvotes and net score of a content and the vote of the
+	// given user id.
+	GetVotes(content *pbContext.Context, userId string) (*Votes, error)
+	// Get every tag in use in a section and the number of threads tagged with
+	// it, from the most used.
+	ListTags() ([]TagCount, error)
+	// Pin an active thread to the top of the feeds of a section, unless there
+	// are already the given maximum number of pinned threads.
+	PinThread(thread *pbContext.Thread, max int) error
+	// Unpin a thread.
+	UnpinThread(thread *pbContext.Thread) error
+	// Get the ids of the pinned threads of a section, from the most recently
+	// pinned.
+	GetPinnedThreads() ([]string, error)
+	// Lock a thread so it no longer accepts comments, record it in the
+	// moderation log and return the notification for the thread author, if
+	// any.
+	LockThread(thread *pbContext.Thread, l Lock) (*pbApi.NotifyUser, error)
+	// Unlock a thread, record it in the moderation log and return the
+	// notification for the thread author, if any.
+	UnlockThread(thread *pbContext.Thread, l Lock) (*pbApi.NotifyUser, error)
+	// Get whether a thread is locked.
+	IsLocked(thread *pbContext.Thread) (bool, error)
+	// Get the last n actions of the moderation log of a section, from the
+	// newest.
+	ModerationLog(n int) ([]*ModerationAction, error)
+	// Replace the text of a content with RemovedText on behalf of a moderator
+	// and record it in the moderation log.
+	RemoveContent(content *pbContext.Context, r Removal) error
+	// Get whether a content was removed by a moderator.
+	IsRemoved(content *pbContext.Context) (bool, error)
+	// Grant a role in a section to a user and record it in the moderation log.
+	SetRole(userId, role, grantedBy string) error
+	// Revoke the role of a user in a section and record it in the moderation
+	// log.
+	RemoveRole(userId, removedBy string) error
+	// Get the role of a user in a section, which is empty if the user has none.
+	GetRole(userId string) (string, error)
+	// Get the users with a role in a section.
+	ListRoles() ([]*Role, error)
+	// Report a content on behalf of the user in the given Report, adding it to
+	// the moderation queue of a section, and return the id of its item.
+	ReportContent(content *pbContext.Context, r Report) (uint64, error)
+	// Get up to n items of the moderation queue of a section, from the oldest,
+	// whose ids are greater than the given one.
+	ReportQueue(after uint64, n int) ([]*ReportItem, error)
+	// Resolve an item of the moderation queue of a section, carry out its
+	// outcome and return the resolved item and the notification for the author
+	// of a locked thread, if any.
+	ResolveReport(id uint64, r Resolution) (*ReportItem, *pbApi.NotifyUser, error)
 	// Release all database resources.
 	Close() error
 }
@@ -86,6 +218,277 @@ type Reply struct {
 	PublishDate *pbTime.Timestamp
 }
 
+// Edit holds the data of an edit on a content. Content cannot be empty. The
+// title and the featured file are kept unless new ones are set, and the
+// featured file is dropped if RemoveFtFile is true.
+type Edit struct {
+	Title        string // Only threads have title; ignored otherwise.
+	Content      string
+	FtFile       string
+	RemoveFtFile bool
+	Submitter    string
+	EditDate     *pbTime.Timestamp
+}
+
+// Restore holds the data of a request to restore a deleted thread. The author
+// of the thread can restore it within GracePeriod since it was deleted, as of
+// RestoreDate, or the current time if it's not set, while an admin can restore
+// it at any time.
+type Restore struct {
+	Submitter   string
+	Admin       bool
+	GracePeriod time.Duration
+	RestoreDate *pbTime.Timestamp
+}
+
+// Lock holds the data of a request to lock or unlock a thread. The author of
+// the thread and the moderators of the section can lock and unlock it.
+type Lock struct {
+	Submitter string
+	Moderator bool
+	Reason    string
+}
+
+// Removal holds the data of a request to remove a content: the moderator
+// removing it and the reason.
+type Removal struct {
+	Submitter string
+	Reason    string
+}
+
+// RemovedText replaces the content of the contents removed by moderators, and
+// the title of the threads.
+const RemovedText = "[removed by moderator]"
+
+// Roles of the users in a section. Moderators can pin, lock and remove any
+// content, while owners can also grant and revoke roles.
+const (
+	RoleModerator = "moderator"
+	RoleOwner     = "owner"
+)
+
+// Role holds the role of a user in a section, who granted it and when.
+type Role struct {
+	UserId    string `json:"user_id"`
+	Role      string `json:"role"`
+	GrantedBy string `json:"granted_by"`
+	GrantedAt int64  `json:"granted_at"`
+}
+
+// Report holds a report of a user on a content: the reason code, the free text
+// and when it was reported.
+type Report struct {
+	UserId string `json:"user_id"`
+	Reason string `json:"reason"`
+	Text   string `json:"text,omitempty"`
+	Time   int64  `json:"time"`
+}
+
+// Outcomes of the resolution of the reports on a content: dismissing them,
+// removing the content or locking the thread it belongs to.
+const (
+	OutcomeDismiss = "dismiss"
+	OutcomeRemove  = "remove"
+	OutcomeLock    = "lock"
+)
+
+// ReportItem is an item of the moderation queue of a section: a content, the
+// reports on it and, once it's resolved, the outcome, who resolved it, when and
+// the note given, if any.
+type ReportItem struct {
+	Id           uint64   `json:"id"`
+	ThreadId     string   `json:"thread_id"`
+	CommentId    string   `json:"comment_id,omitempty"`
+	SubcommentId string   `json:"subcomment_id,omitempty"`
+	Reports      []Report `json:"reports"`
+	Outcome      string   `json:"outcome,omitempty"`
+	ResolvedBy   string   `json:"resolved_by,omitempty"`
+	ResolvedAt   int64    `json:"resolved_at,omitempty"`
+	Note         string   `json:"note,omitempty"`
+}
+
+// Resolution holds the data of a request to resolve an item of the moderation
+// queue: the moderator resolving it, the outcome and a note.
+type Resolution struct {
+	Submitter string
+	Outcome   string
+	Note      string
+}
+
+// Actions recorded in the moderation log.
+const (
+	ActionLock       = "lock"
+	ActionUnlock     = "unlock"
+	ActionRemove     = "remove"
+	ActionSetRole    = "set_role"
+	ActionRemoveRole = "remove_role"
+)
+
+// ModerationAction is an entry of the moderation log of a section: an action
+// taken by a user on a content or on the role of another user, the role
+// granted, the reason given, if any, and when.
+type ModerationAction struct {
+	Id           uint64 `json:"id"`
+	Action       string `json:"action"`
+	ThreadId     string `json:"thread_id,omitempty"`
+	CommentId    string `json:"comment_id,omitempty"`
+	SubcommentId string `json:"subcomment_id,omitempty"`
+	TargetUserId string `json:"target_user_id,omitempty"`
+	Role         string `json:"role,omitempty"`
+	UserId       string `json:"user_id"`
+	Reason       string `json:"reason,omitempty"`
+	Time         int64  `json:"time"`
+}
+
+// Revision holds a previous version of a content, its sequential number,
+// starting from 1, and the time it was replaced.
+type Revision struct {
+	Number   int
+	EditedAt int64
+	Content  *pbDataFormat.Content
+}
+
+// QASummary holds the structured result of a clean up: the ids of the threads
+// that kept active, the ones moved to archived contents, the deleted threads
+// whose comments were moved to archived contents and the errors found.
+type QASummary struct {
+	Id       uint64   `json:"id"`
+	Started  int64    `json:"started"`
+	Finished int64    `json:"finished"`
+	Kept     []string `json:"kept"`
+	Archived []string `json:"archived"`
+	Deleted  []string `json:"deleted"`
+	Errors   []string `json:"errors"`
+	// The thresholds that each archived thread failed, by thread id.
+	Failed map[string][]string `json:"failed"`
+}
+
+// QAThresholds holds the rules that a thread must follow to keep active on a
+// clean up. Threads younger than MinAge are never archived. Older threads keep
+// active only if they have at least MinInteractions interactions, an average
+// update time difference no longer than MaxAvgUpdateTime and a net score of at
+// least MinScore.
+type QAThresholds struct {
+	MinAge           time.Duration
+	MinInteractions  uint32
+	MaxAvgUpdateTime time.Duration
+	MinScore         int
+}
+
+// DefaultQAThresholds keeps active the threads younger than 1 day and those
+// with 50 interactions or more, an average update time difference no longer
+// than 1 hour and no more downvotes than upvotes.
+var DefaultQAThresholds = QAThresholds{
+	MinAge:           24 * time.Hour,
+	MinInteractions:  50,
+	MaxAvgUpdateTime: 1 * time.Hour,
+	MinScore:         0,
+}
+
+// Retention holds how long contents are kept after being deleted or archived
+// before they're permanently removed. A zero value keeps them forever.
+type Retention struct {
+	Deleted  time.Duration
+	Archived time.Duration
+}
+
+// PurgeSummary holds the structured result of a purge: the ids of the deleted
+// threads whose contents were removed, the ids of the archived threads removed
+// along with their contents, the number of references enqueued to be dropped
+// from the activity of users and the errors found.
+type PurgeSummary struct {
+	Id       uint64   `json:"id"`
+	Started  int64    `json:"started"`
+	Finished int64    `json:"finished"`
+	Deleted  []string `json:"deleted"`
+	Archived []string `json:"archived"`
+	Dropped  int      `json:"dropped"`
+	Errors   []string `json:"errors"`
+}
+
+// IdempotentResult holds the result of a write operation, saved under the
+// idempotency key sent by the client, so a replay of the request returns it
+// instead of writing again.
+type IdempotentResult struct {
+	Permalink string              // Of the thread created.
+	Notifs    []*pbApi.NotifyUser // Sent on replies and upvotes.
+}
+
+// SearchQuery holds the words to search for and the page of results to return:
+// Limit results, skipping the first Offset. If ThreadsOnly is true, comments
+// and subcomments are left out.
+type SearchQuery struct {
+	Text        string
+	Offset      int
+	Limit       int
+	ThreadsOnly bool
+}
+
+// SearchResults holds a page of the active and archived contents matching a
+// search, from the most relevant, and the number of contents matching it.
+type SearchResults struct {
+	Total int
+	Hits  []SearchHit
+}
+
+// SearchHit is a content matching a search and its score. Scores are only
+// comparable between the results of the same section.
+type SearchHit struct {
+	Content *pbApi.ContentRule
+	Score   float64
+}
+
+// NewThread holds the data of a new thread besides its content: its tags and,
+// if it's not nil, a poll attached to it.
+type NewThread struct {
+	Tags []string
+	Poll *Poll
+}
+
+// Poll holds the options of a poll attached to a thread. Votes are accepted
+// until ClosesAt, a unix time, unless it's 0. If MultipleChoice is true, users
+// can choose several options.
+type Poll struct {
+	Options        []string
+	ClosesAt       int64
+	MultipleChoice bool
+}
+
+// PollResults holds a poll, the number of votes for each option, the number of
+// users who voted, whether it's closed and the indexes of the options chosen
+// by the user who asked for them, if they voted.
+type PollResults struct {
+	Poll
+	Votes   []int
+	Voters  int
+	Closed  bool
+	Choices []int
+}
+
+// Reactions holds the number of users who added each reaction to a content,
+// by reaction, and the reactions added by a given user.
+type Reactions struct {
+	Counts map[string]int
+	Mine   []string
+}
+
+// Votes holds the number of upvotes and downvotes of a content, its net score,
+// which is the upvotes minus the downvotes, and whether a given user upvoted or
+// downvoted it.
+type Votes struct {
+	Upvotes   int
+	Downvotes int
+	Score     int
+	Upvoted   bool
+	Downvoted bool
+}
+
+// TagCount holds a tag and the number of threads tagged with it.
+type TagCount struct {
+	Tag     string
+	Threads int
+}
+
 // These errors are returned when contents are not found.
 var (
 	ErrSectionNotFound           = errors.New("Section not found")
@@ -95,6 +498,9 @@ var (
 	ErrBucketNotFound            = errors.New("Bucket not found")
 	ErrCommentsBucketNotFound    = errors.New("Comments bucket not found")
 	ErrSubcommentsBucketNotFound = errors.New("Subcomments bucket not found")
+	ErrRevisionNotFound          = errors.New("Revision not found")
+	ErrDeletedThreadNotFound     = errors.New("Deleted thread not found")
+	ErrPollNotFound              = errors.New("Poll not found")
 )
 
 // These errors can be returned when accessing contents.
@@ -113,4 +519,58 @@ var (
 	ErrNotUpvoted = errors.New("This user has not upvoted this content")
 	// A user has not the permission to do something.
 	ErrUserNotAllowed = errors.New("User not allowed")
+	// An edit leaves the content empty.
+	ErrEmptyContent = errors.New("The content cannot be empty")
+	// The author is trying to restore a thread after the grace period.
+	ErrGracePeriodExpired = errors.New("Grace period to restore the thread has expired")
+	// A user is trying to downvote a content twice.
+	ErrAlreadyDownvoted = errors.New("This user has already downvoted this content")
+	// A user is trying to undo a downvote on a content not downvoted.
+	ErrNotDownvoted = errors.New("This user has not downvoted this content")
+	// A user is trying to upvote a downvoted content or to downvote an upvoted
+	// one; the previous vote must be undone first.
+	ErrOppositeVote = errors.New("This user has already voted the other way on this content")
+	// A user is trying to add a reaction he's already added to a content.
+	ErrAlreadyReacted = errors.New("This user has already added this reaction")
+	// A user is trying to remove a reaction he's not added to a content.
+	ErrNotReacted = errors.New("This user has not added this reaction")
+	// A user is trying to vote again on a poll.
+	ErrAlreadyVoted = errors.New("This user has already voted on this poll")
+	// A user is trying to change a vote on a poll he's not voted on.
+	ErrNotVoted = errors.New("This user has not voted on this poll")
+	// A user is trying to vote on a poll after its close time.
+	ErrPollClosed = errors.New("The poll is closed")
+	// A user chose an option that does not exist, the same option twice or
+	// several options on a single-choice poll.
+	ErrInvalidChoice = errors.New("Invalid choice")
+	// A moderator is trying to pin a thread that is already pinned.
+	ErrAlreadyPinned = errors.New("This thread is already pinned")
+	// A moderator is trying to unpin a thread that is not pinned.
+	ErrNotPinned = errors.New("This thread is not pinned")
+	// A moderator is trying to pin a thread when the maximum number of pinned
+	// threads has been reached.
+	ErrTooManyPinned = errors.New("Too many pinned threads")
+	// A user is trying to reply to a locked thread or to a comment in it.
+	ErrThreadLocked = errors.New("This thread is locked")
+	// A user is trying to lock a thread that is already locked.
+	ErrAlreadyLocked = errors.New("This thread is already locked")
+	// A user is trying to unlock a thread that is not locked.
+	ErrNotLocked = errors.New("This thread is not locked")
+	// A user is trying to edit or remove a content removed by a moderator.
+	ErrContentRemoved = errors.New("This content has been removed by a moderator")
+	// An owner is trying to grant a role that does not exist.
+	ErrInvalidRole = errors.New("Invalid role")
+	// An owner is trying to revoke the role of a user who has none.
+	ErrNoRole = errors.New("This user has no role")
+	// A user is trying to report a content twice.
+	ErrAlreadyReported = errors.New("This user has already reported this content")
+	// A moderator is trying to resolve an item that is not in the moderation
+	// queue.
+	ErrReportNotFound = errors.New("Report not found")
+	// A moderator is trying to resolve an item with an unknown outcome.
+	ErrInvalidOutcome = errors.New("Invalid outcome")
+	// Another request with the same idempotency key has not finished yet.
+	ErrRequestInProgress = errors.New("A request with the same idempotency key is in progress")
+	// A clean up was requested while another one is moving contents.
+	ErrQARunning = errors.New("A clean up is already running")
 )
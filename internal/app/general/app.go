@@ -5,12 +5,16 @@ import (
 	"log"
 	"net"
 
+	"github.com/luisguve/cheroapi/internal/pkg/search"
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
 	pbGeneral "github.com/luisguve/cheroproto-go/cheroapi"
 	"google.golang.org/grpc"
 )
 
 type Server interface {
 	pbGeneral.CrudGeneralServer
+	search.Server
+	tags.Server
 }
 
 type App struct {
@@ -31,6 +35,8 @@ func (a *App) Run(addr string) error {
 	s := grpc.NewServer()
 
 	pbGeneral.RegisterCrudGeneralServer(s, a.srv)
+	search.Register(s, a.srv)
+	tags.Register(s, a.srv)
 
 	log.Println("Running")
 	return s.Serve(lis)
@@ -5,18 +5,26 @@ import (
 	"log"
 	"net"
 
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
+	"github.com/luisguve/cheroapi/internal/pkg/snapshots"
 	pbApi "github.com/luisguve/cheroproto-go/userapi"
 	"google.golang.org/grpc"
 )
 
-func New(s pbApi.CrudUsersServer) *App {
+type Server interface {
+	pbApi.CrudUsersServer
+	bans.Server
+	snapshots.Server
+}
+
+func New(s Server) *App {
 	return &App{
 		srv: s,
 	}
 }
 
 type App struct {
-	srv pbApi.CrudUsersServer
+	srv Server
 }
 
 func (a *App) Run(addr string) error {
@@ -27,6 +35,8 @@ func (a *App) Run(addr string) error {
 	s := grpc.NewServer()
 
 	pbApi.RegisterCrudUsersServer(s, a.srv)
+	bans.Register(s, a.srv)
+	snapshots.Register(s, a.srv)
 
 	log.Println("Running")
 	return s.Serve(lis)
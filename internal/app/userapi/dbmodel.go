@@ -2,6 +2,7 @@ package userapi
 
 import (
 	"errors"
+	"io"
 
 	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
 	"google.golang.org/grpc/status"
@@ -26,16 +27,64 @@ type Handler interface {
 	FindUserIdByUsername(username string) ([]byte, error)
 	// Get user id with the given email.
 	FindUserIdByEmail(email string) ([]byte, error)
+	// Ban a user from a section or, if the section id of the ban is empty,
+	// from every section, replacing the previous ban, if any.
+	AddBan(b Ban) error
+	// Lift the ban of a user from a section or from every section.
+	LiftBan(userId, sectionId string) error
+	// Get the bans in force of a user or, if the user id is empty, of every
+	// user.
+	ListBans(userId string) ([]*Ban, error)
+	// Get the ban in force of a user from every section or from the given
+	// section, if any.
+	ActiveBan(userId, sectionId string) (*Ban, error)
+	// Shadowban a user, so the contents of the user are hidden from everyone
+	// else.
+	Shadowban(s Shadowban) error
+	// Lift the shadowban of a user.
+	LiftShadowban(userId string) error
+	// Get the shadowbanned users.
+	ListShadowbans() ([]*Shadowban, error)
+	// Get whether a user is shadowbanned.
+	IsShadowbanned(userId string) (bool, error)
+	// Write a consistent copy of the whole database to w.
+	Snapshot(w io.Writer) (int64, error)
 	// Release all database resources.
 	Close() error
 }
 
+// Ban holds a ban of a user from the section with the given id or, if it's
+// empty, from every section: the reason, the admin who gave it, when and the
+// unix time it expires at, which is 0 if it never expires.
+type Ban struct {
+	UserId    string `json:"user_id"`
+	SectionId string `json:"section_id,omitempty"`
+	Reason    string `json:"reason"`
+	BannedBy  string `json:"banned_by"`
+	BannedAt  int64  `json:"banned_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// Active returns whether the ban is in force at the given unix time.
+func (b *Ban) Active(now int64) bool {
+	return (b.ExpiresAt == 0) || (b.ExpiresAt > now)
+}
+
+// Shadowban holds a shadowban of a user: the admin who gave it and when.
+type Shadowban struct {
+	UserId   string `json:"user_id"`
+	BannedBy string `json:"banned_by"`
+	BannedAt int64  `json:"banned_at"`
+}
+
 // These errors are returned when data is not found.
 var (
 	ErrUserNotFound     = errors.New("User not found")
 	ErrUsernameNotFound = errors.New("Username not found")
 	ErrEmailNotFound    = errors.New("Email not found")
 	ErrBucketNotFound   = errors.New("Bucket not found")
+	ErrBanNotFound      = errors.New("Ban not found")
+	ErrNotShadowbanned  = errors.New("This user is not shadowbanned")
 )
 
 // These errors can be returned when submitting actions.
@@ -0,0 +1,125 @@
+// Package admin provides the Admin gRPC service, through which the admins of a
+// section run its Quality Assurance and review the summaries of the last ones,
+// and its client. The section services implement it.
+//
+// The protocol in cheroproto does not define admin rpcs yet, so the service is
+// described here by hand and its messages are encoded as JSON by jsoncodec.
+// Clients built by NewClient set the content subtype accordingly.
+
+package admin
+
+import (
+	"context"
+
+	"github.com/luisguve/cheroapi/internal/pkg/jsoncodec"
+	"google.golang.org/grpc"
+)
+
+// MaxSummaries is the maximum number of summaries of the QA history that can
+// be requested at once.
+const MaxSummaries = 100
+
+// QARequest asks for a Quality Assurance of the section on behalf of an admin.
+// If DryRun is true, it only reports what would be archived.
+type QARequest struct {
+	UserId string `json:"user_id"`
+	DryRun bool   `json:"dry_run,omitempty"`
+}
+
+// QAResponse holds the summary of a Quality Assurance.
+type QAResponse struct {
+	Summary string `json:"summary"`
+}
+
+// HistoryRequest asks for the summaries of the last Max runs of the Quality
+// Assurance on behalf of an admin.
+type HistoryRequest struct {
+	UserId string `json:"user_id"`
+	Max    int    `json:"max"`
+}
+
+// QASummary is the result of a Quality Assurance: the ids of the threads that
+// kept active, the ones moved to archived contents, the deleted threads whose
+// comments were moved to archived contents, the errors found and the
+// thresholds that each archived thread failed, by thread id.
+type QASummary struct {
+	Id       uint64              `json:"id"`
+	Started  int64               `json:"started"`
+	Finished int64               `json:"finished"`
+	Kept     []string            `json:"kept"`
+	Archived []string            `json:"archived"`
+	Deleted  []string            `json:"deleted"`
+	Errors   []string            `json:"errors"`
+	Failed   map[string][]string `json:"failed"`
+}
+
+// QAHistory holds summaries of the Quality Assurance, from the newest.
+type QAHistory struct {
+	Summaries []QASummary `json:"summaries"`
+}
+
+// Server is the server API for the Admin service.
+type Server interface {
+	RunQA(context.Context, *QARequest) (*QAResponse, error)
+	GetQAHistory(context.Context, *HistoryRequest) (*QAHistory, error)
+}
+
+// serviceName is the full name of the service.
+const serviceName = "cheroapi.Admin"
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(serviceName, "RunQA", func() interface{} { return new(QARequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).RunQA(ctx, req.(*QARequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "GetQAHistory", func() interface{} { return new(HistoryRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).GetQAHistory(ctx, req.(*HistoryRequest))
+			}),
+	},
+	Metadata: "admin.go",
+}
+
+// Register registers srv as the Admin service of s.
+func Register(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client is the client API for the Admin service.
+type Client interface {
+	RunQA(ctx context.Context, req *QARequest, opts ...grpc.CallOption) (*QAResponse, error)
+	GetQAHistory(ctx context.Context, req *HistoryRequest, opts ...grpc.CallOption) (*QAHistory, error)
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client of the Admin service on the given connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc}
+}
+
+func (c *client) invoke(ctx context.Context, method string, req, res interface{}, opts []grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	return c.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, res, opts...)
+}
+
+func (c *client) RunQA(ctx context.Context, req *QARequest, opts ...grpc.CallOption) (*QAResponse, error) {
+	res := new(QAResponse)
+	if err := c.invoke(ctx, "RunQA", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) GetQAHistory(ctx context.Context, req *HistoryRequest, opts ...grpc.CallOption) (*QAHistory, error) {
+	res := new(QAHistory)
+	if err := c.invoke(ctx, "GetQAHistory", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
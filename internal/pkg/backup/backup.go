@@ -0,0 +1,254 @@
+// Package backup provides consistent snapshots of bolt databases, written to a
+// local directory along with a manifest, and the verification and restoration
+// of such snapshots.
+
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Snapshotter is implemented by database handlers able to write a consistent
+// copy of their database while serving requests.
+type Snapshotter interface {
+	// Snapshot writes the whole database to w and returns the number of
+	// bytes written.
+	Snapshot(w io.Writer) (int64, error)
+}
+
+// Manifest describes a snapshot. It's saved next to the snapshot, in a file
+// with the same name and the extension .json.
+type Manifest struct {
+	Service   string `json:"service"`    // Either "contents" or "users".
+	SectionId string `json:"section_id"` // Empty for the users database.
+	Created   int64  `json:"created"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+}
+
+// These errors are returned when a snapshot does not match its manifest.
+var (
+	ErrSizeMismatch     = errors.New("Snapshot size does not match its manifest")
+	ErrChecksumMismatch = errors.New("Snapshot checksum does not match its manifest")
+)
+
+// ErrOtherDatabase is returned by Restore when a snapshot is not of the
+// database it's restored to.
+var ErrOtherDatabase = errors.New("Snapshot is of another database")
+
+// prefix returns the prefix of the file names of the snapshots described by m.
+func (m Manifest) prefix() string {
+	if m.SectionId != "" {
+		return fmt.Sprintf("%s-%s-", m.Service, m.SectionId)
+	}
+	return fmt.Sprintf("%s-", m.Service)
+}
+
+// manifestPath returns the path of the manifest of the given snapshot.
+func manifestPath(snapshot string) string {
+	return strings.TrimSuffix(snapshot, filepath.Ext(snapshot)) + ".json"
+}
+
+// Write takes a snapshot from s and writes it to the directory dir, creating it
+// if it does not exist, along with its manifest. The Service and SectionId
+// fields of m identify the snapshot; the rest are set by Write.
+//
+// Snapshots are named after the service, the section id and the time they were
+// created at. Once the snapshot is written, only the newest keep snapshots of
+// the same service and section are kept; if keep is 0 or less, every snapshot
+// is kept.
+//
+// It returns the path of the snapshot.
+func Write(dir string, s Snapshotter, m Manifest, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	m.Created = time.Now().Unix()
+	name := fmt.Sprintf("%s%d.db", m.prefix(), m.Created)
+	path := filepath.Join(dir, name)
+
+	// Write to a temporary file first, so a failed snapshot never looks like
+	// a complete one.
+	tmp, err := ioutil.TempFile(dir, name+".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	m.Size, err = s.Snapshot(io.MultiWriter(tmp, hash))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	m.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	mBytes, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err = ioutil.WriteFile(manifestPath(path), mBytes, 0600); err != nil {
+		return "", err
+	}
+	if keep > 0 {
+		if err = rotate(dir, m.prefix(), keep); err != nil {
+			log.Printf("Could not rotate snapshots: %v\n", err)
+		}
+	}
+	return path, nil
+}
+
+// rotate removes the snapshots in dir whose names start with prefix, along
+// with their manifests, but the newest keep ones.
+func rotate(dir, prefix string, keep int) error {
+	snapshots, err := filepath.Glob(filepath.Join(dir, prefix+"*.db"))
+	if err != nil {
+		return err
+	}
+	if len(snapshots) <= keep {
+		return nil
+	}
+	// Names only differ in the creation time, which has the same number of
+	// digits for the foreseeable future, so sorting them sorts by time.
+	sort.Strings(snapshots)
+	for _, snapshot := range snapshots[:len(snapshots)-keep] {
+		if err = os.Remove(snapshot); err != nil {
+			return err
+		}
+		if err = os.Remove(manifestPath(snapshot)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify checks that the given snapshot matches the size and checksum in its
+// manifest and that it's a consistent bolt database, and returns the manifest.
+func Verify(snapshot string) (*Manifest, error) {
+	mBytes, err := ioutil.ReadFile(manifestPath(snapshot))
+	if err != nil {
+		return nil, err
+	}
+	m := new(Manifest)
+	if err = json.Unmarshal(mBytes, m); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return nil, err
+	}
+	if size != m.Size {
+		return nil, ErrSizeMismatch
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != m.SHA256 {
+		return nil, ErrChecksumMismatch
+	}
+	// Check the consistency of the pages of the database.
+	db, err := bolt.Open(snapshot, 0600, &bolt.Options{ReadOnly: true, Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		for err := range tx.Check() {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Restore verifies the given snapshot, checks that it has the Service and
+// SectionId of want and swaps it in place of the database at dbFile. The
+// current database, if any, is kept next to it with the extension .bak and the
+// current unix time appended. The service using the database must not be
+// running.
+//
+// It returns the manifest of the snapshot.
+func Restore(snapshot, dbFile string, want Manifest) (*Manifest, error) {
+	m, err := Verify(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if (m.Service != want.Service) || (m.SectionId != want.SectionId) {
+		return nil, fmt.Errorf("%w: %s %s", ErrOtherDatabase, m.Service, m.SectionId)
+	}
+	src, err := os.Open(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	// Copy to the directory of the database first, so the swap is a rename
+	// in the same file system.
+	tmp, err := ioutil.TempFile(filepath.Dir(dbFile), filepath.Base(dbFile)+".restore")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(dbFile); err == nil {
+		bak := fmt.Sprintf("%s.bak%d", dbFile, time.Now().Unix())
+		if err = os.Rename(dbFile, bak); err != nil {
+			return nil, err
+		}
+	}
+	if err = os.Rename(tmp.Name(), dbFile); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Schedule writes a snapshot from s to dir on the schedule described by the
+// given cron expression, in UTC, keeping the newest keep snapshots. Results
+// are logged.
+func Schedule(spec string, s Snapshotter, dir string, m Manifest, keep int) error {
+	scheduler := cron.New(cron.WithLocation(time.UTC))
+	_, err := scheduler.AddFunc(spec, func() {
+		path, err := Write(dir, s, m, keep)
+		if err != nil {
+			log.Printf("Could not write snapshot: %v\n", err)
+			return
+		}
+		log.Printf("Wrote snapshot %s\n", path)
+	})
+	if err != nil {
+		return fmt.Errorf("Invalid backup schedule %q: %v", spec, err)
+	}
+	scheduler.Start()
+	return nil
+}
@@ -0,0 +1,153 @@
+package backup_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luisguve/cheroapi/internal/pkg/backup"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltSnapshotter takes snapshots of a bolt database.
+type boltSnapshotter struct {
+	db *bolt.DB
+}
+
+func (s boltSnapshotter) Snapshot(w io.Writer) (int64, error) {
+	var n int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+func setupDB(t *testing.T, dir, value string) *bolt.DB {
+	db, err := bolt.Open(filepath.Join(dir, "contents.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("ActiveContents"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte(value))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestWriteAndRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := setupDB(t, dir, "before")
+	m := backup.Manifest{Service: "contents", SectionId: "mylife"}
+	snapshot, err := backup.Write(filepath.Join(dir, "snapshots"), boltSnapshotter{db}, m, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := backup.Verify(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (got.SectionId != "mylife") || (got.Size == 0) || (got.SHA256 == "") {
+		t.Errorf("unexpected manifest: %+v\n", got)
+	}
+	// Modify the database after the snapshot and restore it.
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("ActiveContents")).Put([]byte("key"), []byte("after"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbFile := db.Path()
+	db.Close()
+	other := backup.Manifest{Service: "contents", SectionId: "other"}
+	if _, err = backup.Restore(snapshot, dbFile, other); !errors.Is(err, backup.ErrOtherDatabase) {
+		t.Errorf("got error %v restoring to another section, want %v\n", err, backup.ErrOtherDatabase)
+	}
+	if _, err = backup.Restore(snapshot, dbFile, m); err != nil {
+		t.Fatal(err)
+	}
+	db, err = bolt.Open(dbFile, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket([]byte("ActiveContents")).Get([]byte("key")); string(v) != "before" {
+			t.Errorf("got value %q after restoring, want %q\n", v, "before")
+		}
+		return nil
+	})
+}
+
+func TestVerifyCorrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := setupDB(t, dir, "value")
+	defer db.Close()
+	m := backup.Manifest{Service: "users"}
+	snapshot, err := backup.Write(dir, boltSnapshotter{db}, m, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(snapshot, os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("corrupted"), 4096)
+	f.Close()
+	if _, err = backup.Verify(snapshot); !errors.Is(err, backup.ErrChecksumMismatch) {
+		t.Errorf("got error %v, want %v\n", err, backup.ErrChecksumMismatch)
+	}
+	if _, err = backup.Restore(snapshot, filepath.Join(dir, "users.db"), m); err == nil {
+		t.Errorf("restored a corrupted snapshot\n")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := setupDB(t, dir, "value")
+	defer db.Close()
+	snapshots := filepath.Join(dir, "snapshots")
+	// Fake older snapshots.
+	os.MkdirAll(snapshots, 0700)
+	for _, name := range []string{"users-1500000000", "users-1500000001", "users-1500000002"} {
+		ioutil.WriteFile(filepath.Join(snapshots, name+".db"), nil, 0600)
+		ioutil.WriteFile(filepath.Join(snapshots, name+".json"), nil, 0600)
+	}
+	m := backup.Manifest{Service: "users"}
+	newest, err := backup.Write(snapshots, boltSnapshotter{db}, m, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	left, _ := filepath.Glob(filepath.Join(snapshots, "users-*.db"))
+	if len(left) != 2 {
+		t.Fatalf("got %d snapshots, want 2: %v\n", len(left), left)
+	}
+	if left[1] != newest {
+		t.Errorf("got newest snapshot %s, want %s\n", left[1], newest)
+	}
+	if _, err = os.Stat(filepath.Join(snapshots, "users-1500000000.json")); !os.IsNotExist(err) {
+		t.Errorf("manifest of a rotated snapshot was kept\n")
+	}
+}
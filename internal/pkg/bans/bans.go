@@ -0,0 +1,332 @@
+// Package bans provides the Bans gRPC service, through which the admins of the
+// users service ban users, either from every section or from a single one, and
+// shadowban them, and the section services check whether a user is banned, and
+// its client. The users service implements it.
+//
+// The contents of shadowbanned users are written as usual but left out of the
+// feeds of everyone else. The services that send feeds learn who is asking for
+// them through the ViewerMD key of the incoming metadata.
+//
+// The protocol in cheroproto does not define ban rpcs yet, so the service is
+// described here by hand and its messages are encoded as JSON by jsoncodec.
+// Clients built by NewClient set the content subtype accordingly.
+
+package bans
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/luisguve/cheroapi/internal/pkg/jsoncodec"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ViewerMD is the key of the metadata holding the id of the user a feed is sent
+// to, who still sees the contents of shadowbanned users if they're the author.
+const ViewerMD = "viewer-id"
+
+// ViewerFromContext returns the id of the user sent in the incoming metadata of
+// ctx, or an empty string if there is none.
+func ViewerFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(ViewerMD)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// WithViewer returns a copy of ctx that sends the given user id in its outgoing
+// metadata, or ctx itself if userId is empty.
+func WithViewer(ctx context.Context, userId string) context.Context {
+	if userId == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, ViewerMD, userId)
+}
+
+// Ban is a ban of a user from the section with the given id or, if it's empty,
+// from every section and from logging in. It was given by BannedBy at the
+// unix time BannedAt and lasts until the unix time ExpiresAt, or forever if
+// it's 0.
+type Ban struct {
+	UserId    string `json:"user_id"`
+	SectionId string `json:"section_id,omitempty"`
+	Reason    string `json:"reason"`
+	BannedBy  string `json:"banned_by"`
+	BannedAt  int64  `json:"banned_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// Error returns a codes.PermissionDenied error telling the given user why and
+// until when the user is banned.
+func Error(b Ban) error {
+	from := "This account is banned"
+	if b.SectionId != "" {
+		from += " from this section"
+	}
+	until := "permanently"
+	if b.ExpiresAt != 0 {
+		until = "until " + time.Unix(b.ExpiresAt, 0).UTC().Format(time.RubyDate)
+	}
+	return status.Error(codes.PermissionDenied, fmt.Sprintf("%s %s: %s", from, until, b.Reason))
+}
+
+// AddRequest holds the user id of an admin and the ban to give. The user,
+// reason and expiry of the ban are taken from Ban; a previous ban of the same
+// user from the same section, or from every section, is replaced.
+type AddRequest struct {
+	UserId string `json:"user_id"`
+	Ban    Ban    `json:"ban"`
+}
+
+// LiftRequest holds the user id of an admin, the banned user and the section
+// the user is banned from, which is empty for bans from every section.
+type LiftRequest struct {
+	UserId    string `json:"user_id"`
+	TargetId  string `json:"target_id"`
+	SectionId string `json:"section_id,omitempty"`
+}
+
+// ListRequest asks for the bans in force, on behalf of the admin with the given
+// user id. If TargetId is set, only the bans of that user are listed.
+type ListRequest struct {
+	UserId   string `json:"user_id"`
+	TargetId string `json:"target_id,omitempty"`
+}
+
+// Bans holds bans in force, sorted by user id, with the bans from every
+// section first.
+type Bans struct {
+	Bans []Ban `json:"bans"`
+}
+
+// CheckRequest asks whether the user with the given id is banned from the
+// section with the given id.
+type CheckRequest struct {
+	UserId    string `json:"user_id"`
+	SectionId string `json:"section_id"`
+}
+
+// CheckResponse holds the ban in force of the user, either from every section
+// or from the section in the request, or nil if the user is not banned.
+type CheckResponse struct {
+	Ban *Ban `json:"ban,omitempty"`
+}
+
+// Shadowban is a shadowban of a user, given by BannedBy at the unix time
+// BannedAt.
+type Shadowban struct {
+	UserId   string `json:"user_id"`
+	BannedBy string `json:"banned_by"`
+	BannedAt int64  `json:"banned_at"`
+}
+
+// ShadowbanRequest holds the user id of an admin and the user being shadowbanned
+// or whose shadowban is being lifted.
+type ShadowbanRequest struct {
+	UserId   string `json:"user_id"`
+	TargetId string `json:"target_id"`
+}
+
+// ListShadowbansRequest asks for the shadowbanned users.
+type ListShadowbansRequest struct{}
+
+// Shadowbans holds the shadowbanned users, sorted by user id.
+type Shadowbans struct {
+	Shadowbans []Shadowban `json:"shadowbans"`
+}
+
+// Server is the server API for the Bans service.
+type Server interface {
+	AddBan(context.Context, *AddRequest) (*Bans, error)
+	LiftBan(context.Context, *LiftRequest) (*Bans, error)
+	ListBans(context.Context, *ListRequest) (*Bans, error)
+	CheckBan(context.Context, *CheckRequest) (*CheckResponse, error)
+	Shadowban(context.Context, *ShadowbanRequest) (*Shadowbans, error)
+	LiftShadowban(context.Context, *ShadowbanRequest) (*Shadowbans, error)
+	ListShadowbans(context.Context, *ListShadowbansRequest) (*Shadowbans, error)
+}
+
+// serviceName is the full name of the service.
+const serviceName = "userapi.Bans"
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(serviceName, "AddBan", func() interface{} { return new(AddRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).AddBan(ctx, req.(*AddRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "LiftBan", func() interface{} { return new(LiftRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).LiftBan(ctx, req.(*LiftRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "ListBans", func() interface{} { return new(ListRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).ListBans(ctx, req.(*ListRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "CheckBan", func() interface{} { return new(CheckRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).CheckBan(ctx, req.(*CheckRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "Shadowban", func() interface{} { return new(ShadowbanRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).Shadowban(ctx, req.(*ShadowbanRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "LiftShadowban", func() interface{} { return new(ShadowbanRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).LiftShadowban(ctx, req.(*ShadowbanRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "ListShadowbans", func() interface{} { return new(ListShadowbansRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).ListShadowbans(ctx, req.(*ListShadowbansRequest))
+			}),
+	},
+	Metadata: "bans.go",
+}
+
+// Register registers srv as the Bans service of s.
+func Register(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client is the client API for the Bans service.
+type Client interface {
+	AddBan(ctx context.Context, req *AddRequest, opts ...grpc.CallOption) (*Bans, error)
+	LiftBan(ctx context.Context, req *LiftRequest, opts ...grpc.CallOption) (*Bans, error)
+	ListBans(ctx context.Context, req *ListRequest, opts ...grpc.CallOption) (*Bans, error)
+	CheckBan(ctx context.Context, req *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error)
+	Shadowban(ctx context.Context, req *ShadowbanRequest, opts ...grpc.CallOption) (*Shadowbans, error)
+	LiftShadowban(ctx context.Context, req *ShadowbanRequest, opts ...grpc.CallOption) (*Shadowbans, error)
+	ListShadowbans(ctx context.Context, req *ListShadowbansRequest, opts ...grpc.CallOption) (*Shadowbans, error)
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client of the Bans service on the given connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc}
+}
+
+func (c *client) invoke(ctx context.Context, method string, req, res interface{}, opts []grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	return c.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, res, opts...)
+}
+
+func (c *client) AddBan(ctx context.Context, req *AddRequest, opts ...grpc.CallOption) (*Bans, error) {
+	res := new(Bans)
+	if err := c.invoke(ctx, "AddBan", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) LiftBan(ctx context.Context, req *LiftRequest, opts ...grpc.CallOption) (*Bans, error) {
+	res := new(Bans)
+	if err := c.invoke(ctx, "LiftBan", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) ListBans(ctx context.Context, req *ListRequest, opts ...grpc.CallOption) (*Bans, error) {
+	res := new(Bans)
+	if err := c.invoke(ctx, "ListBans", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) CheckBan(ctx context.Context, req *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error) {
+	res := new(CheckResponse)
+	if err := c.invoke(ctx, "CheckBan", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) Shadowban(ctx context.Context, req *ShadowbanRequest, opts ...grpc.CallOption) (*Shadowbans, error) {
+	res := new(Shadowbans)
+	if err := c.invoke(ctx, "Shadowban", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) LiftShadowban(ctx context.Context, req *ShadowbanRequest, opts ...grpc.CallOption) (*Shadowbans, error) {
+	res := new(Shadowbans)
+	if err := c.invoke(ctx, "LiftShadowban", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) ListShadowbans(ctx context.Context, req *ListShadowbansRequest, opts ...grpc.CallOption) (*Shadowbans, error) {
+	res := new(Shadowbans)
+	if err := c.invoke(ctx, "ListShadowbans", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DefaultShadowbanTTL is how long a ShadowbanCache keeps the shadowbanned users
+// before asking for them again, unless a different time is set.
+const DefaultShadowbanTTL = time.Minute
+
+// ShadowbanCache keeps the ids of the shadowbanned users listed by the Bans
+// service for a while, so the services that send feeds do not ask for them on
+// every request. It's safe for concurrent use.
+type ShadowbanCache struct {
+	client Client
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	ids     map[string]bool
+	fetched time.Time
+}
+
+// NewShadowbanCache returns a ShadowbanCache that asks c for the shadowbanned
+// users once every ttl, or DefaultShadowbanTTL if it's 0.
+func NewShadowbanCache(c Client, ttl time.Duration) *ShadowbanCache {
+	if ttl == 0 {
+		ttl = DefaultShadowbanTTL
+	}
+	return &ShadowbanCache{
+		client: c,
+		ttl:    ttl,
+	}
+}
+
+// Shadowbanned returns the set of ids of the shadowbanned users. If they could
+// not be listed, it returns the last set listed, which is nil if there is none,
+// along with the error.
+func (c *ShadowbanCache) Shadowbanned(ctx context.Context) (map[string]bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if (c.ids != nil) && (time.Since(c.fetched) < c.ttl) {
+		return c.ids, nil
+	}
+	res, err := c.client.ListShadowbans(ctx, &ListShadowbansRequest{})
+	if err != nil {
+		return c.ids, err
+	}
+	ids := make(map[string]bool)
+	for _, s := range res.Shadowbans {
+		ids[s.UserId] = true
+	}
+	c.ids = ids
+	c.fetched = time.Now()
+	return ids, nil
+}
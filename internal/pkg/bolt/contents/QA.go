@@ -1,9 +1,11 @@
 package contents
 
 import (
-	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -17,38 +19,70 @@ import (
 type resultErr struct {
 	err    error
 	result string
+	// Id of the thread the result is about and whether it had been deleted;
+	// used to build the QA summary.
+	threadId string
+	deleted  bool
 }
 
 // Return the last time a clean up was done.
 func (h *handler) LastQA() int64 {
-	return h.lastQA
+	return atomic.LoadInt64(&h.lastQA)
 }
 
 // Clean up the section database.
 //
 // It moves unpopular contents from the bucket of active contents to the bucket
-// of archived contents. It will only test the popularity of threads with 1 day
-// or longer and move them accordingly, along with its comments and subcomments.
+// of archived contents. It will only test the popularity of threads older than
+// the minimum age set in the QA thresholds and move them accordingly, along with
+// its comments and subcomments.
+// Pinned threads are never moved.
 //
 // It will also move comments and subcomments of deleted threads to the bucket
-// of archived contents, even if the thread has been around for less than one
-// day.
+// of archived contents, even if the thread is younger than the minimum age.
 //
 // In addition to moving the contents to the bucket of archived contents, it also
 // updates the activity of the users involved, moving contexts from the list of
 // recent activity of the users to their list of old activity.
 //
+// Once it's done, it sets the last time a clean up was done and saves it along
+// with a structured summary of the clean up in the section database.
+//
+// Only one clean up runs at a time; if another one is running, it returns
+// ErrQARunning right away.
+//
 // It returns the result of moving the contents in a string and an error.
 func (h *handler) QA() (string, error) {
+	if !atomic.CompareAndSwapInt32(&h.qaRunning, 0, 1) {
+		return "", dbmodel.ErrQARunning
+	}
+	defer atomic.StoreInt32(&h.qaRunning, 0)
+	return h.qa(false)
+}
+
+// DryRunQA evaluates the popularity of active threads the same way QA does and
+// returns a summary of the contents that would be moved to archived contents,
+// without modifying the section database nor the activity of the users.
+func (h *handler) DryRunQA() (string, error) {
+	return h.qa(true)
+}
+
+// qa performs the clean up described in QA. If dryRun is true, it only reports
+// what it would do.
+func (h *handler) qa(dryRun bool) (string, error) {
 	var (
 		summary string
 		numGR   int
 		done    = make(chan resultErr)
 		quit    = make(chan struct{})
 		now     = time.Now()
+		qa      = &dbmodel.QASummary{Started: now.Unix()}
 	)
 	defer close(quit)
 	summary = fmt.Sprintf("[%v] Starting QA (section %s).\n", now.Format(time.Stamp), h.section.name)
+	if dryRun {
+		summary += "Dry run: no contents will be moved.\n"
+	}
 
 	err := h.section.contents.View(func(tx *bolt.Tx) error {
 		activeContents := tx.Bucket([]byte(activeContentsB))
@@ -70,15 +104,28 @@ func (h *handler) QA() (string, error) {
 				log.Printf("Could not unmarshal content %s: %v\n", string(k), err)
 				return err
 			}
-			// Check whether the thread has been around for less than one day.
-			// If so, it doesn't qualify for the popularity evaluation and it
-			// will be skipped.
+			// Pinned threads are never archived.
+			pinned, err := isPinned(tx, string(k))
+			if err != nil {
+				return err
+			}
+			if pinned {
+				summary += fmt.Sprintln("-----------------------------------------------------")
+				summary += fmt.Sprintf("%s is pinned, hence it is not a candidate for moving to archived contents.\n", pbThread.Title)
+				qa.Kept = append(qa.Kept, string(k))
+				continue
+			}
+			// Check whether the thread has been around for less than the
+			// minimum age. If so, it doesn't qualify for the popularity
+			// evaluation and it will be skipped.
+			t := h.qaThresholds
 			published := time.Unix(pbThread.PublishDate.Seconds, 0)
 			diff := now.Sub(published)
-			if diff < (24 * time.Hour) {
+			if diff < t.MinAge {
 				summary += fmt.Sprintln("-----------------------------------------------------")
-				summary += fmt.Sprintf("%s has been around for less than one day, ", pbThread.Title)
+				summary += fmt.Sprintf("%s has been around for less than %v, ", pbThread.Title, t.MinAge)
 				summary += fmt.Sprintf("hence it is not a candidate for moving to archived contents.\n")
+				qa.Kept = append(qa.Kept, string(k))
 				continue
 			}
 			m := pbThread.Metadata
@@ -94,41 +141,73 @@ func (h *handler) QA() (string, error) {
 			} else {
 				avgUpdateTime = diff.Seconds()
 			}
-			// Check whether the thread is still popular. It should have more
-			// than 100 interactions and the average time difference between
-			// interactions must be no longer than 1 hour.
+			// Check whether the thread is still popular. It should have at
+			// least the minimum number of interactions and the minimum net
+			// score, and the average time difference between interactions must
+			// be no longer than the maximum average update time.
 			// If so, it will be skipped.
-			min := 1 * time.Hour
-			if (m.Interactions > 49) && (avgUpdateTime <= min.Seconds()) {
+			max := t.MaxAvgUpdateTime.Seconds()
+			var failed []string
+			if m.Interactions < t.MinInteractions {
+				failed = append(failed, fmt.Sprintf("interactions: %v (< %v)", m.Interactions, t.MinInteractions))
+			}
+			if avgUpdateTime > max {
+				failed = append(failed, fmt.Sprintf("average update time difference: %v (> %v)", avgUpdateTime, max))
+			}
+			downvotes, err := countDownvotes(tx, threadContext(&pbContext.Thread{Id: string(k)}))
+			if err != nil {
+				return err
+			}
+			if score := int(pbThread.Upvotes) - downvotes; score < t.MinScore {
+				failed = append(failed, fmt.Sprintf("net score: %v (< %v)", score, t.MinScore))
+			}
+			if len(failed) == 0 {
 				summary += fmt.Sprintln("-----------------------------------------------------")
-				summary += fmt.Sprintf("With an average update time difference of %v (< %v), ", avgUpdateTime, min.Seconds())
-				summary += fmt.Sprintf("and a total of %v interactions (> 49), %s keeps active.\n", m.Interactions, pbThread.Title)
+				summary += fmt.Sprintf("With an average update time difference of %v (<= %v), ", avgUpdateTime, max)
+				summary += fmt.Sprintf("and a total of %v interactions (>= %v), %s keeps active.\n",
+					m.Interactions, t.MinInteractions, pbThread.Title)
+				qa.Kept = append(qa.Kept, string(k))
 				continue
 			}
+			if qa.Failed == nil {
+				qa.Failed = make(map[string][]string)
+			}
+			qa.Failed[string(k)] = failed
 			// Otherwise, it will be moved to the bucket of archived contents,
 			// along with the contents associated to it; comments and
 			// subcomments.
+			if dryRun {
+				summary += fmt.Sprintln("-----------------------------------------------------")
+				summary += fmt.Sprintf("With an average update time difference of %v, ", avgUpdateTime)
+				summary += fmt.Sprintf("and a total of %v interactions, %s would be moved to archived contents, ",
+					m.Interactions, pbThread.Title)
+				summary += fmt.Sprintf("along with %d comments.\n", countComments(activeContents, k))
+				summary += fmt.Sprintf("Failed thresholds: %s.\n", strings.Join(failed, ", "))
+				qa.Archived = append(qa.Archived, string(k))
+				continue
+			}
 			copyKey := make([]byte, len(k))
 			copy(copyKey, k)
 			copyVal := make([]byte, len(v))
 			copy(copyVal, v)
 			numGR++
-			go func(k, v []byte, c *pbDataFormat.Content, avgUpdateTime float64) {
+			go func(k, v []byte, c *pbDataFormat.Content, avgUpdateTime float64, failed []string) {
 				var (
 					result string
-					resErr resultErr
+					resErr = resultErr{threadId: string(k)}
 				)
 				resErr.result += fmt.Sprintln("-----------------------------------------------------")
 				resErr.result += fmt.Sprintf("With an average update time difference of %v, ", avgUpdateTime)
 				resErr.result += fmt.Sprintf("and a total of %v interactions, %s will be moved to archived contents.\n",
 					c.Metadata.Interactions, pbThread.Title)
+				resErr.result += fmt.Sprintf("Failed thresholds: %s.\n", strings.Join(failed, ", "))
 				result, resErr.err = h.moveContents(h.section, k, v, c)
 				resErr.result += result
 				select {
 				case done <- resErr:
 				case <-quit:
 				}
-			}(copyKey, copyVal, pbThread, avgUpdateTime)
+			}(copyKey, copyVal, pbThread, avgUpdateTime, failed)
 		}
 		// Move comments and subcomments associated to deleted threads.
 		deletedContents := activeContents.Bucket([]byte(deletedThreadsB))
@@ -143,11 +222,21 @@ func (h *handler) QA() (string, error) {
 			if v == nil {
 				continue
 			}
+			if dryRun {
+				summary += fmt.Sprintln("-----------------------------------------------------")
+				summary += fmt.Sprintf("The %d comments of deleted thread %s would be moved to archived contents.\n",
+					countComments(activeContents, k), k)
+				qa.Deleted = append(qa.Deleted, string(k))
+				continue
+			}
 			copyKey := make([]byte, len(k))
 			copy(copyKey, k)
 			numGR++
 			go func(k []byte) {
-				var resErr resultErr
+				resErr := resultErr{
+					threadId: string(k),
+					deleted:  true,
+				}
 				resErr.result, resErr.err = h.deleteThread(h.section, k)
 				select {
 				case done <- resErr:
@@ -157,9 +246,14 @@ func (h *handler) QA() (string, error) {
 		}
 		return nil
 	})
+	if dryRun {
+		return summary, err
+	}
 	if err != nil {
+		qa.Errors = append(qa.Errors, err.Error())
 		if numGR == 0 {
 			// Nothing to do; there are no summaries to receive.
+			h.saveQA(qa)
 			return summary, err
 		}
 		// There are summaries to receive, print the error and continue.
@@ -179,6 +273,14 @@ func (h *handler) QA() (string, error) {
 		if resErr.result != "" {
 			summary += resErr.result
 		}
+		switch {
+		case resErr.err != nil:
+			qa.Errors = append(qa.Errors, fmt.Sprintf("%s: %v", resErr.threadId, resErr.err))
+		case resErr.deleted:
+			qa.Deleted = append(qa.Deleted, resErr.threadId)
+		default:
+			qa.Archived = append(qa.Archived, resErr.threadId)
+		}
 		if !foundErr {
 			if resErr.err != nil {
 				foundErr = true
@@ -186,9 +288,89 @@ func (h *handler) QA() (string, error) {
 			}
 		}
 	}
+	if saveErr := h.saveQA(qa); (saveErr != nil) && (err == nil) {
+		err = saveErr
+	}
 	return summary, err
 }
 
+// countComments returns the number of comments of the given thread in the
+// given bucket of active contents.
+func countComments(activeContents *bolt.Bucket, threadId []byte) int {
+	commentsBucket := activeContents.Bucket([]byte(commentsB))
+	if commentsBucket == nil {
+		return 0
+	}
+	comments := commentsBucket.Bucket(threadId)
+	if comments == nil {
+		return 0
+	}
+	return comments.Stats().KeyN
+}
+
+// saveQA sets the last time a clean up was done to the time the given clean up
+// started and saves it in the bucket of metadata, along with the given summary
+// in the bucket of QA history.
+func (h *handler) saveQA(qa *dbmodel.QASummary) error {
+	qa.Finished = time.Now().Unix()
+	atomic.StoreInt64(&h.lastQA, qa.Started)
+
+	err := h.section.contents.Update(func(tx *bolt.Tx) error {
+		metadata := tx.Bucket([]byte(metadataB))
+		if metadata == nil {
+			log.Printf("Bucket %s not found\n", metadataB)
+			return dbmodel.ErrBucketNotFound
+		}
+		if err := metadata.Put([]byte(lastQAK), itob(uint64(qa.Started))); err != nil {
+			return err
+		}
+		history := tx.Bucket([]byte(qaHistoryB))
+		if history == nil {
+			log.Printf("Bucket %s not found\n", qaHistoryB)
+			return dbmodel.ErrBucketNotFound
+		}
+		qa.Id, _ = history.NextSequence()
+		qaBytes, err := json.Marshal(qa)
+		if err != nil {
+			log.Printf("Could not marshal QA summary: %v\n", err)
+			return err
+		}
+		return history.Put(itob(qa.Id), qaBytes)
+	})
+	if err != nil {
+		log.Printf("Could not save QA summary: %v\n", err)
+	}
+	return err
+}
+
+// QAHistory returns the summaries of the last n clean ups, from the newest to
+// the oldest. If n is 0 or less, it returns every summary.
+func (h *handler) QAHistory(n int) ([]*dbmodel.QASummary, error) {
+	var history []*dbmodel.QASummary
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		qaHistory := tx.Bucket([]byte(qaHistoryB))
+		if qaHistory == nil {
+			log.Printf("Bucket %s not found\n", qaHistoryB)
+			return dbmodel.ErrBucketNotFound
+		}
+		c := qaHistory.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if (n > 0) && (len(history) == n) {
+				break
+			}
+			qa := new(dbmodel.QASummary)
+			if err := json.Unmarshal(v, qa); err != nil {
+				log.Printf("Could not unmarshal QA summary: %v\n", err)
+				return err
+			}
+			history = append(history, qa)
+		}
+		return nil
+	})
+	return history, err
+}
+
 // Update the given section by moving the thread, its comments and subcomments
 // from the bucket of active contents to the bucket of archived contents.
 //
@@ -199,6 +381,9 @@ func (h *handler) QA() (string, error) {
 // Note that it will also move all of the subcomments of the deleted comments,
 // if any, to the bucket of archived contents under the same Id of the deleted
 // comment.
+//
+// The search index needs no update, since contents are indexed under keys that
+// do not depend on whether they're active or archived.
 func (h *handler) moveContents(s section, threadId, threadBytes []byte, pbContent *pbDataFormat.Content) (string, error) {
 	var (
 		result string
@@ -216,37 +401,6 @@ func (h *handler) moveContents(s section, threadId, threadBytes []byte, pbConten
 			result += fmt.Sprintf("\nCould not find bucket %s. Contents moving aborted.\n", archivedContentsB)
 			return dbmodel.ErrBucketNotFound
 		}
-		var (
-			done  = make(chan resultErr)
-			quit  = make(chan struct{})
-			numGR = 0
-		)
-		defer close(quit)
-		// Update activity of user. This can be done in another go-routine.
-		numGR++
-		go func() {
-			ctx := &pbContext.Thread{
-				Id: string(threadId),
-				SectionCtx: &pbContext.Section{
-					Id: pbContent.SectionId,
-				},
-			}
-			userId := pbContent.AuthorId
-			var resErr resultErr
-			err := h.markThreadAsOld(userId, ctx)
-			if err != nil {
-				resErr.result = fmt.Sprintf("Could not mark thread %s as old to user %s: %v. Contents moving aborted.\n",
-					ctx.Id, userId, resErr.err)
-				resErr.err = err
-			} else {
-				resErr.result = fmt.Sprintln("Updated thread author's activity successfully.")
-			}
-			select {
-			case done <- resErr:
-			case <-quit:
-			}
-		}()
-
 		// Put thread into archived contents.
 		err = archivedContents.Put(threadId, threadBytes)
 		if err != nil {
@@ -254,6 +408,19 @@ func (h *handler) moveContents(s section, threadId, threadBytes []byte, pbConten
 			return err
 		}
 		result += "Done.\n"
+		// Enqueue the update of the activity of the author.
+		ctx := &pbContext.Thread{
+			Id: string(threadId),
+			SectionCtx: &pbContext.Section{
+				Id: pbContent.SectionId,
+			},
+		}
+		userId := pbContent.AuthorId
+		if err := h.markThreadAsOld(tx, userId, ctx); err != nil {
+			result += fmt.Sprintf("Could not mark thread %s as old to user %s: %v. Contents moving aborted.\n",
+				ctx.Id, userId, err)
+			return err
+		}
 
 		// Check whether there are comments and move them to archived contents.
 		commentsBucket := activeContents.Bucket([]byte(commentsB))
@@ -327,26 +494,7 @@ func (h *handler) moveContents(s section, threadId, threadBytes []byte, pbConten
 			result += fmt.Sprintf("Could not DEL thread from active contents: %v. Contents moving aborted.\n", err)
 			return err
 		}
-		var (
-			resErr   resultErr
-			err      error
-			foundErr bool
-		)
-		// Check for errors. All the results will be concatenated but only the first
-		// err read, if any, will be returned.
-		for i := 0; i < numGR; i++ {
-			resErr = <-done
-			if resErr.result != "" {
-				result += resErr.result
-			}
-			if !foundErr {
-				if resErr.err != nil {
-					foundErr = true
-					err = resErr.err
-				}
-			}
-		}
-		return err
+		return nil
 	})
 	return result, err
 }
@@ -354,7 +502,7 @@ func (h *handler) moveContents(s section, threadId, threadBytes []byte, pbConten
 // Move comments and subcomments associated to the given thread, which has been
 // deleted, to the bucket of archived contents under the thread id as the key,
 // then remove the reference to the deleted thread from the bucket of deleted
-// contents.
+// contents and its saved tags and poll.
 func (h *handler) deleteThread(s section, threadId []byte) (string, error) {
 	var (
 		result string
@@ -389,6 +537,27 @@ func (h *handler) deleteThread(s section, threadId []byte) (string, error) {
 			result += fmt.Sprintf("\nCould not DEL thread from deleted contents: %v. Aborting contents moving.\n", err)
 			return err
 		}
+		// Threads deleted before deletion times were recorded are considered
+		// deleted now.
+		deletedAt := itob(uint64(time.Now().Unix()))
+		if delTimes := deletedContents.Bucket([]byte(deletionTimesB)); delTimes != nil {
+			if t := delTimes.Get(threadId); t != nil {
+				deletedAt = copyBytes(t)
+			}
+			if err := delTimes.Delete(threadId); err != nil {
+				result += fmt.Sprintf("\nCould not DEL deletion time of thread: %v. Aborting contents moving.\n", err)
+				return err
+			}
+		}
+		// The thread cannot be restored anymore.
+		if err := dropTags(tx, string(threadId)); err != nil {
+			result += fmt.Sprintf("\nCould not DEL tags of thread: %v. Aborting contents moving.\n", err)
+			return err
+		}
+		if err := dropPoll(tx, string(threadId)); err != nil {
+			result += fmt.Sprintf("\nCould not DEL poll of thread: %v. Aborting contents moving.\n", err)
+			return err
+		}
 		result += "Done.\n"
 
 		// Check whether there are comments and move them to archived contents.
@@ -405,6 +574,17 @@ func (h *handler) deleteThread(s section, threadId []byte) (string, error) {
 				result += fmt.Sprintf("Could not create archived comments bucket %s: %v\n", threadId, err)
 				return err
 			}
+			// Keep the deletion time, so the comments can be purged once
+			// the retention of deleted contents expires.
+			archDelTimes := archivedContents.Bucket([]byte(deletionTimesB))
+			if archDelTimes == nil {
+				result += fmt.Sprintf("Bucket %s not found.\n", deletionTimesB)
+				return dbmodel.ErrBucketNotFound
+			}
+			if err = archDelTimes.Put(threadId, deletedAt); err != nil {
+				result += fmt.Sprintf("Could not put deletion time of thread %s: %v\n", threadId, err)
+				return err
+			}
 			resErr := h.moveComments(string(threadId), actComments, archComments)
 			if resErr.result != "" {
 				result += resErr.result
@@ -457,17 +637,14 @@ func (h *handler) deleteThread(s section, threadId []byte) (string, error) {
 }
 
 // Move the comments associated to the given thread, from actComments to
-// archComments.
+// archComments, and enqueue the update of the activity of their authors in the
+// same transaction.
 func (h *handler) moveComments(threadId string, actComments, archComments *bolt.Bucket) resultErr {
 	// Put comments from active comments into archived comments.
 	var (
 		result string
-		numGR  = 0
 		c      = actComments.Cursor()
-		done   = make(chan resultErr)
-		quit   = make(chan struct{})
 	)
-	defer close(quit)
 	for k, v := c.First(); k != nil; k, v = c.Next() {
 		// Check whether the value is a nested bucket. If so, just continue.
 		// Cursors see nested buckets with value == nil.
@@ -483,77 +660,44 @@ func (h *handler) moveComments(threadId string, actComments, archComments *bolt.
 			}
 		}
 		result += "Done.\n"
-		// Update activity of user. This can be done in another go-routine.
-		numGR++
-		go func(k, v []byte) {
-			var resErr resultErr
-			pbContent := new(pbDataFormat.Content)
-			err := proto.Unmarshal(v, pbContent)
-			if err != nil {
-				resErr.result = fmt.Sprintf("Could not unmarshal comment %s: %v. Aborting comment moving.\n", k, err)
-				resErr.err = err
-			} else {
-				ctx := &pbContext.Comment{
-					Id: string(k),
-					ThreadCtx: &pbContext.Thread{
-						Id: pbContent.Id,
-						SectionCtx: &pbContext.Section{
-							Id: pbContent.SectionId,
-						},
-					},
-				}
-				userId := pbContent.AuthorId
-				err = h.markCommentAsOld(userId, ctx)
-				if err != nil {
-					resErr.result = fmt.Sprintf("Could not mark comment %s as old to user %s: %v. Aborting comment moving.\n",
-						ctx.Id, userId, resErr.err)
-					resErr.err = err
-				} else {
-					resErr.result = fmt.Sprintf("Updated comment %s author's activity successfully.\n", ctx.Id)
-				}
-			}
-			select {
-			case done <- resErr:
-			case <-quit:
+		// Enqueue the update of the activity of the author.
+		pbContent := new(pbDataFormat.Content)
+		if err := proto.Unmarshal(v, pbContent); err != nil {
+			return resultErr{
+				result: result + fmt.Sprintf("Could not unmarshal comment %s: %v. Aborting comment moving.\n", k, err),
+				err:    err,
 			}
-		}(k, v)
-	}
-	var (
-		resErr   resultErr
-		err      error
-		foundErr bool
-	)
-	// Check for errors. All the results will be concatenated but only the first
-	// err read, if any, will be returned.
-	for i := 0; i < numGR; i++ {
-		resErr = <-done
-		if resErr.result != "" {
-			result += resErr.result
 		}
-		if !foundErr {
-			if resErr.err != nil {
-				foundErr = true
-				err = resErr.err
+		ctx := &pbContext.Comment{
+			Id: string(k),
+			ThreadCtx: &pbContext.Thread{
+				Id: pbContent.Id,
+				SectionCtx: &pbContext.Section{
+					Id: pbContent.SectionId,
+				},
+			},
+		}
+		userId := pbContent.AuthorId
+		if err := h.markCommentAsOld(actComments.Tx(), userId, ctx); err != nil {
+			return resultErr{
+				result: result + fmt.Sprintf("Could not mark comment %s as old to user %s: %v. Aborting comment moving.\n",
+					ctx.Id, userId, err),
+				err: err,
 			}
 		}
 	}
-	resErr.result = result
-	resErr.err = err
-	return resErr
+	return resultErr{result: result}
 }
 
 // Move subcoments from every bucket in actSubcomKeys to a new bucket with the
-// same key in archSubcomKeys.
+// same key in archSubcomKeys, and enqueue the update of the activity of their
+// authors in the same transaction.
 func (h *handler) moveSubcomments(actSubcomKeys, archSubcomKeys *bolt.Bucket) resultErr {
 	var (
-		numGR  = 0
 		err    error
 		c      = actSubcomKeys.Cursor()
-		done   = make(chan resultErr)
-		quit   = make(chan struct{})
 		result string
 	)
-	defer close(quit)
 	// actSubcomKeys bucket only holds nested buckets, hence the values are
 	// discarded and the keys are used to find the buckets, which store the
 	// actual active subcomments.
@@ -584,91 +728,68 @@ func (h *handler) moveSubcomments(actSubcomKeys, archSubcomKeys *bolt.Bucket) re
 				}
 			}
 			result += "Done.\n"
-			// Update activity of user. This can be done in another go-routine.
-			numGR++
-			go func(k, v, comKey []byte) {
-				var resErr resultErr
-				pbContent := new(pbDataFormat.Content)
-				err := proto.Unmarshal(v, pbContent)
-				if err != nil {
-					resErr.result = fmt.Sprintf("Could not unmarshal subcomment %s: %v. Aborting subcomment moving.\n", k, err)
-					resErr.err = err
-				} else {
-					ctx := &pbContext.Subcomment{
-						Id: string(k),
-						CommentCtx: &pbContext.Comment{
-							Id: string(comKey),
-							ThreadCtx: &pbContext.Thread{
-								Id: pbContent.Id,
-								SectionCtx: &pbContext.Section{
-									Id: pbContent.SectionId,
-								},
-							},
-						},
-					}
-					userId := pbContent.AuthorId
-					err = h.markSubcommentAsOld(userId, ctx)
-					if err != nil {
-						resErr.err = err
-						resErr.result = fmt.Sprintf("Could not mark subcomment %s as old to user %s: %v. Aborting subcomment moving.\n",
-							ctx.Id, userId, err)
-					} else {
-						resErr.result = fmt.Sprintf("Updated subcomment %s author's activity successfully.\n", ctx.Id)
-					}
+			// Enqueue the update of the activity of the author.
+			pbContent := new(pbDataFormat.Content)
+			if err = proto.Unmarshal(v, pbContent); err != nil {
+				return resultErr{
+					err:    err,
+					result: result + fmt.Sprintf("Could not unmarshal subcomment %s: %v. Aborting subcomment moving.\n", k, err),
 				}
-				select {
-				case done <- resErr:
-				case <-quit:
+			}
+			ctx := &pbContext.Subcomment{
+				Id: string(k),
+				CommentCtx: &pbContext.Comment{
+					Id: string(comKey),
+					ThreadCtx: &pbContext.Thread{
+						Id: pbContent.Id,
+						SectionCtx: &pbContext.Section{
+							Id: pbContent.SectionId,
+						},
+					},
+				},
+			}
+			userId := pbContent.AuthorId
+			if err = h.markSubcommentAsOld(actSubcomKeys.Tx(), userId, ctx); err != nil {
+				return resultErr{
+					err: err,
+					result: result + fmt.Sprintf("Could not mark subcomment %s as old to user %s: %v. Aborting subcomment moving.\n",
+						ctx.Id, userId, err),
 				}
-			}(k, v, comKey)
-		}
-	}
-	var (
-		resErr   resultErr
-		foundErr bool
-	)
-	// Check for errors. All the results will be concatenated but only the first
-	// err read, if any, will be returned.
-	for i := 0; i < numGR; i++ {
-		resErr = <-done
-		if resErr.result != "" {
-			result += resErr.result
-		}
-		if !foundErr {
-			if resErr.err != nil {
-				foundErr = true
-				err = resErr.err
 			}
 		}
 	}
-	resErr.result = result
-	resErr.err = err
-	return resErr
+	return resultErr{
+		result: result,
+		err:    err,
+	}
 }
 
-func (h *handler) markThreadAsOld(userId string, ctx *pbContext.Thread) error {
+// markThreadAsOld enqueues the operation to move the given thread from the
+// recent activity to the old activity of the user in the outbox.
+func (h *handler) markThreadAsOld(tx *bolt.Tx, userId string, ctx *pbContext.Thread) error {
 	req := &pbUsers.OldThreadRequest{
 		UserId: userId,
 		Ctx:    ctx,
 	}
-	_, err := h.users.OldThread(context.Background(), req)
-	return err
+	return h.enqueue(tx, opOldThread, userId, req)
 }
 
-func (h *handler) markCommentAsOld(userId string, ctx *pbContext.Comment) error {
+// markCommentAsOld enqueues the operation to move the given comment from the
+// recent activity to the old activity of the user in the outbox.
+func (h *handler) markCommentAsOld(tx *bolt.Tx, userId string, ctx *pbContext.Comment) error {
 	req := &pbUsers.OldCommentRequest{
 		UserId: userId,
 		Ctx:    ctx,
 	}
-	_, err := h.users.OldComment(context.Background(), req)
-	return err
+	return h.enqueue(tx, opOldComment, userId, req)
 }
 
-func (h *handler) markSubcommentAsOld(userId string, ctx *pbContext.Subcomment) error {
+// markSubcommentAsOld enqueues the operation to move the given subcomment from
+// the recent activity to the old activity of the user in the outbox.
+func (h *handler) markSubcommentAsOld(tx *bolt.Tx, userId string, ctx *pbContext.Subcomment) error {
 	req := &pbUsers.OldSubcommentRequest{
 		UserId: userId,
 		Ctx:    ctx,
 	}
-	_, err := h.users.OldSubcomment(context.Background(), req)
-	return err
+	return h.enqueue(tx, opOldSubcomment, userId, req)
 }
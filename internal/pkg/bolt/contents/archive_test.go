@@ -0,0 +1,187 @@
+package contents_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+)
+
+// scoreThresholds archive every thread with a net score lower than 1, however
+// young or quiet it is.
+var scoreThresholds = dbmodel.QAThresholds{
+	MaxAvgUpdateTime: 24 * time.Hour,
+	MinScore:         1,
+}
+
+// threadContext returns the context of the given thread.
+func threadContext(thread *pbContext.Thread) *pbContext.Context {
+	return &pbContext.Context{
+		Ctx: &pbContext.Context_ThreadCtx{ThreadCtx: thread},
+	}
+}
+
+func TestQANetScore(t *testing.T) {
+	h, _, done := newHandler(t, scoreThresholds)
+	defer done()
+
+	liked := newThread(t, h, "Liked thread", "author1")
+	disputed := newThread(t, h, "Disputed thread", "author2")
+	for _, voter := range []string{"voter1", "voter2"} {
+		if _, err := h.UpvoteThread(voter, liked); err != nil {
+			t.Fatalf("Could not upvote thread: %v\n", err)
+		}
+	}
+	if _, err := h.UpvoteThread("voter1", disputed); err != nil {
+		t.Fatalf("Could not upvote thread: %v\n", err)
+	}
+	if _, err := h.Downvote(threadContext(disputed), "voter1"); !errors.Is(err, dbmodel.ErrOppositeVote) {
+		t.Errorf("Got %v downvoting an upvoted thread, want %v\n", err, dbmodel.ErrOppositeVote)
+	}
+	votes, err := h.Downvote(threadContext(liked), "voter3")
+	if err != nil {
+		t.Fatalf("Could not downvote thread: %v\n", err)
+	}
+	want := &dbmodel.Votes{Upvotes: 2, Downvotes: 1, Score: 1, Downvoted: true}
+	if !reflect.DeepEqual(votes, want) {
+		t.Errorf("Got votes %+v, want %+v\n", votes, want)
+	}
+	if _, err = h.Downvote(threadContext(disputed), "voter2"); err != nil {
+		t.Fatalf("Could not downvote thread: %v\n", err)
+	}
+
+	// The liked thread keeps its net score of 1; the disputed one drops to
+	// 0 and is archived.
+	if _, err = h.QA(); err != nil {
+		t.Fatalf("Could not run QA: %v\n", err)
+	}
+	history, err := h.QAHistory(1)
+	if err != nil {
+		t.Fatalf("Could not get QA history: %v\n", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("Got %d QA summaries, want 1\n", len(history))
+	}
+	qa := history[0]
+	if !reflect.DeepEqual(qa.Kept, []string{liked.Id}) || !reflect.DeepEqual(qa.Archived, []string{disputed.Id}) {
+		t.Errorf("Got threads %v kept and %v archived, want [%s] and [%s]\n", qa.Kept, qa.Archived,
+			liked.Id, disputed.Id)
+	}
+	if failed := qa.Failed[disputed.Id]; !reflect.DeepEqual(failed, []string{"net score: 0 (< 1)"}) {
+		t.Errorf("Got failed thresholds %v, want only the net score\n", failed)
+	}
+}
+
+// Pinned threads are kept active whatever thresholds they fail.
+func TestQAPinned(t *testing.T) {
+	h, _, done := newHandler(t, scoreThresholds)
+	defer done()
+
+	pinned := newThread(t, h, "Pinned thread", "author1")
+	unpinned := newThread(t, h, "Unpinned thread", "author2")
+	if err := h.PinThread(pinned, 1); err != nil {
+		t.Fatalf("Could not pin thread: %v\n", err)
+	}
+	if _, err := h.QA(); err != nil {
+		t.Fatalf("Could not run QA: %v\n", err)
+	}
+	history, err := h.QAHistory(1)
+	if err != nil {
+		t.Fatalf("Could not get QA history: %v\n", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("Got %d QA summaries, want 1\n", len(history))
+	}
+	qa := history[0]
+	if !reflect.DeepEqual(qa.Kept, []string{pinned.Id}) || !reflect.DeepEqual(qa.Archived, []string{unpinned.Id}) {
+		t.Errorf("Got threads %v kept and %v archived, want [%s] and [%s]\n", qa.Kept, qa.Archived,
+			pinned.Id, unpinned.Id)
+	}
+	ids, err := h.GetPinnedThreads()
+	if err != nil {
+		t.Fatalf("Could not get pinned threads: %v\n", err)
+	}
+	if !reflect.DeepEqual(ids, []string{pinned.Id}) {
+		t.Errorf("Got pinned threads %v after QA, want [%s]\n", ids, pinned.Id)
+	}
+}
+
+// Every threshold a thread fails is reported in the QA summary, and threads
+// younger than the minimum age are not evaluated at all.
+func TestQAThresholds(t *testing.T) {
+	tests := []struct {
+		name       string
+		thresholds dbmodel.QAThresholds
+		archived   bool
+		failed     []string // Prefixes of the failed thresholds.
+	}{
+		{
+			name:       "min age",
+			thresholds: dbmodel.QAThresholds{MinAge: time.Hour, MinInteractions: 10, MinScore: 1},
+		},
+		{
+			name:       "min interactions",
+			thresholds: dbmodel.QAThresholds{MinInteractions: 10, MaxAvgUpdateTime: time.Hour},
+			archived:   true,
+			failed:     []string{"interactions: 1 (< 10)"},
+		},
+		{
+			name:       "max avg update time",
+			thresholds: dbmodel.QAThresholds{MaxAvgUpdateTime: time.Millisecond},
+			archived:   true,
+			failed:     []string{"average update time difference: "},
+		},
+		{
+			name:       "every threshold",
+			thresholds: dbmodel.QAThresholds{MinInteractions: 10, MaxAvgUpdateTime: time.Millisecond, MinScore: 1},
+			archived:   true,
+			failed: []string{
+				"interactions: 1 (< 10)",
+				"average update time difference: ",
+				"net score: 0 (< 1)",
+			},
+		},
+		{
+			name:       "none",
+			thresholds: dbmodel.QAThresholds{MinInteractions: 1, MaxAvgUpdateTime: time.Hour},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, _, done := newHandler(t, test.thresholds)
+			defer done()
+
+			thread := newThread(t, h, "Evaluated thread", "author")
+			newComment(t, h, thread, 0, "replier")
+			// The average update time is counted by the second.
+			time.Sleep(time.Second)
+			if _, err := h.QA(); err != nil {
+				t.Fatalf("Could not run QA: %v\n", err)
+			}
+			history, err := h.QAHistory(1)
+			if err != nil {
+				t.Fatalf("Could not get QA history: %v\n", err)
+			}
+			if len(history) != 1 {
+				t.Fatalf("Got %d QA summaries, want 1\n", len(history))
+			}
+			qa := history[0]
+			if archived := len(qa.Archived) == 1; archived != test.archived {
+				t.Errorf("Got threads %v archived and %v kept, want archived: %v\n", qa.Archived, qa.Kept, test.archived)
+			}
+			failed := qa.Failed[thread.Id]
+			if len(failed) != len(test.failed) {
+				t.Fatalf("Got failed thresholds %v, want %v\n", failed, test.failed)
+			}
+			for i, prefix := range test.failed {
+				if !strings.HasPrefix(failed[i], prefix) {
+					t.Errorf("Got failed threshold %q, want %q\n", failed[i], prefix)
+				}
+			}
+		})
+	}
+}
@@ -4,9 +4,12 @@
 package contents
 
 import (
+	"encoding/binary"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
@@ -21,13 +24,59 @@ const (
 	commentsB         = "Comments"
 	subcommentsB      = "Subcomments"
 	deletedThreadsB   = "DeletedThreads"
+	deletionTimesB    = "DeletionTimes"
 	deletedCommentsB  = "DeletedComments"
+	revisionsB        = "Revisions"
+	editTimesB        = "EditTimes"
+	lastCreatedB      = "LastCreated"
+	metadataB         = "Metadata"
+	qaHistoryB        = "QAHistory"
+	purgeHistoryB     = "PurgeHistory"
+	outboxB           = "Outbox"
+	failedOpsB        = "Failed"
+	idempotencyKeysB  = "IdempotencyKeys"
+	expiryB           = "Expiry"
+	searchIndexB      = "SearchIndex"
+	postingsB         = "Postings"
+	searchDocsB       = "Docs"
+	tagsB             = "Tags"
+	byThreadB         = "ByThread"
+	pollsB            = "Polls"
+	votersB           = "Voters"
+	reactionsB        = "Reactions"
+	reactionUsersB    = "Users"
+	reactionCountsB   = "Counts"
+	downvotesB        = "Downvotes"
+	moderationLogB    = "ModerationLog"
+	rolesB            = "Roles"
+	removedB          = "Removed"
+	reportsB          = "Reports"
+	queueB            = "Queue"
+	resolvedB         = "Resolved"
+	byContentB        = "ByContent"
+	reportersB        = "Reporters"
+)
+
+// keys of the bucket of metadata
+const (
+	lastQAK = "lastQA"
+	pinnedB = "Pinned"
+	lockedB = "Locked"
 )
 
 type handler struct {
-	section section // Contents section
-	lastQA  int64 // Last time a clean up was done.
-	users   pbApi.CrudUsersClient // Connection to remote users service.
+	section      section // Contents section
+	lastQA       int64 // Last time a clean up was done.
+	qaRunning    int32 // Set to 1 while a clean up is moving contents.
+	qaThresholds dbmodel.QAThresholds // Rules for archiving threads on clean ups.
+	users        pbApi.CrudUsersClient // Connection to remote users service.
+	// delivering is held while delivering the outbox, so the dispatcher and
+	// flushes never deliver the same operation twice.
+	delivering sync.Mutex
+	// Channels of the dispatcher of the outbox.
+	wake    chan struct{} // New operations were enqueued.
+	quit    chan struct{} // The handler is being closed.
+	stopped chan struct{} // The dispatcher returned.
 }
 
 type section struct {
@@ -39,11 +88,34 @@ type section struct {
 	id       string // Section ID
 }
 
-// Close the section database and returns an error, if any.
+// Close stops the dispatcher of the outbox, closes the section database and
+// returns an error, if any. Operations not delivered yet are kept in the outbox
+// and delivered once the database is open again.
 func (h *handler) Close() error {
+	close(h.quit)
+	<-h.stopped
 	return h.section.contents.Close()
 }
 
+// Snapshot writes a consistent copy of the whole section database to w in a
+// read-only transaction, so it can be called while serving requests. It
+// returns the number of bytes written.
+func (h *handler) Snapshot(w io.Writer) (int64, error) {
+	var n int64
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// DBFile returns the path of the database file of the given section under the
+// directory specified by path.
+func DBFile(path, sectionId string) string {
+	return filepath.Join(path, sectionId, "contents.db")
+}
+
 // New returns a dbmodel.Handler with a few just open bolt databases under the
 // directory specified by path for the given sections.
 //
@@ -54,7 +126,8 @@ func (h *handler) Close() error {
 // The top-level bucket of active contents holds key/value pairs representing
 // thread ids and thread contents, respectively, a comments bucket and a bucket
 // for deleted threads, which hold the thread-id/thread-content pairs of deleted
-// threads.
+// threads and a bucket with the time each of them was deleted at. Deleted
+// threads can be restored until the next clean up.
 //
 // The bucket of comments has a bucket for each thread, where the keys are the
 // same as the key of the thread the comments belong to. Each of these buckets
@@ -70,23 +143,106 @@ func (h *handler) Close() error {
 // Both comments and subcomments have numeric, sequential ids.
 //
 // The bucket of archived contents has almost the same structure. The only
-// difference is that it doesn't have buckets for deleted contents.
+// difference is that it doesn't have buckets for deleted contents; instead, it
+// has a bucket with the time each deleted thread whose comments were moved to
+// archived contents was deleted at.
+//
+// The bucket of revisions lives next to them and is not moved on clean ups. It
+// has a bucket for each edited content, where the keys are sequential numbers
+// and the values are the previous versions of the content. The bucket of edit
+// times holds the last time each of them was edited by its author, under the
+// same key as its bucket of revisions.
+//
+// The bucket of metadata holds data about the section database itself, such as
+// the last time a clean up was done, a bucket of the threads pinned to the top
+// of the feeds of the section, holding the time they were pinned by thread id,
+// and a bucket of the locked threads, holding the time they were locked by
+// thread id. The buckets of QA history and purge history hold the summaries of
+// every clean up and every purge, respectively, with sequential numbers as
+// keys, and so does the moderation log with the actions of the moderators.
+//
+// The bucket of roles holds the role of each moderator and owner of the
+// section, who granted it and when, by user id. The bucket of removed contents
+// has a bucket for each thread whose contents were removed by moderators,
+// holding the time each of them was removed under the same key as its bucket of
+// revisions.
+//
+// The bucket of reports holds the moderation queue: a bucket of the open items,
+// with sequential numbers as keys, a bucket of the resolved items, under the
+// same keys, a bucket with the number of the open item of each content, under
+// the same key as its bucket of revisions, and a bucket of reporters, laid out
+// as the bucket of downvotes, with the ids of the users who reported each
+// content as keys.
 //
-// New only creates the bucket of active contents and the bucket of archived
-// contents, along with their top-level bucket for comments. In the bucket of
-// active contents, it also creates a bucket for deleted threads.
-func New(path string, sectionId, sectionName string, usersClient pbApi.CrudUsersClient) (dbmodel.Handler, error) {
+// The outbox bucket holds the operations on the users service enqueued by the
+// writes to the section database, with sequential numbers as keys, and a bucket
+// for the operations that could not be delivered. A dispatcher started by New
+// delivers them in the background until the handler is closed.
+//
+// The bucket of the search index holds an inverted index of the active and
+// archived contents: a bucket of postings, with a key for each word and content
+// holding it, a bucket with the words of every content indexed and the number
+// of contents indexed and their total length.
+//
+// The bucket of tags has a bucket for each tag in use, holding the ids of the
+// active and archived threads tagged with it as keys, and a bucket with the
+// tags of every thread, by thread id, which keeps them while the thread is
+// deleted so they're back if it's restored.
+//
+// The bucket of polls has a bucket for each thread with a poll attached, where
+// the keys are the same as the key of the thread, holding the poll and its
+// number of votes, and a bucket of voters, holding the choices of each user by
+// user id.
+//
+// The bucket of reactions has a bucket for each thread whose contents got
+// reactions, where the keys are the same as the key of the thread. Each of them
+// has a bucket for each content, under the same key as its bucket of revisions,
+// holding a bucket with the reactions of each user, by user id, and a bucket
+// with the number of users who added each reaction.
+//
+// The bucket of downvotes is laid out the same way, but the bucket of each
+// content holds the ids of the users who downvoted it as keys. The users who
+// upvoted a content are in the content itself.
+//
+// The bucket of idempotency keys holds the results of the write operations
+// sent with an idempotency key, under the key, and a bucket of expiry times
+// which sorts the keys by the time they were claimed.
+//
+// New only creates the bucket of active contents, the bucket of archived
+// contents, along with their top-level bucket for comments, the buckets of
+// revisions and edit times, the bucket of metadata, the buckets of QA and purge
+// history, the outbox, along with its bucket of failed operations, and the
+// bucket of idempotency keys, along with its bucket of expiry times, and the
+// bucket of tags, along with its bucket of tags by thread, the bucket of polls,
+// the bucket of reactions, the bucket of downvotes, the moderation log, the
+// bucket of roles, the bucket of removed contents and the bucket of reports,
+// along with its buckets of open and resolved items, items by content and
+// reporters. In the buckets of active and archived contents, it also creates a
+// bucket of deletion times and, in the former, a bucket for deleted threads,
+// and in the bucket of metadata, the buckets of pinned and locked threads. If
+// the search index does not exist or has an older layout, every content is
+// indexed again.
+//
+// The last time a clean up was done is loaded from the bucket of metadata. If
+// it has not been set yet, it will be set to the current time.
+//
+// Clean ups will archive threads according to the given thresholds.
+func New(path string, sectionId, sectionName string, usersClient pbApi.CrudUsersClient,
+	qaThresholds dbmodel.QAThresholds) (dbmodel.Handler, error) {
 
 	// open or create section database
 	dbPath := filepath.Join(path, sectionId)
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
 		os.MkdirAll(dbPath, os.ModeDir)
 	}
-	dbFile := filepath.Join(dbPath, "contents.db")
-	db, err := bolt.Open(dbFile, 0600, nil)
+	dbFile := DBFile(path, sectionId)
+	// Fail instead of waiting forever if another process, such as a running
+	// section service, holds the database.
+	db, err := bolt.Open(dbFile, 0600, &bolt.Options{Timeout: 5 * time.Second})
 	if err != nil {
 		return nil, err
 	}
+	var lastQA int64
 	// create bucket for active contents and for archived contents
 	err = db.Update(func(tx *bolt.Tx) error {
 		// active
@@ -100,11 +256,16 @@ func New(path string, sectionId, sectionName string, usersClient pbApi.CrudUsers
 			log.Printf("Could not create bucket %s: %v\n", commentsB, err)
 			return err
 		}
-		_, err = b.CreateBucketIfNotExists([]byte(deletedThreadsB))
+		delThreads, err := b.CreateBucketIfNotExists([]byte(deletedThreadsB))
 		if err != nil {
 			log.Printf("Could not create bucket %s: %v\n", deletedThreadsB, err)
 			return err
 		}
+		_, err = delThreads.CreateBucketIfNotExists([]byte(deletionTimesB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", deletionTimesB, err)
+			return err
+		}
 		// archived
 		b, err = tx.CreateBucketIfNotExists([]byte(archivedContentsB))
 		if err != nil {
@@ -116,22 +277,169 @@ func New(path string, sectionId, sectionName string, usersClient pbApi.CrudUsers
 			log.Printf("Could not create bucket %s: %v\n", commentsB, err)
 			return err
 		}
-		return nil
+		_, err = b.CreateBucketIfNotExists([]byte(deletionTimesB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", deletionTimesB, err)
+			return err
+		}
+		// revisions
+		_, err = tx.CreateBucketIfNotExists([]byte(revisionsB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", revisionsB, err)
+			return err
+		}
+		// edit times
+		_, err = tx.CreateBucketIfNotExists([]byte(editTimesB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", editTimesB, err)
+			return err
+		}
+		// last times users created threads
+		_, err = tx.CreateBucketIfNotExists([]byte(lastCreatedB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", lastCreatedB, err)
+			return err
+		}
+		// QA history
+		_, err = tx.CreateBucketIfNotExists([]byte(qaHistoryB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", qaHistoryB, err)
+			return err
+		}
+		// purge history
+		_, err = tx.CreateBucketIfNotExists([]byte(purgeHistoryB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", purgeHistoryB, err)
+			return err
+		}
+		// outbox
+		b, err = tx.CreateBucketIfNotExists([]byte(outboxB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", outboxB, err)
+			return err
+		}
+		_, err = b.CreateBucketIfNotExists([]byte(failedOpsB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", failedOpsB, err)
+			return err
+		}
+		// idempotency keys
+		b, err = tx.CreateBucketIfNotExists([]byte(idempotencyKeysB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", idempotencyKeysB, err)
+			return err
+		}
+		_, err = b.CreateBucketIfNotExists([]byte(expiryB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", expiryB, err)
+			return err
+		}
+		// tags
+		b, err = tx.CreateBucketIfNotExists([]byte(tagsB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", tagsB, err)
+			return err
+		}
+		_, err = b.CreateBucketIfNotExists([]byte(byThreadB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", byThreadB, err)
+			return err
+		}
+		// polls
+		_, err = tx.CreateBucketIfNotExists([]byte(pollsB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", pollsB, err)
+			return err
+		}
+		// reactions
+		_, err = tx.CreateBucketIfNotExists([]byte(reactionsB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", reactionsB, err)
+			return err
+		}
+		// downvotes
+		_, err = tx.CreateBucketIfNotExists([]byte(downvotesB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", downvotesB, err)
+			return err
+		}
+		// moderation log
+		_, err = tx.CreateBucketIfNotExists([]byte(moderationLogB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", moderationLogB, err)
+			return err
+		}
+		// roles
+		_, err = tx.CreateBucketIfNotExists([]byte(rolesB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", rolesB, err)
+			return err
+		}
+		// removed contents
+		_, err = tx.CreateBucketIfNotExists([]byte(removedB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", removedB, err)
+			return err
+		}
+		// reports
+		b, err = tx.CreateBucketIfNotExists([]byte(reportsB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", reportsB, err)
+			return err
+		}
+		for _, name := range []string{queueB, resolvedB, byContentB, reportersB} {
+			_, err = b.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				log.Printf("Could not create bucket %s: %v\n", name, err)
+				return err
+			}
+		}
+		// search index
+		index := tx.Bucket([]byte(searchIndexB))
+		if (index == nil) || (getStat(index, versionK) != searchIndexVersion) {
+			if err = rebuildSearchIndex(tx); err != nil {
+				return err
+			}
+		}
+		// metadata
+		b, err = tx.CreateBucketIfNotExists([]byte(metadataB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", metadataB, err)
+			return err
+		}
+		if _, err = b.CreateBucketIfNotExists([]byte(pinnedB)); err != nil {
+			log.Printf("Could not create bucket %s: %v\n", pinnedB, err)
+			return err
+		}
+		if _, err = b.CreateBucketIfNotExists([]byte(lockedB)); err != nil {
+			log.Printf("Could not create bucket %s: %v\n", lockedB, err)
+			return err
+		}
+		if lastQAB := b.Get([]byte(lastQAK)); lastQAB != nil {
+			lastQA = int64(binary.BigEndian.Uint64(lastQAB))
+			return nil
+		}
+		lastQA = time.Now().Unix()
+		return b.Put([]byte(lastQAK), itob(uint64(lastQA)))
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	now := time.Now()
-
-	return &handler{
-		users:    usersClient,
-		section:  section{
+	h := &handler{
+		users:        usersClient,
+		qaThresholds: qaThresholds,
+		section: section{
 			contents: db,
 			path:     dbFile,
 			name:     sectionName,
 			id:       sectionId,
 		},
-		lastQA:   now.Unix(),
-	}, nil
+		lastQA:  lastQA,
+		wake:    make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go h.dispatch()
+	return h, nil
 }
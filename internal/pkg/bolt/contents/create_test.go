@@ -0,0 +1,43 @@
+package contents_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+)
+
+// A user creates a single thread between clean ups, even before the outbox
+// delivers the first thread to the users service.
+func TestCreateThreadPerQA(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	create := func(title string) error {
+		content := &pbApi.Content{
+			Title:       title,
+			Content:     "Content of " + title,
+			PublishDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+		}
+		_, err := h.CreateThread(content, "author", dbmodel.NewThread{})
+		return err
+	}
+	if err := create("First thread"); err != nil {
+		t.Fatalf("Could not create thread: %v\n", err)
+	}
+	if err := create("Second thread"); !errors.Is(err, dbmodel.ErrUserNotAllowed) {
+		t.Errorf("Got %v creating a second thread, want %v\n", err, dbmodel.ErrUserNotAllowed)
+	}
+
+	// Clean ups are recorded by the second.
+	time.Sleep(time.Second)
+	if _, err := h.QA(); err != nil {
+		t.Fatalf("Could not run QA: %v\n", err)
+	}
+	if err := create("Third thread"); err != nil {
+		t.Errorf("Could not create thread after QA: %v\n", err)
+	}
+}
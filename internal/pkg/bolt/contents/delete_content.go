@@ -1,8 +1,8 @@
 package contents
 
 import (
-	"context"
 	"log"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
@@ -13,17 +13,24 @@ import (
 )
 
 // DeleteThread removes the thread from the database only if the userId is the
-// same as the one indicated by AuthorId on the given thread, then it updates the
-// recent or old activity of the given user by removing the reference to the thread.
+// same as the one indicated by AuthorId on the given thread, then it enqueues the
+// update of the recent or old activity of the given user by removing the
+// reference to the thread in the outbox.
+//
+// Active threads are kept in the bucket of deleted threads, along with the time
+// they were deleted at, so they can be restored until the next clean up. The
+// thread is unpinned and, along with its comments and subcomments, removed from
+// the search index either way.
 func (h *handler) DeleteThread(thread *pbContext.Thread, userId string) error {
 	var (
 		id = thread.Id
 	)
 
-	// Find thread, check whether the submitter is the author, update activity
-	// of author and remove reference to thread from the list of saved threads
-	// of every user who saved it, insert thread into the bucket of deleted
-	// threads if the thread is active and delete thread from active contents.
+	// Find thread, check whether the submitter is the author, enqueue the
+	// update of the activity of author and the removal of the reference to
+	// thread from the list of saved threads of every user who saved it, insert
+	// thread into the bucket of deleted threads if the thread is active and
+	// delete thread from active contents.
 	return h.section.contents.Update(func(tx *bolt.Tx) error {
 		contents, name, err := getThreadBucket(tx, id)
 		if err != nil {
@@ -41,41 +48,24 @@ func (h *handler) DeleteThread(thread *pbContext.Thread, userId string) error {
 		if pbThread.AuthorId != userId {
 			return dbmodel.ErrUserNotAllowed
 		}
-		usersWhoSaved := pbThread.UsersWhoSaved
-		var (
-			done = make(chan error)
-			quit = make(chan struct{})
-			// Users to be updated: the author of the thread and the users who
-			// saved it.
-			users = 1 + len(usersWhoSaved)
-		)
-		defer close(quit)
 		// Delete reference to the thread from the activity of the author.
-		go func(userId string) {
-			req := &pbUsers.DeleteThreadRequest{
-				UserId: userId,
+		req := &pbUsers.DeleteThreadRequest{
+			UserId: userId,
+			Ctx:    thread,
+		}
+		if err = h.enqueue(tx, opDeleteThread, userId, req); err != nil {
+			return err
+		}
+		// Delete reference to the thread from the list of saved threads of every
+		// user who saved it.
+		for _, userWhoSaved := range pbThread.UsersWhoSaved {
+			req := &pbUsers.RemoveSavedRequest{
+				UserId: userWhoSaved,
 				Ctx:    thread,
 			}
-			_, err := h.users.DeleteThread(context.Background(), req)
-			select {
-			case done<- err:
-			case <-quit:
+			if err = h.enqueue(tx, opRemoveSaved, userWhoSaved, req); err != nil {
+				return err
 			}
-		}(userId)
-		// Delete reference to the thread from the list of saved threads of every
-		// user who saved it.
-		for _, userId = range usersWhoSaved {
-			go func(userId string) {
-				req := &pbUsers.RemoveSavedRequest{
-					UserId: userId,
-					Ctx:    thread,
-				}
-				_, err := h.users.RemoveSaved(context.Background(), req)
-				select {
-				case done<- err:
-				case <-quit:
-				}
-			}(userId)
 		}
 		// Check whether the thread is active. If so, insert it into the bucket
 		// of deleted threads.
@@ -88,28 +78,37 @@ func (h *handler) DeleteThread(thread *pbContext.Thread, userId string) error {
 			if err = delContents.Put([]byte(id), threadBytes); err != nil {
 				return err
 			}
+			delTimes := delContents.Bucket([]byte(deletionTimesB))
+			if delTimes == nil {
+				log.Printf("Bucket %s not found.\n", deletionTimesB)
+				return dbmodel.ErrBucketNotFound
+			}
+			deletedAt := itob(uint64(time.Now().Unix()))
+			if err = delTimes.Put([]byte(id), deletedAt); err != nil {
+				return err
+			}
 		}
 		err = contents.Delete([]byte(id))
 		if err != nil {
 			log.Printf("Could not delete thread: %v.\n", err)
 			return err
 		}
-		// Check for errors. It terminates every go-routine hung on the statement
-		// case "done<- err" and returns the first err received.
-		for i := 0; i < users; i++ {
-			err = <-done
-			if err != nil {
-				log.Println(err)
-				break
-			}
+		// The thread is indexed and tagged again if it's restored.
+		if err = untagThread(tx, id); err != nil {
+			return err
 		}
-		return err
+		// Pinned threads are not pinned again if they're restored.
+		if err = unpinThread(tx, id); err != nil {
+			return err
+		}
+		return unindexThread(tx, id)
 	})
 }
 
 // DeleteComment removes the comment from the database only if the userId is the
 // same as the one indicated by AuthorId on the given comment, then it updates the
 // recent or old activity of the given user by removing the reference to the comment.
+// The comment and its subcomments are removed from the search index.
 func (h *handler) DeleteComment(comment *pbContext.Comment, userId string) error {
 	var (
 		id        = comment.Id
@@ -140,13 +139,15 @@ func (h *handler) DeleteComment(comment *pbContext.Comment, userId string) error
 		if err != nil {
 			return err
 		}
+		if err = unindexComment(tx, threadId, id); err != nil {
+			return err
+		}
 		req := &pbUsers.DeleteCommentRequest{
 			UserId: userId,
 			Ctx:    comment,
 		}
 		// Update user; remove comment from its activity.
-		_, err = h.users.DeleteComment(context.Background(), req)
-		if err != nil {
+		if err = h.enqueue(tx, opDeleteComment, userId, req); err != nil {
 			return err
 		}
 		// Update the thread which the comment belongs to; decrease Replies by 1
@@ -217,13 +218,15 @@ func (h *handler) DeleteSubcomment(subcomment *pbContext.Subcomment, userId stri
 		if err = subcommentsBucket.Delete([]byte(id)); err != nil {
 			return err
 		}
+		if err = unindexSubcomment(tx, threadId, commentId, id); err != nil {
+			return err
+		}
 		req := &pbUsers.DeleteSubcommentRequest{
 			UserId: userId,
 			Ctx:    subcomment,
 		}
 		// Update user; remove subcomment from its activity.
-		_, err = h.users.DeleteSubcomment(context.Background(), req)
-		if err != nil {
+		if err = h.enqueue(tx, opDeleteSubcomment, userId, req); err != nil {
 			return err
 		}
 		// Update the comment which the subcomment belongs to; decrease replies
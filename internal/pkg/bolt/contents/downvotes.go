@@ -0,0 +1,246 @@
+package contents
+
+import (
+	"log"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	bolt "go.etcd.io/bbolt"
+)
+
+// threadContext, commentContext and subcommentContext wrap the given content
+// context into a *pbContext.Context.
+func threadContext(thread *pbContext.Thread) *pbContext.Context {
+	return &pbContext.Context{
+		Ctx: &pbContext.Context_ThreadCtx{ThreadCtx: thread},
+	}
+}
+
+func commentContext(comment *pbContext.Comment) *pbContext.Context {
+	return &pbContext.Context{
+		Ctx: &pbContext.Context_CommentCtx{CommentCtx: comment},
+	}
+}
+
+func subcommentContext(subcomment *pbContext.Subcomment) *pbContext.Context {
+	return &pbContext.Context{
+		Ctx: &pbContext.Context_SubcommentCtx{SubcommentCtx: subcomment},
+	}
+}
+
+// downvotersBucket returns the bucket of the users who downvoted the content
+// pointed to by the given context, which is nil if nobody downvoted it yet,
+// unless create is true.
+func downvotersBucket(tx *bolt.Tx, content *pbContext.Context, create bool) (*bolt.Bucket, error) {
+	key, err := revisionKey(content)
+	if err != nil {
+		return nil, err
+	}
+	downvotes := tx.Bucket([]byte(downvotesB))
+	if downvotes == nil {
+		log.Printf("Bucket %s not found\n", downvotesB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	threadId := []byte(contentThreadId(content))
+	if !create {
+		if b := downvotes.Bucket(threadId); b != nil {
+			return b.Bucket([]byte(key)), nil
+		}
+		return nil, nil
+	}
+	b, err := downvotes.CreateBucketIfNotExists(threadId)
+	if err != nil {
+		log.Printf("Could not create bucket %s: %v\n", threadId, err)
+		return nil, err
+	}
+	if b, err = b.CreateBucketIfNotExists([]byte(key)); err != nil {
+		log.Printf("Could not create bucket %s: %v\n", key, err)
+		return nil, err
+	}
+	return b, nil
+}
+
+// downvoted returns whether the given user downvoted the content pointed to by
+// the given context.
+func downvoted(tx *bolt.Tx, content *pbContext.Context, userId string) (bool, error) {
+	downvoters, err := downvotersBucket(tx, content, false)
+	if (err != nil) || (downvoters == nil) {
+		return false, err
+	}
+	return downvoters.Get([]byte(userId)) != nil, nil
+}
+
+// countDownvotes returns the number of users who downvoted the content pointed
+// to by the given context.
+func countDownvotes(tx *bolt.Tx, content *pbContext.Context) (int, error) {
+	downvoters, err := downvotersBucket(tx, content, false)
+	if (err != nil) || (downvoters == nil) {
+		return 0, err
+	}
+	return countVoters(downvoters), nil
+}
+
+// countThreadDownvotes returns the number of users who downvoted the given
+// thread and each of its comments and subcomments, by the key of their bucket
+// of downvoters. Contents nobody downvoted are not set.
+func countThreadDownvotes(tx *bolt.Tx, threadId string) (map[string]int, error) {
+	downvotes := tx.Bucket([]byte(downvotesB))
+	if downvotes == nil {
+		log.Printf("Bucket %s not found\n", downvotesB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	counts := make(map[string]int)
+	b := downvotes.Bucket([]byte(threadId))
+	if b == nil {
+		return counts, nil
+	}
+	err := b.ForEach(func(k, v []byte) error {
+		if downvoters := b.Bucket(k); downvoters != nil {
+			counts[string(k)] = countVoters(downvoters)
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// threadDownvotes returns the number of users who downvoted the thread with
+// the given id, given the bucket of downvotes.
+func threadDownvotes(downvotes *bolt.Bucket, threadId string) int {
+	b := downvotes.Bucket([]byte(threadId))
+	if b == nil {
+		return 0
+	}
+	if downvoters := b.Bucket([]byte(threadKey(threadId))); downvoters != nil {
+		return countVoters(downvoters)
+	}
+	return 0
+}
+
+// scoreThread returns the given thread set as a patillator.ScoredContent or a
+// patillator.ScoredGeneralContent, along with the given net score, if it was set
+// as a patillator.Content or a patillator.GeneralContent, or as is otherwise.
+func scoreThread(content patillator.SegregateDiscarderFinder, score int) patillator.SegregateDiscarderFinder {
+	switch c := content.(type) {
+	case patillator.Content:
+		return patillator.ScoredContent{Content: c, Score: score}
+	case patillator.GeneralContent:
+		return patillator.ScoredGeneralContent{GeneralContent: c, Score: score}
+	}
+	return content
+}
+
+// dropDownvotes removes the downvotes on the given thread and on its comments
+// and subcomments, if any. It's called when they're gone for good.
+func dropDownvotes(tx *bolt.Tx, threadId string) error {
+	downvotes := tx.Bucket([]byte(downvotesB))
+	if downvotes.Bucket([]byte(threadId)) == nil {
+		return nil
+	}
+	return downvotes.DeleteBucket([]byte(threadId))
+}
+
+// contentVotes returns the votes of the given content, pointed to by the given
+// context, and the vote of the given user.
+func contentVotes(tx *bolt.Tx, content *pbContext.Context, pbContent *pbDataFormat.Content,
+	userId string) (*dbmodel.Votes, error) {
+	downvoters, err := downvotersBucket(tx, content, false)
+	if err != nil {
+		return nil, err
+	}
+	v := &dbmodel.Votes{
+		Upvotes: int(pbContent.Upvotes),
+	}
+	v.Upvoted, _ = inSlice(pbContent.VoterIds, userId)
+	if downvoters != nil {
+		v.Downvotes = countVoters(downvoters)
+		v.Downvoted = downvoters.Get([]byte(userId)) != nil
+	}
+	v.Score = v.Upvotes - v.Downvotes
+	return v, nil
+}
+
+// Downvote saves the downvote of the given user on the content pointed to by the
+// given context and returns its votes. It returns an ErrAlreadyDownvoted if the
+// user has already downvoted it or an ErrOppositeVote if the user upvoted it.
+//
+// Downvotes neither count as interactions nor notify anyone.
+func (h *handler) Downvote(content *pbContext.Context, userId string) (*dbmodel.Votes, error) {
+	var votes *dbmodel.Votes
+
+	err := h.section.contents.Update(func(tx *bolt.Tx) error {
+		pbContent, _, err := getContentAndThread(tx, content)
+		if err != nil {
+			return err
+		}
+		if upvoted, _ := inSlice(pbContent.VoterIds, userId); upvoted {
+			return dbmodel.ErrOppositeVote
+		}
+		downvoters, err := downvotersBucket(tx, content, true)
+		if err != nil {
+			return err
+		}
+		if downvoters.Get([]byte(userId)) != nil {
+			return dbmodel.ErrAlreadyDownvoted
+		}
+		if err = downvoters.Put([]byte(userId), []byte{}); err != nil {
+			return err
+		}
+		votes, err = contentVotes(tx, content, pbContent, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+// UndoDownvote removes the downvote of the given user from the content pointed
+// to by the given context and returns its votes. It returns an ErrNotDownvoted
+// if the user has not downvoted it.
+func (h *handler) UndoDownvote(content *pbContext.Context, userId string) (*dbmodel.Votes, error) {
+	var votes *dbmodel.Votes
+
+	err := h.section.contents.Update(func(tx *bolt.Tx) error {
+		pbContent, _, err := getContentAndThread(tx, content)
+		if err != nil {
+			return err
+		}
+		downvoters, err := downvotersBucket(tx, content, false)
+		if err != nil {
+			return err
+		}
+		if (downvoters == nil) || (downvoters.Get([]byte(userId)) == nil) {
+			return dbmodel.ErrNotDownvoted
+		}
+		if err = downvoters.Delete([]byte(userId)); err != nil {
+			return err
+		}
+		votes, err = contentVotes(tx, content, pbContent, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+// GetVotes returns the upvotes, downvotes and net score of the content pointed
+// to by the given context, along with the vote of the given user.
+func (h *handler) GetVotes(content *pbContext.Context, userId string) (*dbmodel.Votes, error) {
+	var votes *dbmodel.Votes
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		pbContent, _, err := getContentAndThread(tx, content)
+		if err != nil {
+			return err
+		}
+		votes, err = contentVotes(tx, content, pbContent, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
@@ -0,0 +1,102 @@
+package contents_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+)
+
+// A dry run reports the threads a clean up would archive, without touching the
+// section database nor the activity of the users.
+func TestDryRunQA(t *testing.T) {
+	h, users, done := newHandler(t, scoreThresholds)
+	defer done()
+
+	thread := newThread(t, h, "Quiet thread", "author")
+	newComment(t, h, thread, 0, "replier")
+	// Wait for the outbox to be empty, so the dispatcher leaves the database
+	// alone.
+	calls := len(users.waitDelivered(t, 2))
+
+	var before, after bytes.Buffer
+	if _, err := h.Snapshot(&before); err != nil {
+		t.Fatalf("Could not take snapshot: %v\n", err)
+	}
+	summary, err := h.DryRunQA()
+	if err != nil {
+		t.Fatalf("Could not run dry QA: %v\n", err)
+	}
+	if !bytes.Contains([]byte(summary), []byte("Quiet thread would be moved to archived contents")) {
+		t.Errorf("Got summary %q, want it to report the quiet thread\n", summary)
+	}
+	if _, err = h.Snapshot(&after); err != nil {
+		t.Fatalf("Could not take snapshot: %v\n", err)
+	}
+	if !bytes.Equal(before.Bytes(), after.Bytes()) {
+		t.Errorf("Got the section database modified by a dry run\n")
+	}
+	if got := users.delivered(); len(got) != calls {
+		t.Errorf("Got operations %v delivered after a dry run, want %d\n", got[calls:], 0)
+	}
+	history, err := h.QAHistory(0)
+	if err != nil {
+		t.Fatalf("Could not get QA history: %v\n", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("Got %d QA summaries after a dry run, want 0\n", len(history))
+	}
+}
+
+// Clean ups requested while another one is running are rejected, so threads
+// are never archived twice.
+func TestQAOverlap(t *testing.T) {
+	h, _, done := newHandler(t, scoreThresholds)
+	defer done()
+
+	var want []string
+	for _, author := range []string{"author1", "author2", "author3", "author4"} {
+		thread := newThread(t, h, "Thread of "+author, author)
+		newComment(t, h, thread, 0, "replier")
+		want = append(want, thread.Id)
+	}
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, 8)
+	)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := h.QA()
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if (err != nil) && !errors.Is(err, dbmodel.ErrQARunning) {
+			t.Errorf("Got %v running overlapping clean ups, want nil or %v\n", err, dbmodel.ErrQARunning)
+		}
+	}
+	history, err := h.QAHistory(0)
+	if err != nil {
+		t.Fatalf("Could not get QA history: %v\n", err)
+	}
+	archived := make(map[string]int)
+	for _, qa := range history {
+		for _, id := range qa.Archived {
+			archived[id]++
+		}
+	}
+	got := make(map[string]int)
+	for _, id := range want {
+		got[id] = 1
+	}
+	if !reflect.DeepEqual(archived, got) {
+		t.Errorf("Got threads archived %v times, want each of %v once\n", archived, want)
+	}
+}
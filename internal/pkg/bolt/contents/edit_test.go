@@ -0,0 +1,173 @@
+package contents_test
+
+import (
+	"errors"
+	"testing"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+)
+
+func TestEditRevisions(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Edited thread", "author")
+	ctx := &pbContext.Context{
+		Ctx: &pbContext.Context_ThreadCtx{ThreadCtx: thread},
+	}
+	editedAt, err := h.GetEditTime(ctx)
+	if err != nil {
+		t.Fatalf("Could not get edit time: %v\n", err)
+	}
+	if editedAt != 0 {
+		t.Errorf("Got edit time %d before any edit, want 0\n", editedAt)
+	}
+	if _, err = h.GetRevisions(ctx); !errors.Is(err, dbmodel.ErrRevisionNotFound) {
+		t.Errorf("Got %v getting revisions before any edit, want %v\n", err, dbmodel.ErrRevisionNotFound)
+	}
+
+	// Only the author can edit the thread and the content cannot be empty.
+	e := dbmodel.Edit{
+		Content:   "First edit",
+		Submitter: "someone else",
+		EditDate:  &pbTime.Timestamp{Seconds: 100},
+	}
+	if err = h.UpdateThread(thread, e); !errors.Is(err, dbmodel.ErrUserNotAllowed) {
+		t.Errorf("Got %v editing as another user, want %v\n", err, dbmodel.ErrUserNotAllowed)
+	}
+	e.Submitter = "author"
+	e.Content = " \n"
+	if err = h.UpdateThread(thread, e); !errors.Is(err, dbmodel.ErrEmptyContent) {
+		t.Errorf("Got %v editing with empty content, want %v\n", err, dbmodel.ErrEmptyContent)
+	}
+
+	// The first edit keeps the title and the featured file.
+	e.Content = "First edit"
+	if err = h.UpdateThread(thread, e); err != nil {
+		t.Fatalf("Could not edit thread: %v\n", err)
+	}
+	content, err := h.GetThreadContent(thread)
+	if err != nil {
+		t.Fatalf("Could not get thread: %v\n", err)
+	}
+	if (content.Title != "Edited thread") || (content.Content != "First edit") || (content.FtFile != "file.png") {
+		t.Errorf("Got title %q, content %q and file %q after first edit\n", content.Title, content.Content, content.FtFile)
+	}
+
+	// The second one replaces the title and drops the featured file.
+	e = dbmodel.Edit{
+		Title:        "New title",
+		Content:      "Second edit",
+		RemoveFtFile: true,
+		Submitter:    "author",
+		EditDate:     &pbTime.Timestamp{Seconds: 200},
+	}
+	if err = h.UpdateThread(thread, e); err != nil {
+		t.Fatalf("Could not edit thread: %v\n", err)
+	}
+	content, err = h.GetThreadContent(thread)
+	if err != nil {
+		t.Fatalf("Could not get thread: %v\n", err)
+	}
+	if (content.Title != "New title") || (content.Content != "Second edit") || (content.FtFile != "") {
+		t.Errorf("Got title %q, content %q and file %q after second edit\n", content.Title, content.Content, content.FtFile)
+	}
+
+	// Every previous version is kept, from oldest to newest.
+	revisions, err := h.GetRevisions(ctx)
+	if err != nil {
+		t.Fatalf("Could not get revisions: %v\n", err)
+	}
+	want := []struct {
+		editedAt int64
+		title    string
+		content  string
+		ftFile   string
+	}{
+		{100, "Edited thread", "Content of Edited thread", "file.png"},
+		{200, "Edited thread", "First edit", "file.png"},
+	}
+	if len(revisions) != len(want) {
+		t.Fatalf("Got %d revisions, want %d\n", len(revisions), len(want))
+	}
+	for i, w := range want {
+		rev := revisions[i]
+		if (rev.Number != i+1) || (rev.EditedAt != w.editedAt) {
+			t.Errorf("Got revision %d edited at %d, want %d edited at %d\n", rev.Number, rev.EditedAt, i+1, w.editedAt)
+		}
+		c := rev.Content
+		if (c.Title != w.title) || (c.Content != w.content) || (c.FtFile != w.ftFile) {
+			t.Errorf("Got revision %d with title %q, content %q and file %q, want %q, %q and %q\n",
+				rev.Number, c.Title, c.Content, c.FtFile, w.title, w.content, w.ftFile)
+		}
+	}
+	rev, err := h.GetRevision(ctx, 2)
+	if err != nil {
+		t.Fatalf("Could not get revision 2: %v\n", err)
+	}
+	if rev.Content.Content != "First edit" {
+		t.Errorf("Got revision 2 with content %q, want %q\n", rev.Content.Content, "First edit")
+	}
+	if _, err = h.GetRevision(ctx, 3); !errors.Is(err, dbmodel.ErrRevisionNotFound) {
+		t.Errorf("Got %v getting revision 3, want %v\n", err, dbmodel.ErrRevisionNotFound)
+	}
+
+	// The edit time is the time of the last edit.
+	editedAt, err = h.GetEditTime(ctx)
+	if err != nil {
+		t.Fatalf("Could not get edit time: %v\n", err)
+	}
+	if editedAt != 200 {
+		t.Errorf("Got edit time %d, want 200\n", editedAt)
+	}
+}
+
+func TestEditComment(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Commented thread", "author")
+	comment := newComment(t, h, thread, 0, "replier")
+	ctx := &pbContext.Context{
+		Ctx: &pbContext.Context_CommentCtx{CommentCtx: comment},
+	}
+	e := dbmodel.Edit{
+		Title:     "Ignored",
+		Content:   "Edited comment",
+		Submitter: "replier",
+		EditDate:  &pbTime.Timestamp{Seconds: 300},
+	}
+	if err := h.UpdateComment(comment, e); err != nil {
+		t.Fatalf("Could not edit comment: %v\n", err)
+	}
+	content, err := h.GetCommentContent(comment)
+	if err != nil {
+		t.Fatalf("Could not get comment: %v\n", err)
+	}
+	if (content.Content != "Edited comment") || (content.Title != "Commented thread") {
+		t.Errorf("Got comment with title %q and content %q\n", content.Title, content.Content)
+	}
+	revisions, err := h.GetRevisions(ctx)
+	if err != nil {
+		t.Fatalf("Could not get revisions: %v\n", err)
+	}
+	if (len(revisions) != 1) || (revisions[0].Content.Content != "A comment") {
+		t.Errorf("Got revisions %v, want the original comment\n", revisions)
+	}
+	editedAt, err := h.GetEditTime(ctx)
+	if err != nil {
+		t.Fatalf("Could not get edit time: %v\n", err)
+	}
+	if editedAt != 300 {
+		t.Errorf("Got edit time %d, want 300\n", editedAt)
+	}
+	// Edits of a comment do not change the edit time of its thread.
+	threadCtx := &pbContext.Context{
+		Ctx: &pbContext.Context_ThreadCtx{ThreadCtx: thread},
+	}
+	if editedAt, _ = h.GetEditTime(threadCtx); editedAt != 0 {
+		t.Errorf("Got thread edit time %d, want 0\n", editedAt)
+	}
+}
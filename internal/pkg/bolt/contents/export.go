@@ -0,0 +1,432 @@
+package contents
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// exportFormat and exportVersion identify dumps of section databases.
+const (
+	exportFormat  = "cheroapi-section"
+	exportVersion = 1
+)
+
+// Kinds of records in a dump.
+const (
+	headerKind        = "header"
+	bucketKind        = "bucket"
+	threadKind        = "thread"
+	commentKind       = "comment"
+	subcommentKind    = "subcomment"
+	deletionTimeKind  = "deletion_time"
+	revisionKind      = "revision"
+	editTimeKind      = "edit_time"
+	lastCreatedKind   = "last_created"
+	metadataKind      = "metadata"
+	qaSummaryKind     = "qa_summary"
+	purgeSummaryKind  = "purge_summary"
+	outboxOpKind      = "outbox_op"
+	idempotencyKind   = "idempotency_key"
+	searchDocKind     = "search_doc"
+	threadTagsKind    = "thread_tags"
+	pollKind          = "poll"
+	pollVoteKind      = "poll_vote"
+	reactionKind      = "reaction"
+	reactionCountKind = "reaction_count"
+	downvoteKind      = "downvote"
+	moderationKind    = "moderation_action"
+	roleKind          = "role"
+	removalKind       = "removal"
+	reportKind        = "report"
+	reportIndexKind   = "report_index"
+	reporterKind      = "reporter"
+	otherKind         = "other"
+)
+
+// ErrInvalidDump is returned when importing a dump that is not a dump of a
+// section database or that belongs to a different section.
+var ErrInvalidDump = errors.New("Invalid section dump")
+
+// record is a line of a dump. Every bucket is described by a record of kind
+// "bucket", holding its path from the root and its sequence, followed by the
+// records of its key/value pairs and then by its nested buckets.
+//
+// Keys are written as text in Key if they're printable, or in hexadecimal in
+// KeyHex otherwise. Values are written in exactly one of these fields:
+// Content, as protojson, for threads, comments and subcomments; JSON, for
+// revisions, summaries, operations in the outbox, idempotency keys, documents
+// of the search index, tags of threads, polls, votes, reactions, moderation
+// actions, roles and reports; Uint64 for times, counts of reactions and numbers
+// of reports; and ValueHex for anything else.
+type record struct {
+	Kind     string   `json:"kind"`
+	Path     []string `json:"path,omitempty"`
+	Status   string   `json:"status,omitempty"` // active, archived or deleted.
+	Sequence uint64   `json:"sequence,omitempty"`
+	Key      string   `json:"key,omitempty"`
+	KeyHex   string   `json:"key_hex,omitempty"`
+
+	Content  json.RawMessage `json:"content,omitempty"`
+	JSON     json.RawMessage `json:"json,omitempty"`
+	Uint64   *uint64         `json:"uint64,omitempty"`
+	ValueHex string          `json:"value_hex,omitempty"`
+
+	// Header fields.
+	Format    string `json:"format,omitempty"`
+	Version   int    `json:"version,omitempty"`
+	SectionId string `json:"section_id,omitempty"`
+	Exported  int64  `json:"exported,omitempty"`
+}
+
+// classify returns the kind of the key/value pairs of the bucket with the
+// given path and, for contents, their status.
+func classify(path []string) (kind, status string) {
+	var root string
+	if len(path) > 0 {
+		root = path[0]
+	}
+	switch root {
+	case activeContentsB:
+		status = "active"
+	case archivedContentsB:
+		status = "archived"
+	case revisionsB:
+		return revisionKind, ""
+	case editTimesB:
+		return editTimeKind, ""
+	case lastCreatedB:
+		return lastCreatedKind, ""
+	case metadataB:
+		return metadataKind, ""
+	case qaHistoryB:
+		return qaSummaryKind, ""
+	case purgeHistoryB:
+		return purgeSummaryKind, ""
+	case outboxB:
+		return outboxOpKind, ""
+	case idempotencyKeysB:
+		return idempotencyKind, ""
+	case searchIndexB:
+		if (len(path) == 2) && (path[1] == searchDocsB) {
+			return searchDocKind, ""
+		}
+		return otherKind, ""
+	case pollsB:
+		switch {
+		case len(path) == 2:
+			return pollKind, ""
+		case (len(path) == 3) && (path[2] == votersB):
+			return pollVoteKind, ""
+		}
+		return otherKind, ""
+	case reactionsB:
+		if len(path) == 4 {
+			switch path[3] {
+			case reactionUsersB:
+				return reactionKind, ""
+			case reactionCountsB:
+				return reactionCountKind, ""
+			}
+		}
+		return otherKind, ""
+	case moderationLogB:
+		return moderationKind, ""
+	case rolesB:
+		return roleKind, ""
+	case removedB:
+		if len(path) == 2 {
+			return removalKind, ""
+		}
+		return otherKind, ""
+	case reportsB:
+		switch {
+		case (len(path) == 2) && ((path[1] == queueB) || (path[1] == resolvedB)):
+			return reportKind, ""
+		case (len(path) == 2) && (path[1] == byContentB):
+			return reportIndexKind, ""
+		case (len(path) == 4) && (path[1] == reportersB):
+			return reporterKind, ""
+		}
+		return otherKind, ""
+	case downvotesB:
+		if len(path) == 3 {
+			return downvoteKind, ""
+		}
+		return otherKind, ""
+	case tagsB:
+		if (len(path) == 2) && (path[1] == byThreadB) {
+			return threadTagsKind, ""
+		}
+		return otherKind, ""
+	default:
+		return otherKind, ""
+	}
+	rest := path[1:]
+	switch {
+	case len(rest) == 0:
+		return threadKind, status
+	case (len(rest) == 1) && (rest[0] == deletedThreadsB):
+		return threadKind, "deleted"
+	case (len(rest) == 1) && (rest[0] == deletionTimesB),
+		(len(rest) == 2) && (rest[0] == deletedThreadsB) && (rest[1] == deletionTimesB):
+		return deletionTimeKind, ""
+	case (len(rest) == 2) && (rest[0] == commentsB):
+		return commentKind, status
+	case (len(rest) == 3) && (rest[0] == commentsB) && (rest[2] == deletedCommentsB):
+		return commentKind, "deleted"
+	case (len(rest) == 4) && (rest[0] == commentsB) && (rest[2] == subcommentsB):
+		return subcommentKind, status
+	}
+	return otherKind, ""
+}
+
+// printable returns whether b can be written as text in a dump.
+func printable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeValue sets the value of the given record according to its kind.
+func encodeValue(rec *record, v []byte) error {
+	switch rec.Kind {
+	case threadKind, commentKind, subcommentKind:
+		pbContent := new(pbDataFormat.Content)
+		if err := proto.Unmarshal(v, pbContent); err != nil {
+			return fmt.Errorf("Could not unmarshal content %v %s: %w", rec.Path, rec.Key, err)
+		}
+		content, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(proto.MessageV2(pbContent))
+		if err != nil {
+			return err
+		}
+		rec.Content = content
+		return nil
+	case revisionKind, qaSummaryKind, purgeSummaryKind, outboxOpKind, idempotencyKind,
+		searchDocKind, threadTagsKind, pollKind, pollVoteKind, reactionKind,
+		moderationKind, roleKind, reportKind:
+		if json.Valid(v) {
+			rec.JSON = v
+			return nil
+		}
+	case deletionTimeKind, editTimeKind, lastCreatedKind, metadataKind,
+		reactionCountKind, removalKind, reportIndexKind:
+		if len(v) == 8 {
+			n := binary.BigEndian.Uint64(v)
+			rec.Uint64 = &n
+			return nil
+		}
+	}
+	rec.ValueHex = hex.EncodeToString(v)
+	return nil
+}
+
+// decodeValue returns the value of the given record in the format it's stored
+// in the database.
+func decodeValue(rec *record) ([]byte, error) {
+	switch {
+	case rec.Content != nil:
+		pbContent := new(pbDataFormat.Content)
+		err := protojson.Unmarshal(rec.Content, proto.MessageV2(pbContent))
+		if err != nil {
+			return nil, err
+		}
+		return proto.Marshal(pbContent)
+	case rec.JSON != nil:
+		return []byte(rec.JSON), nil
+	case rec.Uint64 != nil:
+		return itob(*rec.Uint64), nil
+	}
+	return hex.DecodeString(rec.ValueHex)
+}
+
+// Export writes every bucket and key/value pair of the section database to w,
+// one JSON record per line, in a read-only transaction. Threads, comments and
+// subcomments, whether active, archived or deleted, are written as protojson,
+// so the dump can be inspected and imported without knowing the layout of the
+// buckets.
+func (h *handler) Export(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	header := record{
+		Kind:      headerKind,
+		Format:    exportFormat,
+		Version:   exportVersion,
+		SectionId: h.section.id,
+		Exported:  time.Now().Unix(),
+	}
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return exportBucket(enc, []string{string(name)}, b)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// exportBucket writes the record of the bucket with the given path, the
+// records of its key/value pairs and then its nested buckets.
+func exportBucket(enc *json.Encoder, path []string, b *bolt.Bucket) error {
+	err := enc.Encode(record{
+		Kind:     bucketKind,
+		Path:     path,
+		Sequence: b.Sequence(),
+	})
+	if err != nil {
+		return err
+	}
+	kind, status := classify(path)
+	var nested [][]byte
+	err = b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			nested = append(nested, k)
+			return nil
+		}
+		rec := record{
+			Kind:   kind,
+			Path:   path,
+			Status: status,
+		}
+		if printable(k) {
+			rec.Key = string(k)
+		} else {
+			rec.KeyHex = hex.EncodeToString(k)
+		}
+		if err := encodeValue(&rec, v); err != nil {
+			return err
+		}
+		return enc.Encode(rec)
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range nested {
+		nestedPath := append(append([]string{}, path...), string(name))
+		if err = exportBucket(enc, nestedPath, b.Bucket(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bucketAt returns the bucket with the given path, creating it and its parents
+// if they do not exist.
+func bucketAt(tx *bolt.Tx, path []string) (*bolt.Bucket, error) {
+	if len(path) == 0 {
+		return nil, ErrInvalidDump
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(path[0]))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range path[1:] {
+		if b, err = b.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Import rebuilds the database of the given section under the directory
+// specified by path from a dump written by Export, preserving the sequences of
+// every bucket. The database must not exist yet, and the dump must belong to
+// the same section.
+//
+// It returns the number of key/value pairs imported.
+func Import(path, sectionId string, r io.Reader) (int, error) {
+	dbFile := DBFile(path, sectionId)
+	if _, err := os.Stat(dbFile); err == nil {
+		return 0, fmt.Errorf("%s already exists", dbFile)
+	}
+	if err := os.MkdirAll(filepath.Dir(dbFile), 0700); err != nil {
+		return 0, err
+	}
+	db, err := bolt.Open(dbFile, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var n int
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var header record
+	if err = dec.Decode(&header); err != nil {
+		return 0, err
+	}
+	if (header.Kind != headerKind) || (header.Format != exportFormat) ||
+		(header.Version != exportVersion) {
+		return 0, ErrInvalidDump
+	}
+	if header.SectionId != sectionId {
+		return 0, fmt.Errorf("%w: dump of section %s", ErrInvalidDump, header.SectionId)
+	}
+	// Import in a single transaction, so a broken dump leaves an empty
+	// database.
+	err = db.Update(func(tx *bolt.Tx) error {
+		for {
+			var rec record
+			err := dec.Decode(&rec)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			b, err := bucketAt(tx, rec.Path)
+			if err != nil {
+				return err
+			}
+			if rec.Kind == bucketKind {
+				if err = b.SetSequence(rec.Sequence); err != nil {
+					return err
+				}
+				continue
+			}
+			k := []byte(rec.Key)
+			if rec.KeyHex != "" {
+				if k, err = hex.DecodeString(rec.KeyHex); err != nil {
+					return err
+				}
+			}
+			v, err := decodeValue(&rec)
+			if err != nil {
+				return fmt.Errorf("Could not decode %v %s: %w", rec.Path, k, err)
+			}
+			if err = b.Put(k, v); err != nil {
+				return err
+			}
+			n++
+		}
+	})
+	if err != nil {
+		db.Close()
+		os.Remove(dbFile)
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,91 @@
+package contents_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/bolt/contents"
+)
+
+// A section imported from a dump holds the same contents and exports the same
+// dump.
+func TestExportImport(t *testing.T) {
+	h, users, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Exported thread", "author")
+	newComment(t, h, thread, 0, "replier")
+	deleted := newThread(t, h, "Deleted thread", "deleter")
+	if err := h.DeleteThread(deleted, "deleter"); err != nil {
+		t.Fatalf("Could not delete thread: %v\n", err)
+	}
+	// Empty the outbox first, so the imported section has nothing to deliver.
+	users.waitDelivered(t, 5)
+	var dump bytes.Buffer
+	if err := h.Export(&dump); err != nil {
+		t.Fatalf("Could not export section: %v\n", err)
+	}
+
+	dir, err := ioutil.TempDir("", "import")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err = contents.Import(dir, "other", bytes.NewReader(dump.Bytes())); !errors.Is(err, contents.ErrInvalidDump) {
+		t.Errorf("Got %v importing into another section, want %v\n", err, contents.ErrInvalidDump)
+	}
+	n, err := contents.Import(dir, testSection, bytes.NewReader(dump.Bytes()))
+	if err != nil {
+		t.Fatalf("Could not import section: %v\n", err)
+	}
+	if n == 0 {
+		t.Errorf("Got no key/value pairs imported\n")
+	}
+	if _, err = contents.Import(dir, testSection, bytes.NewReader(dump.Bytes())); err == nil {
+		t.Errorf("Got no error importing over an existing database\n")
+	}
+
+	imported, err := contents.New(dir, testSection, "My life", new(fakeUsers), dbmodel.QAThresholds{})
+	if err != nil {
+		t.Fatalf("Could not open imported section: %v\n", err)
+	}
+	defer imported.Close()
+	content, err := imported.GetThreadContent(thread)
+	if err != nil {
+		t.Fatalf("Could not get imported thread: %v\n", err)
+	}
+	if content.Title != "Exported thread" {
+		t.Errorf("Got thread %q, want %q\n", content.Title, "Exported thread")
+	}
+	comments, err := imported.GetCommentsOverview(thread, nil)
+	if err != nil {
+		t.Fatalf("Could not get imported comments: %v\n", err)
+	}
+	if len(comments) != 1 {
+		t.Errorf("Got %d imported comments, want 1\n", len(comments))
+	}
+	res, err := imported.Search(dbmodel.SearchQuery{Text: "exported", Limit: 10})
+	if err != nil {
+		t.Fatalf("Could not search: %v\n", err)
+	}
+	if res.Total != 1 {
+		t.Errorf("Got %d hits in the imported search index, want 1\n", res.Total)
+	}
+
+	// Both dumps are equal but for their headers, which hold the time of
+	// the export.
+	var again bytes.Buffer
+	if err = imported.Export(&again); err != nil {
+		t.Fatalf("Could not export imported section: %v\n", err)
+	}
+	body := func(b []byte) []byte {
+		return b[bytes.IndexByte(b, '\n')+1:]
+	}
+	if !bytes.Equal(body(dump.Bytes()), body(again.Bytes())) {
+		t.Errorf("Got a different dump of the imported section\n")
+	}
+}
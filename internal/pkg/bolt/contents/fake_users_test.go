@@ -0,0 +1,341 @@
+package contents_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/bolt/contents"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	pbUsers "github.com/luisguve/cheroproto-go/userapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testSection is the id of the section of the handlers built by newHandler.
+const testSection = "mylife"
+
+// fakeUsers is a users service that records the operations delivered to it
+// by the outbox of a section, in order, and applies them to the recent
+// activity and the saved threads of the users in the section. While fail is
+// set, every delivery returns it instead. Users in missing do not exist.
+type fakeUsers struct {
+	pbUsers.CrudUsersClient
+	mu       sync.Mutex
+	calls    []string
+	notifs   []*pbApi.NotifyUser
+	fail     error
+	missing  map[string]bool
+	activity map[string]*pbDataFormat.Activity
+	saved    map[string][]string
+}
+
+// deliver records an operation of the given kind, unless deliveries fail.
+func (f *fakeUsers) deliver(kind string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail != nil {
+		return f.fail
+	}
+	f.calls = append(f.calls, kind)
+	return nil
+}
+
+// apply records an operation of the given kind, unless deliveries fail, and
+// then calls update on the recent activity of the given user.
+func (f *fakeUsers) apply(kind, userId string, update func(a *pbDataFormat.Activity)) error {
+	if err := f.deliver(kind); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.activity == nil {
+		f.activity = make(map[string]*pbDataFormat.Activity)
+	}
+	if f.activity[userId] == nil {
+		f.activity[userId] = new(pbDataFormat.Activity)
+	}
+	update(f.activity[userId])
+	return nil
+}
+
+// setSaved records an operation of the given kind, unless deliveries fail, and
+// adds the given thread to the saved threads of the given user, or removes it
+// if add is false.
+func (f *fakeUsers) setSaved(kind, userId string, thread *pbContext.Thread, add bool) error {
+	if err := f.deliver(kind); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.saved == nil {
+		f.saved = make(map[string][]string)
+	}
+	var ids []string
+	for _, id := range f.saved[userId] {
+		if id != thread.Id {
+			ids = append(ids, id)
+		}
+	}
+	if add {
+		ids = append(ids, thread.Id)
+	}
+	f.saved[userId] = ids
+	return nil
+}
+
+// setMissing makes the given user not exist.
+func (f *fakeUsers) setMissing(userId string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.missing == nil {
+		f.missing = make(map[string]bool)
+	}
+	f.missing[userId] = true
+}
+
+// dropThread, dropComment and dropSubcomment return the given list of
+// references without the given one.
+func dropThread(threads []*pbContext.Thread, t *pbContext.Thread) []*pbContext.Thread {
+	var rest []*pbContext.Thread
+	for _, thread := range threads {
+		if thread.Id != t.Id {
+			rest = append(rest, thread)
+		}
+	}
+	return rest
+}
+
+func dropComment(comments []*pbContext.Comment, c *pbContext.Comment) []*pbContext.Comment {
+	var rest []*pbContext.Comment
+	for _, comment := range comments {
+		if (comment.Id != c.Id) || (comment.ThreadCtx.Id != c.ThreadCtx.Id) {
+			rest = append(rest, comment)
+		}
+	}
+	return rest
+}
+
+func dropSubcomment(subcomments []*pbContext.Subcomment, sc *pbContext.Subcomment) []*pbContext.Subcomment {
+	var rest []*pbContext.Subcomment
+	for _, subcomment := range subcomments {
+		if (subcomment.Id != sc.Id) || (subcomment.CommentCtx.Id != sc.CommentCtx.Id) ||
+			(subcomment.CommentCtx.ThreadCtx.Id != sc.CommentCtx.ThreadCtx.Id) {
+			rest = append(rest, subcomment)
+		}
+	}
+	return rest
+}
+
+// setFail makes every delivery return err, or succeed again if it's nil.
+func (f *fakeUsers) setFail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = err
+}
+
+// delivered returns the kinds of the operations delivered so far.
+func (f *fakeUsers) delivered() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// waitDelivered waits for n operations to be delivered and returns their
+// kinds. It fails the test if they are not delivered within 10 seconds.
+func (f *fakeUsers) waitDelivered(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		calls := f.delivered()
+		if len(calls) >= n {
+			return calls
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Got %d operations delivered, want %d: %v\n", len(calls), n, calls)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func (f *fakeUsers) GetUserHeaderData(ctx context.Context, in *pbUsers.GetBasicUserDataRequest, opts ...grpc.CallOption) (*pbUsers.UserHeaderData, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.missing[in.UserId] {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return &pbUsers.UserHeaderData{}, nil
+}
+
+func (f *fakeUsers) RecentActivity(ctx context.Context, in *pbUsers.RecentActivityRequest, opts ...grpc.CallOption) (*pbUsers.RecentActivityResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := &pbUsers.RecentActivityResponse{
+		References: make(map[string]*pbDataFormat.Activity),
+	}
+	activity := new(pbDataFormat.Activity)
+	for _, userId := range in.Users {
+		if a := f.activity[userId]; a != nil {
+			activity.ThreadsCreated = append(activity.ThreadsCreated, a.ThreadsCreated...)
+			activity.Comments = append(activity.Comments, a.Comments...)
+			activity.Subcomments = append(activity.Subcomments, a.Subcomments...)
+		}
+	}
+	res.References[testSection] = activity
+	return res, nil
+}
+
+func (f *fakeUsers) SavedThreads(ctx context.Context, in *pbUsers.SavedThreadsRequest, opts ...grpc.CallOption) (*pbUsers.SavedThreadsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &pbUsers.SavedThreadsResponse{
+		References: map[string]*pbApi.IdList{
+			testSection: {Ids: append([]string(nil), f.saved[in.UserId]...)},
+		},
+	}, nil
+}
+
+func (f *fakeUsers) GetBasicUserData(ctx context.Context, in *pbUsers.GetBasicUserDataRequest, opts ...grpc.CallOption) (*pbDataFormat.BasicUserData, error) {
+	return &pbDataFormat.BasicUserData{Username: in.UserId}, nil
+}
+
+func (f *fakeUsers) CreateThread(ctx context.Context, in *pbUsers.CreateThreadRequest, opts ...grpc.CallOption) (*pbUsers.CreateThreadResponse, error) {
+	return &pbUsers.CreateThreadResponse{}, f.apply("CreateThread", in.UserId, func(a *pbDataFormat.Activity) {
+		a.ThreadsCreated = append(a.ThreadsCreated, in.Ctx)
+	})
+}
+
+func (f *fakeUsers) Comment(ctx context.Context, in *pbUsers.CommentRequest, opts ...grpc.CallOption) (*pbUsers.CommentResponse, error) {
+	return &pbUsers.CommentResponse{}, f.apply("Comment", in.UserId, func(a *pbDataFormat.Activity) {
+		a.Comments = append(a.Comments, in.Ctx)
+	})
+}
+
+func (f *fakeUsers) Subcomment(ctx context.Context, in *pbUsers.SubcommentRequest, opts ...grpc.CallOption) (*pbUsers.SubcommentResponse, error) {
+	return &pbUsers.SubcommentResponse{}, f.apply("Subcomment", in.UserId, func(a *pbDataFormat.Activity) {
+		a.Subcomments = append(a.Subcomments, in.Ctx)
+	})
+}
+
+func (f *fakeUsers) SaveThread(ctx context.Context, in *pbUsers.SaveThreadRequest, opts ...grpc.CallOption) (*pbUsers.SaveThreadResponse, error) {
+	return &pbUsers.SaveThreadResponse{}, f.setSaved("SaveThread", in.UserId, in.Thread, true)
+}
+
+func (f *fakeUsers) RemoveSaved(ctx context.Context, in *pbUsers.RemoveSavedRequest, opts ...grpc.CallOption) (*pbUsers.RemoveSavedResponse, error) {
+	return &pbUsers.RemoveSavedResponse{}, f.setSaved("RemoveSaved", in.UserId, in.Ctx, false)
+}
+
+func (f *fakeUsers) DeleteThread(ctx context.Context, in *pbUsers.DeleteThreadRequest, opts ...grpc.CallOption) (*pbUsers.DeleteThreadResponse, error) {
+	return &pbUsers.DeleteThreadResponse{}, f.apply("DeleteThread", in.UserId, func(a *pbDataFormat.Activity) {
+		a.ThreadsCreated = dropThread(a.ThreadsCreated, in.Ctx)
+	})
+}
+
+func (f *fakeUsers) DeleteComment(ctx context.Context, in *pbUsers.DeleteCommentRequest, opts ...grpc.CallOption) (*pbUsers.DeleteCommentResponse, error) {
+	return &pbUsers.DeleteCommentResponse{}, f.apply("DeleteComment", in.UserId, func(a *pbDataFormat.Activity) {
+		a.Comments = dropComment(a.Comments, in.Ctx)
+	})
+}
+
+func (f *fakeUsers) DeleteSubcomment(ctx context.Context, in *pbUsers.DeleteSubcommentRequest, opts ...grpc.CallOption) (*pbUsers.DeleteSubcommentResponse, error) {
+	return &pbUsers.DeleteSubcommentResponse{}, f.apply("DeleteSubcomment", in.UserId, func(a *pbDataFormat.Activity) {
+		a.Subcomments = dropSubcomment(a.Subcomments, in.Ctx)
+	})
+}
+
+func (f *fakeUsers) OldThread(ctx context.Context, in *pbUsers.OldThreadRequest, opts ...grpc.CallOption) (*pbUsers.OldThreadResponse, error) {
+	return &pbUsers.OldThreadResponse{}, f.apply("OldThread", in.UserId, func(a *pbDataFormat.Activity) {
+		a.ThreadsCreated = dropThread(a.ThreadsCreated, in.Ctx)
+	})
+}
+
+func (f *fakeUsers) OldComment(ctx context.Context, in *pbUsers.OldCommentRequest, opts ...grpc.CallOption) (*pbUsers.OldCommentResponse, error) {
+	return &pbUsers.OldCommentResponse{}, f.apply("OldComment", in.UserId, func(a *pbDataFormat.Activity) {
+		a.Comments = dropComment(a.Comments, in.Ctx)
+	})
+}
+
+func (f *fakeUsers) OldSubcomment(ctx context.Context, in *pbUsers.OldSubcommentRequest, opts ...grpc.CallOption) (*pbUsers.OldSubcommentResponse, error) {
+	return &pbUsers.OldSubcommentResponse{}, f.apply("OldSubcomment", in.UserId, func(a *pbDataFormat.Activity) {
+		a.Subcomments = dropSubcomment(a.Subcomments, in.Ctx)
+	})
+}
+
+func (f *fakeUsers) SaveNotif(ctx context.Context, in *pbApi.NotifyUser, opts ...grpc.CallOption) (*pbUsers.SaveNotifResponse, error) {
+	if err := f.deliver("SaveNotif"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notifs = append(f.notifs, in)
+	return &pbUsers.SaveNotifResponse{}, nil
+}
+
+// newHandler opens a section database in a temporary directory with a fake
+// users service. The returned function closes the handler and removes the
+// directory.
+func newHandler(t *testing.T, qaThresholds dbmodel.QAThresholds) (dbmodel.Handler, *fakeUsers, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "contents")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v\n", err)
+	}
+	users := new(fakeUsers)
+	h, err := contents.New(dir, testSection, "My life", users, qaThresholds)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Could not open section: %v\n", err)
+	}
+	return h, users, func() {
+		h.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// newThread creates a thread with the given title by the given author and
+// returns its context.
+func newThread(t *testing.T, h dbmodel.Handler, title, author string) *pbContext.Thread {
+	t.Helper()
+	content := &pbApi.Content{
+		Title:       title,
+		Content:     "Content of " + title,
+		FtFile:      "file.png",
+		PublishDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+	}
+	permalink, err := h.CreateThread(content, author, dbmodel.NewThread{})
+	if err != nil {
+		t.Fatalf("Could not create thread %q: %v\n", title, err)
+	}
+	return &pbContext.Thread{
+		Id:         path.Base(permalink),
+		SectionCtx: &pbContext.Section{Id: testSection},
+	}
+}
+
+// newComment replies the given thread on behalf of the given user and returns
+// the context of the comment, given the number of comments the thread had.
+func newComment(t *testing.T, h dbmodel.Handler, thread *pbContext.Thread, n int, author string) *pbContext.Comment {
+	t.Helper()
+	reply := dbmodel.Reply{
+		Content:     "A comment",
+		Submitter:   author,
+		PublishDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+	}
+	if _, err := h.ReplyThread(thread, reply); err != nil {
+		t.Fatalf("Could not reply thread %s: %v\n", thread.Id, err)
+	}
+	return &pbContext.Comment{
+		Id:        strconv.Itoa(n + 1),
+		ThreadCtx: thread,
+	}
+}
@@ -0,0 +1,538 @@
+package contents
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	pbUsers "github.com/luisguve/cheroproto-go/userapi"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// indexedContent is a thread, comment or subcomment found in the section
+// database while checking references. Only one of thread, comment or
+// subcomment is set.
+type indexedContent struct {
+	path          []string // Path of the bucket holding the content.
+	id            string
+	status        string // active, archived or deleted.
+	authorId      string
+	publishDate   *pbTime.Timestamp
+	usersWhoSaved []string
+	// Users who saved, upvoted or replied to the content.
+	others []string
+	// Whether the content is a comment or subcomment of a deleted thread. The
+	// references to such contents are kept until the thread is purged, so
+	// they're neither required nor dangling.
+	detached   bool
+	thread     *pbContext.Thread
+	comment    *pbContext.Comment
+	subcomment *pbContext.Subcomment
+}
+
+// localFix holds the changes to be made to a content of the section database.
+type localFix struct {
+	path    []string
+	id      string
+	missing map[string]bool // Users to remove from the lists of users.
+	savers  []string        // Users to add to the list of users who saved it.
+}
+
+// missingRef is a reference to an existing content that is missing from the
+// recent activity or from the list of saved threads of a user. Only one of
+// thread, comment or subcomment is set.
+type missingRef struct {
+	userId      string
+	thread      *pbContext.Thread
+	comment     *pbContext.Comment
+	subcomment  *pbContext.Subcomment
+	publishDate *pbTime.Timestamp // Publish date of thread.
+	saved       bool              // Whether thread is missing from saved threads.
+}
+
+// addRef enqueues the operation to add the given reference to the user in the
+// outbox.
+func (h *handler) addRef(tx *bolt.Tx, r missingRef) error {
+	switch {
+	case r.saved:
+		req := &pbUsers.SaveThreadRequest{
+			UserId: r.userId,
+			Thread: r.thread,
+		}
+		return h.enqueue(tx, opSaveThread, r.userId, req)
+	case r.thread != nil:
+		// The users service keeps the last time the author created a thread
+		// if it's after the publish date.
+		req := &pbUsers.CreateThreadRequest{
+			UserId:      r.userId,
+			Ctx:         r.thread,
+			PublishDate: r.publishDate,
+		}
+		return h.enqueue(tx, opCreateThread, r.userId, req)
+	case r.comment != nil:
+		req := &pbUsers.CommentRequest{
+			UserId: r.userId,
+			Ctx:    r.comment,
+		}
+		return h.enqueue(tx, opComment, r.userId, req)
+	case r.subcomment != nil:
+		req := &pbUsers.SubcommentRequest{
+			UserId: r.userId,
+			Ctx:    r.subcomment,
+		}
+		return h.enqueue(tx, opSubcomment, r.userId, req)
+	}
+	return nil
+}
+
+// markAsOld enqueues the operation to move the given reference from the recent
+// activity to the old activity of the user in the outbox.
+func (h *handler) markAsOld(tx *bolt.Tx, r staleRef) error {
+	switch {
+	case r.thread != nil:
+		return h.markThreadAsOld(tx, r.userId, r.thread)
+	case r.comment != nil:
+		return h.markCommentAsOld(tx, r.userId, r.comment)
+	case r.subcomment != nil:
+		return h.markSubcommentAsOld(tx, r.userId, r.subcomment)
+	}
+	return nil
+}
+
+// bucketIn returns the bucket with the given path, or nil if it does not exist.
+func bucketIn(tx *bolt.Tx, path []string) *bolt.Bucket {
+	if len(path) == 0 {
+		return nil
+	}
+	b := tx.Bucket([]byte(path[0]))
+	for _, name := range path[1:] {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket([]byte(name))
+	}
+	return b
+}
+
+// indexBucket adds the threads, comments and subcomments in the bucket with the
+// given path and in its nested buckets to contents, keyed by their revision
+// keys.
+func indexBucket(b *bolt.Bucket, path []string, section *pbContext.Section,
+	contents map[string]*indexedContent) error {
+	kind, status := classify(path)
+	var nested []string
+	err := b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			nested = append(nested, string(k))
+			return nil
+		}
+		var (
+			c   = &indexedContent{path: path, id: string(k), status: status}
+			key string
+		)
+		switch kind {
+		case threadKind:
+			c.thread = &pbContext.Thread{
+				Id:         string(k),
+				SectionCtx: section,
+			}
+			key = threadKey(c.id)
+		case commentKind:
+			c.comment = &pbContext.Comment{
+				Id: string(k),
+				ThreadCtx: &pbContext.Thread{
+					Id:         path[2],
+					SectionCtx: section,
+				},
+			}
+			key = commentKey(path[2], c.id)
+		case subcommentKind:
+			c.subcomment = &pbContext.Subcomment{
+				Id: string(k),
+				CommentCtx: &pbContext.Comment{
+					Id: path[4],
+					ThreadCtx: &pbContext.Thread{
+						Id:         path[2],
+						SectionCtx: section,
+					},
+				},
+			}
+			key = subcommentKey(path[2], path[4], c.id)
+		default:
+			return nil
+		}
+		pbContent := new(pbDataFormat.Content)
+		if err := proto.Unmarshal(v, pbContent); err != nil {
+			log.Printf("Could not unmarshal content %s: %v\n", key, err)
+			return err
+		}
+		c.authorId = pbContent.AuthorId
+		c.publishDate = pbContent.PublishDate
+		c.usersWhoSaved = pbContent.UsersWhoSaved
+		c.others = append(c.others, pbContent.UsersWhoSaved...)
+		c.others = append(c.others, pbContent.VoterIds...)
+		c.others = append(c.others, pbContent.ReplierIds...)
+		contents[key] = c
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range nested {
+		nestedPath := append(append([]string{}, path...), name)
+		err = indexBucket(b.Bucket([]byte(name)), nestedPath, section, contents)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeUsers returns the given list of users without the missing ones and the
+// number of users removed.
+func removeUsers(users []string, missing map[string]bool) ([]string, int) {
+	var kept []string
+	for _, userId := range users {
+		if !missing[userId] {
+			kept = append(kept, userId)
+		}
+	}
+	return kept, len(users) - len(kept)
+}
+
+// Fsck checks the references between the section database and the users
+// service, since several write paths update both sides non-atomically:
+// + Every user referenced by a content as its author or in its lists of users
+//   who saved, upvoted or replied to it must exist.
+// + Every active content must be in the recent activity of its author, and the
+//   recent activity of a user must only reference active contents authored by
+//   the user. Archived contents must be in the old activity instead.
+// + Every user in the list of users who saved a thread must have the thread in
+//   its list of saved threads, and vice versa.
+//
+// Comments and subcomments of deleted threads are skipped, since the references
+// to them are kept until the thread is purged.
+//
+// The users service can only be asked for the users referenced by contents of
+// this section and it does not expose the old activity of users, so references
+// held by other users and references in the old activity are not checked.
+//
+// The operations in the outbox are delivered before checking, since they would
+// show up as issues otherwise. It returns an ErrOutboxNotEmpty if some of them
+// could not be delivered.
+//
+// If repair is true, it fixes the issues found: missing users are removed from
+// the lists of users of the contents, and the operations to add the missing
+// references to the users and to drop the dangling references from them are
+// enqueued in the outbox in the same transaction, and then delivered. Contents
+// whose author does not exist are only reported. Otherwise, it only reports the
+// issues.
+//
+// It returns the result of the check in a string and an error.
+func (h *handler) Fsck(repair bool) (string, error) {
+	var (
+		summary  string
+		issues   int
+		now      = time.Now()
+		contents = make(map[string]*indexedContent)
+		section  = &pbContext.Section{
+			Id: h.section.id,
+		}
+	)
+	summary = fmt.Sprintf("[%v] Checking references (section %s).\n", now.Format(time.Stamp), h.section.name)
+
+	// Operations still in the outbox would be reported as missing or dangling
+	// references.
+	pending, err := h.flushOutbox()
+	if err != nil {
+		return summary, err
+	}
+	if pending > 0 {
+		summary += fmt.Sprintf("Could not deliver %d operations in the outbox.\n", pending)
+		return summary, ErrOutboxNotEmpty
+	}
+
+	err = h.section.contents.View(func(tx *bolt.Tx) error {
+		for _, name := range []string{activeContentsB, archivedContentsB} {
+			b := tx.Bucket([]byte(name))
+			if b == nil {
+				log.Printf("Could not find bucket %s\n", name)
+				return dbmodel.ErrBucketNotFound
+			}
+			if err := indexBucket(b, []string{name}, section, contents); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return summary, err
+	}
+
+	// Sort the keys and the users referenced by contents, so the report is
+	// always in the same order.
+	var (
+		keys       []string
+		userIds    []string
+		referenced = make(map[string]bool)
+	)
+	for key, c := range contents {
+		keys = append(keys, key)
+		if c.comment != nil || c.subcomment != nil {
+			var threadId string
+			if c.comment != nil {
+				threadId = c.comment.ThreadCtx.Id
+			} else {
+				threadId = c.subcomment.CommentCtx.ThreadCtx.Id
+			}
+			thread, ok := contents[threadKey(threadId)]
+			c.detached = !ok || (thread.status == "deleted")
+		}
+		for _, userId := range append([]string{c.authorId}, c.others...) {
+			if (userId != "") && !referenced[userId] {
+				referenced[userId] = true
+				userIds = append(userIds, userId)
+			}
+		}
+	}
+	sort.Strings(keys)
+	sort.Strings(userIds)
+	summary += fmt.Sprintf("Found %d contents referencing %d users.\n", len(contents), len(userIds))
+
+	var (
+		fixes   = make(map[string]*localFix)
+		drops   []staleRef
+		olds    []staleRef
+		adds    []missingRef
+		missing = make(map[string]bool)
+		// Keys of the contents in the recent activity of their authors.
+		inActivity = make(map[string]bool)
+		// Keys of the threads in the list of saved threads of each user.
+		saved = make(map[string]map[string]bool)
+	)
+	report := func(format string, a ...interface{}) {
+		issues++
+		summary += fmt.Sprintf(format, a...)
+	}
+	fix := func(c *indexedContent) *localFix {
+		key := fmt.Sprintf("%v/%s", c.path, c.id)
+		f, ok := fixes[key]
+		if !ok {
+			f = &localFix{
+				path:    c.path,
+				id:      c.id,
+				missing: make(map[string]bool),
+			}
+			fixes[key] = f
+		}
+		return f
+	}
+	// check looks for the content referenced by ref in the recent activity of
+	// the user.
+	check := func(key string, ref staleRef) {
+		c, ok := contents[key]
+		switch {
+		case ok && c.detached:
+		case !ok || (c.status == "deleted") || (c.authorId != ref.userId):
+			report("Recent activity of user %s references %s, which does not exist.\n", ref.userId, key)
+			drops = append(drops, ref)
+		case c.status == "archived":
+			report("Recent activity of user %s references %s, which is archived.\n", ref.userId, key)
+			olds = append(olds, ref)
+		default:
+			inActivity[key] = true
+		}
+	}
+
+	summary += fmt.Sprintln("-----------------------------------------------------")
+	for _, userId := range userIds {
+		reqUser := &pbUsers.GetBasicUserDataRequest{UserId: userId}
+		_, err = h.users.GetUserHeaderData(context.Background(), reqUser)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				missing[userId] = true
+				continue
+			}
+			return summary, err
+		}
+		reqActivity := &pbUsers.RecentActivityRequest{Users: []string{userId}}
+		resActivity, err := h.users.RecentActivity(context.Background(), reqActivity)
+		if err != nil {
+			return summary, err
+		}
+		var activity *pbDataFormat.Activity
+		if resActivity != nil {
+			activity = resActivity.References[h.section.id]
+		}
+		if activity != nil {
+			for _, thread := range activity.ThreadsCreated {
+				check(threadKey(thread.Id), staleRef{userId: userId, thread: thread})
+			}
+			for _, comment := range activity.Comments {
+				key := commentKey(comment.ThreadCtx.Id, comment.Id)
+				check(key, staleRef{userId: userId, comment: comment})
+			}
+			for _, subcomment := range activity.Subcomments {
+				commentCtx := subcomment.CommentCtx
+				key := subcommentKey(commentCtx.ThreadCtx.Id, commentCtx.Id, subcomment.Id)
+				check(key, staleRef{userId: userId, subcomment: subcomment})
+			}
+		}
+		reqSaved := &pbUsers.SavedThreadsRequest{UserId: userId}
+		resSaved, err := h.users.SavedThreads(context.Background(), reqSaved)
+		if err != nil {
+			return summary, err
+		}
+		saved[userId] = make(map[string]bool)
+		var savedIds []string
+		if idList := resSaved.References[h.section.id]; idList != nil {
+			savedIds = idList.Ids
+		}
+		for _, id := range savedIds {
+			key := threadKey(id)
+			c, ok := contents[key]
+			if !ok || (c.thread == nil) || (c.status == "deleted") {
+				report("Saved threads of user %s reference %s, which does not exist.\n", userId, key)
+				thread := &pbContext.Thread{
+					Id:         id,
+					SectionCtx: section,
+				}
+				drops = append(drops, staleRef{userId: userId, thread: thread, saved: true})
+				continue
+			}
+			saved[userId][key] = true
+			if ok, _ := inSlice(c.usersWhoSaved, userId); !ok {
+				report("User %s saved %s, but it's not in its list of users who saved it.\n", userId, key)
+				f := fix(c)
+				f.savers = append(f.savers, userId)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		c := contents[key]
+		if missing[c.authorId] {
+			report("Author %s of %s does not exist.\n", c.authorId, key)
+		}
+		for _, userId := range c.others {
+			if missing[userId] {
+				report("User %s referenced by %s does not exist.\n", userId, key)
+				fix(c).missing[userId] = true
+			}
+		}
+		if c.detached || (c.status != "active") || missing[c.authorId] {
+			continue
+		}
+		if !inActivity[key] {
+			report("%s is not in the recent activity of its author %s.\n", key, c.authorId)
+			adds = append(adds, missingRef{
+				userId:      c.authorId,
+				thread:      c.thread,
+				comment:     c.comment,
+				subcomment:  c.subcomment,
+				publishDate: c.publishDate,
+			})
+		}
+		if c.thread == nil {
+			continue
+		}
+		for _, userId := range c.usersWhoSaved {
+			if !missing[userId] && !saved[userId][key] {
+				report("%s is not in the saved threads of user %s.\n", key, userId)
+				adds = append(adds, missingRef{userId: userId, thread: c.thread, saved: true})
+			}
+		}
+	}
+
+	summary += fmt.Sprintln("-----------------------------------------------------")
+	if issues == 0 {
+		summary += "No issues found.\n"
+		return summary, nil
+	}
+	if !repair {
+		summary += fmt.Sprintf("Found %d issues. Nothing was repaired.\n", issues)
+		return summary, nil
+	}
+	summary += fmt.Sprintf("Found %d issues. Repairing...\n", issues)
+
+	// Fix the contents and enqueue the fixes of the users in the same
+	// transaction.
+	err = h.section.contents.Update(func(tx *bolt.Tx) error {
+		for _, f := range fixes {
+			b := bucketIn(tx, f.path)
+			if b == nil {
+				continue
+			}
+			contentBytes := b.Get([]byte(f.id))
+			if contentBytes == nil {
+				// It was deleted since it was checked.
+				continue
+			}
+			pbContent := new(pbDataFormat.Content)
+			if err := proto.Unmarshal(contentBytes, pbContent); err != nil {
+				log.Printf("Could not unmarshal content: %v\n", err)
+				return err
+			}
+			var removed int
+			pbContent.UsersWhoSaved, _ = removeUsers(pbContent.UsersWhoSaved, f.missing)
+			pbContent.VoterIds, removed = removeUsers(pbContent.VoterIds, f.missing)
+			if int(pbContent.Upvotes) >= removed {
+				pbContent.Upvotes -= uint32(removed)
+			} else {
+				pbContent.Upvotes = 0
+			}
+			pbContent.ReplierIds, _ = removeUsers(pbContent.ReplierIds, f.missing)
+			for _, userId := range f.savers {
+				if ok, _ := inSlice(pbContent.UsersWhoSaved, userId); !ok {
+					pbContent.UsersWhoSaved = append(pbContent.UsersWhoSaved, userId)
+				}
+			}
+			contentBytes, err := proto.Marshal(pbContent)
+			if err != nil {
+				log.Printf("Could not marshal content: %v\n", err)
+				return err
+			}
+			if err = b.Put([]byte(f.id), contentBytes); err != nil {
+				return err
+			}
+		}
+		if err := h.dropRefs(tx, drops); err != nil {
+			return err
+		}
+		for _, ref := range olds {
+			if err := h.markAsOld(tx, ref); err != nil {
+				return err
+			}
+		}
+		for _, ref := range adds {
+			if err := h.addRef(tx, ref); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		summary += fmt.Sprintf("Could not repair: %v\n", err)
+		return summary, err
+	}
+	summary += fmt.Sprintf("Repaired %d contents.\n", len(fixes))
+
+	pending, err = h.flushOutbox()
+	if err != nil {
+		return summary, err
+	}
+	summary += fmt.Sprintf("Repaired %d references of users.\n", len(drops)+len(olds)+len(adds)-pending)
+	if pending > 0 {
+		summary += fmt.Sprintf("%d operations are still pending in the outbox.\n", pending)
+	}
+	return summary, nil
+}
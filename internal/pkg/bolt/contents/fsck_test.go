@@ -0,0 +1,121 @@
+package contents_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/bolt/contents"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbUsers "github.com/luisguve/cheroproto-go/userapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fsck runs Fsck and fails the test if the summary does not contain want.
+func fsck(t *testing.T, h dbmodel.Handler, repair bool, want string) {
+	t.Helper()
+	summary, err := h.Fsck(repair)
+	if err != nil {
+		t.Fatalf("Could not run fsck: %v\n", err)
+	}
+	if !strings.Contains(summary, want) {
+		t.Errorf("Got summary %q, want it to contain %q\n", summary, want)
+	}
+}
+
+func TestFsckClean(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Clean thread", "author")
+	newComment(t, h, thread, 0, "replier")
+	if err := h.AppendUserWhoSaved(thread, "saver"); err != nil {
+		t.Fatalf("Could not save thread: %v\n", err)
+	}
+	fsck(t, h, false, "No issues found.")
+}
+
+// References in the recent activity of a user to contents that do not exist
+// are dropped on repair.
+func TestFsckDanglingActivity(t *testing.T) {
+	h, users, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	newThread(t, h, "Existing thread", "author")
+	gone := &pbContext.Thread{
+		Id:         "gone",
+		SectionCtx: &pbContext.Section{Id: testSection},
+	}
+	req := &pbUsers.CreateThreadRequest{UserId: "author", Ctx: gone}
+	if _, err := users.CreateThread(context.Background(), req); err != nil {
+		t.Fatalf("Could not add reference: %v\n", err)
+	}
+
+	fsck(t, h, false, "Recent activity of user author references gone, which does not exist.")
+	fsck(t, h, false, "Found 1 issues. Nothing was repaired.")
+	fsck(t, h, true, "Repaired 1 references of users.")
+	fsck(t, h, false, "No issues found.")
+}
+
+// Threads missing from the saved threads of the users who saved them are added
+// back on repair.
+func TestFsckMissingSaved(t *testing.T) {
+	h, users, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Saved thread", "author")
+	if err := h.AppendUserWhoSaved(thread, "saver"); err != nil {
+		t.Fatalf("Could not save thread: %v\n", err)
+	}
+	users.waitDelivered(t, 2)
+	req := &pbUsers.RemoveSavedRequest{UserId: "saver", Ctx: thread}
+	if _, err := users.RemoveSaved(context.Background(), req); err != nil {
+		t.Fatalf("Could not remove reference: %v\n", err)
+	}
+
+	fsck(t, h, false, thread.Id+" is not in the saved threads of user saver.")
+	fsck(t, h, true, "Repaired 1 references of users.")
+	fsck(t, h, false, "No issues found.")
+}
+
+// Users that do not exist are removed from the lists of users of contents on
+// repair, along with their upvotes.
+func TestFsckMissingVoter(t *testing.T) {
+	h, users, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Upvoted thread", "author")
+	if _, err := h.UpvoteThread("ghost", thread); err != nil {
+		t.Fatalf("Could not upvote thread: %v\n", err)
+	}
+	users.setMissing("ghost")
+
+	fsck(t, h, false, "User ghost referenced by "+thread.Id+" does not exist.")
+	fsck(t, h, true, "Repaired 1 contents.")
+	content, err := h.GetThreadContent(thread)
+	if err != nil {
+		t.Fatalf("Could not get thread: %v\n", err)
+	}
+	if (len(content.VoterIds) != 0) || (content.Upvotes != 0) {
+		t.Errorf("Got voters %v and %d upvotes, want none\n", content.VoterIds, content.Upvotes)
+	}
+	fsck(t, h, false, "No issues found.")
+}
+
+// Fsck does not check references while operations are pending in the outbox.
+func TestFsckOutboxNotEmpty(t *testing.T) {
+	h, users, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	users.setFail(status.Error(codes.Unavailable, "users service down"))
+	newThread(t, h, "Thread while down", "author")
+	if _, err := h.Fsck(true); !errors.Is(err, contents.ErrOutboxNotEmpty) {
+		t.Errorf("Got %v checking with a pending operation, want %v\n", err, contents.ErrOutboxNotEmpty)
+	}
+
+	users.setFail(nil)
+	fsck(t, h, false, "No issues found.")
+}
@@ -17,15 +17,22 @@ import (
 // section is invalid and ErrBucketNotFound if the section doesn't have a bucket
 // for active contents or a bucket for archived contents, depending upon the
 // current status of the thread which the comments belongs to.
-func (h *handler) GetCommentsOverview(thread *pbContext.Thread) ([]patillator.SegregateDiscarderFinder, error) {
+//
+// Comments are set as patillator.ScoredContents, along with their net score.
+// Comments whose author hidden returns true for are left out; a nil hidden
+// leaves none out.
+func (h *handler) GetCommentsOverview(thread *pbContext.Thread, hidden dbmodel.HiddenFunc) ([]patillator.SegregateDiscarderFinder, error) {
 	var (
 		err       error
 		id        = thread.Id
 		contents  []patillator.SegregateDiscarderFinder
 	)
 
-	setContent := func(c *pbDataFormat.Content) patillator.SegregateDiscarderFinder {
-		return patillator.Content(*c.Metadata)
+	setContent := func(c *pbDataFormat.Content, downvotes int) patillator.SegregateDiscarderFinder {
+		return patillator.ScoredContent{
+			Content: patillator.Content(*c.Metadata),
+			Score:   int(c.Upvotes) - downvotes,
+		}
 	}
 
 	// query database
@@ -36,6 +43,11 @@ func (h *handler) GetCommentsOverview(thread *pbContext.Thread) ([]patillator.Se
 			return dbmodel.ErrNoComments
 		}
 
+		threadDownvotes, err := countThreadDownvotes(tx, id)
+		if err != nil {
+			return err
+		}
+
 		var (
 			c     = comments.Cursor()
 			m     sync.Mutex
@@ -50,19 +62,20 @@ func (h *handler) GetCommentsOverview(thread *pbContext.Thread) ([]patillator.Se
 			if v == nil {
 				continue
 			}
+			downvotes := threadDownvotes[commentKey(id, string(k))]
 			elems++
 			wg.Add(1)
 			// Do the unmarshaling, content setting and content appending in its
 			// own go-routine. Should it get an error and it will send it to the
 			// channel done, otherwise it will be sending nil to the same channel,
 			// meaning it could complete its work successfully.
-			go func(commentBytes []byte) {
+			go func(commentBytes []byte, downvotes int) {
 				defer wg.Done()
 				pbContent := new(pbDataFormat.Content)
 				if err := proto.Unmarshal(commentBytes, pbContent); err != nil {
 					log.Printf("Could not unmarshal content: %v\n", err)
-				} else {
-					content := setContent(pbContent)
+				} else if (hidden == nil) || !hidden(pbContent.AuthorId) {
+					content := setContent(pbContent, downvotes)
 					m.Lock()
 					contents = append(contents, content)
 					m.Unlock()
@@ -71,7 +84,7 @@ func (h *handler) GetCommentsOverview(thread *pbContext.Thread) ([]patillator.Se
 				case done <- err:
 				case <-quit: // exit in case of getting stuck on above statement.
 				}
-			}(v)
+			}(v, downvotes)
 		}
 		// Check for errors. It terminates every go-routine hung on the statement
 		// "case done<- err" by closing the channel quit and returns the first err
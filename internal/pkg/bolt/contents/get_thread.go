@@ -53,7 +53,11 @@ func (h *handler) GetThreadsOverview(ids []string, setSDF ...patillator.SetSDF)
 
 // Get metadata of all the active threads in the section. If setSDF is set, it is
 // used as the callback to set the metadata, otherwise a default one will be
-// used.
+// used. Threads it returns nil for are left out.
+//
+// Threads set as a patillator.Content or a patillator.GeneralContent are
+// returned as a patillator.ScoredContent or a patillator.ScoredGeneralContent,
+// along with their net score.
 func (h *handler) GetActiveThreadsOverview(setSDF ...patillator.SetSDF) ([]patillator.SegregateDiscarderFinder, error) {
 	var (
 		contents  []patillator.SegregateDiscarderFinder
@@ -77,6 +81,11 @@ func (h *handler) GetActiveThreadsOverview(setSDF ...patillator.SetSDF) ([]patil
 			log.Printf("bucket %s not found\n", activeContentsB)
 			return dbmodel.ErrBucketNotFound
 		}
+		downvotes := tx.Bucket([]byte(downvotesB))
+		if downvotes == nil {
+			log.Printf("Bucket %s not found\n", downvotesB)
+			return dbmodel.ErrBucketNotFound
+		}
 		var (
 			done  = make(chan error)
 			quit  = make(chan error)
@@ -91,28 +100,31 @@ func (h *handler) GetActiveThreadsOverview(setSDF ...patillator.SetSDF) ([]patil
 			if v == nil {
 				continue
 			}
+			downvotes := threadDownvotes(downvotes, string(k))
 			elems++
 			wg.Add(1)
 			// Do the unmarshaling, content setting and content appending in its
 			// own go-routine. Should it get an error and it will send it to the
 			// channel done, otherwise it will be sending nil to the same channel,
 			// meaning it could complete its work successfully.
-			go func(contentBytes []byte) {
+			go func(contentBytes []byte, downvotes int) {
 				defer wg.Done()
 				pbContent := new(pbDataFormat.Content)
 				if err := proto.Unmarshal(contentBytes, pbContent); err != nil {
 					log.Printf("Could not unmarshal content: %v\n", err)
 				} else {
-					content := setContent(pbContent)
-					m.Lock()
-					contents = append(contents, content)
-					m.Unlock()
+					if content := setContent(pbContent); content != nil {
+						content = scoreThread(content, int(pbContent.Upvotes)-downvotes)
+						m.Lock()
+						contents = append(contents, content)
+						m.Unlock()
+					}
 				}
 				select {
 				case done <- err:
 				case <-quit: // exit in case of getting stuck on above statement.
 				}
-			}(v)
+			}(v, downvotes)
 		}
 		// Check for errors. It terminates every go-routine hung on the statement
 		// "case done<- err" by closing the channel quit and returns the first err
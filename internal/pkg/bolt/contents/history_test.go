@@ -0,0 +1,54 @@
+package contents_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/bolt/contents"
+)
+
+// The last time a clean up was done and the QA history outlive the handler.
+func TestQARestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contents")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	open := func() dbmodel.Handler {
+		h, err := contents.New(dir, testSection, "My life", new(fakeUsers), dbmodel.QAThresholds{})
+		if err != nil {
+			t.Fatalf("Could not open section: %v\n", err)
+		}
+		return h
+	}
+	h := open()
+	created := h.LastQA()
+	// Clean ups are recorded by the second.
+	time.Sleep(time.Second)
+	if _, err = h.QA(); err != nil {
+		h.Close()
+		t.Fatalf("Could not run QA: %v\n", err)
+	}
+	lastQA := h.LastQA()
+	if lastQA <= created {
+		t.Errorf("Got last QA %d, want it later than the creation of the section at %d\n", lastQA, created)
+	}
+	h.Close()
+
+	h = open()
+	defer h.Close()
+	if got := h.LastQA(); got != lastQA {
+		t.Errorf("Got last QA %d after restarting, want %d\n", got, lastQA)
+	}
+	history, err := h.QAHistory(0)
+	if err != nil {
+		t.Fatalf("Could not get QA history: %v\n", err)
+	}
+	if (len(history) != 1) || (history[0].Started != lastQA) {
+		t.Errorf("Got QA history %+v after restarting, want one summary started at %d\n", history, lastQA)
+	}
+}
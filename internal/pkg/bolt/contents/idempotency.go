@@ -0,0 +1,193 @@
+package contents
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	bolt "go.etcd.io/bbolt"
+)
+
+// idempotencySweep is the maximum number of expired keys removed on every
+// claim.
+const idempotencySweep = 100
+
+// idempotentEntry is the state of an idempotency key. It's saved as JSON in the
+// bucket of idempotency keys, under the key itself.
+type idempotentEntry struct {
+	Created   int64    `json:"created"`
+	Done      bool     `json:"done,omitempty"`
+	Permalink string   `json:"permalink,omitempty"`
+	Notifs    [][]byte `json:"notifs,omitempty"` // Protobuf-encoded notifications.
+}
+
+// expiryKey returns the key of the given idempotency key in the bucket of
+// expiry times, which sorts keys by the time they were claimed.
+func expiryKey(created int64, key string) []byte {
+	return append(itob(uint64(created)), key...)
+}
+
+// idempotencyBuckets returns the bucket of idempotency keys and its bucket of
+// expiry times.
+func idempotencyBuckets(tx *bolt.Tx) (*bolt.Bucket, *bolt.Bucket, error) {
+	keys := tx.Bucket([]byte(idempotencyKeysB))
+	if keys == nil {
+		log.Printf("Bucket %s not found\n", idempotencyKeysB)
+		return nil, nil, dbmodel.ErrBucketNotFound
+	}
+	expiry := keys.Bucket([]byte(expiryB))
+	if expiry == nil {
+		log.Printf("Bucket %s not found\n", expiryB)
+		return nil, nil, dbmodel.ErrBucketNotFound
+	}
+	return keys, expiry, nil
+}
+
+// putEntry saves the given entry under key, along with its expiry time.
+func putEntry(keys, expiry *bolt.Bucket, key string, entry *idempotentEntry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err = keys.Put([]byte(key), entryBytes); err != nil {
+		return err
+	}
+	return expiry.Put(expiryKey(entry.Created, key), []byte{})
+}
+
+// sweepKeys removes up to idempotencySweep keys claimed before cutoff, oldest
+// first.
+func sweepKeys(keys, expiry *bolt.Bucket, cutoff time.Time) error {
+	var expired [][]byte
+	c := expiry.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if len(expired) == idempotencySweep {
+			break
+		}
+		created := int64(binary.BigEndian.Uint64(k[:8]))
+		if !time.Unix(created, 0).Before(cutoff) {
+			break
+		}
+		expired = append(expired, copyBytes(k))
+	}
+	for _, k := range expired {
+		if err := keys.Delete(k[8:]); err != nil {
+			return err
+		}
+		if err := expiry.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClaimIdempotencyKey claims the given idempotency key for a write operation,
+// so that requests with the same key do not write again. If a previous request
+// claimed the key and finished, it returns the result saved by that request.
+// If the previous request has not finished, it returns ErrRequestInProgress,
+// unless the key has been held for longer than pending, in which case the
+// request is assumed to be gone and the key is claimed again.
+//
+// Keys expire ttl after they were claimed. Every claim removes some of the
+// expired keys, so the bucket does not grow forever.
+func (h *handler) ClaimIdempotencyKey(key string, ttl, pending time.Duration) (*dbmodel.IdempotentResult, error) {
+	var res *dbmodel.IdempotentResult
+	err := h.section.contents.Update(func(tx *bolt.Tx) error {
+		keys, expiry, err := idempotencyBuckets(tx)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if err = sweepKeys(keys, expiry, now.Add(-ttl)); err != nil {
+			return err
+		}
+		if v := keys.Get([]byte(key)); v != nil {
+			entry := new(idempotentEntry)
+			if err = json.Unmarshal(v, entry); err != nil {
+				return err
+			}
+			if entry.Done {
+				res = &dbmodel.IdempotentResult{Permalink: entry.Permalink}
+				for _, notifBytes := range entry.Notifs {
+					notif := new(pbApi.NotifyUser)
+					if err = proto.Unmarshal(notifBytes, notif); err != nil {
+						log.Printf("Could not unmarshal notification: %v\n", err)
+						return err
+					}
+					res.Notifs = append(res.Notifs, notif)
+				}
+				return nil
+			}
+			if now.Sub(time.Unix(entry.Created, 0)) < pending {
+				return dbmodel.ErrRequestInProgress
+			}
+			if err = expiry.Delete(expiryKey(entry.Created, key)); err != nil {
+				return err
+			}
+		}
+		return putEntry(keys, expiry, key, &idempotentEntry{Created: now.Unix()})
+	})
+	return res, err
+}
+
+// SaveIdempotentResult saves the result of the write operation that claimed the
+// given idempotency key, so it's returned to the requests that claim it again.
+// It runs in its own transaction, after the one of the write operation.
+func (h *handler) SaveIdempotentResult(key string, r *dbmodel.IdempotentResult) error {
+	entry := &idempotentEntry{
+		Done:      true,
+		Permalink: r.Permalink,
+	}
+	for _, notif := range r.Notifs {
+		notifBytes, err := proto.Marshal(notif)
+		if err != nil {
+			log.Printf("Could not marshal notification: %v\n", err)
+			return err
+		}
+		entry.Notifs = append(entry.Notifs, notifBytes)
+	}
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		keys, expiry, err := idempotencyBuckets(tx)
+		if err != nil {
+			return err
+		}
+		// Keep the time the key was claimed; if it already expired, it
+		// starts over.
+		entry.Created = time.Now().Unix()
+		if v := keys.Get([]byte(key)); v != nil {
+			claimed := new(idempotentEntry)
+			if err = json.Unmarshal(v, claimed); err != nil {
+				return err
+			}
+			entry.Created = claimed.Created
+		}
+		return putEntry(keys, expiry, key, entry)
+	})
+}
+
+// ReleaseIdempotencyKey removes the given idempotency key, so the next request
+// with the same key writes again.
+func (h *handler) ReleaseIdempotencyKey(key string) error {
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		keys, expiry, err := idempotencyBuckets(tx)
+		if err != nil {
+			return err
+		}
+		v := keys.Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		entry := new(idempotentEntry)
+		if err = json.Unmarshal(v, entry); err != nil {
+			return err
+		}
+		if err = expiry.Delete(expiryKey(entry.Created, key)); err != nil {
+			return err
+		}
+		return keys.Delete([]byte(key))
+	})
+}
@@ -0,0 +1,77 @@
+package contents_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	const (
+		key = "Comment/user/1"
+		ttl = time.Hour
+	)
+	res, err := h.ClaimIdempotencyKey(key, ttl, time.Hour)
+	if err != nil {
+		t.Fatalf("Could not claim key: %v\n", err)
+	}
+	if res != nil {
+		t.Errorf("Got result %+v claiming a new key, want none\n", res)
+	}
+	// A replay while the first request is running is rejected.
+	if _, err = h.ClaimIdempotencyKey(key, ttl, time.Hour); !errors.Is(err, dbmodel.ErrRequestInProgress) {
+		t.Errorf("Got %v claiming a pending key, want %v\n", err, dbmodel.ErrRequestInProgress)
+	}
+
+	// After the result is saved, a replay gets it back.
+	saved := &dbmodel.IdempotentResult{
+		Permalink: "/mylife/thread",
+		Notifs:    []*pbApi.NotifyUser{{UserId: "author"}},
+	}
+	if err = h.SaveIdempotentResult(key, saved); err != nil {
+		t.Fatalf("Could not save result: %v\n", err)
+	}
+	res, err = h.ClaimIdempotencyKey(key, ttl, time.Hour)
+	if err != nil {
+		t.Fatalf("Could not claim key again: %v\n", err)
+	}
+	if (res == nil) || (res.Permalink != saved.Permalink) || (len(res.Notifs) != 1) ||
+		(res.Notifs[0].UserId != "author") {
+		t.Errorf("Got result %+v replaying, want %+v\n", res, saved)
+	}
+
+	// A released key can be claimed by the next request.
+	if err = h.ReleaseIdempotencyKey(key); err != nil {
+		t.Fatalf("Could not release key: %v\n", err)
+	}
+	if res, err = h.ClaimIdempotencyKey(key, ttl, time.Hour); (err != nil) || (res != nil) {
+		t.Errorf("Got result %+v and error %v claiming a released key, want neither\n", res, err)
+	}
+}
+
+// A key whose request never saved its result is claimed again once the
+// pending hold expires.
+func TestIdempotencyKeyPending(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	const key = "CreateThread/user/1"
+	if _, err := h.ClaimIdempotencyKey(key, time.Hour, time.Second); err != nil {
+		t.Fatalf("Could not claim key: %v\n", err)
+	}
+	if _, err := h.ClaimIdempotencyKey(key, time.Hour, time.Second); !errors.Is(err, dbmodel.ErrRequestInProgress) {
+		t.Errorf("Got %v claiming a pending key, want %v\n", err, dbmodel.ErrRequestInProgress)
+	}
+	// Keys are claimed by the second.
+	time.Sleep(2 * time.Second)
+	res, err := h.ClaimIdempotencyKey(key, time.Hour, time.Second)
+	if (err != nil) || (res != nil) {
+		t.Errorf("Got result %+v and error %v past the pending hold, want neither\n", res, err)
+	}
+}
@@ -0,0 +1,219 @@
+package contents
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	bolt "go.etcd.io/bbolt"
+)
+
+// lockedBucket returns the bucket of locked threads.
+func lockedBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	metadata := tx.Bucket([]byte(metadataB))
+	if metadata == nil {
+		log.Printf("Bucket %s not found\n", metadataB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	locked := metadata.Bucket([]byte(lockedB))
+	if locked == nil {
+		log.Printf("Bucket %s not found\n", lockedB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	return locked, nil
+}
+
+// isLocked returns whether the given thread is locked.
+func isLocked(tx *bolt.Tx, threadId string) (bool, error) {
+	locked, err := lockedBucket(tx)
+	if err != nil {
+		return false, err
+	}
+	return locked.Get([]byte(threadId)) != nil, nil
+}
+
+// dropLock unlocks the given thread, if it's locked. It's called when the
+// thread is gone for good; deleted threads keep locked, so they're still locked
+// if they're restored.
+func dropLock(tx *bolt.Tx, threadId string) error {
+	locked, err := lockedBucket(tx)
+	if err != nil {
+		return err
+	}
+	return locked.Delete([]byte(threadId))
+}
+
+// logModeration saves the given action in the moderation log, setting its id
+// and time.
+func logModeration(tx *bolt.Tx, action *dbmodel.ModerationAction) error {
+	modLog := tx.Bucket([]byte(moderationLogB))
+	if modLog == nil {
+		log.Printf("Bucket %s not found\n", moderationLogB)
+		return dbmodel.ErrBucketNotFound
+	}
+	action.Id, _ = modLog.NextSequence()
+	action.Time = time.Now().Unix()
+	actionBytes, err := json.Marshal(action)
+	if err != nil {
+		log.Printf("Could not marshal moderation action: %v\n", err)
+		return err
+	}
+	return modLog.Put(itob(action.Id), actionBytes)
+}
+
+// setLock locks or unlocks the given thread, depending upon lock, on behalf of
+// the submitter of l, records it in the moderation log and returns the thread.
+func setLock(tx *bolt.Tx, threadId string, l dbmodel.Lock, lock bool) (*pbDataFormat.Content, error) {
+	threadBytes, err := getThreadBytes(tx, threadId)
+	if err != nil {
+		return nil, err
+	}
+	pbThread := new(pbDataFormat.Content)
+	if err = proto.Unmarshal(threadBytes, pbThread); err != nil {
+		log.Printf("Could not unmarshal content: %v\n", err)
+		return nil, err
+	}
+	if !l.Moderator && (pbThread.AuthorId != l.Submitter) {
+		return nil, dbmodel.ErrUserNotAllowed
+	}
+	locked, err := lockedBucket(tx)
+	if err != nil {
+		return nil, err
+	}
+	action := &dbmodel.ModerationAction{
+		ThreadId: threadId,
+		UserId:   l.Submitter,
+		Reason:   l.Reason,
+	}
+	if lock {
+		if locked.Get([]byte(threadId)) != nil {
+			return nil, dbmodel.ErrAlreadyLocked
+		}
+		err = locked.Put([]byte(threadId), itob(uint64(time.Now().Unix())))
+		action.Action = dbmodel.ActionLock
+	} else {
+		if locked.Get([]byte(threadId)) == nil {
+			return nil, dbmodel.ErrNotLocked
+		}
+		err = locked.Delete([]byte(threadId))
+		action.Action = dbmodel.ActionUnlock
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pbThread, logModeration(tx, action)
+}
+
+// notifyLock enqueues, in the given transaction, and returns the notification
+// for the author of the given thread, which has been locked or unlocked,
+// depending upon lock, by the submitter of l, or nil if the submitter is the
+// author.
+func (h *handler) notifyLock(tx *bolt.Tx, pbThread *pbDataFormat.Content, l dbmodel.Lock, lock bool) (*pbApi.NotifyUser, error) {
+	toNotify := pbThread.AuthorId
+	if l.Submitter == toNotify {
+		return nil, nil
+	}
+	msg := "Your thread has been unlocked and accepts comments again"
+	if lock {
+		msg = "Your thread has been locked and no longer accepts comments"
+	}
+	if l.Reason != "" {
+		msg = fmt.Sprintf("%s: %s", msg, l.Reason)
+	}
+	subj := fmt.Sprintf("On your thread %s", pbThread.Title)
+	return h.notifyKind(tx, l.Submitter, toNotify, msg, subj, pbDataFormat.Notif_COMMENT, notifLock, pbThread)
+}
+
+// LockThread locks the given thread, so it no longer accepts comments, records
+// it in the moderation log and returns the notification for the thread author,
+// if the submitter is not the author.
+//
+// It returns an ErrThreadNotFound if the thread does not exist, an
+// ErrUserNotAllowed if the submitter is neither the author nor a moderator or
+// an ErrAlreadyLocked if the thread is locked.
+func (h *handler) LockThread(thread *pbContext.Thread, l dbmodel.Lock) (*pbApi.NotifyUser, error) {
+	var notifyUser *pbApi.NotifyUser
+
+	err := h.section.contents.Update(func(tx *bolt.Tx) error {
+		pbThread, err := setLock(tx, thread.Id, l, true)
+		if err != nil {
+			return err
+		}
+		notifyUser, err = h.notifyLock(tx, pbThread, l, true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notifyUser, nil
+}
+
+// UnlockThread unlocks the given thread, records it in the moderation log and
+// returns the notification for the thread author, if the submitter is not the
+// author.
+//
+// It returns an ErrThreadNotFound if the thread does not exist, an
+// ErrUserNotAllowed if the submitter is neither the author nor a moderator or
+// an ErrNotLocked if the thread is not locked.
+func (h *handler) UnlockThread(thread *pbContext.Thread, l dbmodel.Lock) (*pbApi.NotifyUser, error) {
+	var notifyUser *pbApi.NotifyUser
+
+	err := h.section.contents.Update(func(tx *bolt.Tx) error {
+		pbThread, err := setLock(tx, thread.Id, l, false)
+		if err != nil {
+			return err
+		}
+		notifyUser, err = h.notifyLock(tx, pbThread, l, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notifyUser, nil
+}
+
+// IsLocked returns whether the given thread is locked.
+func (h *handler) IsLocked(thread *pbContext.Thread) (bool, error) {
+	var locked bool
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		var err error
+		locked, err = isLocked(tx, thread.Id)
+		return err
+	})
+	return locked, err
+}
+
+// ModerationLog returns the last n actions of the moderation log, from the
+// newest to the oldest. If n is 0 or less, it returns every action.
+func (h *handler) ModerationLog(n int) ([]*dbmodel.ModerationAction, error) {
+	var actions []*dbmodel.ModerationAction
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		modLog := tx.Bucket([]byte(moderationLogB))
+		if modLog == nil {
+			log.Printf("Bucket %s not found\n", moderationLogB)
+			return dbmodel.ErrBucketNotFound
+		}
+		c := modLog.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if (n > 0) && (len(actions) == n) {
+				break
+			}
+			action := new(dbmodel.ModerationAction)
+			if err := json.Unmarshal(v, action); err != nil {
+				log.Printf("Could not unmarshal moderation action: %v\n", err)
+				return err
+			}
+			actions = append(actions, action)
+		}
+		return nil
+	})
+	return actions, err
+}
@@ -0,0 +1,55 @@
+package contents_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+)
+
+// Notifications of locks are sent with the type of comments but under an id of
+// their own, so they do not replace the notification of the comments.
+func TestLockThread(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Locked thread", "author")
+	reply, err := h.ReplyThread(thread, dbmodel.Reply{Content: "A comment", Submitter: "replier"})
+	if err != nil {
+		t.Fatalf("Could not reply thread: %v\n", err)
+	}
+	l := dbmodel.Lock{Submitter: "moderator", Moderator: true, Reason: "Off topic"}
+	notif, err := h.LockThread(thread, l)
+	if err != nil {
+		t.Fatalf("Could not lock thread: %v\n", err)
+	}
+	if (notif == nil) || (notif.UserId != "author") {
+		t.Fatalf("Got notification %v, want one for the author\n", notif)
+	}
+	lock := notif.Notification
+	if lock.Details.Type != pbDataFormat.Notif_COMMENT {
+		t.Errorf("Got notification type %v, want %v\n", lock.Details.Type, pbDataFormat.Notif_COMMENT)
+	}
+	if lock.Id == reply.Notification.Id {
+		t.Errorf("Got the id %s of the comment notification for a lock\n", lock.Id)
+	}
+	if !strings.Contains(lock.Message, "locked") || !strings.HasSuffix(lock.Message, l.Reason) {
+		t.Errorf("Got message %q, want one about the lock and its reason\n", lock.Message)
+	}
+	if _, err = h.LockThread(thread, l); !errors.Is(err, dbmodel.ErrAlreadyLocked) {
+		t.Errorf("Got %v locking twice, want %v\n", err, dbmodel.ErrAlreadyLocked)
+	}
+	if _, err = h.ReplyThread(thread, dbmodel.Reply{Content: "Late", Submitter: "replier"}); !errors.Is(err, dbmodel.ErrThreadLocked) {
+		t.Errorf("Got %v replying to a locked thread, want %v\n", err, dbmodel.ErrThreadLocked)
+	}
+
+	// Unlocking replaces the notification of the lock.
+	if notif, err = h.UnlockThread(thread, l); err != nil {
+		t.Fatalf("Could not unlock thread: %v\n", err)
+	}
+	if (notif == nil) || (notif.Notification.Id != lock.Id) {
+		t.Errorf("Got notification %v, want one with id %s\n", notif, lock.Id)
+	}
+}
@@ -1,19 +1,38 @@
 package contents
 
 import (
-	"context"
 	"fmt"
 	"time"
 
 	pbTime "github.com/golang/protobuf/ptypes/timestamp"
 	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
 	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	bolt "go.etcd.io/bbolt"
 )
 
-// notifyInteraction formats the notification, calls SaveNotif to save it to
-// the user and returns a *pbApi.NotifyUser.
-func (h *handler) notifyInteraction(userId, toNotify, msg, subject string,
-	notifType pbDataFormat.Notif_NotifType, pbContent *pbDataFormat.Content) *pbApi.NotifyUser {
+// Kinds of the notifications that the protocol in cheroproto defines no type
+// for. They're sent with the type of the closest notification it defines, and
+// their kind is appended to their id, so they don't replace the unread
+// notifications of that type on the same content.
+const (
+	// Reactions to threads, comments and subcomments, sent as upvotes.
+	notifReaction = "reaction"
+	// Threads locked or unlocked by a moderator, sent as comments.
+	notifLock = "lock"
+)
+
+// notifyInteraction formats the notification, enqueues the operation to save
+// it to the user in the outbox, in the given transaction, so it's delivered if
+// and only if the interaction is saved, and returns a *pbApi.NotifyUser.
+func (h *handler) notifyInteraction(tx *bolt.Tx, userId, toNotify, msg, subject string,
+	notifType pbDataFormat.Notif_NotifType, pbContent *pbDataFormat.Content) (*pbApi.NotifyUser, error) {
+	return h.notifyKind(tx, userId, toNotify, msg, subject, notifType, "", pbContent)
+}
+
+// notifyKind is notifyInteraction for the notifications of the given kind,
+// which is empty for those of the types defined by the protocol.
+func (h *handler) notifyKind(tx *bolt.Tx, userId, toNotify, msg, subject string,
+	notifType pbDataFormat.Notif_NotifType, kind string, pbContent *pbDataFormat.Content) (*pbApi.NotifyUser, error) {
 	now := &pbTime.Timestamp{
 		Seconds: time.Now().Unix(),
 	}
@@ -23,6 +42,9 @@ func (h *handler) notifyInteraction(userId, toNotify, msg, subject string,
 		Type:               notifType,
 	}
 	notifId := fmt.Sprintf("%s#%v", notifPermalink, notifDetails.Type)
+	if kind != "" {
+		notifId += "#" + kind
+	}
 
 	notif := &pbDataFormat.Notif{
 		Message:   msg,
@@ -36,7 +58,8 @@ func (h *handler) notifyInteraction(userId, toNotify, msg, subject string,
 		UserId:       toNotify,
 		Notification: notif,
 	}
-	go h.users.SaveNotif(context.Background(), req)
-
-	return req
+	if err := h.enqueue(tx, opSaveNotif, toNotify, req); err != nil {
+		return nil, err
+	}
+	return req, nil
 }
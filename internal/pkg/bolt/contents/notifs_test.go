@@ -0,0 +1,47 @@
+package contents_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+)
+
+// Notifications are enqueued in the same transaction as the interaction, so
+// they are delivered right after it and never for a failed interaction.
+func TestNotifyInteraction(t *testing.T) {
+	h, users, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Notified thread", "author")
+	n := len(users.waitDelivered(t, 1))
+
+	notif, err := h.UpvoteThread("voter", thread)
+	if err != nil {
+		t.Fatalf("Could not upvote thread: %v\n", err)
+	}
+	if (notif == nil) || (notif.UserId != "author") {
+		t.Fatalf("Got notification %v, want one for the author\n", notif)
+	}
+	calls := users.waitDelivered(t, n+1)
+	if got := calls[n:]; !reflect.DeepEqual(got, []string{"SaveNotif"}) {
+		t.Errorf("Got operations %v delivered after upvoting, want [SaveNotif]\n", got)
+	}
+	n = len(calls)
+
+	// Upvoting twice fails and notifies nobody.
+	if _, err = h.UpvoteThread("voter", thread); !errors.Is(err, dbmodel.ErrUserNotAllowed) {
+		t.Errorf("Got %v upvoting twice, want %v\n", err, dbmodel.ErrUserNotAllowed)
+	}
+	// Replying goes along with its notification, in order.
+	newComment(t, h, thread, 0, "replier")
+	users.waitDelivered(t, n+2)
+	// Give a notification of the failed upvote time to show up, if any.
+	time.Sleep(100 * time.Millisecond)
+	calls = users.delivered()
+	if got := calls[n:]; !reflect.DeepEqual(got, []string{"Comment", "SaveNotif"}) {
+		t.Errorf("Got operations %v delivered after replying, want [Comment SaveNotif]\n", got)
+	}
+}
@@ -0,0 +1,381 @@
+package contents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbUsers "github.com/luisguve/cheroproto-go/userapi"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Kinds of operations on the users service, named after the rpc that delivers
+// them.
+const (
+	opCreateThread     = "CreateThread"
+	opComment          = "Comment"
+	opSubcomment       = "Subcomment"
+	opSaveThread       = "SaveThread"
+	opRemoveSaved      = "RemoveSaved"
+	opDeleteThread     = "DeleteThread"
+	opDeleteComment    = "DeleteComment"
+	opDeleteSubcomment = "DeleteSubcomment"
+	opOldThread        = "OldThread"
+	opOldComment       = "OldComment"
+	opOldSubcomment    = "OldSubcomment"
+	opSaveNotif        = "SaveNotif"
+)
+
+const (
+	// outboxPoll is how long the dispatcher waits for new operations before
+	// checking the outbox again.
+	outboxPoll = time.Minute
+	// Delivery is retried with exponential backoff between these bounds.
+	outboxMinBackoff = time.Second
+	outboxMaxBackoff = 5 * time.Minute
+	// outboxTimeout is how long a delivery can take.
+	outboxTimeout = 30 * time.Second
+)
+
+// errInvalidOp is returned when delivering an operation that cannot be decoded;
+// retrying it would never succeed.
+var errInvalidOp = errors.New("Invalid outbox operation")
+
+// ErrOutboxNotEmpty is returned by operations that need every operation on the
+// users service to be delivered, when some of them could not be delivered.
+var ErrOutboxNotEmpty = errors.New("Outbox is not empty")
+
+// outboxOp is an operation on the users service waiting to be delivered. It's
+// saved as JSON in the outbox bucket, with a sequential number as key.
+type outboxOp struct {
+	Kind        string `json:"kind"`
+	UserId      string `json:"user_id"`
+	Request     []byte `json:"request"` // Protobuf-encoded request of the rpc.
+	Created     int64  `json:"created"`
+	Attempts    int    `json:"attempts,omitempty"`
+	NextAttempt int64  `json:"next_attempt,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+// enqueue saves an operation of the given kind on the users service in the
+// outbox, in the given transaction, so it's delivered if and only if the
+// transaction is committed. The dispatcher is woken up right after the commit.
+func (h *handler) enqueue(tx *bolt.Tx, kind, userId string, req proto.Message) error {
+	outbox := tx.Bucket([]byte(outboxB))
+	if outbox == nil {
+		log.Printf("Bucket %s not found\n", outboxB)
+		return dbmodel.ErrBucketNotFound
+	}
+	reqBytes, err := proto.Marshal(req)
+	if err != nil {
+		log.Printf("Could not marshal %s request: %v\n", kind, err)
+		return err
+	}
+	op := outboxOp{
+		Kind:    kind,
+		UserId:  userId,
+		Request: reqBytes,
+		Created: time.Now().Unix(),
+	}
+	opBytes, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	seq, _ := outbox.NextSequence()
+	if err = outbox.Put(itob(seq), opBytes); err != nil {
+		return err
+	}
+	tx.OnCommit(h.wakeDispatcher)
+	return nil
+}
+
+// wakeDispatcher tells the dispatcher there are new operations in the outbox,
+// without blocking.
+func (h *handler) wakeDispatcher() {
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver calls the rpc of the users service for the given operation.
+func (h *handler) deliver(op *outboxOp) error {
+	ctx, cancel := context.WithTimeout(context.Background(), outboxTimeout)
+	defer cancel()
+
+	var err error
+	switch op.Kind {
+	case opCreateThread:
+		req := new(pbUsers.CreateThreadRequest)
+		if err = proto.Unmarshal(op.Request, req); err == nil {
+			_, err = h.users.CreateThread(ctx, req)
+		}
+	case opComment:
+		req := new(pbUsers.CommentRequest)
+		if err = proto.Unmarshal(op.Request, req); err == nil {
+			_, err = h.users.Comment(ctx, req)
+		}
+	case opSubcomment:
+		req := new(pbUsers.SubcommentRequest)
+		if err = proto.Unmarshal(op.Request, req); err == nil {
+			_, err = h.users.Subcomment(ctx, req)
+		}
+	case opSaveThread:
+		req := new(pbUsers.SaveThreadRequest)
+		if err = proto.Unmarshal(op.Request, req); err == nil {
+			_, err = h.users.SaveThread(ctx, req)
+		}
+	case opRemoveSaved:
+		req := new(pbUsers.RemoveSavedRequest)
+		if err = proto.Unmarshal(op.Request, req); err == nil {
+			_, err = h.users.RemoveSaved(ctx, req)
+		}
+	case opDeleteThread:
+		req := new(pbUsers.DeleteThreadRequest)
+		if err = proto.Unmarshal(op.Request, req); err == nil {
+			_, err = h.users.DeleteThread(ctx, req)
+		}
+	case opDeleteComment:
+		req := new(pbUsers.DeleteCommentRequest)
+		if err = proto.Unmarshal(op.Request, req); err == nil {
+			_, err = h.users.DeleteComment(ctx, req)
+		}
+	case opDeleteSubcomment:
+		req := new(pbUsers.DeleteSubcommentRequest)
+		if err = proto.Unmarshal(op.Request, req); err == nil {
+			_, err = h.users.DeleteSubcomment(ctx, req)
+		}
+	case opOldThread:
+		req := new(pbUsers.OldThreadRequest)
+		if err = proto.Unmarshal(op.Request, req); err == nil {
+			_, err = h.users.OldThread(ctx, req)
+		}
+	case opOldComment:
+		req := new(pbUsers.OldCommentRequest)
+		if err = proto.Unmarshal(op.Request, req); err == nil {
+			_, err = h.users.OldComment(ctx, req)
+		}
+	case opOldSubcomment:
+		req := new(pbUsers.OldSubcommentRequest)
+		if err = proto.Unmarshal(op.Request, req); err == nil {
+			_, err = h.users.OldSubcomment(ctx, req)
+		}
+	case opSaveNotif:
+		req := new(pbApi.NotifyUser)
+		if err = proto.Unmarshal(op.Request, req); err == nil {
+			_, err = h.users.SaveNotif(ctx, req)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q", errInvalidOp, op.Kind)
+	}
+	return err
+}
+
+// permanent returns whether the given delivery error will happen again on
+// every retry, such as when the user does not exist anymore.
+func permanent(err error) bool {
+	if errors.Is(err, errInvalidOp) {
+		return true
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		// Only proto unmarshal errors do not come from the users service.
+		return true
+	}
+	switch st.Code() {
+	case codes.NotFound, codes.InvalidArgument:
+		return true
+	}
+	return false
+}
+
+// backoff returns how long to wait before the next attempt to deliver an
+// operation that failed the given number of times.
+func backoff(attempts int) time.Duration {
+	d := outboxMinBackoff
+	for i := 1; (i < attempts) && (d < outboxMaxBackoff); i++ {
+		d *= 2
+	}
+	if d > outboxMaxBackoff {
+		d = outboxMaxBackoff
+	}
+	return d
+}
+
+// firstOp returns the oldest operation in the outbox and its key, or a nil
+// operation if the outbox is empty.
+func (h *handler) firstOp() ([]byte, *outboxOp, error) {
+	var (
+		key []byte
+		op  *outboxOp
+	)
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		outbox := tx.Bucket([]byte(outboxB))
+		if outbox == nil {
+			log.Printf("Bucket %s not found\n", outboxB)
+			return dbmodel.ErrBucketNotFound
+		}
+		c := outbox.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			// Skip the bucket of failed operations.
+			if v == nil {
+				continue
+			}
+			key = copyBytes(k)
+			op = new(outboxOp)
+			return json.Unmarshal(v, op)
+		}
+		return nil
+	})
+	return key, op, err
+}
+
+// settleOp updates the operation with the given key in the outbox. If op is
+// nil, the operation is removed; if failed is true, it's moved to the bucket of
+// failed operations. Operations already removed are left alone.
+func (h *handler) settleOp(key []byte, op *outboxOp, failed bool) error {
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		outbox := tx.Bucket([]byte(outboxB))
+		if outbox == nil {
+			log.Printf("Bucket %s not found\n", outboxB)
+			return dbmodel.ErrBucketNotFound
+		}
+		if outbox.Get(key) == nil {
+			return nil
+		}
+		if op == nil {
+			return outbox.Delete(key)
+		}
+		opBytes, err := json.Marshal(op)
+		if err != nil {
+			return err
+		}
+		if !failed {
+			return outbox.Put(key, opBytes)
+		}
+		failedOps := outbox.Bucket([]byte(failedOpsB))
+		if failedOps == nil {
+			log.Printf("Bucket %s not found\n", failedOpsB)
+			return dbmodel.ErrBucketNotFound
+		}
+		if err = failedOps.Put(key, opBytes); err != nil {
+			return err
+		}
+		return outbox.Delete(key)
+	})
+}
+
+// deliverOutbox delivers the operations in the outbox in the order they were
+// enqueued, until the outbox is empty or an operation fails, and returns how
+// long to wait before trying again. An operation that fails is retried with
+// backoff, and the operations enqueued after it wait for it, so the users
+// service always applies them in order. Operations that would never succeed
+// are moved to the bucket of failed operations instead.
+//
+// The operations of every user wait for a failing operation, not only those of
+// its user: operations fail mostly while the users service is unavailable,
+// which holds back every user alike, and keeping a single order is simpler
+// than tracking one per user.
+//
+// If force is true, an operation waiting for its next attempt is delivered
+// right away. Deliveries are serialized, so a flush waits for the dispatcher
+// and the other way around.
+func (h *handler) deliverOutbox(force bool) time.Duration {
+	h.delivering.Lock()
+	defer h.delivering.Unlock()
+	for {
+		select {
+		case <-h.quit:
+			return 0
+		default:
+		}
+		key, op, err := h.firstOp()
+		if err != nil {
+			log.Printf("Could not read outbox: %v\n", err)
+			return outboxPoll
+		}
+		if op == nil {
+			return outboxPoll
+		}
+		now := time.Now()
+		if wait := time.Unix(op.NextAttempt, 0).Sub(now); !force && (wait > 0) {
+			return wait
+		}
+		err = h.deliver(op)
+		switch {
+		case err == nil:
+			err = h.settleOp(key, nil, false)
+		case permanent(err):
+			log.Printf("Could not deliver %s to user %s: %v. Giving up.\n", op.Kind, op.UserId, err)
+			op.Attempts++
+			op.LastError = err.Error()
+			err = h.settleOp(key, op, true)
+		default:
+			op.Attempts++
+			op.LastError = err.Error()
+			wait := backoff(op.Attempts)
+			op.NextAttempt = now.Add(wait).Unix()
+			log.Printf("Could not deliver %s to user %s (attempt %d): %v. Retrying in %v.\n",
+				op.Kind, op.UserId, op.Attempts, err, wait)
+			if err = h.settleOp(key, op, false); err != nil {
+				log.Printf("Could not update outbox: %v\n", err)
+			}
+			return wait
+		}
+		if err != nil {
+			log.Printf("Could not update outbox: %v\n", err)
+			return outboxPoll
+		}
+	}
+}
+
+// dispatch delivers the operations in the outbox in the background until the
+// handler is closed.
+func (h *handler) dispatch() {
+	defer close(h.stopped)
+	for {
+		wait := h.deliverOutbox(false)
+		// Do not spin on operations due within the current second.
+		if wait < outboxMinBackoff {
+			wait = outboxMinBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-h.quit:
+			timer.Stop()
+			return
+		case <-h.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// flushOutbox delivers every operation in the outbox right away and returns
+// the number of operations still pending.
+func (h *handler) flushOutbox() (int, error) {
+	h.deliverOutbox(true)
+	var pending int
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		outbox := tx.Bucket([]byte(outboxB))
+		if outbox == nil {
+			log.Printf("Bucket %s not found\n", outboxB)
+			return dbmodel.ErrBucketNotFound
+		}
+		return outbox.ForEach(func(k, v []byte) error {
+			if v != nil {
+				pending++
+			}
+			return nil
+		})
+	})
+	return pending, err
+}
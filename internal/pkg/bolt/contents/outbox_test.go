@@ -0,0 +1,55 @@
+package contents_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Operations that fail to be delivered are retried, and the operations
+// enqueued after them wait, so the users service applies them in order.
+func TestOutboxRetry(t *testing.T) {
+	h, users, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	users.setFail(status.Error(codes.Unavailable, "users service down"))
+	thread := newThread(t, h, "Thread while down", "author")
+	newComment(t, h, thread, 0, "replier")
+	// Give the failed delivery time to be retried at least once.
+	time.Sleep(1500 * time.Millisecond)
+	if calls := users.delivered(); len(calls) != 0 {
+		t.Fatalf("Got operations %v delivered while failing, want none\n", calls)
+	}
+
+	users.setFail(nil)
+	calls := users.waitDelivered(t, 3)
+	want := []string{"CreateThread", "Comment", "SaveNotif"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("Got operations %v delivered after recovering, want %v\n", calls, want)
+	}
+}
+
+// Operations that would never succeed are given up, so they do not hold the
+// operations enqueued after them.
+func TestOutboxPermanentError(t *testing.T) {
+	h, users, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	users.setFail(status.Error(codes.NotFound, "user not found"))
+	newThread(t, h, "Thread of a missing user", "missing")
+	// Give the delivery time to be attempted.
+	time.Sleep(500 * time.Millisecond)
+	users.setFail(nil)
+	newThread(t, h, "Thread of an existing user", "author")
+
+	calls := users.waitDelivered(t, 1)
+	// Give the operation given up time to show up, if it were retried.
+	time.Sleep(100 * time.Millisecond)
+	if calls = users.delivered(); !reflect.DeepEqual(calls, []string{"CreateThread"}) {
+		t.Errorf("Got operations %v delivered, want only the second CreateThread\n", calls)
+	}
+}
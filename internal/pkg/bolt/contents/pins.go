@@ -0,0 +1,125 @@
+package contents
+
+import (
+	"encoding/binary"
+	"log"
+	"sort"
+	"time"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	bolt "go.etcd.io/bbolt"
+)
+
+// pinnedBucket returns the bucket of pinned threads.
+func pinnedBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	metadata := tx.Bucket([]byte(metadataB))
+	if metadata == nil {
+		log.Printf("Bucket %s not found\n", metadataB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	pinned := metadata.Bucket([]byte(pinnedB))
+	if pinned == nil {
+		log.Printf("Bucket %s not found\n", pinnedB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	return pinned, nil
+}
+
+// isPinned returns whether the given thread is pinned.
+func isPinned(tx *bolt.Tx, threadId string) (bool, error) {
+	pinned, err := pinnedBucket(tx)
+	if err != nil {
+		return false, err
+	}
+	return pinned.Get([]byte(threadId)) != nil, nil
+}
+
+// unpinThread unpins the given thread, if it's pinned. It's called when the
+// thread is deleted.
+func unpinThread(tx *bolt.Tx, threadId string) error {
+	pinned, err := pinnedBucket(tx)
+	if err != nil {
+		return err
+	}
+	return pinned.Delete([]byte(threadId))
+}
+
+// PinThread pins the given thread to the top of the feeds of the section. Only
+// active threads can be pinned, and no more than max at the same time.
+//
+// It returns an ErrThreadNotFound if the thread is not active, an
+// ErrAlreadyPinned if it's pinned or an ErrTooManyPinned if there are already
+// max pinned threads.
+func (h *handler) PinThread(thread *pbContext.Thread, max int) error {
+	id := thread.Id
+
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		if _, err := getActiveThreadBucket(tx, id); err != nil {
+			return dbmodel.ErrThreadNotFound
+		}
+		pinned, err := pinnedBucket(tx)
+		if err != nil {
+			return err
+		}
+		if pinned.Get([]byte(id)) != nil {
+			return dbmodel.ErrAlreadyPinned
+		}
+		if countVoters(pinned) >= max {
+			return dbmodel.ErrTooManyPinned
+		}
+		return pinned.Put([]byte(id), itob(uint64(time.Now().Unix())))
+	})
+}
+
+// UnpinThread unpins the given thread. It returns an ErrNotPinned if the thread
+// is not pinned.
+func (h *handler) UnpinThread(thread *pbContext.Thread) error {
+	id := thread.Id
+
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		pinned, err := pinnedBucket(tx)
+		if err != nil {
+			return err
+		}
+		if pinned.Get([]byte(id)) == nil {
+			return dbmodel.ErrNotPinned
+		}
+		return pinned.Delete([]byte(id))
+	})
+}
+
+// GetPinnedThreads returns the ids of the pinned threads, from the most
+// recently pinned.
+func (h *handler) GetPinnedThreads() ([]string, error) {
+	type pin struct {
+		id       string
+		pinnedAt uint64
+	}
+	var pins []pin
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		pinned, err := pinnedBucket(tx)
+		if err != nil {
+			return err
+		}
+		return pinned.ForEach(func(k, v []byte) error {
+			pins = append(pins, pin{
+				id:       string(k),
+				pinnedAt: binary.BigEndian.Uint64(v),
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(pins, func(i, j int) bool {
+		return pins[i].pinnedAt > pins[j].pinnedAt
+	})
+	ids := make([]string, len(pins))
+	for i, p := range pins {
+		ids[i] = p.id
+	}
+	return ids, nil
+}
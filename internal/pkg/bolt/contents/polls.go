@@ -0,0 +1,274 @@
+package contents
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	bolt "go.etcd.io/bbolt"
+)
+
+// keys of the bucket of the poll of a thread
+const (
+	pollK = "poll"
+)
+
+// pollEntry is a poll and its number of votes for each option. It's saved as
+// JSON in the bucket of the poll of the thread it's attached to, which does not
+// move when the thread is archived.
+type pollEntry struct {
+	Options        []string `json:"options"`
+	ClosesAt       int64    `json:"closes_at,omitempty"`
+	MultipleChoice bool     `json:"multiple_choice,omitempty"`
+	Votes          []int    `json:"votes"`
+}
+
+// results returns the results of the poll with the given number of voters.
+func (p *pollEntry) results(voters int, now time.Time) *dbmodel.PollResults {
+	return &dbmodel.PollResults{
+		Poll: dbmodel.Poll{
+			Options:        p.Options,
+			ClosesAt:       p.ClosesAt,
+			MultipleChoice: p.MultipleChoice,
+		},
+		Votes:  p.Votes,
+		Voters: voters,
+		Closed: (p.ClosesAt > 0) && (now.Unix() >= p.ClosesAt),
+	}
+}
+
+// validChoices returns whether choices are indexes of options of the poll,
+// without duplicates, and there is a single one unless the poll is multiple
+// choice.
+func (p *pollEntry) validChoices(choices []int) bool {
+	if (len(choices) == 0) || (!p.MultipleChoice && (len(choices) > 1)) {
+		return false
+	}
+	seen := make(map[int]bool)
+	for _, c := range choices {
+		if (c < 0) || (c >= len(p.Options)) || seen[c] {
+			return false
+		}
+		seen[c] = true
+	}
+	return true
+}
+
+// setPoll saves the given poll in a new bucket for the given thread.
+func setPoll(tx *bolt.Tx, threadId string, poll *dbmodel.Poll) error {
+	if poll == nil {
+		return nil
+	}
+	polls := tx.Bucket([]byte(pollsB))
+	if polls == nil {
+		log.Printf("Bucket %s not found\n", pollsB)
+		return dbmodel.ErrBucketNotFound
+	}
+	b, err := polls.CreateBucket([]byte(threadId))
+	if err != nil {
+		log.Printf("Could not create bucket %s: %v\n", threadId, err)
+		return err
+	}
+	if _, err = b.CreateBucket([]byte(votersB)); err != nil {
+		log.Printf("Could not create bucket %s: %v\n", votersB, err)
+		return err
+	}
+	return putPoll(b, &pollEntry{
+		Options:        poll.Options,
+		ClosesAt:       poll.ClosesAt,
+		MultipleChoice: poll.MultipleChoice,
+		Votes:          make([]int, len(poll.Options)),
+	})
+}
+
+// getPoll returns the bucket of the poll of the given thread and the poll, or
+// an ErrPollNotFound if the thread has no poll.
+func getPoll(tx *bolt.Tx, threadId string) (*bolt.Bucket, *pollEntry, error) {
+	polls := tx.Bucket([]byte(pollsB))
+	if polls == nil {
+		log.Printf("Bucket %s not found\n", pollsB)
+		return nil, nil, dbmodel.ErrBucketNotFound
+	}
+	b := polls.Bucket([]byte(threadId))
+	if b == nil {
+		return nil, nil, dbmodel.ErrPollNotFound
+	}
+	p := new(pollEntry)
+	if err := json.Unmarshal(b.Get([]byte(pollK)), p); err != nil {
+		log.Printf("Could not unmarshal poll: %v\n", err)
+		return nil, nil, err
+	}
+	return b, p, nil
+}
+
+func putPoll(b *bolt.Bucket, p *pollEntry) error {
+	pollBytes, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("Could not marshal poll: %v\n", err)
+		return err
+	}
+	return b.Put([]byte(pollK), pollBytes)
+}
+
+// dropPoll removes the poll of the given thread, if any, along with its
+// voters. It's called when the thread is gone for good.
+func dropPoll(tx *bolt.Tx, threadId string) error {
+	polls := tx.Bucket([]byte(pollsB))
+	if polls.Bucket([]byte(threadId)) == nil {
+		return nil
+	}
+	return polls.DeleteBucket([]byte(threadId))
+}
+
+// countVoters returns the number of users who voted on a poll.
+func countVoters(voters *bolt.Bucket) int {
+	n := 0
+	c := voters.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		n++
+	}
+	return n
+}
+
+// votePoll saves the choices of the given user on the poll of the given thread,
+// replacing the previous ones if change is true, and returns the results.
+//
+// A first vote counts as an interaction on the thread, so it updates the
+// metadata of the thread the same way an upvote does; changing a vote does not.
+func (h *handler) votePoll(thread *pbContext.Thread, userId string, choices []int, change bool) (*dbmodel.PollResults, error) {
+	var (
+		id  = thread.Id
+		res *dbmodel.PollResults
+		now = time.Now()
+	)
+
+	err := h.section.contents.Update(func(tx *bolt.Tx) error {
+		threadBytes, err := getThreadBytes(tx, id)
+		if err != nil {
+			log.Printf("Could not find thread %s: %v.\n", id, err)
+			return err
+		}
+		b, p, err := getPoll(tx, id)
+		if err != nil {
+			return err
+		}
+		voters := b.Bucket([]byte(votersB))
+		if voters == nil {
+			log.Printf("Bucket %s not found\n", votersB)
+			return dbmodel.ErrBucketNotFound
+		}
+		if (p.ClosesAt > 0) && (now.Unix() >= p.ClosesAt) {
+			return dbmodel.ErrPollClosed
+		}
+		if !p.validChoices(choices) {
+			return dbmodel.ErrInvalidChoice
+		}
+		prevBytes := voters.Get([]byte(userId))
+		switch {
+		case change && (prevBytes == nil):
+			return dbmodel.ErrNotVoted
+		case !change && (prevBytes != nil):
+			return dbmodel.ErrAlreadyVoted
+		}
+		if prevBytes != nil {
+			var prev []int
+			if err = json.Unmarshal(prevBytes, &prev); err != nil {
+				log.Printf("Could not unmarshal vote: %v\n", err)
+				return err
+			}
+			for _, c := range prev {
+				if (c >= 0) && (c < len(p.Votes)) {
+					p.Votes[c]--
+				}
+			}
+		}
+		for _, c := range choices {
+			p.Votes[c]++
+		}
+		choicesBytes, err := json.Marshal(choices)
+		if err != nil {
+			log.Printf("Could not marshal vote: %v\n", err)
+			return err
+		}
+		if err = voters.Put([]byte(userId), choicesBytes); err != nil {
+			return err
+		}
+		if err = putPoll(b, p); err != nil {
+			return err
+		}
+		res = p.results(countVoters(voters), now)
+		res.Choices = choices
+		if change {
+			return nil
+		}
+		pbThread := new(pbDataFormat.Content)
+		if err = proto.Unmarshal(threadBytes, pbThread); err != nil {
+			log.Printf("Could not unmarshal content: %v.\n", err)
+			return err
+		}
+		incInteractions(pbThread.Metadata)
+		threadBytes, err = proto.Marshal(pbThread)
+		if err != nil {
+			log.Printf("Could not marshal content: %v\n", err)
+			return err
+		}
+		return setThreadBytes(tx, id, threadBytes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// VotePoll saves the vote of the given user on the poll of the given thread and
+// returns the results. Each user votes once; it returns an ErrAlreadyVoted if
+// the user has already voted, an ErrPollClosed if the poll is closed or an
+// ErrInvalidChoice if the choices do not fit the poll.
+func (h *handler) VotePoll(thread *pbContext.Thread, userId string, choices []int) (*dbmodel.PollResults, error) {
+	return h.votePoll(thread, userId, choices, false)
+}
+
+// ChangePollVote replaces the vote of the given user on the poll of the given
+// thread and returns the results. It returns an ErrNotVoted if the user has not
+// voted yet, an ErrPollClosed if the poll is closed or an ErrInvalidChoice if
+// the choices do not fit the poll.
+func (h *handler) ChangePollVote(thread *pbContext.Thread, userId string, choices []int) (*dbmodel.PollResults, error) {
+	return h.votePoll(thread, userId, choices, true)
+}
+
+// GetPollResults returns the results of the poll of the given thread, along
+// with the choices of the given user, if they voted.
+func (h *handler) GetPollResults(thread *pbContext.Thread, userId string) (*dbmodel.PollResults, error) {
+	var res *dbmodel.PollResults
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		if _, err := getThreadBytes(tx, thread.Id); err != nil {
+			return err
+		}
+		b, p, err := getPoll(tx, thread.Id)
+		if err != nil {
+			return err
+		}
+		voters := b.Bucket([]byte(votersB))
+		if voters == nil {
+			log.Printf("Bucket %s not found\n", votersB)
+			return dbmodel.ErrBucketNotFound
+		}
+		res = p.results(countVoters(voters), time.Now())
+		if choicesBytes := voters.Get([]byte(userId)); choicesBytes != nil {
+			if err = json.Unmarshal(choicesBytes, &res.Choices); err != nil {
+				log.Printf("Could not unmarshal vote: %v\n", err)
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
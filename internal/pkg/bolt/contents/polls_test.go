@@ -0,0 +1,109 @@
+package contents_test
+
+import (
+	"errors"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+)
+
+// newPoll creates a thread with the given poll and returns its context.
+func newPoll(t *testing.T, h dbmodel.Handler, author string, poll *dbmodel.Poll) *pbContext.Thread {
+	t.Helper()
+	content := &pbApi.Content{
+		Title:       "Poll of " + author,
+		Content:     "Vote, please",
+		PublishDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+	}
+	permalink, err := h.CreateThread(content, author, dbmodel.NewThread{Poll: poll})
+	if err != nil {
+		t.Fatalf("Could not create thread with poll: %v\n", err)
+	}
+	return &pbContext.Thread{
+		Id:         path.Base(permalink),
+		SectionCtx: &pbContext.Section{Id: testSection},
+	}
+}
+
+func TestPollVote(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newPoll(t, h, "author", &dbmodel.Poll{Options: []string{"Yes", "No", "Maybe"}})
+	if _, err := h.VotePoll(thread, "voter1", []int{0}); err != nil {
+		t.Fatalf("Could not vote: %v\n", err)
+	}
+	res, err := h.VotePoll(thread, "voter2", []int{1})
+	if err != nil {
+		t.Fatalf("Could not vote: %v\n", err)
+	}
+	if !reflect.DeepEqual(res.Votes, []int{1, 1, 0}) || (res.Voters != 2) ||
+		!reflect.DeepEqual(res.Choices, []int{1}) {
+		t.Errorf("Got results %+v, want votes [1 1 0] of 2 voters and choices [1]\n", res)
+	}
+
+	// Each user votes once, for a single option of a single choice poll.
+	if _, err = h.VotePoll(thread, "voter1", []int{1}); !errors.Is(err, dbmodel.ErrAlreadyVoted) {
+		t.Errorf("Got %v voting twice, want %v\n", err, dbmodel.ErrAlreadyVoted)
+	}
+	for _, choices := range [][]int{nil, {0, 1}, {3}, {-1}} {
+		if _, err = h.VotePoll(thread, "voter3", choices); !errors.Is(err, dbmodel.ErrInvalidChoice) {
+			t.Errorf("Got %v voting %v, want %v\n", err, choices, dbmodel.ErrInvalidChoice)
+		}
+	}
+
+	// Changing a vote moves it to the new option.
+	if _, err = h.ChangePollVote(thread, "voter3", []int{2}); !errors.Is(err, dbmodel.ErrNotVoted) {
+		t.Errorf("Got %v changing a missing vote, want %v\n", err, dbmodel.ErrNotVoted)
+	}
+	if _, err = h.ChangePollVote(thread, "voter1", []int{2}); err != nil {
+		t.Fatalf("Could not change vote: %v\n", err)
+	}
+	if res, err = h.GetPollResults(thread, "voter1"); err != nil {
+		t.Fatalf("Could not get results: %v\n", err)
+	}
+	if !reflect.DeepEqual(res.Votes, []int{0, 1, 1}) || (res.Voters != 2) ||
+		!reflect.DeepEqual(res.Choices, []int{2}) {
+		t.Errorf("Got results %+v after changing the vote, want votes [0 1 1] of 2 voters and choices [2]\n", res)
+	}
+}
+
+func TestPollMultipleChoiceClosed(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	poll := &dbmodel.Poll{
+		Options:        []string{"Red", "Green", "Blue"},
+		MultipleChoice: true,
+		ClosesAt:       time.Now().Add(2 * time.Second).Unix(),
+	}
+	thread := newPoll(t, h, "author", poll)
+	res, err := h.VotePoll(thread, "voter", []int{0, 2})
+	if err != nil {
+		t.Fatalf("Could not vote: %v\n", err)
+	}
+	if !reflect.DeepEqual(res.Votes, []int{1, 0, 1}) || (res.Voters != 1) {
+		t.Errorf("Got results %+v, want votes [1 0 1] of 1 voter\n", res)
+	}
+	if _, err = h.VotePoll(thread, "other", []int{1, 1}); !errors.Is(err, dbmodel.ErrInvalidChoice) {
+		t.Errorf("Got %v choosing an option twice, want %v\n", err, dbmodel.ErrInvalidChoice)
+	}
+
+	// No votes are accepted after the poll closes.
+	time.Sleep(3 * time.Second)
+	if _, err = h.VotePoll(thread, "other", []int{1}); !errors.Is(err, dbmodel.ErrPollClosed) {
+		t.Errorf("Got %v voting on a closed poll, want %v\n", err, dbmodel.ErrPollClosed)
+	}
+	if res, err = h.GetPollResults(thread, "other"); err != nil {
+		t.Fatalf("Could not get results: %v\n", err)
+	}
+	if !res.Closed || (len(res.Choices) != 0) {
+		t.Errorf("Got results %+v, want a closed poll without choices of the user\n", res)
+	}
+}
@@ -0,0 +1,500 @@
+package contents
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	pbUsers "github.com/luisguve/cheroproto-go/userapi"
+	bolt "go.etcd.io/bbolt"
+)
+
+// staleRef is a reference to a purged content in the activity or in the list
+// of saved threads of a user. Only one of thread, comment or subcomment is set.
+type staleRef struct {
+	userId     string
+	thread     *pbContext.Thread
+	comment    *pbContext.Comment
+	subcomment *pbContext.Subcomment
+	saved      bool // Whether thread is in the list of saved threads.
+}
+
+// dropRef enqueues the operation to remove the given reference from the user in
+// the outbox.
+func (h *handler) dropRef(tx *bolt.Tx, r staleRef) error {
+	switch {
+	case r.saved:
+		req := &pbUsers.RemoveSavedRequest{
+			UserId: r.userId,
+			Ctx:    r.thread,
+		}
+		return h.enqueue(tx, opRemoveSaved, r.userId, req)
+	case r.thread != nil:
+		req := &pbUsers.DeleteThreadRequest{
+			UserId: r.userId,
+			Ctx:    r.thread,
+		}
+		return h.enqueue(tx, opDeleteThread, r.userId, req)
+	case r.comment != nil:
+		req := &pbUsers.DeleteCommentRequest{
+			UserId: r.userId,
+			Ctx:    r.comment,
+		}
+		return h.enqueue(tx, opDeleteComment, r.userId, req)
+	case r.subcomment != nil:
+		req := &pbUsers.DeleteSubcommentRequest{
+			UserId: r.userId,
+			Ctx:    r.subcomment,
+		}
+		return h.enqueue(tx, opDeleteSubcomment, r.userId, req)
+	}
+	return nil
+}
+
+// dropRefs enqueues the operations to remove the given references from the
+// users in the outbox.
+func (h *handler) dropRefs(tx *bolt.Tx, refs []staleRef) error {
+	for _, ref := range refs {
+		if err := h.dropRef(tx, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expired returns whether the given big endian unix time is older than the
+// given retention. A zero retention never expires.
+func expired(t []byte, retention time.Duration, now time.Time) bool {
+	if (retention == 0) || (len(t) != 8) {
+		return false
+	}
+	deletedAt := time.Unix(int64(binary.BigEndian.Uint64(t)), 0)
+	return now.Sub(deletedAt) > retention
+}
+
+// Purge permanently removes the contents that have been deleted or archived
+// for longer than the given retention:
+// + Deleted threads still in the bucket of deleted threads, along with their
+//   comments and subcomments.
+// + Comments and subcomments of deleted threads moved to archived contents.
+// + Archived threads that have not been updated within the retention of
+//   archived contents, along with their comments and subcomments.
+//
+// The revisions of the removed contents are removed as well, and so are the
+// archived threads from the search index and the tags, polls, reactions,
+// downvotes, locks, removals by moderators and open reports of the removed
+// threads. A zero retention keeps the contents forever.
+//
+// In the same transaction, it enqueues the operations to drop the references to
+// them from the activity of their authors and from the list of saved threads of
+// the users who saved them in the outbox.
+//
+// Finally, it saves a structured summary of the purge in the bucket of purge
+// history.
+//
+// It returns the result of the purge in a string and an error.
+func (h *handler) Purge(r dbmodel.Retention) (string, error) {
+	var (
+		summary string
+		refs    []staleRef
+		now     = time.Now()
+		p       = &dbmodel.PurgeSummary{Started: now.Unix()}
+		section = &pbContext.Section{
+			Id: h.section.id,
+		}
+	)
+	summary = fmt.Sprintf("[%v] Starting purge (section %s).\n", now.Format(time.Stamp), h.section.name)
+	if r.Deleted == 0 {
+		summary += "Deleted contents are kept forever.\n"
+	}
+	if r.Archived == 0 {
+		summary += "Archived contents are kept forever.\n"
+	}
+
+	err := h.section.contents.Update(func(tx *bolt.Tx) error {
+		// These buckets must have been defined on setup.
+		activeContents := tx.Bucket([]byte(activeContentsB))
+		if activeContents == nil {
+			log.Printf("Could not find bucket %s\n", activeContentsB)
+			return dbmodel.ErrBucketNotFound
+		}
+		archivedContents := tx.Bucket([]byte(archivedContentsB))
+		if archivedContents == nil {
+			log.Printf("Could not find bucket %s\n", archivedContentsB)
+			return dbmodel.ErrBucketNotFound
+		}
+		revisions := tx.Bucket([]byte(revisionsB))
+		if revisions == nil {
+			log.Printf("Could not find bucket %s\n", revisionsB)
+			return dbmodel.ErrBucketNotFound
+		}
+		// Deleted threads that have not been swept by a clean up yet.
+		deletedContents := activeContents.Bucket([]byte(deletedThreadsB))
+		if deletedContents == nil {
+			log.Printf("Could not find bucket %s\n", deletedThreadsB)
+			return dbmodel.ErrBucketNotFound
+		}
+		delTimes := deletedContents.Bucket([]byte(deletionTimesB))
+		if delTimes == nil {
+			log.Printf("Could not find bucket %s\n", deletionTimesB)
+			return dbmodel.ErrBucketNotFound
+		}
+		var expiredIds [][]byte
+		c := delTimes.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if expired(v, r.Deleted, now) {
+				expiredIds = append(expiredIds, copyBytes(k))
+			}
+		}
+		for _, id := range expiredIds {
+			summary += fmt.Sprintln("-----------------------------------------------------")
+			summary += fmt.Sprintf("Purging deleted thread %s... ", id)
+			if err := deletedContents.Delete(id); err != nil {
+				summary += fmt.Sprintf("\nCould not DEL thread: %v.\n", err)
+				return err
+			}
+			if err := delTimes.Delete(id); err != nil {
+				summary += fmt.Sprintf("\nCould not DEL deletion time: %v.\n", err)
+				return err
+			}
+			threadRefs, err := purgeComments(activeContents, revisions, section, id)
+			if err != nil {
+				summary += fmt.Sprintf("\nCould not purge comments: %v.\n", err)
+				return err
+			}
+			if err = deleteRevisions(revisions, threadKey(string(id))); err != nil {
+				return err
+			}
+			if err = dropTags(tx, string(id)); err != nil {
+				return err
+			}
+			if err = dropPoll(tx, string(id)); err != nil {
+				return err
+			}
+			if err = dropReactions(tx, string(id)); err != nil {
+				return err
+			}
+			if err = dropDownvotes(tx, string(id)); err != nil {
+				return err
+			}
+			if err = dropLock(tx, string(id)); err != nil {
+				return err
+			}
+			if err = dropRemovals(tx, string(id)); err != nil {
+				return err
+			}
+			if err = dropReports(tx, string(id)); err != nil {
+				return err
+			}
+			summary += fmt.Sprintf("Done. %d references to drop.\n", len(threadRefs))
+			refs = append(refs, threadRefs...)
+			p.Deleted = append(p.Deleted, string(id))
+		}
+
+		// Comments of deleted threads moved to archived contents.
+		archDelTimes := archivedContents.Bucket([]byte(deletionTimesB))
+		if archDelTimes == nil {
+			log.Printf("Could not find bucket %s\n", deletionTimesB)
+			return dbmodel.ErrBucketNotFound
+		}
+		expiredIds = nil
+		c = archDelTimes.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if expired(v, r.Deleted, now) {
+				expiredIds = append(expiredIds, copyBytes(k))
+			}
+		}
+		for _, id := range expiredIds {
+			summary += fmt.Sprintln("-----------------------------------------------------")
+			summary += fmt.Sprintf("Purging archived comments of deleted thread %s... ", id)
+			if err := archDelTimes.Delete(id); err != nil {
+				summary += fmt.Sprintf("\nCould not DEL deletion time: %v.\n", err)
+				return err
+			}
+			threadRefs, err := purgeComments(archivedContents, revisions, section, id)
+			if err != nil {
+				summary += fmt.Sprintf("\nCould not purge comments: %v.\n", err)
+				return err
+			}
+			if err = deleteRevisions(revisions, threadKey(string(id))); err != nil {
+				return err
+			}
+			if err = dropReactions(tx, string(id)); err != nil {
+				return err
+			}
+			if err = dropDownvotes(tx, string(id)); err != nil {
+				return err
+			}
+			if err = dropLock(tx, string(id)); err != nil {
+				return err
+			}
+			if err = dropRemovals(tx, string(id)); err != nil {
+				return err
+			}
+			if err = dropReports(tx, string(id)); err != nil {
+				return err
+			}
+			summary += fmt.Sprintf("Done. %d references to drop.\n", len(threadRefs))
+			refs = append(refs, threadRefs...)
+			p.Deleted = append(p.Deleted, string(id))
+		}
+
+		// Archived threads.
+		if r.Archived == 0 {
+			return h.dropRefs(tx, refs)
+		}
+		var expiredThreads []*pbDataFormat.Content
+		c = archivedContents.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			// Check whether the value is a nested bucket. If so, just continue.
+			// Cursors see nested buckets with value == nil.
+			if v == nil {
+				continue
+			}
+			pbThread := new(pbDataFormat.Content)
+			if err := proto.Unmarshal(v, pbThread); err != nil {
+				log.Printf("Could not unmarshal content %s: %v\n", string(k), err)
+				return err
+			}
+			var lastUpdated int64
+			if (pbThread.Metadata != nil) && (pbThread.Metadata.LastUpdated != nil) {
+				lastUpdated = pbThread.Metadata.LastUpdated.Seconds
+			}
+			if now.Sub(time.Unix(lastUpdated, 0)) > r.Archived {
+				expiredThreads = append(expiredThreads, pbThread)
+			}
+		}
+		for _, pbThread := range expiredThreads {
+			id := []byte(pbThread.Id)
+			summary += fmt.Sprintln("-----------------------------------------------------")
+			summary += fmt.Sprintf("Purging archived thread %s... ", pbThread.Title)
+			if err := archivedContents.Delete(id); err != nil {
+				summary += fmt.Sprintf("\nCould not DEL thread: %v.\n", err)
+				return err
+			}
+			thread := &pbContext.Thread{
+				Id:         pbThread.Id,
+				SectionCtx: section,
+			}
+			refs = append(refs, staleRef{userId: pbThread.AuthorId, thread: thread})
+			for _, userId := range pbThread.UsersWhoSaved {
+				refs = append(refs, staleRef{userId: userId, thread: thread, saved: true})
+			}
+			threadRefs, err := purgeComments(archivedContents, revisions, section, id)
+			if err != nil {
+				summary += fmt.Sprintf("\nCould not purge comments: %v.\n", err)
+				return err
+			}
+			if err = deleteRevisions(revisions, threadKey(pbThread.Id)); err != nil {
+				return err
+			}
+			if err = unindexThread(tx, pbThread.Id); err != nil {
+				return err
+			}
+			if err = dropTags(tx, pbThread.Id); err != nil {
+				return err
+			}
+			if err = dropPoll(tx, pbThread.Id); err != nil {
+				return err
+			}
+			if err = dropReactions(tx, pbThread.Id); err != nil {
+				return err
+			}
+			if err = dropDownvotes(tx, pbThread.Id); err != nil {
+				return err
+			}
+			if err = dropLock(tx, pbThread.Id); err != nil {
+				return err
+			}
+			if err = dropRemovals(tx, pbThread.Id); err != nil {
+				return err
+			}
+			if err = dropReports(tx, pbThread.Id); err != nil {
+				return err
+			}
+			summary += fmt.Sprintf("Done. %d references to drop.\n", 1+len(pbThread.UsersWhoSaved)+len(threadRefs))
+			refs = append(refs, threadRefs...)
+			p.Archived = append(p.Archived, pbThread.Id)
+		}
+		return h.dropRefs(tx, refs)
+	})
+	if err != nil {
+		p.Errors = append(p.Errors, err.Error())
+		h.savePurge(p)
+		return summary, err
+	}
+
+	// The contents are gone and the references to them will be dropped from
+	// the users by the dispatcher of the outbox.
+	if len(refs) > 0 {
+		summary += fmt.Sprintln("-----------------------------------------------------")
+		summary += fmt.Sprintf("Enqueued the removal of %d references from the activity of users.\n", len(refs))
+	}
+	p.Dropped = len(refs)
+	if saveErr := h.savePurge(p); (saveErr != nil) && (err == nil) {
+		err = saveErr
+	}
+	return summary, err
+}
+
+// purgeComments deletes the bucket of comments of the given thread, along with
+// its subcomments, from the given bucket of either active or archived contents,
+// and the revisions of every comment and subcomment. It returns the references
+// to the deleted comments and subcomments in the activity of their authors.
+func purgeComments(contents, revisions *bolt.Bucket, section *pbContext.Section, threadId []byte) ([]staleRef, error) {
+	commentsBucket := contents.Bucket([]byte(commentsB))
+	if commentsBucket == nil {
+		log.Printf("Could not find bucket %s\n", commentsB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	comments := commentsBucket.Bucket(threadId)
+	if comments == nil {
+		// The thread has no comments.
+		return nil, nil
+	}
+	var (
+		refs   []staleRef
+		thread = &pbContext.Thread{
+			Id:         string(threadId),
+			SectionCtx: section,
+		}
+	)
+	err := comments.ForEach(func(k, v []byte) error {
+		// Skip nested buckets.
+		if v == nil {
+			return nil
+		}
+		pbComment := new(pbDataFormat.Content)
+		if err := proto.Unmarshal(v, pbComment); err != nil {
+			log.Printf("Could not unmarshal content: %v\n", err)
+			return err
+		}
+		comment := &pbContext.Comment{
+			Id:        string(k),
+			ThreadCtx: thread,
+		}
+		refs = append(refs, staleRef{userId: pbComment.AuthorId, comment: comment})
+		return deleteRevisions(revisions, commentKey(thread.Id, comment.Id))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if subcomKeys := comments.Bucket([]byte(subcommentsB)); subcomKeys != nil {
+		err = subcomKeys.ForEach(func(commentId, v []byte) error {
+			subcomments := subcomKeys.Bucket(commentId)
+			if subcomments == nil {
+				return nil
+			}
+			comment := &pbContext.Comment{
+				Id:        string(commentId),
+				ThreadCtx: thread,
+			}
+			return subcomments.ForEach(func(k, v []byte) error {
+				if v == nil {
+					return nil
+				}
+				pbSubcomment := new(pbDataFormat.Content)
+				if err := proto.Unmarshal(v, pbSubcomment); err != nil {
+					log.Printf("Could not unmarshal content: %v\n", err)
+					return err
+				}
+				subcomment := &pbContext.Subcomment{
+					Id:         string(k),
+					CommentCtx: comment,
+				}
+				refs = append(refs, staleRef{userId: pbSubcomment.AuthorId, subcomment: subcomment})
+				key := subcommentKey(thread.Id, comment.Id, subcomment.Id)
+				return deleteRevisions(revisions, key)
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Deleting the comments bucket also deletes the subcomments bucket.
+	if err = commentsBucket.DeleteBucket(threadId); err != nil {
+		log.Printf("Could not delete comments bucket of thread %s: %v\n", threadId, err)
+		return nil, err
+	}
+	return refs, nil
+}
+
+// deleteRevisions deletes the bucket of revisions with the given key, if any,
+// along with the last time the content was edited.
+func deleteRevisions(revisions *bolt.Bucket, key string) error {
+	if editTimes := revisions.Tx().Bucket([]byte(editTimesB)); editTimes != nil {
+		if err := editTimes.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	if revisions.Bucket([]byte(key)) == nil {
+		return nil
+	}
+	return revisions.DeleteBucket([]byte(key))
+}
+
+// copyBytes returns a copy of b, which can be used after the transaction b was
+// read in is closed or b is deleted.
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+// savePurge saves the given summary in the bucket of purge history.
+func (h *handler) savePurge(p *dbmodel.PurgeSummary) error {
+	p.Finished = time.Now().Unix()
+
+	err := h.section.contents.Update(func(tx *bolt.Tx) error {
+		history := tx.Bucket([]byte(purgeHistoryB))
+		if history == nil {
+			log.Printf("Bucket %s not found\n", purgeHistoryB)
+			return dbmodel.ErrBucketNotFound
+		}
+		p.Id, _ = history.NextSequence()
+		pBytes, err := json.Marshal(p)
+		if err != nil {
+			log.Printf("Could not marshal purge summary: %v\n", err)
+			return err
+		}
+		return history.Put(itob(p.Id), pBytes)
+	})
+	if err != nil {
+		log.Printf("Could not save purge summary: %v\n", err)
+	}
+	return err
+}
+
+// PurgeHistory returns the summaries of the last n purges, from the newest to
+// the oldest. If n is 0 or less, it returns every summary.
+func (h *handler) PurgeHistory(n int) ([]*dbmodel.PurgeSummary, error) {
+	var history []*dbmodel.PurgeSummary
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		purgeHistory := tx.Bucket([]byte(purgeHistoryB))
+		if purgeHistory == nil {
+			log.Printf("Bucket %s not found\n", purgeHistoryB)
+			return dbmodel.ErrBucketNotFound
+		}
+		c := purgeHistory.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if (n > 0) && (len(history) == n) {
+				break
+			}
+			p := new(dbmodel.PurgeSummary)
+			if err := json.Unmarshal(v, p); err != nil {
+				log.Printf("Could not unmarshal purge summary: %v\n", err)
+				return err
+			}
+			history = append(history, p)
+		}
+		return nil
+	})
+	return history, err
+}
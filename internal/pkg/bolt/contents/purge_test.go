@@ -0,0 +1,71 @@
+package contents_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+)
+
+func TestPurgeDeleted(t *testing.T) {
+	h, users, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Purged thread", "author")
+	newComment(t, h, thread, 0, "replier")
+	if err := h.DeleteThread(thread, "author"); err != nil {
+		t.Fatalf("Could not delete thread: %v\n", err)
+	}
+	n := len(users.waitDelivered(t, 4))
+
+	// Deleted contents are kept within the retention and forever with a zero
+	// retention.
+	for _, r := range []dbmodel.Retention{{}, {Deleted: time.Hour}} {
+		if _, err := h.Purge(r); err != nil {
+			t.Fatalf("Could not purge: %v\n", err)
+		}
+	}
+	history, err := h.PurgeHistory(10)
+	if err != nil {
+		t.Fatalf("Could not get purge history: %v\n", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Got %d purges, want 2\n", len(history))
+	}
+	for _, p := range history {
+		if len(p.Deleted) != 0 {
+			t.Errorf("Got threads %v purged within the retention, want none\n", p.Deleted)
+		}
+	}
+
+	// Deletion times are recorded by the second.
+	time.Sleep(time.Second)
+	if _, err = h.Purge(dbmodel.Retention{Deleted: time.Millisecond}); err != nil {
+		t.Fatalf("Could not purge: %v\n", err)
+	}
+	if history, err = h.PurgeHistory(1); err != nil {
+		t.Fatalf("Could not get purge history: %v\n", err)
+	}
+	if (len(history) != 1) || !reflect.DeepEqual(history[0].Deleted, []string{thread.Id}) {
+		t.Fatalf("Got purge history %+v, want the deleted thread %s purged\n", history, thread.Id)
+	}
+
+	// The thread cannot be restored anymore, even by an admin.
+	r := dbmodel.Restore{
+		Submitter:   "admin",
+		Admin:       true,
+		GracePeriod: time.Hour,
+		RestoreDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+	}
+	if err = h.RestoreThread(thread, r); !errors.Is(err, dbmodel.ErrDeletedThreadNotFound) {
+		t.Errorf("Got %v restoring a purged thread, want %v\n", err, dbmodel.ErrDeletedThreadNotFound)
+	}
+	// The comment is dropped from the activity of its author.
+	calls := users.waitDelivered(t, n+1)
+	if got := calls[n:]; !reflect.DeepEqual(got, []string{"DeleteComment"}) {
+		t.Errorf("Got operations %v delivered after purging, want [DeleteComment]\n", got)
+	}
+}
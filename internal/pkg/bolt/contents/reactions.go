@@ -0,0 +1,331 @@
+package contents
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/golang/protobuf/proto"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	bolt "go.etcd.io/bbolt"
+)
+
+// contentThreadId returns the id of the thread the content pointed to by the
+// given context belongs to.
+func contentThreadId(content *pbContext.Context) string {
+	switch ctx := content.Ctx.(type) {
+	case *pbContext.Context_ThreadCtx:
+		return ctx.ThreadCtx.Id
+	case *pbContext.Context_CommentCtx:
+		return ctx.CommentCtx.ThreadCtx.Id
+	case *pbContext.Context_SubcommentCtx:
+		return ctx.SubcommentCtx.CommentCtx.ThreadCtx.Id
+	}
+	return ""
+}
+
+// getContentAndThread returns the content pointed to by the given context
+// along with the thread it belongs to, which is the same content for threads.
+func getContentAndThread(tx *bolt.Tx, content *pbContext.Context) (pbContent, pbThread *pbDataFormat.Content, err error) {
+	var (
+		contentBytes []byte
+		threadId     = contentThreadId(content)
+	)
+	switch ctx := content.Ctx.(type) {
+	case *pbContext.Context_ThreadCtx:
+		contentBytes, err = getThreadBytes(tx, threadId)
+	case *pbContext.Context_CommentCtx:
+		contentBytes, err = getCommentBytes(tx, threadId, ctx.CommentCtx.Id)
+	case *pbContext.Context_SubcommentCtx:
+		sc := ctx.SubcommentCtx
+		contentBytes, err = getSubcommentBytes(tx, threadId, sc.CommentCtx.Id, sc.Id)
+	default:
+		return nil, nil, dbmodel.ErrThreadNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	pbContent = new(pbDataFormat.Content)
+	if err = proto.Unmarshal(contentBytes, pbContent); err != nil {
+		log.Printf("Could not unmarshal content: %v\n", err)
+		return nil, nil, err
+	}
+	if _, ok := content.Ctx.(*pbContext.Context_ThreadCtx); ok {
+		return pbContent, pbContent, nil
+	}
+	threadBytes, err := getThreadBytes(tx, threadId)
+	if err != nil {
+		return nil, nil, err
+	}
+	pbThread = new(pbDataFormat.Content)
+	if err = proto.Unmarshal(threadBytes, pbThread); err != nil {
+		log.Printf("Could not unmarshal content: %v\n", err)
+		return nil, nil, err
+	}
+	return pbContent, pbThread, nil
+}
+
+// reactionsBucket returns the bucket of reactions of the content pointed to by
+// the given context, which is nil if nobody reacted to it yet, unless create is
+// true.
+func reactionsBucket(tx *bolt.Tx, content *pbContext.Context, create bool) (*bolt.Bucket, error) {
+	key, err := revisionKey(content)
+	if err != nil {
+		return nil, err
+	}
+	reactions := tx.Bucket([]byte(reactionsB))
+	if reactions == nil {
+		log.Printf("Bucket %s not found\n", reactionsB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	threadId := []byte(contentThreadId(content))
+	if !create {
+		if b := reactions.Bucket(threadId); b != nil {
+			return b.Bucket([]byte(key)), nil
+		}
+		return nil, nil
+	}
+	b, err := reactions.CreateBucketIfNotExists(threadId)
+	if err != nil {
+		log.Printf("Could not create bucket %s: %v\n", threadId, err)
+		return nil, err
+	}
+	if b, err = b.CreateBucketIfNotExists([]byte(key)); err != nil {
+		log.Printf("Could not create bucket %s: %v\n", key, err)
+		return nil, err
+	}
+	if _, err = b.CreateBucketIfNotExists([]byte(reactionUsersB)); err != nil {
+		log.Printf("Could not create bucket %s: %v\n", reactionUsersB, err)
+		return nil, err
+	}
+	if _, err = b.CreateBucketIfNotExists([]byte(reactionCountsB)); err != nil {
+		log.Printf("Could not create bucket %s: %v\n", reactionCountsB, err)
+		return nil, err
+	}
+	return b, nil
+}
+
+// userReactions returns the reactions of the given user saved in the given
+// bucket of users.
+func userReactions(users *bolt.Bucket, userId string) ([]string, error) {
+	var reactions []string
+	if v := users.Get([]byte(userId)); v != nil {
+		if err := json.Unmarshal(v, &reactions); err != nil {
+			log.Printf("Could not unmarshal reactions: %v\n", err)
+			return nil, err
+		}
+	}
+	return reactions, nil
+}
+
+// addCount adds n to the count of the given reaction and returns the new count.
+// Counts that get to 0 are removed.
+func addCount(counts *bolt.Bucket, reaction string, n int) (int, error) {
+	count := n
+	if v := counts.Get([]byte(reaction)); v != nil {
+		count += int(binary.BigEndian.Uint64(v))
+	}
+	if count <= 0 {
+		return 0, counts.Delete([]byte(reaction))
+	}
+	return count, counts.Put([]byte(reaction), itob(uint64(count)))
+}
+
+// dropReactions removes the reactions to the given thread and to its comments
+// and subcomments, if any. It's called when they're gone for good.
+func dropReactions(tx *bolt.Tx, threadId string) error {
+	reactions := tx.Bucket([]byte(reactionsB))
+	if reactions.Bucket([]byte(threadId)) == nil {
+		return nil
+	}
+	return reactions.DeleteBucket([]byte(threadId))
+}
+
+// AddReaction saves the given reaction of the user to the content pointed to by
+// the given context. A user can add each reaction once to a content, so it
+// returns an ErrAlreadyReacted if the user has already added it.
+//
+// Then, it saves the notification in the list of unread notifications of the
+// content author and, for comments and subcomments, of the thread author, the
+// same way upvotes do, and returns them. Notifications of the same content are
+// aggregated under the same id.
+func (h *handler) AddReaction(content *pbContext.Context, userId, reaction string) ([]*pbApi.NotifyUser, error) {
+	var (
+		pbContent *pbDataFormat.Content
+		pbThread  *pbDataFormat.Content
+		total     int // Reactions to the content.
+		notifs    []*pbApi.NotifyUser
+	)
+
+	err := h.section.contents.Update(func(tx *bolt.Tx) error {
+		var err error
+		pbContent, pbThread, err = getContentAndThread(tx, content)
+		if err != nil {
+			return err
+		}
+		b, err := reactionsBucket(tx, content, true)
+		if err != nil {
+			return err
+		}
+		users := b.Bucket([]byte(reactionUsersB))
+		mine, err := userReactions(users, userId)
+		if err != nil {
+			return err
+		}
+		if reacted, _ := inSlice(mine, reaction); reacted {
+			return dbmodel.ErrAlreadyReacted
+		}
+		mine = append(mine, reaction)
+		v, err := json.Marshal(mine)
+		if err != nil {
+			log.Printf("Could not marshal reactions: %v\n", err)
+			return err
+		}
+		if err = users.Put([]byte(userId), v); err != nil {
+			return err
+		}
+		counts := b.Bucket([]byte(reactionCountsB))
+		if _, err = addCount(counts, reaction, 1); err != nil {
+			return err
+		}
+		err = counts.ForEach(func(k, v []byte) error {
+			total += int(binary.BigEndian.Uint64(v))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		var (
+			what      string
+			notifType pbDataFormat.Notif_NotifType
+		)
+		switch content.Ctx.(type) {
+		case *pbContext.Context_ThreadCtx:
+			what, notifType = "thread", pbDataFormat.Notif_UPVOTE
+		case *pbContext.Context_CommentCtx:
+			what, notifType = "comment", pbDataFormat.Notif_UPVOTE_COMMENT
+		default:
+			what, notifType = "comment", pbDataFormat.Notif_UPVOTE_SUBCOMMENT
+		}
+		// Set notification only if the submitter is not the content author.
+		toNotify := pbContent.AuthorId
+		if userId != toNotify {
+			var msg string
+			if total > 1 {
+				msg = fmt.Sprintf("%d users have reacted to your %s", total, what)
+			} else {
+				msg = fmt.Sprintf("1 user has reacted to your %s", what)
+			}
+			subj := fmt.Sprintf("On your %s %s", what, pbThread.Title)
+			if what == "comment" {
+				subj = fmt.Sprintf("On your comment on %s", pbThread.Title)
+			}
+			notifyUser, err := h.notifyKind(tx, userId, toNotify, msg, subj, notifType, notifReaction, pbContent)
+			if err != nil {
+				return err
+			}
+			notifs = append(notifs, notifyUser)
+		}
+		// Set notification only if the content is not the thread and the submitter
+		// is not the thread author.
+		toNotify = pbThread.AuthorId
+		if (pbContent != pbThread) && (userId != toNotify) && (toNotify != pbContent.AuthorId) {
+			var msg string
+			if total > 1 {
+				msg = fmt.Sprintf("%d users have reacted to a comment on your thread", total)
+			} else {
+				msg = "1 user has reacted to a comment on your thread"
+			}
+			subj := fmt.Sprintf("On your thread %s", pbThread.Title)
+			notifyUser, err := h.notifyKind(tx, userId, toNotify, msg, subj, notifType, notifReaction, pbContent)
+			if err != nil {
+				return err
+			}
+			notifs = append(notifs, notifyUser)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notifs, nil
+}
+
+// RemoveReaction removes the given reaction of the user from the content
+// pointed to by the given context. It returns an ErrNotReacted if the user has
+// not added it.
+func (h *handler) RemoveReaction(content *pbContext.Context, userId, reaction string) error {
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		if _, _, err := getContentAndThread(tx, content); err != nil {
+			return err
+		}
+		b, err := reactionsBucket(tx, content, false)
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			return dbmodel.ErrNotReacted
+		}
+		users := b.Bucket([]byte(reactionUsersB))
+		mine, err := userReactions(users, userId)
+		if err != nil {
+			return err
+		}
+		reacted, idx := inSlice(mine, reaction)
+		if !reacted {
+			return dbmodel.ErrNotReacted
+		}
+		mine = append(mine[:idx], mine[idx+1:]...)
+		if len(mine) == 0 {
+			err = users.Delete([]byte(userId))
+		} else {
+			var v []byte
+			if v, err = json.Marshal(mine); err != nil {
+				log.Printf("Could not marshal reactions: %v\n", err)
+				return err
+			}
+			err = users.Put([]byte(userId), v)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = addCount(b.Bucket([]byte(reactionCountsB)), reaction, -1)
+		return err
+	})
+}
+
+// GetReactions returns the number of users who added each reaction to the
+// content pointed to by the given context and the reactions of the given user.
+func (h *handler) GetReactions(content *pbContext.Context, userId string) (*dbmodel.Reactions, error) {
+	r := &dbmodel.Reactions{
+		Counts: make(map[string]int),
+	}
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		if _, _, err := getContentAndThread(tx, content); err != nil {
+			return err
+		}
+		b, err := reactionsBucket(tx, content, false)
+		if (err != nil) || (b == nil) {
+			return err
+		}
+		err = b.Bucket([]byte(reactionCountsB)).ForEach(func(k, v []byte) error {
+			r.Counts[string(k)] = int(binary.BigEndian.Uint64(v))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		r.Mine, err = userReactions(b.Bucket([]byte(reactionUsersB)), userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
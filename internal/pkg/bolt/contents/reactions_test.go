@@ -0,0 +1,106 @@
+package contents_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+)
+
+func TestReactions(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Thread with reactions", "author")
+	ctx := &pbContext.Context{
+		Ctx: &pbContext.Context_ThreadCtx{ThreadCtx: thread},
+	}
+	reactions := []struct {
+		userId, reaction string
+	}{
+		{"user1", "like"},
+		{"user2", "like"},
+		{"user1", "laugh"},
+		{"author", "like"},
+	}
+	for _, r := range reactions {
+		if _, err := h.AddReaction(ctx, r.userId, r.reaction); err != nil {
+			t.Fatalf("Could not add reaction %s of %s: %v\n", r.reaction, r.userId, err)
+		}
+	}
+	if _, err := h.AddReaction(ctx, "user1", "like"); !errors.Is(err, dbmodel.ErrAlreadyReacted) {
+		t.Errorf("Got %v reacting twice, want %v\n", err, dbmodel.ErrAlreadyReacted)
+	}
+	got, err := h.GetReactions(ctx, "user1")
+	if err != nil {
+		t.Fatalf("Could not get reactions: %v\n", err)
+	}
+	want := &dbmodel.Reactions{
+		Counts: map[string]int{"like": 3, "laugh": 1},
+		Mine:   []string{"like", "laugh"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got reactions %+v, want %+v\n", got, want)
+	}
+
+	// Removing the last reaction of a kind drops its count.
+	if err = h.RemoveReaction(ctx, "user1", "laugh"); err != nil {
+		t.Fatalf("Could not remove reaction: %v\n", err)
+	}
+	if err = h.RemoveReaction(ctx, "user1", "laugh"); !errors.Is(err, dbmodel.ErrNotReacted) {
+		t.Errorf("Got %v removing twice, want %v\n", err, dbmodel.ErrNotReacted)
+	}
+	if got, err = h.GetReactions(ctx, "user2"); err != nil {
+		t.Fatalf("Could not get reactions: %v\n", err)
+	}
+	want = &dbmodel.Reactions{
+		Counts: map[string]int{"like": 3},
+		Mine:   []string{"like"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got reactions %+v after removing, want %+v\n", got, want)
+	}
+}
+
+// Notifications of reactions are sent with the type of upvotes but under an id
+// of their own, so they do not replace the notification of the upvotes.
+func TestReactionNotifs(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Notified thread", "author")
+	ctx := &pbContext.Context{
+		Ctx: &pbContext.Context_ThreadCtx{ThreadCtx: thread},
+	}
+	upvote, err := h.UpvoteThread("voter", thread)
+	if err != nil {
+		t.Fatalf("Could not upvote thread: %v\n", err)
+	}
+	notifs, err := h.AddReaction(ctx, "voter", "like")
+	if err != nil {
+		t.Fatalf("Could not add reaction: %v\n", err)
+	}
+	if len(notifs) != 1 {
+		t.Fatalf("Got %d notifications, want 1\n", len(notifs))
+	}
+	reaction := notifs[0].Notification
+	if reaction.Details.Type != upvote.Notification.Details.Type {
+		t.Errorf("Got notification type %v, want %v\n", reaction.Details.Type, upvote.Notification.Details.Type)
+	}
+	if reaction.Id == upvote.Notification.Id {
+		t.Errorf("Got the id %s of the upvote notification for a reaction\n", reaction.Id)
+	}
+	if msg := "1 user has reacted to your thread"; reaction.Message != msg {
+		t.Errorf("Got message %q, want %q\n", reaction.Message, msg)
+	}
+
+	// The author is not notified of their own reactions.
+	if notifs, err = h.AddReaction(ctx, "author", "like"); err != nil {
+		t.Fatalf("Could not add reaction: %v\n", err)
+	}
+	if len(notifs) != 0 {
+		t.Errorf("Got %d notifications for a reaction of the author, want 0\n", len(notifs))
+	}
+}
@@ -0,0 +1,143 @@
+package contents
+
+import (
+	"log"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	bolt "go.etcd.io/bbolt"
+)
+
+// removedBucket returns the bucket of the removed contents of the given thread,
+// which is nil if none of them was removed yet, unless create is true.
+func removedBucket(tx *bolt.Tx, threadId string, create bool) (*bolt.Bucket, error) {
+	removed := tx.Bucket([]byte(removedB))
+	if removed == nil {
+		log.Printf("Bucket %s not found\n", removedB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	if !create {
+		return removed.Bucket([]byte(threadId)), nil
+	}
+	b, err := removed.CreateBucketIfNotExists([]byte(threadId))
+	if err != nil {
+		log.Printf("Could not create bucket %s: %v\n", threadId, err)
+		return nil, err
+	}
+	return b, nil
+}
+
+// isRemoved returns whether the content pointed to by the given context was
+// removed by a moderator.
+func isRemoved(tx *bolt.Tx, content *pbContext.Context) (bool, error) {
+	key, err := revisionKey(content)
+	if err != nil {
+		return false, err
+	}
+	removed, err := removedBucket(tx, contentThreadId(content), false)
+	if (err != nil) || (removed == nil) {
+		return false, err
+	}
+	return removed.Get([]byte(key)) != nil, nil
+}
+
+// IsRemoved returns whether the content pointed to by the given context was
+// removed by a moderator.
+func (h *handler) IsRemoved(content *pbContext.Context) (bool, error) {
+	var removed bool
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		var err error
+		removed, err = isRemoved(tx, content)
+		return err
+	})
+	return removed, err
+}
+
+// dropRemovals forgets the removals of the given thread and of its comments and
+// subcomments, if any. It's called when they're gone for good.
+func dropRemovals(tx *bolt.Tx, threadId string) error {
+	removed := tx.Bucket([]byte(removedB))
+	if removed.Bucket([]byte(threadId)) == nil {
+		return nil
+	}
+	return removed.DeleteBucket([]byte(threadId))
+}
+
+// RemoveContent replaces the content of the thread, comment or subcomment
+// pointed to by the given context, and the title of threads, with RemovedText,
+// drops its featured file and removes it from the search index, so it shows as
+// removed instead of disappearing. The caller must check that the submitter is
+// a moderator.
+//
+// The removed text is not kept as a revision. The removal is recorded in the
+// moderation log, along with the reason.
+//
+// It returns an ErrThreadNotFound, ErrCommentNotFound or ErrSubcommentNotFound
+// if the content does not exist or an ErrContentRemoved if it was already
+// removed.
+func (h *handler) RemoveContent(content *pbContext.Context, r dbmodel.Removal) error {
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		return removeContent(tx, content, r)
+	})
+}
+
+// removeContent removes the content pointed to by the given context on behalf
+// of the moderator in r, as described by RemoveContent.
+func removeContent(tx *bolt.Tx, content *pbContext.Context, r dbmodel.Removal) error {
+	key, err := revisionKey(content)
+	if err != nil {
+		return dbmodel.ErrThreadNotFound
+	}
+	threadId := contentThreadId(content)
+	action := &dbmodel.ModerationAction{
+		Action:   dbmodel.ActionRemove,
+		ThreadId: threadId,
+		UserId:   r.Submitter,
+		Reason:   r.Reason,
+	}
+	pbContent, _, err := getContentAndThread(tx, content)
+	if err != nil {
+		return err
+	}
+	removed, err := removedBucket(tx, threadId, true)
+	if err != nil {
+		return err
+	}
+	if removed.Get([]byte(key)) != nil {
+		return dbmodel.ErrContentRemoved
+	}
+	pbContent.Content = dbmodel.RemovedText
+	pbContent.FtFile = ""
+	if _, ok := content.Ctx.(*pbContext.Context_ThreadCtx); ok {
+		pbContent.Title = dbmodel.RemovedText
+	}
+	contentBytes, err := proto.Marshal(pbContent)
+	if err != nil {
+		log.Printf("Could not marshal content: %v\n", err)
+		return err
+	}
+	switch ctx := content.Ctx.(type) {
+	case *pbContext.Context_ThreadCtx:
+		err = setThreadBytes(tx, threadId, contentBytes)
+	case *pbContext.Context_CommentCtx:
+		action.CommentId = ctx.CommentCtx.Id
+		err = setCommentBytes(tx, threadId, action.CommentId, contentBytes)
+	case *pbContext.Context_SubcommentCtx:
+		sc := ctx.SubcommentCtx
+		action.CommentId, action.SubcommentId = sc.CommentCtx.Id, sc.Id
+		err = setSubcommentBytes(tx, threadId, sc.CommentCtx.Id, sc.Id, contentBytes)
+	}
+	if err != nil {
+		return err
+	}
+	if err = removed.Put([]byte(key), itob(uint64(time.Now().Unix()))); err != nil {
+		return err
+	}
+	if err = removeFromIndex(tx, key); err != nil {
+		return err
+	}
+	return logModeration(tx, action)
+}
@@ -0,0 +1,95 @@
+package contents_test
+
+import (
+	"errors"
+	"testing"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+)
+
+func TestRemoveContent(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Reported thread", "author")
+	comment := newComment(t, h, thread, 0, "replier")
+	ctx := &pbContext.Context{
+		Ctx: &pbContext.Context_CommentCtx{CommentCtx: comment},
+	}
+	e := dbmodel.Edit{
+		Content:   "Abusive comment",
+		Submitter: "replier",
+		EditDate:  &pbTime.Timestamp{Seconds: 100},
+	}
+	if err := h.UpdateComment(comment, e); err != nil {
+		t.Fatalf("Could not edit comment: %v\n", err)
+	}
+	removed, err := h.IsRemoved(ctx)
+	if err != nil {
+		t.Fatalf("Could not get whether the comment was removed: %v\n", err)
+	}
+	if removed {
+		t.Errorf("Got a removed comment before removing it\n")
+	}
+
+	r := dbmodel.Removal{Submitter: "moderator", Reason: "Harassment"}
+	if err = h.RemoveContent(ctx, r); err != nil {
+		t.Fatalf("Could not remove comment: %v\n", err)
+	}
+	if err = h.RemoveContent(ctx, r); !errors.Is(err, dbmodel.ErrContentRemoved) {
+		t.Errorf("Got %v removing twice, want %v\n", err, dbmodel.ErrContentRemoved)
+	}
+	if removed, err = h.IsRemoved(ctx); err != nil || !removed {
+		t.Errorf("Got removed %v and error %v after removing, want true and no error\n", removed, err)
+	}
+
+	// The comment is kept in its place with its text replaced.
+	content, err := h.GetCommentContent(comment)
+	if err != nil {
+		t.Fatalf("Could not get removed comment: %v\n", err)
+	}
+	if content.Content != dbmodel.RemovedText {
+		t.Errorf("Got content %q of removed comment, want %q\n", content.Content, dbmodel.RemovedText)
+	}
+
+	// The removed text is not kept as a revision; only the previous edit is.
+	revisions, err := h.GetRevisions(ctx)
+	if err != nil {
+		t.Fatalf("Could not get revisions: %v\n", err)
+	}
+	if len(revisions) != 1 {
+		t.Fatalf("Got %d revisions of removed comment, want 1\n", len(revisions))
+	}
+	if revisions[0].Content.Content != "A comment" {
+		t.Errorf("Got revision with content %q, want %q\n", revisions[0].Content.Content, "A comment")
+	}
+
+	// It's left out of the search index and cannot be edited anymore.
+	res, err := h.Search(dbmodel.SearchQuery{Text: "abusive", Limit: 10})
+	if err != nil {
+		t.Fatalf("Could not search: %v\n", err)
+	}
+	if res.Total != 0 {
+		t.Errorf("Got %d hits for a removed comment, want 0\n", res.Total)
+	}
+	e.Content = "Edited again"
+	if err = h.UpdateComment(comment, e); !errors.Is(err, dbmodel.ErrContentRemoved) {
+		t.Errorf("Got %v editing a removed comment, want %v\n", err, dbmodel.ErrContentRemoved)
+	}
+
+	// The removal is recorded in the moderation log.
+	actions, err := h.ModerationLog(1)
+	if err != nil {
+		t.Fatalf("Could not get moderation log: %v\n", err)
+	}
+	if len(actions) != 1 {
+		t.Fatalf("Got %d moderation actions, want 1\n", len(actions))
+	}
+	a := actions[0]
+	if (a.Action != dbmodel.ActionRemove) || (a.CommentId != comment.Id) ||
+		(a.UserId != "moderator") || (a.Reason != "Harassment") {
+		t.Errorf("Got moderation action %+v, want the removal of comment %s\n", a, comment.Id)
+	}
+}
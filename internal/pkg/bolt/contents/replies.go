@@ -1,7 +1,6 @@
 package contents
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -18,9 +17,10 @@ import (
 )
 
 // ReplyThread performs a few tasks:
-// + Creates a comment and associates it to the given thread.
-// + Appends the newly formatted comment context to the list of comments in the
-//   recent activity of the replier.
+// + Creates a comment and associates it to the given thread and adds it to the
+//   search index.
+// + Enqueues the operation to append the newly formatted comment context to the
+//   list of comments in the recent activity of the replier in the outbox.
 // + Updates thread metadata by incrementing its replies and interactions.
 // + Append id of replier to list of repliers of thread.
 // + Formats the notification and saves it if the replier is not the author, and.
@@ -29,16 +29,17 @@ import (
 // It may return an error if:
 // - invalid section: ErrSectionNotFound
 // - invalid thread context: ErrThreadNotFound
-// - invalid user id: ErrUserNotFound
+// - locked thread: ErrThreadLocked
 // - unprepared database or proto marshal/unmarshal error
 func (h *handler) ReplyThread(thread *pbContext.Thread, reply dbmodel.Reply) (*pbApi.NotifyUser, error) {
 	var (
-		pbComment = new(pbDataFormat.Content)
-		pbThread  = new(pbDataFormat.Content)
+		pbComment  = new(pbDataFormat.Content)
+		pbThread   = new(pbDataFormat.Content)
+		notifyUser *pbApi.NotifyUser
 	)
 
-	// Format, marshal and save comment and update user and thread content in
-	// the same transaction.
+	// Format, marshal and save comment and update user and thread content, and
+	// enqueue the notification, in the same transaction.
 	err := h.section.contents.Update(func(tx *bolt.Tx) error {
 		var err error
 		threadBytes, err := getThreadBytes(tx, thread.Id)
@@ -50,6 +51,13 @@ func (h *handler) ReplyThread(thread *pbContext.Thread, reply dbmodel.Reply) (*p
 			log.Printf("Could not unmarshal content: %v.\n", err)
 			return err
 		}
+		locked, err := isLocked(tx, thread.Id)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return dbmodel.ErrThreadLocked
+		}
 		commentsBucket, err := getActiveCommentsBucket(tx, thread.Id)
 		if err != nil {
 			if errors.Is(err, dbmodel.ErrCommentsBucketNotFound) {
@@ -91,6 +99,9 @@ func (h *handler) ReplyThread(thread *pbContext.Thread, reply dbmodel.Reply) (*p
 		if err = commentsBucket.Put([]byte(commentId), pbCommentBytes); err != nil {
 			return err
 		}
+		if err = indexComment(tx, thread.Id, commentId, pbComment); err != nil {
+			return err
+		}
 		// Update thread metadata.
 		pbThread.Replies++
 		pbThread.ReplierIds = append(pbThread.ReplierIds, reply.Submitter)
@@ -113,16 +124,16 @@ func (h *handler) ReplyThread(thread *pbContext.Thread, reply dbmodel.Reply) (*p
 			Ctx:    commentCtx,
 		}
 		// Update user; append comment to list of activity of user.
-		_, err = h.users.Comment(context.Background(), reqUpdateUser)
-		return err
-	})
-	if err != nil {
-		return nil, err
-	}
+		if err = h.enqueue(tx, opComment, reply.Submitter, reqUpdateUser); err != nil {
+			return err
+		}
 
-	// Set notification and notify user only if the submitter is not the author
-	toNotify := pbThread.AuthorId
-	if reply.Submitter != toNotify {
+		// Set notification and notify user only if the submitter is not the
+		// author
+		toNotify := pbThread.AuthorId
+		if reply.Submitter == toNotify {
+			return nil
+		}
 		replies := pbThread.Replies
 		var msg string
 		if replies > 1 {
@@ -134,17 +145,21 @@ func (h *handler) ReplyThread(thread *pbContext.Thread, reply dbmodel.Reply) (*p
 		notifType := pbDataFormat.Notif_COMMENT
 		// Add fragment comments to permalink.
 		pbThread.Permalink += "#comments"
-		notifyUser := h.notifyInteraction(reply.Submitter, toNotify, msg, subj, notifType, pbThread)
-
-		return notifyUser, err
+		notifyUser, err = h.notifyInteraction(tx, reply.Submitter, toNotify, msg, subj, notifType, pbThread)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil, err
+	return notifyUser, nil
 }
 
 // ReplyComment performs a few tasks:
-// + Creates a subcomment and associates it to the given comment.
-// + Appends the newly formatted subcomment context to the list of subcomments
-//   in the recent activity of the replier.
+// + Creates a subcomment and associates it to the given comment and adds it to
+//   the search index.
+// + Enqueues the operation to append the newly formatted subcomment context to
+//   the list of subcomments in the recent activity of the replier in the
+//   outbox.
 // + Updates thread metadata by incrementing its replies and interactions.
 // + Updates comment metadata by incrementing its replies and interactions.
 // + Append id of replier to list of repliers of the comment.
@@ -153,8 +168,8 @@ func (h *handler) ReplyThread(thread *pbContext.Thread, reply dbmodel.Reply) (*p
 // It may return an error if:
 // - invalid section: ErrSectionNotFound
 // - invalid thread context: ErrThreadNotFound
+// - locked thread: ErrThreadLocked
 // - invalid comment context: ErrCommentNotFound
-// - invalid user id: ErrUserNotFound
 // - unprepared database or proto marshal/unmarshal error
 func (h *handler) ReplyComment(comment *pbContext.Comment, reply dbmodel.Reply) ([]*pbApi.NotifyUser, error) {
 	var (
@@ -178,6 +193,13 @@ func (h *handler) ReplyComment(comment *pbContext.Comment, reply dbmodel.Reply)
 			log.Printf("Could not unmarshal content: %v.\n", err)
 			return err
 		}
+		locked, err := isLocked(tx, threadId)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return dbmodel.ErrThreadLocked
+		}
 		// Get comment which the subcomment is being submitted on.
 		commentBytes, err := getCommentBytes(tx, threadId, commentId)
 		if err != nil {
@@ -231,6 +253,10 @@ func (h *handler) ReplyComment(comment *pbContext.Comment, reply dbmodel.Reply)
 		if err != nil {
 			return err
 		}
+		err = indexSubcomment(tx, threadId, commentId, subcommentId, pbSubcomment)
+		if err != nil {
+			return err
+		}
 		// Update thread metadata.
 		pbThread.Replies++
 		incInteractions(pbThread.Metadata)
@@ -265,53 +291,61 @@ func (h *handler) ReplyComment(comment *pbContext.Comment, reply dbmodel.Reply)
 			Ctx:    subcommentCtx,
 		}
 		// Update user; append subcomment to list of activity of author.
-		_, err = h.users.Subcomment(context.Background(), reqUpdateUser)
-		return err
-	})
-	if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-	// notify thread author
-	toNotify := pbThread.AuthorId
-	if reply.Submitter != toNotify {
-		var msg string
-		if pbThread.Replies > 1 {
-			msg = fmt.Sprintf("%d users have commented out your thread", pbThread.Replies)
-		} else {
-			msg = "1 user has commented out your thread"
+		if err = h.enqueue(tx, opSubcomment, reply.Submitter, reqUpdateUser); err != nil {
+			return err
 		}
-		subj := fmt.Sprintf("On your thread %s", pbThread.Title)
-		notifType := pbDataFormat.Notif_SUBCOMMENT
-		notifyUser := h.notifyInteraction(reply.Submitter, toNotify, msg, subj, notifType, pbComment)
-
-		notifyUsers = append(notifyUsers, notifyUser)
-	}
-	// notify comment author
-	toNotify = pbComment.AuthorId
-	if reply.Submitter != toNotify {
-		var msg string
-		if pbComment.Replies > 1 {
-			msg = fmt.Sprintf("%d users have commented out your comment", pbComment.Replies)
-		} else {
-			msg = "1 user has commented out your comment"
+		// notify thread author
+		toNotify := pbThread.AuthorId
+		if reply.Submitter != toNotify {
+			var msg string
+			if pbThread.Replies > 1 {
+				msg = fmt.Sprintf("%d users have commented out your thread", pbThread.Replies)
+			} else {
+				msg = "1 user has commented out your thread"
+			}
+			subj := fmt.Sprintf("On your thread %s", pbThread.Title)
+			notifType := pbDataFormat.Notif_SUBCOMMENT
+			notifyUser, err := h.notifyInteraction(tx, reply.Submitter, toNotify, msg, subj, notifType, pbComment)
+			if err != nil {
+				return err
+			}
+			notifyUsers = append(notifyUsers, notifyUser)
 		}
-		subj := fmt.Sprintf("On your comment on %s", pbComment.Title)
-		notifType := pbDataFormat.Notif_SUBCOMMENT
-		notifyUser := h.notifyInteraction(reply.Submitter, toNotify, msg, subj, notifType, pbComment)
-
-		notifyUsers = append(notifyUsers, notifyUser)
-	}
-	// notify other repliers of the comment
-	for _, toNotify = range pbComment.ReplierIds {
+		// notify comment author
+		toNotify = pbComment.AuthorId
 		if reply.Submitter != toNotify {
-			msg := "Other users have followed the discussion"
+			var msg string
+			if pbComment.Replies > 1 {
+				msg = fmt.Sprintf("%d users have commented out your comment", pbComment.Replies)
+			} else {
+				msg = "1 user has commented out your comment"
+			}
 			subj := fmt.Sprintf("On your comment on %s", pbComment.Title)
 			notifType := pbDataFormat.Notif_SUBCOMMENT
-			notifyUser := h.notifyInteraction(reply.Submitter, toNotify, msg, subj, notifType, pbComment)
-
+			notifyUser, err := h.notifyInteraction(tx, reply.Submitter, toNotify, msg, subj, notifType, pbComment)
+			if err != nil {
+				return err
+			}
 			notifyUsers = append(notifyUsers, notifyUser)
 		}
+		// notify other repliers of the comment
+		for _, toNotify = range pbComment.ReplierIds {
+			if reply.Submitter != toNotify {
+				msg := "Other users have followed the discussion"
+				subj := fmt.Sprintf("On your comment on %s", pbComment.Title)
+				notifType := pbDataFormat.Notif_SUBCOMMENT
+				notifyUser, err := h.notifyInteraction(tx, reply.Submitter, toNotify, msg, subj, notifType, pbComment)
+				if err != nil {
+					return err
+				}
+				notifyUsers = append(notifyUsers, notifyUser)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
 	}
-	return notifyUsers, err
+	return notifyUsers, nil
 }
@@ -0,0 +1,335 @@
+package contents
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	bolt "go.etcd.io/bbolt"
+)
+
+// reportBuckets returns the buckets of the moderation queue: the open items,
+// the resolved items and the ids of the open items by content key.
+func reportBuckets(tx *bolt.Tx) (queue, resolved, byContent *bolt.Bucket, err error) {
+	reports := tx.Bucket([]byte(reportsB))
+	if reports == nil {
+		log.Printf("Bucket %s not found\n", reportsB)
+		return nil, nil, nil, dbmodel.ErrBucketNotFound
+	}
+	for _, b := range []struct {
+		name string
+		b    **bolt.Bucket
+	}{{queueB, &queue}, {resolvedB, &resolved}, {byContentB, &byContent}} {
+		if *b.b = reports.Bucket([]byte(b.name)); *b.b == nil {
+			log.Printf("Bucket %s not found\n", b.name)
+			return nil, nil, nil, dbmodel.ErrBucketNotFound
+		}
+	}
+	return queue, resolved, byContent, nil
+}
+
+// reportersBucket returns the bucket of the users who reported the content with
+// the given key in the given thread, creating it if it does not exist yet.
+func reportersBucket(tx *bolt.Tx, threadId, key string) (*bolt.Bucket, error) {
+	reports := tx.Bucket([]byte(reportsB))
+	if reports == nil {
+		log.Printf("Bucket %s not found\n", reportsB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	reporters := reports.Bucket([]byte(reportersB))
+	if reporters == nil {
+		log.Printf("Bucket %s not found\n", reportersB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	b, err := reporters.CreateBucketIfNotExists([]byte(threadId))
+	if err != nil {
+		log.Printf("Could not create bucket %s: %v\n", threadId, err)
+		return nil, err
+	}
+	if b, err = b.CreateBucketIfNotExists([]byte(key)); err != nil {
+		log.Printf("Could not create bucket %s: %v\n", key, err)
+		return nil, err
+	}
+	return b, nil
+}
+
+// getReportItem returns the item of the moderation queue with the given id from
+// the given bucket, or nil if it's not there.
+func getReportItem(b *bolt.Bucket, id uint64) (*dbmodel.ReportItem, error) {
+	itemBytes := b.Get(itob(id))
+	if itemBytes == nil {
+		return nil, nil
+	}
+	item := new(dbmodel.ReportItem)
+	if err := json.Unmarshal(itemBytes, item); err != nil {
+		log.Printf("Could not unmarshal report: %v\n", err)
+		return nil, err
+	}
+	return item, nil
+}
+
+// putReportItem saves the given item of the moderation queue in the given
+// bucket.
+func putReportItem(b *bolt.Bucket, item *dbmodel.ReportItem) error {
+	itemBytes, err := json.Marshal(item)
+	if err != nil {
+		log.Printf("Could not marshal report: %v\n", err)
+		return err
+	}
+	return b.Put(itob(item.Id), itemBytes)
+}
+
+// reportedContext returns the context of the content of the given item of the
+// moderation queue.
+func reportedContext(item *dbmodel.ReportItem) *pbContext.Context {
+	thread := &pbContext.Thread{Id: item.ThreadId}
+	if item.CommentId == "" {
+		return threadContext(thread)
+	}
+	comment := &pbContext.Comment{Id: item.CommentId, ThreadCtx: thread}
+	if item.SubcommentId == "" {
+		return commentContext(comment)
+	}
+	return subcommentContext(&pbContext.Subcomment{Id: item.SubcommentId, CommentCtx: comment})
+}
+
+// reportReasons returns the distinct reasons of the reports of the given item,
+// in the order they were first given.
+func reportReasons(item *dbmodel.ReportItem) string {
+	var reasons []string
+	for _, r := range item.Reports {
+		if found, _ := inSlice(reasons, r.Reason); !found {
+			reasons = append(reasons, r.Reason)
+		}
+	}
+	return "Reported as " + strings.Join(reasons, ", ")
+}
+
+// dropReports removes the open items of the moderation queue of the given
+// thread and of its comments and subcomments, along with the users who
+// reported them. It's called when they're gone for good. Resolved items are
+// kept.
+func dropReports(tx *bolt.Tx, threadId string) error {
+	queue, _, byContent, err := reportBuckets(tx)
+	if err != nil {
+		return err
+	}
+	var keys [][]byte
+	prefix := []byte(threadId)
+	c := byContent.Cursor()
+	for k, v := c.Seek(prefix); (k != nil) && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		// Skip the contents of other threads whose id starts with threadId.
+		if (len(k) > len(prefix)) && (k[len(prefix)] != '/') {
+			continue
+		}
+		keys = append(keys, copyBytes(k))
+		if err = queue.Delete(v); err != nil {
+			return err
+		}
+	}
+	for _, k := range keys {
+		if err = byContent.Delete(k); err != nil {
+			return err
+		}
+	}
+	reporters := tx.Bucket([]byte(reportsB)).Bucket([]byte(reportersB))
+	if reporters.Bucket([]byte(threadId)) == nil {
+		return nil
+	}
+	return reporters.DeleteBucket([]byte(threadId))
+}
+
+// ReportContent adds the given report of a user on the content pointed to by
+// the given context to the moderation queue and returns the id of its item.
+// Reports on a content that is already in the queue are added to the same
+// item.
+//
+// It returns an ErrThreadNotFound, ErrCommentNotFound or ErrSubcommentNotFound
+// if the content does not exist, an ErrContentRemoved if it was removed by a
+// moderator or an ErrAlreadyReported if the user has already reported it, even
+// if the reports were resolved.
+func (h *handler) ReportContent(content *pbContext.Context, r dbmodel.Report) (uint64, error) {
+	key, err := revisionKey(content)
+	if err != nil {
+		return 0, dbmodel.ErrThreadNotFound
+	}
+	threadId := contentThreadId(content)
+	var id uint64
+
+	err = h.section.contents.Update(func(tx *bolt.Tx) error {
+		if _, _, err := getContentAndThread(tx, content); err != nil {
+			return err
+		}
+		removed, err := isRemoved(tx, content)
+		if err != nil {
+			return err
+		}
+		if removed {
+			return dbmodel.ErrContentRemoved
+		}
+		reporters, err := reportersBucket(tx, threadId, key)
+		if err != nil {
+			return err
+		}
+		if reporters.Get([]byte(r.UserId)) != nil {
+			return dbmodel.ErrAlreadyReported
+		}
+		if err = reporters.Put([]byte(r.UserId), []byte{}); err != nil {
+			return err
+		}
+		queue, _, byContent, err := reportBuckets(tx)
+		if err != nil {
+			return err
+		}
+		var item *dbmodel.ReportItem
+		if idBytes := byContent.Get([]byte(key)); idBytes != nil {
+			item, err = getReportItem(queue, binary.BigEndian.Uint64(idBytes))
+			if err != nil {
+				return err
+			}
+		}
+		if item == nil {
+			item = &dbmodel.ReportItem{ThreadId: threadId}
+			switch ctx := content.Ctx.(type) {
+			case *pbContext.Context_CommentCtx:
+				item.CommentId = ctx.CommentCtx.Id
+			case *pbContext.Context_SubcommentCtx:
+				sc := ctx.SubcommentCtx
+				item.CommentId, item.SubcommentId = sc.CommentCtx.Id, sc.Id
+			}
+			item.Id, _ = queue.NextSequence()
+			if err = byContent.Put([]byte(key), itob(item.Id)); err != nil {
+				return err
+			}
+		}
+		r.Time = time.Now().Unix()
+		item.Reports = append(item.Reports, r)
+		id = item.Id
+		return putReportItem(queue, item)
+	})
+	return id, err
+}
+
+// ReportQueue returns up to n items of the moderation queue whose ids are
+// greater than after, from the oldest. If n is 0 or less, it returns every
+// item.
+func (h *handler) ReportQueue(after uint64, n int) ([]*dbmodel.ReportItem, error) {
+	var items []*dbmodel.ReportItem
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		queue, _, _, err := reportBuckets(tx)
+		if err != nil {
+			return err
+		}
+		c := queue.Cursor()
+		for k, v := c.Seek(itob(after + 1)); k != nil; k, v = c.Next() {
+			if (n > 0) && (len(items) == n) {
+				break
+			}
+			item := new(dbmodel.ReportItem)
+			if err := json.Unmarshal(v, item); err != nil {
+				log.Printf("Could not unmarshal report: %v\n", err)
+				return err
+			}
+			items = append(items, item)
+		}
+		return nil
+	})
+	return items, err
+}
+
+// ResolveReport resolves the item of the moderation queue with the given id
+// with the outcome of the given Resolution: it removes the content, as
+// RemoveContent does, locks the thread it belongs to, as LockThread does, or
+// just dismisses the reports. The note is the reason of the removal or lock; if
+// it's empty, the reasons of the reports are given instead. Contents already
+// removed and threads already locked are not a failure.
+//
+// The item is moved out of the queue, along with the outcome, who resolved it
+// and when, and returned, along with the notification for the author of the
+// thread if it was locked.
+//
+// It returns an ErrInvalidOutcome if the outcome does not exist, an
+// ErrReportNotFound if the item is not in the queue or an ErrThreadNotFound,
+// ErrCommentNotFound or ErrSubcommentNotFound if the content to remove or
+// thread to lock does not exist anymore.
+func (h *handler) ResolveReport(id uint64, r dbmodel.Resolution) (*dbmodel.ReportItem, *pbApi.NotifyUser, error) {
+	switch r.Outcome {
+	case dbmodel.OutcomeDismiss, dbmodel.OutcomeRemove, dbmodel.OutcomeLock:
+	default:
+		return nil, nil, dbmodel.ErrInvalidOutcome
+	}
+	var (
+		item       *dbmodel.ReportItem
+		notifyUser *pbApi.NotifyUser
+	)
+
+	err := h.section.contents.Update(func(tx *bolt.Tx) error {
+		queue, resolved, byContent, err := reportBuckets(tx)
+		if err != nil {
+			return err
+		}
+		if item, err = getReportItem(queue, id); err != nil {
+			return err
+		}
+		if item == nil {
+			return dbmodel.ErrReportNotFound
+		}
+		content := reportedContext(item)
+		reason := r.Note
+		if reason == "" {
+			reason = reportReasons(item)
+		}
+		switch r.Outcome {
+		case dbmodel.OutcomeRemove:
+			removal := dbmodel.Removal{
+				Submitter: r.Submitter,
+				Reason:    reason,
+			}
+			err = removeContent(tx, content, removal)
+			if errors.Is(err, dbmodel.ErrContentRemoved) {
+				err = nil
+			}
+		case dbmodel.OutcomeLock:
+			l := dbmodel.Lock{
+				Submitter: r.Submitter,
+				Moderator: true,
+				Reason:    reason,
+			}
+			var pbThread *pbDataFormat.Content
+			pbThread, err = setLock(tx, item.ThreadId, l, true)
+			if err == nil {
+				notifyUser, err = h.notifyLock(tx, pbThread, l, true)
+			} else if errors.Is(err, dbmodel.ErrAlreadyLocked) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+		item.Outcome = r.Outcome
+		item.ResolvedBy = r.Submitter
+		item.ResolvedAt = time.Now().Unix()
+		item.Note = r.Note
+		if err = queue.Delete(itob(id)); err != nil {
+			return err
+		}
+		key, _ := revisionKey(content)
+		if err = byContent.Delete([]byte(key)); err != nil {
+			return err
+		}
+		return putReportItem(resolved, item)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return item, notifyUser, nil
+}
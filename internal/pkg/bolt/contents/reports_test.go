@@ -0,0 +1,87 @@
+package contents_test
+
+import (
+	"errors"
+	"testing"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+)
+
+func TestReports(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Reported thread", "author")
+	comment := newComment(t, h, thread, 0, "replier")
+	commentCtx := &pbContext.Context{
+		Ctx: &pbContext.Context_CommentCtx{CommentCtx: comment},
+	}
+	report := func(content *pbContext.Context, userId string) (uint64, error) {
+		return h.ReportContent(content, dbmodel.Report{UserId: userId, Reason: "spam"})
+	}
+
+	// Reports on the same content go to the same item, once per user.
+	commentItem, err := report(commentCtx, "reporter1")
+	if err != nil {
+		t.Fatalf("Could not report comment: %v\n", err)
+	}
+	if id, err := report(commentCtx, "reporter2"); (err != nil) || (id != commentItem) {
+		t.Errorf("Got item %d and error %v reporting again, want item %d\n", id, err, commentItem)
+	}
+	if _, err = report(commentCtx, "reporter1"); !errors.Is(err, dbmodel.ErrAlreadyReported) {
+		t.Errorf("Got %v reporting twice, want %v\n", err, dbmodel.ErrAlreadyReported)
+	}
+	threadItem, err := report(threadContext(thread), "reporter1")
+	if err != nil {
+		t.Fatalf("Could not report thread: %v\n", err)
+	}
+	if threadItem == commentItem {
+		t.Errorf("Got the item of the comment for the thread\n")
+	}
+	queue, err := h.ReportQueue(0, 0)
+	if err != nil {
+		t.Fatalf("Could not get report queue: %v\n", err)
+	}
+	if (len(queue) != 2) || (queue[0].Id != commentItem) || (len(queue[0].Reports) != 2) {
+		t.Fatalf("Got queue %+v, want the comment with 2 reports and then the thread\n", queue)
+	}
+	if queue, err = h.ReportQueue(commentItem, 0); (err != nil) || (len(queue) != 1) || (queue[0].Id != threadItem) {
+		t.Errorf("Got queue %+v and error %v after the comment, want the thread\n", queue, err)
+	}
+
+	// Resolving an item carries out its outcome and moves it out of the
+	// queue.
+	r := dbmodel.Resolution{Submitter: "moderator", Outcome: "ban"}
+	if _, _, err = h.ResolveReport(commentItem, r); !errors.Is(err, dbmodel.ErrInvalidOutcome) {
+		t.Errorf("Got %v resolving with an unknown outcome, want %v\n", err, dbmodel.ErrInvalidOutcome)
+	}
+	r.Outcome = dbmodel.OutcomeRemove
+	item, notif, err := h.ResolveReport(commentItem, r)
+	if err != nil {
+		t.Fatalf("Could not resolve report: %v\n", err)
+	}
+	if (item.Outcome != dbmodel.OutcomeRemove) || (item.ResolvedBy != "moderator") || (notif != nil) {
+		t.Errorf("Got item %+v and notification %v, want the comment removed by moderator\n", item, notif)
+	}
+	if removed, err := h.IsRemoved(commentCtx); (err != nil) || !removed {
+		t.Errorf("Got removed %v and error %v, want the comment removed\n", removed, err)
+	}
+	if _, _, err = h.ResolveReport(commentItem, r); !errors.Is(err, dbmodel.ErrReportNotFound) {
+		t.Errorf("Got %v resolving twice, want %v\n", err, dbmodel.ErrReportNotFound)
+	}
+
+	r.Outcome = dbmodel.OutcomeLock
+	if _, notif, err = h.ResolveReport(threadItem, r); err != nil {
+		t.Fatalf("Could not resolve report: %v\n", err)
+	}
+	if (notif == nil) || (notif.UserId != "author") {
+		t.Errorf("Got notification %v, want one for the author of the locked thread\n", notif)
+	}
+	if locked, err := h.IsLocked(thread); (err != nil) || !locked {
+		t.Errorf("Got locked %v and error %v, want the thread locked\n", locked, err)
+	}
+	if queue, err = h.ReportQueue(0, 0); (err != nil) || (len(queue) != 0) {
+		t.Errorf("Got queue %+v and error %v, want it empty\n", queue, err)
+	}
+}
@@ -0,0 +1,132 @@
+package contents
+
+import (
+	"encoding/binary"
+	"log"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	pbUsers "github.com/luisguve/cheroproto-go/userapi"
+	bolt "go.etcd.io/bbolt"
+)
+
+// RestoreThread moves the given thread from the bucket of deleted threads back
+// into the bucket of active contents. Its comments are still in the bucket of
+// comments of active contents under the thread id, so they become reachable
+// again as soon as the thread is restored, and they're added back to the search
+// index along with the thread.
+//
+// The author can restore the thread only within the grace period since it was
+// deleted, as of the time of the request, while an admin can restore it at any
+// time. A thread cannot be restored after the next clean up, since its comments
+// are moved to archived contents by then.
+//
+// Then, it enqueues the update of the activity of the author by appending the
+// thread to its list of threads created and the addition of the thread back to
+// the list of saved threads of every user who saved it in the outbox.
+//
+// It returns an ErrDeletedThreadNotFound if the thread is not in the bucket of
+// deleted threads, an ErrUserNotAllowed if the submitter is neither the author
+// nor an admin, an ErrGracePeriodExpired if the author is past the grace
+// period or a proto marshal/unmarshal or bolt error.
+func (h *handler) RestoreThread(thread *pbContext.Thread, r dbmodel.Restore) error {
+	var (
+		id = thread.Id
+	)
+
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		activeContents := tx.Bucket([]byte(activeContentsB))
+		if activeContents == nil {
+			log.Printf("Bucket %s not found\n", activeContentsB)
+			return dbmodel.ErrBucketNotFound
+		}
+		delContents := activeContents.Bucket([]byte(deletedThreadsB))
+		if delContents == nil {
+			log.Printf("Bucket %s not found\n", deletedThreadsB)
+			return dbmodel.ErrBucketNotFound
+		}
+		delTimes := delContents.Bucket([]byte(deletionTimesB))
+		if delTimes == nil {
+			log.Printf("Bucket %s not found\n", deletionTimesB)
+			return dbmodel.ErrBucketNotFound
+		}
+		threadBytes := delContents.Get([]byte(id))
+		if threadBytes == nil {
+			return dbmodel.ErrDeletedThreadNotFound
+		}
+		pbThread := new(pbDataFormat.Content)
+		if err := proto.Unmarshal(threadBytes, pbThread); err != nil {
+			log.Printf("Could not unmarshal content: %v\n", err)
+			return err
+		}
+		if !r.Admin {
+			if pbThread.AuthorId != r.Submitter {
+				return dbmodel.ErrUserNotAllowed
+			}
+			// Threads deleted before deletion times were recorded can only
+			// be restored by an admin.
+			deletedAtB := delTimes.Get([]byte(id))
+			if deletedAtB == nil {
+				return dbmodel.ErrGracePeriodExpired
+			}
+			deletedAt := time.Unix(int64(binary.BigEndian.Uint64(deletedAtB)), 0)
+			now := time.Now()
+			if r.RestoreDate != nil {
+				now = time.Unix(r.RestoreDate.Seconds, 0)
+			}
+			if now.Sub(deletedAt) > r.GracePeriod {
+				return dbmodel.ErrGracePeriodExpired
+			}
+		}
+		if err := activeContents.Put([]byte(id), threadBytes); err != nil {
+			return err
+		}
+		if err := delContents.Delete([]byte(id)); err != nil {
+			log.Printf("Could not delete thread from deleted threads: %v\n", err)
+			return err
+		}
+		if err := delTimes.Delete([]byte(id)); err != nil {
+			log.Printf("Could not delete deletion time: %v\n", err)
+			return err
+		}
+		if err := indexThreadTree(tx, activeContents, id, pbThread); err != nil {
+			return err
+		}
+		if err := retagThread(tx, id); err != nil {
+			return err
+		}
+		return h.restoreThreadRefs(tx, thread, pbThread)
+	})
+}
+
+// restoreThreadRefs enqueues the operations to add the reference to the given
+// thread back to the activity of its author and to the list of saved threads of
+// every user who saved it in the outbox. The users service keeps the last time
+// the author created a thread if it's after the publish date of the thread, so
+// restoring an old thread does not let the author create threads more often.
+func (h *handler) restoreThreadRefs(tx *bolt.Tx, thread *pbContext.Thread, pbThread *pbDataFormat.Content) error {
+	// Append the thread to the activity of the author.
+	req := &pbUsers.CreateThreadRequest{
+		UserId:      pbThread.AuthorId,
+		Ctx:         thread,
+		PublishDate: pbThread.PublishDate,
+	}
+	if err := h.enqueue(tx, opCreateThread, pbThread.AuthorId, req); err != nil {
+		return err
+	}
+	// Add the thread back to the list of saved threads of every user who
+	// saved it.
+	for _, userId := range pbThread.UsersWhoSaved {
+		req := &pbUsers.SaveThreadRequest{
+			UserId: userId,
+			Thread: thread,
+		}
+		if err := h.enqueue(tx, opSaveThread, userId, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
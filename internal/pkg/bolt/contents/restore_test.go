@@ -0,0 +1,123 @@
+package contents_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+)
+
+func TestRestoreThread(t *testing.T) {
+	h, users, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Restored thread", "author")
+	newComment(t, h, thread, 0, "replier")
+	if err := h.AppendUserWhoSaved(thread, "saver"); err != nil {
+		t.Fatalf("Could not save thread: %v\n", err)
+	}
+	before := time.Now().Unix()
+	if err := h.DeleteThread(thread, "author"); err != nil {
+		t.Fatalf("Could not delete thread: %v\n", err)
+	}
+	after := time.Now().Unix()
+	if _, err := h.GetCommentsOverview(thread, nil); err == nil {
+		t.Errorf("Got the comments of a deleted thread\n")
+	}
+	res, err := h.Search(dbmodel.SearchQuery{Text: "comment", Limit: 10})
+	if err != nil {
+		t.Fatalf("Could not search: %v\n", err)
+	}
+	if res.Total != 0 {
+		t.Errorf("Got %d hits for the comment of a deleted thread, want 0\n", res.Total)
+	}
+	// Wait for the operations of the deletion to be delivered.
+	n := len(users.waitDelivered(t, 5))
+
+	const grace = time.Hour
+	r := dbmodel.Restore{
+		Submitter:   "someone else",
+		GracePeriod: grace,
+		RestoreDate: &pbTime.Timestamp{Seconds: before + int64(grace.Seconds())},
+	}
+	if err = h.RestoreThread(thread, r); !errors.Is(err, dbmodel.ErrUserNotAllowed) {
+		t.Errorf("Got %v restoring as another user, want %v\n", err, dbmodel.ErrUserNotAllowed)
+	}
+	// A second past the grace period, the author cannot restore the thread.
+	r.Submitter = "author"
+	r.RestoreDate = &pbTime.Timestamp{Seconds: after + int64(grace.Seconds()) + 1}
+	if err = h.RestoreThread(thread, r); !errors.Is(err, dbmodel.ErrGracePeriodExpired) {
+		t.Errorf("Got %v restoring past the grace period, want %v\n", err, dbmodel.ErrGracePeriodExpired)
+	}
+	// Right at the end of the grace period, the author can.
+	r.RestoreDate = &pbTime.Timestamp{Seconds: before + int64(grace.Seconds())}
+	if err = h.RestoreThread(thread, r); err != nil {
+		t.Fatalf("Could not restore thread within the grace period: %v\n", err)
+	}
+	if err = h.RestoreThread(thread, r); !errors.Is(err, dbmodel.ErrDeletedThreadNotFound) {
+		t.Errorf("Got %v restoring twice, want %v\n", err, dbmodel.ErrDeletedThreadNotFound)
+	}
+
+	// The comments are reachable again, in both the thread and the search
+	// index.
+	if _, err = h.GetThreadContent(thread); err != nil {
+		t.Errorf("Could not get restored thread: %v\n", err)
+	}
+	comments, err := h.GetCommentsOverview(thread, nil)
+	if err != nil {
+		t.Fatalf("Could not get comments of restored thread: %v\n", err)
+	}
+	if len(comments) != 1 {
+		t.Errorf("Got %d comments of restored thread, want 1\n", len(comments))
+	}
+	res, err = h.Search(dbmodel.SearchQuery{Text: "comment", Limit: 10})
+	if err != nil {
+		t.Fatalf("Could not search: %v\n", err)
+	}
+	if res.Total != 1 {
+		t.Errorf("Got %d hits for the comment of a restored thread, want 1\n", res.Total)
+	}
+
+	// The thread is added back to the activity of the author and to the saved
+	// threads of the users who saved it.
+	calls := users.waitDelivered(t, n+2)
+	want := []string{"CreateThread", "SaveThread"}
+	if got := calls[n:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got operations %v delivered after restoring, want %v\n", got, want)
+	}
+}
+
+func TestRestoreThreadAdmin(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	thread := newThread(t, h, "Old thread", "author")
+	if err := h.DeleteThread(thread, "author"); err != nil {
+		t.Fatalf("Could not delete thread: %v\n", err)
+	}
+	// Long past the grace period, only an admin can restore the thread.
+	later := &pbTime.Timestamp{Seconds: time.Now().Add(30 * 24 * time.Hour).Unix()}
+	r := dbmodel.Restore{
+		Submitter:   "author",
+		GracePeriod: time.Hour,
+		RestoreDate: later,
+	}
+	if err := h.RestoreThread(thread, r); !errors.Is(err, dbmodel.ErrGracePeriodExpired) {
+		t.Errorf("Got %v restoring past the grace period, want %v\n", err, dbmodel.ErrGracePeriodExpired)
+	}
+	r = dbmodel.Restore{
+		Submitter:   "admin",
+		Admin:       true,
+		GracePeriod: time.Hour,
+		RestoreDate: later,
+	}
+	if err := h.RestoreThread(thread, r); err != nil {
+		t.Fatalf("Could not restore thread as an admin: %v\n", err)
+	}
+	if _, err := h.GetThreadContent(thread); err != nil {
+		t.Errorf("Could not get restored thread: %v\n", err)
+	}
+}
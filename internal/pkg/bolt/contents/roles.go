@@ -0,0 +1,124 @@
+package contents
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	bolt "go.etcd.io/bbolt"
+)
+
+// rolesBucket returns the bucket of roles.
+func rolesBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	roles := tx.Bucket([]byte(rolesB))
+	if roles == nil {
+		log.Printf("Bucket %s not found\n", rolesB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	return roles, nil
+}
+
+// SetRole grants the given role to the given user, replacing the previous one,
+// if any, and records it in the moderation log. It returns an ErrInvalidRole if
+// the role does not exist.
+func (h *handler) SetRole(userId, role, grantedBy string) error {
+	if (role != dbmodel.RoleModerator) && (role != dbmodel.RoleOwner) {
+		return dbmodel.ErrInvalidRole
+	}
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		roles, err := rolesBucket(tx)
+		if err != nil {
+			return err
+		}
+		r := dbmodel.Role{
+			UserId:    userId,
+			Role:      role,
+			GrantedBy: grantedBy,
+			GrantedAt: time.Now().Unix(),
+		}
+		roleBytes, err := json.Marshal(r)
+		if err != nil {
+			log.Printf("Could not marshal role: %v\n", err)
+			return err
+		}
+		if err = roles.Put([]byte(userId), roleBytes); err != nil {
+			return err
+		}
+		return logModeration(tx, &dbmodel.ModerationAction{
+			Action:       dbmodel.ActionSetRole,
+			TargetUserId: userId,
+			Role:         role,
+			UserId:       grantedBy,
+		})
+	})
+}
+
+// RemoveRole revokes the role of the given user and records it in the
+// moderation log. It returns an ErrNoRole if the user has no role.
+func (h *handler) RemoveRole(userId, removedBy string) error {
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		roles, err := rolesBucket(tx)
+		if err != nil {
+			return err
+		}
+		if roles.Get([]byte(userId)) == nil {
+			return dbmodel.ErrNoRole
+		}
+		if err = roles.Delete([]byte(userId)); err != nil {
+			return err
+		}
+		return logModeration(tx, &dbmodel.ModerationAction{
+			Action:       dbmodel.ActionRemoveRole,
+			TargetUserId: userId,
+			UserId:       removedBy,
+		})
+	})
+}
+
+// GetRole returns the role of the given user, or an empty string if the user
+// has none.
+func (h *handler) GetRole(userId string) (string, error) {
+	var role string
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		roles, err := rolesBucket(tx)
+		if err != nil {
+			return err
+		}
+		roleBytes := roles.Get([]byte(userId))
+		if roleBytes == nil {
+			return nil
+		}
+		r := new(dbmodel.Role)
+		if err = json.Unmarshal(roleBytes, r); err != nil {
+			log.Printf("Could not unmarshal role: %v\n", err)
+			return err
+		}
+		role = r.Role
+		return nil
+	})
+	return role, err
+}
+
+// ListRoles returns the users with a role, sorted by user id.
+func (h *handler) ListRoles() ([]*dbmodel.Role, error) {
+	var list []*dbmodel.Role
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		roles, err := rolesBucket(tx)
+		if err != nil {
+			return err
+		}
+		return roles.ForEach(func(k, v []byte) error {
+			r := new(dbmodel.Role)
+			if err := json.Unmarshal(v, r); err != nil {
+				log.Printf("Could not unmarshal role: %v\n", err)
+				return err
+			}
+			list = append(list, r)
+			return nil
+		})
+	})
+	return list, err
+}
@@ -0,0 +1,551 @@
+package contents
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// Words shorter than minTermLen or longer than maxTermLen runes are not
+	// indexed.
+	minTermLen = 2
+	maxTermLen = 64
+	// titleWeight is how many times each word in the title of a thread
+	// counts.
+	titleWeight = 2
+	// Parameters of the BM25 ranking of results.
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Kinds of documents in postings.
+const (
+	threadPosting  = 't'
+	commentPosting = 'c' // Either a comment or a subcomment.
+	postingLen     = 17
+)
+
+// searchIndexVersion is the version of the layout of the search index. Indexes
+// of a different version are rebuilt when the database is open. Version 2 added
+// the kind of document to postings.
+const searchIndexVersion = 2
+
+// keys of the bucket of the search index
+const (
+	versionK  = "version"
+	docCountK = "docs"
+	totalLenK = "length"
+)
+
+// searchDoc is a content in the search index. It's saved as JSON in the bucket
+// of indexed documents, under the revision key of the content, which does not
+// change when the content is archived, so clean ups leave the index alone.
+type searchDoc struct {
+	ThreadId     string   `json:"thread_id"`
+	CommentId    string   `json:"comment_id,omitempty"`
+	SubcommentId string   `json:"subcomment_id,omitempty"`
+	Length       int      `json:"length"`
+	Terms        []string `json:"terms"`
+}
+
+// tokenize splits text into lowercase words of letters and digits, dropping
+// the ones too short or too long to be indexed.
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := words[:0]
+	for _, w := range words {
+		if n := utf8.RuneCountInString(w); (n >= minTermLen) && (n <= maxTermLen) {
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+// postingKey returns the key of the posting of the given term in the document
+// with the given key. Terms never hold a zero byte, so the postings of a term
+// are the keys with the term and a zero byte as prefix.
+func postingKey(term, key string) []byte {
+	return []byte(term + "\x00" + key)
+}
+
+// searchBuckets returns the bucket of the search index and its buckets of
+// postings and indexed documents.
+func searchBuckets(tx *bolt.Tx) (index, postings, docs *bolt.Bucket, err error) {
+	index = tx.Bucket([]byte(searchIndexB))
+	if index == nil {
+		log.Printf("Bucket %s not found\n", searchIndexB)
+		return nil, nil, nil, dbmodel.ErrBucketNotFound
+	}
+	postings = index.Bucket([]byte(postingsB))
+	if postings == nil {
+		log.Printf("Bucket %s not found\n", postingsB)
+		return nil, nil, nil, dbmodel.ErrBucketNotFound
+	}
+	docs = index.Bucket([]byte(searchDocsB))
+	if docs == nil {
+		log.Printf("Bucket %s not found\n", searchDocsB)
+		return nil, nil, nil, dbmodel.ErrBucketNotFound
+	}
+	return index, postings, docs, nil
+}
+
+// getStat returns the value of the given key of the bucket of the search index.
+func getStat(index *bolt.Bucket, k string) uint64 {
+	v := index.Get([]byte(k))
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// addStat adds delta to the value of the given key of the bucket of the search
+// index.
+func addStat(index *bolt.Bucket, k string, delta int) error {
+	n := int64(getStat(index, k)) + int64(delta)
+	if n < 0 {
+		n = 0
+	}
+	return index.Put([]byte(k), itob(uint64(n)))
+}
+
+// addToIndex indexes the given content under key, replacing its previous entry,
+// if any. The title is only indexed for threads.
+func addToIndex(tx *bolt.Tx, key string, doc searchDoc, pbContent *pbDataFormat.Content) error {
+	if err := removeFromIndex(tx, key); err != nil {
+		return err
+	}
+	index, postings, docs, err := searchBuckets(tx)
+	if err != nil {
+		return err
+	}
+	freqs := make(map[string]int)
+	if doc.CommentId == "" {
+		for _, term := range tokenize(pbContent.Title) {
+			freqs[term] += titleWeight
+		}
+	}
+	for _, term := range tokenize(pbContent.Content) {
+		freqs[term]++
+	}
+	if len(freqs) == 0 {
+		return nil
+	}
+	for term, tf := range freqs {
+		doc.Terms = append(doc.Terms, term)
+		doc.Length += tf
+	}
+	sort.Strings(doc.Terms)
+	kind := byte(threadPosting)
+	if doc.CommentId != "" {
+		kind = commentPosting
+	}
+	for term, tf := range freqs {
+		// Keep the length and kind of the document next to the frequency of
+		// the term, so ranking does not need to read the documents.
+		v := append(itob(uint64(tf)), itob(uint64(doc.Length))...)
+		v = append(v, kind)
+		if err = postings.Put(postingKey(term, key), v); err != nil {
+			return err
+		}
+	}
+	docBytes, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err = docs.Put([]byte(key), docBytes); err != nil {
+		return err
+	}
+	if err = addStat(index, docCountK, 1); err != nil {
+		return err
+	}
+	return addStat(index, totalLenK, doc.Length)
+}
+
+// removeFromIndex removes the content with the given key from the search index,
+// if it's there.
+func removeFromIndex(tx *bolt.Tx, key string) error {
+	index, postings, docs, err := searchBuckets(tx)
+	if err != nil {
+		return err
+	}
+	docBytes := docs.Get([]byte(key))
+	if docBytes == nil {
+		return nil
+	}
+	doc := new(searchDoc)
+	if err = json.Unmarshal(docBytes, doc); err != nil {
+		return err
+	}
+	for _, term := range doc.Terms {
+		if err = postings.Delete(postingKey(term, key)); err != nil {
+			return err
+		}
+	}
+	if err = docs.Delete([]byte(key)); err != nil {
+		return err
+	}
+	if err = addStat(index, docCountK, -1); err != nil {
+		return err
+	}
+	return addStat(index, totalLenK, -doc.Length)
+}
+
+// removeTreeFromIndex removes the contents whose keys start with the given
+// prefix from the search index.
+func removeTreeFromIndex(tx *bolt.Tx, prefix string) error {
+	_, _, docs, err := searchBuckets(tx)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	c := docs.Cursor()
+	for k, _ := c.Seek([]byte(prefix)); (k != nil) && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+		keys = append(keys, string(k))
+	}
+	for _, key := range keys {
+		if err = removeFromIndex(tx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexThread, indexComment and indexSubcomment add the given content to the
+// search index, replacing its previous entry, if any.
+func indexThread(tx *bolt.Tx, threadId string, pbThread *pbDataFormat.Content) error {
+	doc := searchDoc{ThreadId: threadId}
+	return addToIndex(tx, threadKey(threadId), doc, pbThread)
+}
+
+func indexComment(tx *bolt.Tx, threadId, commentId string, pbComment *pbDataFormat.Content) error {
+	doc := searchDoc{ThreadId: threadId, CommentId: commentId}
+	return addToIndex(tx, commentKey(threadId, commentId), doc, pbComment)
+}
+
+func indexSubcomment(tx *bolt.Tx, threadId, commentId, subcommentId string,
+	pbSubcomment *pbDataFormat.Content) error {
+	doc := searchDoc{
+		ThreadId:     threadId,
+		CommentId:    commentId,
+		SubcommentId: subcommentId,
+	}
+	key := subcommentKey(threadId, commentId, subcommentId)
+	return addToIndex(tx, key, doc, pbSubcomment)
+}
+
+// unindexThread removes the given thread, along with its comments and
+// subcomments, from the search index.
+func unindexThread(tx *bolt.Tx, threadId string) error {
+	key := threadKey(threadId)
+	if err := removeFromIndex(tx, key); err != nil {
+		return err
+	}
+	return removeTreeFromIndex(tx, key+"/")
+}
+
+// unindexComment removes the given comment, along with its subcomments, from
+// the search index.
+func unindexComment(tx *bolt.Tx, threadId, commentId string) error {
+	key := commentKey(threadId, commentId)
+	if err := removeFromIndex(tx, key); err != nil {
+		return err
+	}
+	return removeTreeFromIndex(tx, key+"/")
+}
+
+// unindexSubcomment removes the given subcomment from the search index.
+func unindexSubcomment(tx *bolt.Tx, threadId, commentId, subcommentId string) error {
+	return removeFromIndex(tx, subcommentKey(threadId, commentId, subcommentId))
+}
+
+// indexThreadTree adds the given thread, along with the comments and
+// subcomments held by the bucket of comments of the given bucket of either
+// active or archived contents, to the search index. Subcomments of deleted
+// comments are skipped.
+func indexThreadTree(tx *bolt.Tx, contents *bolt.Bucket, threadId string,
+	pbThread *pbDataFormat.Content) error {
+	if err := indexThread(tx, threadId, pbThread); err != nil {
+		return err
+	}
+	commentsBucket := contents.Bucket([]byte(commentsB))
+	if commentsBucket == nil {
+		log.Printf("Bucket %s not found\n", commentsB)
+		return dbmodel.ErrBucketNotFound
+	}
+	comments := commentsBucket.Bucket([]byte(threadId))
+	if comments == nil {
+		// The thread has no comments.
+		return nil
+	}
+	subcomments := comments.Bucket([]byte(subcommentsB))
+	return comments.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil
+		}
+		commentId := string(k)
+		pbComment := new(pbDataFormat.Content)
+		if err := proto.Unmarshal(v, pbComment); err != nil {
+			log.Printf("Could not unmarshal content: %v\n", err)
+			return err
+		}
+		if err := indexComment(tx, threadId, commentId, pbComment); err != nil {
+			return err
+		}
+		if subcomments == nil {
+			return nil
+		}
+		subcomKeys := subcomments.Bucket(k)
+		if subcomKeys == nil {
+			return nil
+		}
+		return subcomKeys.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return nil
+			}
+			pbSubcomment := new(pbDataFormat.Content)
+			if err := proto.Unmarshal(v, pbSubcomment); err != nil {
+				log.Printf("Could not unmarshal content: %v\n", err)
+				return err
+			}
+			return indexSubcomment(tx, threadId, commentId, string(k), pbSubcomment)
+		})
+	})
+}
+
+// createSearchIndex creates the bucket of the search index, along with its
+// buckets of postings and indexed documents, and indexes every active and
+// archived thread, comment and subcomment. Deleted contents are left out.
+func createSearchIndex(tx *bolt.Tx) error {
+	index, err := tx.CreateBucket([]byte(searchIndexB))
+	if err != nil {
+		log.Printf("Could not create bucket %s: %v\n", searchIndexB, err)
+		return err
+	}
+	if _, err = index.CreateBucket([]byte(postingsB)); err != nil {
+		log.Printf("Could not create bucket %s: %v\n", postingsB, err)
+		return err
+	}
+	if _, err = index.CreateBucket([]byte(searchDocsB)); err != nil {
+		log.Printf("Could not create bucket %s: %v\n", searchDocsB, err)
+		return err
+	}
+	if err = index.Put([]byte(versionK), itob(searchIndexVersion)); err != nil {
+		return err
+	}
+	for _, name := range []string{activeContentsB, archivedContentsB} {
+		contents := tx.Bucket([]byte(name))
+		if contents == nil {
+			log.Printf("Bucket %s not found\n", name)
+			return dbmodel.ErrBucketNotFound
+		}
+		err = contents.ForEach(func(k, v []byte) error {
+			// Skip nested buckets.
+			if v == nil {
+				return nil
+			}
+			pbThread := new(pbDataFormat.Content)
+			if err := proto.Unmarshal(v, pbThread); err != nil {
+				log.Printf("Could not unmarshal content %s: %v\n", k, err)
+				return err
+			}
+			return indexThreadTree(tx, contents, string(k), pbThread)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildSearchIndex drops the search index, if it exists, and creates it
+// again.
+func rebuildSearchIndex(tx *bolt.Tx) error {
+	if tx.Bucket([]byte(searchIndexB)) != nil {
+		if err := tx.DeleteBucket([]byte(searchIndexB)); err != nil {
+			return err
+		}
+	}
+	return createSearchIndex(tx)
+}
+
+// RebuildSearchIndex drops the search index and indexes every active and
+// archived content of the section again, in a single transaction. It returns
+// the number of contents indexed.
+func (h *handler) RebuildSearchIndex() (int, error) {
+	var n int
+	err := h.section.contents.Update(func(tx *bolt.Tx) error {
+		if err := rebuildSearchIndex(tx); err != nil {
+			return err
+		}
+		index, _, _, err := searchBuckets(tx)
+		if err != nil {
+			return err
+		}
+		n = int(getStat(index, docCountK))
+		return nil
+	})
+	return n, err
+}
+
+// searchHit is a content matching a search and its score.
+type searchHit struct {
+	key   string
+	score float64
+	doc   searchDoc
+	c     *pbDataFormat.Content
+}
+
+// Search looks for the active and archived threads, comments and subcomments
+// holding any of the words in the given query, ranks them by BM25 and returns
+// the requested page of them, along with the number of contents matching the
+// query. Words in the title of a thread count twice.
+func (h *handler) Search(q dbmodel.SearchQuery) (*dbmodel.SearchResults, error) {
+	var (
+		res     = new(dbmodel.SearchResults)
+		page    []*searchHit
+		section = &pbContext.Section{
+			Id: h.section.id,
+		}
+	)
+	terms := tokenize(q.Text)
+	if len(terms) == 0 {
+		return res, nil
+	}
+	sort.Strings(terms)
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		index, postings, docs, err := searchBuckets(tx)
+		if err != nil {
+			return err
+		}
+		n := float64(getStat(index, docCountK))
+		if n == 0 {
+			return nil
+		}
+		avgLen := float64(getStat(index, totalLenK)) / n
+		scores := make(map[string]float64)
+		for i, term := range terms {
+			if (i > 0) && (term == terms[i-1]) {
+				continue
+			}
+			prefix := []byte(term + "\x00")
+			var matches [][]byte
+			c := postings.Cursor()
+			for k, v := c.Seek(prefix); (k != nil) && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				if len(v) != postingLen {
+					continue
+				}
+				if q.ThreadsOnly && (v[16] != threadPosting) {
+					continue
+				}
+				matches = append(matches, append(copyBytes(k[len(prefix):]), v...))
+			}
+			df := float64(len(matches))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			for _, m := range matches {
+				v := m[len(m)-postingLen:]
+				key := string(m[:len(m)-postingLen])
+				tf := float64(binary.BigEndian.Uint64(v[:8]))
+				length := float64(binary.BigEndian.Uint64(v[8:16]))
+				norm := tf + bm25K1*(1-bm25B+bm25B*length/avgLen)
+				scores[key] += idf * tf * (bm25K1 + 1) / norm
+			}
+		}
+		hits := make([]*searchHit, 0, len(scores))
+		for key, score := range scores {
+			hits = append(hits, &searchHit{key: key, score: score})
+		}
+		sort.Slice(hits, func(i, j int) bool {
+			if hits[i].score != hits[j].score {
+				return hits[i].score > hits[j].score
+			}
+			return hits[i].key < hits[j].key
+		})
+		res.Total = len(hits)
+		if q.Offset >= len(hits) {
+			return nil
+		}
+		hits = hits[q.Offset:]
+		if (q.Limit > 0) && (q.Limit < len(hits)) {
+			hits = hits[:q.Limit]
+		}
+		for _, hit := range hits {
+			docBytes := docs.Get([]byte(hit.key))
+			if docBytes == nil {
+				continue
+			}
+			if err = json.Unmarshal(docBytes, &hit.doc); err != nil {
+				return err
+			}
+			var contentBytes []byte
+			d := hit.doc
+			switch {
+			case d.SubcommentId != "":
+				contentBytes, err = getSubcommentBytes(tx, d.ThreadId, d.CommentId, d.SubcommentId)
+			case d.CommentId != "":
+				contentBytes, err = getCommentBytes(tx, d.ThreadId, d.CommentId)
+			default:
+				contentBytes, err = getThreadBytes(tx, d.ThreadId)
+			}
+			if err != nil {
+				log.Printf("Could not find indexed content %s: %v\n", hit.key, err)
+				continue
+			}
+			hit.c = new(pbDataFormat.Content)
+			if err = proto.Unmarshal(contentBytes, hit.c); err != nil {
+				log.Printf("Could not unmarshal content: %v\n", err)
+				return err
+			}
+			page = append(page, hit)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Format the contents after the transaction, since it queries the users
+	// service for the authors.
+	for _, hit := range page {
+		var (
+			d      = hit.doc
+			thread = &pbContext.Thread{
+				Id:         d.ThreadId,
+				SectionCtx: section,
+			}
+			rule *pbApi.ContentRule
+		)
+		switch {
+		case d.SubcommentId != "":
+			comment := &pbContext.Comment{
+				Id:        d.CommentId,
+				ThreadCtx: thread,
+			}
+			rule = h.formatSubcommentContentRule(hit.c, comment, d.SubcommentId)
+		case d.CommentId != "":
+			rule = h.formatCommentContentRule(hit.c, thread, d.CommentId)
+		default:
+			rule = h.formatThreadContentRule(hit.c, section, d.ThreadId)
+		}
+		res.Hits = append(res.Hits, dbmodel.SearchHit{
+			Content: rule,
+			Score:   hit.score,
+		})
+	}
+	return res, nil
+}
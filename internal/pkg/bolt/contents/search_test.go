@@ -0,0 +1,87 @@
+package contents_test
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+)
+
+// hitId returns the id of the given hit if it's a thread.
+func hitId(hit dbmodel.SearchHit) string {
+	if ctx, ok := hit.Content.ContentContext.(*pbApi.ContentRule_ThreadCtx); ok {
+		return ctx.ThreadCtx.Id
+	}
+	return ""
+}
+
+func TestSearchRanking(t *testing.T) {
+	h, _, done := newHandler(t, dbmodel.QAThresholds{})
+	defer done()
+
+	// Users create a single thread between clean ups, so every thread has an
+	// author of its own.
+	create := func(title, content string) *pbContext.Thread {
+		t.Helper()
+		c := &pbApi.Content{
+			Title:       title,
+			Content:     content,
+			PublishDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+		}
+		permalink, err := h.CreateThread(c, title, dbmodel.NewThread{})
+		if err != nil {
+			t.Fatalf("Could not create thread %q: %v\n", title, err)
+		}
+		return &pbContext.Thread{
+			Id:         path.Base(permalink),
+			SectionCtx: &pbContext.Section{Id: testSection},
+		}
+	}
+	inTitle := create("Gardening tips", "Water the plants early")
+	inContent := create("My weekend", "Some gardening and some reading")
+	other := create("Cooking", "Pasta with tomatoes")
+	reply := dbmodel.Reply{
+		Content:     "Gardening beats cooking",
+		Submitter:   "replier",
+		PublishDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+	}
+	if _, err := h.ReplyThread(other, reply); err != nil {
+		t.Fatalf("Could not reply thread: %v\n", err)
+	}
+
+	// Words in the title count twice, so the thread with the word in its
+	// title ranks first among threads.
+	res, err := h.Search(dbmodel.SearchQuery{Text: "GARDENING", Limit: 10, ThreadsOnly: true})
+	if err != nil {
+		t.Fatalf("Could not search: %v\n", err)
+	}
+	if (res.Total != 2) || (len(res.Hits) != 2) {
+		t.Fatalf("Got %d hits of %d, want 2 of 2\n", len(res.Hits), res.Total)
+	}
+	if (hitId(res.Hits[0]) != inTitle.Id) || (hitId(res.Hits[1]) != inContent.Id) {
+		t.Errorf("Got hits %s and %s, want %s and %s\n", hitId(res.Hits[0]), hitId(res.Hits[1]),
+			inTitle.Id, inContent.Id)
+	}
+	if res.Hits[0].Score <= res.Hits[1].Score {
+		t.Errorf("Got scores %v and %v, want them decreasing\n", res.Hits[0].Score, res.Hits[1].Score)
+	}
+
+	// Comments match too, and the total counts every page.
+	if res, err = h.Search(dbmodel.SearchQuery{Text: "gardening", Offset: 2, Limit: 2}); err != nil {
+		t.Fatalf("Could not search: %v\n", err)
+	}
+	if (res.Total != 3) || (len(res.Hits) != 1) {
+		t.Fatalf("Got %d hits of %d in the last page, want 1 of 3\n", len(res.Hits), res.Total)
+	}
+	// Words matching nothing add nothing.
+	if res, err = h.Search(dbmodel.SearchQuery{Text: "pasta unknownword", Limit: 10}); err != nil {
+		t.Fatalf("Could not search: %v\n", err)
+	}
+	if (res.Total != 1) || (hitId(res.Hits[0]) != other.Id) {
+		t.Errorf("Got %d hits, want only thread %s\n", res.Total, other.Id)
+	}
+}
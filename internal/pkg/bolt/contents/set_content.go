@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/golang/protobuf/proto"
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
 	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
 	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
 	pbUsers "github.com/luisguve/cheroproto-go/userapi"
@@ -32,9 +34,16 @@ func itob(v uint64) []byte {
 // converting it to lowercase, and builds the permalink with the format
 // /{section-id}/{thread-id}.
 //
-// Then, it appends the just created thread to the list of threads created in
-// the recent activity of the author.
-func (h *handler) CreateThread(content *pbApi.Content, userId string) (string, error) {
+// A user can create a single thread in the section between clean ups. The
+// last time the author created a thread is checked and set in the same
+// transaction that saves the thread, since the time the users service keeps is
+// only updated once the outbox delivers the thread.
+//
+// Then, it saves the tags and the poll of the thread, if any, adds the thread to
+// the search index and enqueues the operation to append the just created thread
+// to the list of threads created in the recent activity of the author in the
+// outbox.
+func (h *handler) CreateThread(content *pbApi.Content, userId string, t dbmodel.NewThread) (string, error) {
 	var (
 		permalink string
 		section = &pbContext.Section{
@@ -42,27 +51,31 @@ func (h *handler) CreateThread(content *pbApi.Content, userId string) (string, e
 		}
 	)
 
-	// Save thread and user in the same transaction.
-	err := h.section.contents.Update(func(tx *bolt.Tx) error {
-		// Get author data.
-		req := &pbUsers.GetBasicUserDataRequest{UserId: userId}
-		pbUser, err := h.users.GetUserHeaderData(context.Background(), req)
-		if err != nil {
-			return err
+	// Get author data before the transaction, so a slow users service does
+	// not hold the database.
+	req := &pbUsers.GetBasicUserDataRequest{UserId: userId}
+	pbUser, err := h.users.GetUserHeaderData(context.Background(), req)
+	if err != nil {
+		return "", err
+	}
+	// The last time this user created a thread must be before the last clean
+	// up.
+	if pbUser.LastTimeCreated != nil {
+		if !(pbUser.LastTimeCreated.Seconds < h.LastQA()) {
+			return "", dbmodel.ErrUserNotAllowed
 		}
+	}
 
-		// The last time this user created a thread must be before the last clean
-		// up.
-		if pbUser.LastTimeCreated != nil {
-			if !(pbUser.LastTimeCreated.Seconds < h.lastQA) {
-				return dbmodel.ErrUserNotAllowed
-			}
-		}
+	// Save thread and enqueue the update of the user in the same transaction.
+	err = h.section.contents.Update(func(tx *bolt.Tx) error {
 		activeContents := tx.Bucket([]byte(activeContentsB))
 		if activeContents == nil {
 			log.Printf("Bucket %s not found\n", activeContentsB)
 			return dbmodel.ErrBucketNotFound
 		}
+		if err := setLastCreated(tx, userId, content.PublishDate, h.LastQA()); err != nil {
+			return err
+		}
 		seq, _ := activeContents.NextSequence()
 		seqB := itob(seq)
 		hash := sha1.New()
@@ -103,6 +116,15 @@ func (h *handler) CreateThread(content *pbApi.Content, userId string) (string, e
 		if err != nil {
 			return err
 		}
+		if err = setTags(tx, newId, t.Tags); err != nil {
+			return err
+		}
+		if err = setPoll(tx, newId, t.Poll); err != nil {
+			return err
+		}
+		if err = indexThread(tx, newId, pbContent); err != nil {
+			return err
+		}
 		threadCtx := &pbContext.Thread{
 			Id:         newId,
 			SectionCtx: section,
@@ -113,8 +135,7 @@ func (h *handler) CreateThread(content *pbApi.Content, userId string) (string, e
 			PublishDate: content.PublishDate,
 		}
 		// Update users' recent activity by appending a thread.
-		_, err = h.users.CreateThread(context.Background(), reqUpdateUser)
-		return err
+		return h.enqueue(tx, opCreateThread, userId, reqUpdateUser)
 	})
 	if err != nil {
 		return "", err
@@ -122,6 +143,27 @@ func (h *handler) CreateThread(content *pbApi.Content, userId string) (string, e
 	return permalink, nil
 }
 
+// setLastCreated sets the given publish date as the last time the given user
+// created a thread in the section, or returns ErrUserNotAllowed if the user
+// already created a thread after the last clean up, done at lastQA.
+func setLastCreated(tx *bolt.Tx, userId string, publishDate *pbTime.Timestamp, lastQA int64) error {
+	lastCreated := tx.Bucket([]byte(lastCreatedB))
+	if lastCreated == nil {
+		log.Printf("Bucket %s not found\n", lastCreatedB)
+		return dbmodel.ErrBucketNotFound
+	}
+	if v := lastCreated.Get([]byte(userId)); v != nil {
+		if !(int64(binary.BigEndian.Uint64(v)) < lastQA) {
+			return dbmodel.ErrUserNotAllowed
+		}
+	}
+	createdAt := time.Now().Unix()
+	if publishDate != nil {
+		createdAt = publishDate.Seconds
+	}
+	return lastCreated.Put([]byte(userId), itob(uint64(createdAt)))
+}
+
 func (h *handler) AppendUserWhoSaved(thread *pbContext.Thread, userId string) error {
 	var (
 		id = thread.Id
@@ -152,8 +194,7 @@ func (h *handler) AppendUserWhoSaved(thread *pbContext.Thread, userId string) er
 			UserId: userId,
 			Thread: thread,
 		}
-		_, err = h.users.SaveThread(context.Background(), reqUpdateUser)
-		return err
+		return h.enqueue(tx, opSaveThread, userId, reqUpdateUser)
 	})
 }
 
@@ -199,7 +240,6 @@ func (h *handler) RemoveUserWhoSaved(thread *pbContext.Thread, userId string) er
 			UserId: userId,
 			Ctx:    thread,
 		}
-		_, err = h.users.RemoveSaved(context.Background(), reqUpdateUser)
-		return err
+		return h.enqueue(tx, opRemoveSaved, userId, reqUpdateUser)
 	})
 }
@@ -0,0 +1,220 @@
+package contents
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	bolt "go.etcd.io/bbolt"
+)
+
+// setTags saves the tags of the given thread and adds the thread to the bucket
+// of each of them.
+func setTags(tx *bolt.Tx, threadId string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	tagsBucket := tx.Bucket([]byte(tagsB))
+	if tagsBucket == nil {
+		log.Printf("Bucket %s not found\n", tagsB)
+		return dbmodel.ErrBucketNotFound
+	}
+	byThread := tagsBucket.Bucket([]byte(byThreadB))
+	if byThread == nil {
+		log.Printf("Bucket %s not found\n", byThreadB)
+		return dbmodel.ErrBucketNotFound
+	}
+	tagsBytes, err := json.Marshal(tags)
+	if err != nil {
+		log.Printf("Could not marshal tags: %v\n", err)
+		return err
+	}
+	if err = byThread.Put([]byte(threadId), tagsBytes); err != nil {
+		return err
+	}
+	return retagThread(tx, threadId)
+}
+
+// threadTags returns the tags saved for the given thread, if any.
+func threadTags(tx *bolt.Tx, threadId string) ([]string, error) {
+	tagsBucket := tx.Bucket([]byte(tagsB))
+	if tagsBucket == nil {
+		log.Printf("Bucket %s not found\n", tagsB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	byThread := tagsBucket.Bucket([]byte(byThreadB))
+	if byThread == nil {
+		log.Printf("Bucket %s not found\n", byThreadB)
+		return nil, dbmodel.ErrBucketNotFound
+	}
+	tagsBytes := byThread.Get([]byte(threadId))
+	if tagsBytes == nil {
+		return nil, nil
+	}
+	var tags []string
+	if err := json.Unmarshal(tagsBytes, &tags); err != nil {
+		log.Printf("Could not unmarshal tags: %v\n", err)
+		return nil, err
+	}
+	return tags, nil
+}
+
+// retagThread adds the given thread to the bucket of each of its saved tags.
+func retagThread(tx *bolt.Tx, threadId string) error {
+	tags, err := threadTags(tx, threadId)
+	if err != nil {
+		return err
+	}
+	tagsBucket := tx.Bucket([]byte(tagsB))
+	for _, tag := range tags {
+		b, err := tagsBucket.CreateBucketIfNotExists([]byte(tag))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", tag, err)
+			return err
+		}
+		if err = b.Put([]byte(threadId), []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// untagThread removes the given thread from the bucket of each of its tags,
+// removing the buckets left empty, but keeps its tags saved, so the thread can
+// be tagged again if it's restored.
+func untagThread(tx *bolt.Tx, threadId string) error {
+	tags, err := threadTags(tx, threadId)
+	if err != nil {
+		return err
+	}
+	tagsBucket := tx.Bucket([]byte(tagsB))
+	for _, tag := range tags {
+		b := tagsBucket.Bucket([]byte(tag))
+		if b == nil {
+			continue
+		}
+		if err = b.Delete([]byte(threadId)); err != nil {
+			return err
+		}
+		if k, _ := b.Cursor().First(); k == nil {
+			if err = tagsBucket.DeleteBucket([]byte(tag)); err != nil {
+				log.Printf("Could not delete bucket %s: %v\n", tag, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dropTags removes the given thread from the bucket of each of its tags and
+// removes its saved tags. It's called when the thread is gone for good.
+func dropTags(tx *bolt.Tx, threadId string) error {
+	if err := untagThread(tx, threadId); err != nil {
+		return err
+	}
+	byThread := tx.Bucket([]byte(tagsB)).Bucket([]byte(byThreadB))
+	return byThread.Delete([]byte(threadId))
+}
+
+// GetTaggedThreadsOverview returns the metadata of the active threads tagged
+// with the given tag. If setSDF is set, it is used as the callback to set the
+// metadata, otherwise a default one will be used. Threads it returns nil for are
+// left out. Threads are scored as in GetActiveThreadsOverview.
+func (h *handler) GetTaggedThreadsOverview(tag string, setSDF ...patillator.SetSDF) ([]patillator.SegregateDiscarderFinder, error) {
+	var (
+		contents   []patillator.SegregateDiscarderFinder
+		setContent patillator.SetSDF
+	)
+
+	if len(setSDF) > 0 {
+		setContent = setSDF[0]
+	} else {
+		setContent = func(c *pbDataFormat.Content) patillator.SegregateDiscarderFinder {
+			return patillator.Content(*c.Metadata)
+		}
+	}
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		activeContents := tx.Bucket([]byte(activeContentsB))
+		if activeContents == nil {
+			log.Printf("Bucket %s not found\n", activeContentsB)
+			return dbmodel.ErrBucketNotFound
+		}
+		tagsBucket := tx.Bucket([]byte(tagsB))
+		if tagsBucket == nil {
+			log.Printf("Bucket %s not found\n", tagsB)
+			return dbmodel.ErrBucketNotFound
+		}
+		downvotes := tx.Bucket([]byte(downvotesB))
+		if downvotes == nil {
+			log.Printf("Bucket %s not found\n", downvotesB)
+			return dbmodel.ErrBucketNotFound
+		}
+		b := tagsBucket.Bucket([]byte(tag))
+		if (b == nil) || (tag == byThreadB) {
+			return nil
+		}
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			// Archived threads are tagged as well, but only active threads
+			// make it into feeds.
+			threadBytes := activeContents.Get(k)
+			if threadBytes == nil {
+				continue
+			}
+			pbContent := new(pbDataFormat.Content)
+			if err := proto.Unmarshal(threadBytes, pbContent); err != nil {
+				log.Printf("Could not unmarshal content: %v\n", err)
+				return err
+			}
+			if content := setContent(pbContent); content != nil {
+				score := int(pbContent.Upvotes) - threadDownvotes(downvotes, string(k))
+				contents = append(contents, scoreThread(content, score))
+			}
+		}
+		return nil
+	})
+	return contents, err
+}
+
+// ListTags returns every tag in use in the section and the number of active
+// and archived threads tagged with it, from the most used. Ties are sorted by
+// tag.
+func (h *handler) ListTags() ([]dbmodel.TagCount, error) {
+	var tags []dbmodel.TagCount
+
+	err := h.section.contents.View(func(tx *bolt.Tx) error {
+		tagsBucket := tx.Bucket([]byte(tagsB))
+		if tagsBucket == nil {
+			log.Printf("Bucket %s not found\n", tagsB)
+			return dbmodel.ErrBucketNotFound
+		}
+		return tagsBucket.ForEach(func(k, v []byte) error {
+			// Tags are nested buckets, seen with v == nil.
+			if (v != nil) || (string(k) == byThreadB) {
+				return nil
+			}
+			count := 0
+			c := tagsBucket.Bucket(k).Cursor()
+			for id, _ := c.First(); id != nil; id, _ = c.Next() {
+				count++
+			}
+			tags = append(tags, dbmodel.TagCount{Tag: string(k), Threads: count})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Threads != tags[j].Threads {
+			return tags[i].Threads > tags[j].Threads
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags, nil
+}
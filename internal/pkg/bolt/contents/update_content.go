@@ -0,0 +1,421 @@
+package contents
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	bolt "go.etcd.io/bbolt"
+)
+
+// revision is the format in which previous versions of contents are stored in
+// the bucket of revisions. Content holds the protobuf-encoded bytes of the
+// content as it was before the edit done at EditedAt.
+type revision struct {
+	EditedAt int64  `json:"edited_at"`
+	Content  []byte `json:"content"`
+}
+
+// threadKey, commentKey and subcommentKey return the key of the bucket of
+// revisions of a content. Thread ids always end with a hashed sequence and
+// comment and subcomment ids are numeric, so keys of different contents
+// never collide.
+func threadKey(threadId string) string {
+	return threadId
+}
+
+func commentKey(threadId, commentId string) string {
+	return fmt.Sprintf("%s/%s", threadId, commentId)
+}
+
+func subcommentKey(threadId, commentId, subcommentId string) string {
+	return fmt.Sprintf("%s/%s/%s", threadId, commentId, subcommentId)
+}
+
+// revisionKey returns the key of the bucket of revisions of the content
+// pointed to by the given context.
+func revisionKey(content *pbContext.Context) (string, error) {
+	if content == nil {
+		return "", dbmodel.ErrRevisionNotFound
+	}
+	switch ctx := content.Ctx.(type) {
+	case *pbContext.Context_ThreadCtx:
+		return threadKey(ctx.ThreadCtx.Id), nil
+	case *pbContext.Context_CommentCtx:
+		c := ctx.CommentCtx
+		return commentKey(c.ThreadCtx.Id, c.Id), nil
+	case *pbContext.Context_SubcommentCtx:
+		sc := ctx.SubcommentCtx
+		return subcommentKey(sc.CommentCtx.ThreadCtx.Id, sc.CommentCtx.Id, sc.Id), nil
+	}
+	return "", dbmodel.ErrRevisionNotFound
+}
+
+// saveRevision appends the given content bytes to the bucket of revisions of
+// the content with the given key, creating it if it does not exist yet.
+func saveRevision(tx *bolt.Tx, key string, contentBytes []byte, editedAt int64) error {
+	revisions := tx.Bucket([]byte(revisionsB))
+	if revisions == nil {
+		log.Printf("Bucket %s not found\n", revisionsB)
+		return dbmodel.ErrBucketNotFound
+	}
+	contentRevisions, err := revisions.CreateBucketIfNotExists([]byte(key))
+	if err != nil {
+		log.Printf("Could not create bucket %s: %v\n", key, err)
+		return err
+	}
+	seq, _ := contentRevisions.NextSequence()
+	rev := revision{
+		EditedAt: editedAt,
+		Content:  contentBytes,
+	}
+	revBytes, err := json.Marshal(rev)
+	if err != nil {
+		log.Printf("Could not marshal revision: %v\n", err)
+		return err
+	}
+	return contentRevisions.Put(itob(seq), revBytes)
+}
+
+// applyEdit replaces the content of the given content with the one in the
+// given Edit and, if they're set, the featured file and, only if withTitle is
+// true, the title. It drops the featured file if the Edit asks to. It returns
+// the time of the edit or ErrEmptyContent if the Edit has no content.
+func applyEdit(pbContent *pbDataFormat.Content, e dbmodel.Edit, withTitle bool) (int64, error) {
+	if strings.TrimSpace(e.Content) == "" {
+		return 0, dbmodel.ErrEmptyContent
+	}
+	if withTitle && (strings.TrimSpace(e.Title) != "") {
+		pbContent.Title = e.Title
+	}
+	pbContent.Content = e.Content
+	switch {
+	case e.RemoveFtFile:
+		pbContent.FtFile = ""
+	case e.FtFile != "":
+		pbContent.FtFile = e.FtFile
+	}
+	if e.EditDate != nil {
+		return e.EditDate.Seconds, nil
+	}
+	return time.Now().Unix(), nil
+}
+
+// setEditTime saves the given time as the last time the content with the given
+// key was edited. Only edits by the author update it.
+//
+// Neither the content nor its metadata have a field for the time of the last
+// edit, and LastUpdated is the time of the last interaction, which ranks the
+// content in feeds, so the edit time is kept in a bucket of its own.
+func setEditTime(tx *bolt.Tx, key string, editedAt int64) error {
+	editTimes := tx.Bucket([]byte(editTimesB))
+	if editTimes == nil {
+		log.Printf("Bucket %s not found\n", editTimesB)
+		return dbmodel.ErrBucketNotFound
+	}
+	return editTimes.Put([]byte(key), itob(uint64(editedAt)))
+}
+
+// saveEdit appends the given previous version of the content with the given key
+// to its bucket of revisions and records the time of the edit.
+func saveEdit(tx *bolt.Tx, key string, contentBytes []byte, editedAt int64) error {
+	if err := saveRevision(tx, key, contentBytes, editedAt); err != nil {
+		return err
+	}
+	return setEditTime(tx, key, editedAt)
+}
+
+// UpdateThread replaces the title, content and featured file of the given
+// thread with the ones in the given Edit, only if the submitter is the author
+// of the thread. The thread may be either active or archived.
+//
+// The previous version of the thread is appended to its bucket of revisions,
+// along with the time of the edit, which is also saved in the bucket of edit
+// times as the time the thread was last edited at.
+//
+// It returns an ErrThreadNotFound if the thread does not exist, an
+// ErrUserNotAllowed if the submitter is not the author, an ErrEmptyContent if
+// the edit has no content, an ErrContentRemoved if the thread was removed by a
+// moderator or a proto marshal/unmarshal or bolt error.
+func (h *handler) UpdateThread(thread *pbContext.Thread, e dbmodel.Edit) error {
+	var (
+		id = thread.Id
+	)
+
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		threadBytes, err := getThreadBytes(tx, id)
+		if err != nil {
+			log.Printf("Could not find thread %s: %v.\n", id, err)
+			return err
+		}
+		pbThread := new(pbDataFormat.Content)
+		if err = proto.Unmarshal(threadBytes, pbThread); err != nil {
+			log.Printf("Could not unmarshal content: %v\n", err)
+			return err
+		}
+		if pbThread.AuthorId != e.Submitter {
+			return dbmodel.ErrUserNotAllowed
+		}
+		removed, err := isRemoved(tx, threadContext(thread))
+		if err != nil {
+			return err
+		}
+		if removed {
+			return dbmodel.ErrContentRemoved
+		}
+		editedAt, err := applyEdit(pbThread, e, true)
+		if err != nil {
+			return err
+		}
+		if err = saveEdit(tx, threadKey(id), threadBytes, editedAt); err != nil {
+			return err
+		}
+		newThreadBytes, err := proto.Marshal(pbThread)
+		if err != nil {
+			log.Printf("Could not marshal content: %v\n", err)
+			return err
+		}
+		if err = setThreadBytes(tx, id, newThreadBytes); err != nil {
+			return err
+		}
+		return indexThread(tx, id, pbThread)
+	})
+}
+
+// UpdateComment replaces the content and featured file of the given comment
+// with the ones in the given Edit, only if the submitter is the author of the
+// comment. The comment may be either active or archived.
+//
+// The previous version of the comment is appended to its bucket of revisions
+// and the time of the edit is saved in the bucket of edit times.
+//
+// It returns an ErrCommentNotFound if the comment does not exist, an
+// ErrUserNotAllowed if the submitter is not the author, an ErrEmptyContent if
+// the edit has no content, an ErrContentRemoved if the comment was removed by a
+// moderator or a proto marshal/unmarshal or bolt error.
+func (h *handler) UpdateComment(comment *pbContext.Comment, e dbmodel.Edit) error {
+	var (
+		id       = comment.Id
+		threadId = comment.ThreadCtx.Id
+	)
+
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		commentBytes, err := getCommentBytes(tx, threadId, id)
+		if err != nil {
+			log.Printf("Could not find comment %s in bucket %s: %v", id, threadId, err)
+			return err
+		}
+		pbComment := new(pbDataFormat.Content)
+		if err = proto.Unmarshal(commentBytes, pbComment); err != nil {
+			log.Printf("Could not unmarshal content: %v\n", err)
+			return err
+		}
+		if pbComment.AuthorId != e.Submitter {
+			return dbmodel.ErrUserNotAllowed
+		}
+		removed, err := isRemoved(tx, commentContext(comment))
+		if err != nil {
+			return err
+		}
+		if removed {
+			return dbmodel.ErrContentRemoved
+		}
+		editedAt, err := applyEdit(pbComment, e, false)
+		if err != nil {
+			return err
+		}
+		key := commentKey(threadId, id)
+		if err = saveEdit(tx, key, commentBytes, editedAt); err != nil {
+			return err
+		}
+		newCommentBytes, err := proto.Marshal(pbComment)
+		if err != nil {
+			log.Printf("Could not marshal content: %v\n", err)
+			return err
+		}
+		if err = setCommentBytes(tx, threadId, id, newCommentBytes); err != nil {
+			return err
+		}
+		return indexComment(tx, threadId, id, pbComment)
+	})
+}
+
+// UpdateSubcomment replaces the content and featured file of the given
+// subcomment with the ones in the given Edit, only if the submitter is the
+// author of the subcomment. The subcomment may be either active or archived.
+//
+// The previous version of the subcomment is appended to its bucket of
+// revisions and the time of the edit is saved in the bucket of edit times.
+//
+// It returns an ErrSubcommentNotFound if the subcomment does not exist, an
+// ErrUserNotAllowed if the submitter is not the author, an ErrEmptyContent if
+// the edit has no content, an ErrContentRemoved if the subcomment was removed by
+// a moderator or a proto marshal/unmarshal or bolt error.
+func (h *handler) UpdateSubcomment(subcomment *pbContext.Subcomment, e dbmodel.Edit) error {
+	var (
+		id        = subcomment.Id
+		commentId = subcomment.CommentCtx.Id
+		threadId  = subcomment.CommentCtx.ThreadCtx.Id
+	)
+
+	return h.section.contents.Update(func(tx *bolt.Tx) error {
+		subcommentBytes, err := getSubcommentBytes(tx, threadId, commentId, id)
+		if err != nil {
+			log.Printf("Could not find subcomment id %s in bucket %s of bucket %s: %v",
+				id, commentId, threadId, err)
+			return err
+		}
+		pbSubcomment := new(pbDataFormat.Content)
+		if err = proto.Unmarshal(subcommentBytes, pbSubcomment); err != nil {
+			log.Printf("Could not unmarshal content: %v\n", err)
+			return err
+		}
+		if pbSubcomment.AuthorId != e.Submitter {
+			return dbmodel.ErrUserNotAllowed
+		}
+		removed, err := isRemoved(tx, subcommentContext(subcomment))
+		if err != nil {
+			return err
+		}
+		if removed {
+			return dbmodel.ErrContentRemoved
+		}
+		editedAt, err := applyEdit(pbSubcomment, e, false)
+		if err != nil {
+			return err
+		}
+		key := subcommentKey(threadId, commentId, id)
+		if err = saveEdit(tx, key, subcommentBytes, editedAt); err != nil {
+			return err
+		}
+		newSubcommentBytes, err := proto.Marshal(pbSubcomment)
+		if err != nil {
+			log.Printf("Could not marshal content: %v\n", err)
+			return err
+		}
+		err = setSubcommentBytes(tx, threadId, commentId, id, newSubcommentBytes)
+		if err != nil {
+			return err
+		}
+		return indexSubcomment(tx, threadId, commentId, id, pbSubcomment)
+	})
+}
+
+// formatRevision unmarshals the given revision bytes stored under the given
+// sequence number into a *dbmodel.Revision.
+func formatRevision(seqB, revBytes []byte) (*dbmodel.Revision, error) {
+	var rev revision
+	if err := json.Unmarshal(revBytes, &rev); err != nil {
+		log.Printf("Could not unmarshal revision: %v\n", err)
+		return nil, err
+	}
+	pbContent := new(pbDataFormat.Content)
+	if err := proto.Unmarshal(rev.Content, pbContent); err != nil {
+		log.Printf("Could not unmarshal content: %v\n", err)
+		return nil, err
+	}
+	return &dbmodel.Revision{
+		Number:   int(binary.BigEndian.Uint64(seqB)),
+		EditedAt: rev.EditedAt,
+		Content:  pbContent,
+	}, nil
+}
+
+// GetRevisions returns every previous version of the given content, from the
+// oldest to the newest.
+//
+// It returns an ErrRevisionNotFound if the content has never been edited.
+func (h *handler) GetRevisions(content *pbContext.Context) ([]*dbmodel.Revision, error) {
+	key, err := revisionKey(content)
+	if err != nil {
+		return nil, err
+	}
+	var revisions []*dbmodel.Revision
+
+	err = h.section.contents.View(func(tx *bolt.Tx) error {
+		revisionsBucket := tx.Bucket([]byte(revisionsB))
+		if revisionsBucket == nil {
+			log.Printf("Bucket %s not found\n", revisionsB)
+			return dbmodel.ErrBucketNotFound
+		}
+		contentRevisions := revisionsBucket.Bucket([]byte(key))
+		if contentRevisions == nil {
+			return dbmodel.ErrRevisionNotFound
+		}
+		return contentRevisions.ForEach(func(k, v []byte) error {
+			rev, err := formatRevision(k, v)
+			if err != nil {
+				return err
+			}
+			revisions = append(revisions, rev)
+			return nil
+		})
+	})
+	return revisions, err
+}
+
+// GetRevision returns the previous version number n of the given content.
+//
+// It returns an ErrRevisionNotFound if either the content has never been
+// edited or it does not have a revision with the given number.
+func (h *handler) GetRevision(content *pbContext.Context, n int) (*dbmodel.Revision, error) {
+	key, err := revisionKey(content)
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		return nil, dbmodel.ErrRevisionNotFound
+	}
+	var rev *dbmodel.Revision
+
+	err = h.section.contents.View(func(tx *bolt.Tx) error {
+		revisionsBucket := tx.Bucket([]byte(revisionsB))
+		if revisionsBucket == nil {
+			log.Printf("Bucket %s not found\n", revisionsB)
+			return dbmodel.ErrBucketNotFound
+		}
+		contentRevisions := revisionsBucket.Bucket([]byte(key))
+		if contentRevisions == nil {
+			return dbmodel.ErrRevisionNotFound
+		}
+		seqB := itob(uint64(n))
+		revBytes := contentRevisions.Get(seqB)
+		if revBytes == nil {
+			return dbmodel.ErrRevisionNotFound
+		}
+		var err error
+		rev, err = formatRevision(seqB, revBytes)
+		return err
+	})
+	return rev, err
+}
+
+// GetEditTime returns the last time the given content was edited by its
+// author, which is 0 if it was never edited.
+func (h *handler) GetEditTime(content *pbContext.Context) (int64, error) {
+	key, err := revisionKey(content)
+	if err != nil {
+		return 0, err
+	}
+	var editedAt int64
+
+	err = h.section.contents.View(func(tx *bolt.Tx) error {
+		editTimes := tx.Bucket([]byte(editTimesB))
+		if editTimes == nil {
+			log.Printf("Bucket %s not found\n", editTimesB)
+			return dbmodel.ErrBucketNotFound
+		}
+		if v := editTimes.Get([]byte(key)); v != nil {
+			editedAt = int64(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	return editedAt, err
+}
@@ -52,11 +52,13 @@ func inSlice(users []string, user string) (bool, int) {
 // It returns the notification for the owner of the thread and its user id and
 // a nil error on success, or a nil *pbApi.NotifyUser and a nil error if the
 // submitter is the content author, or a nil *pbApi.NotifyUser and an
-// ErrThreadNotFound or proto marshal/unmarshal error on failure.
+// ErrThreadNotFound or proto marshal/unmarshal error on failure. Users who
+// downvoted the thread get an ErrOppositeVote.
 func (h *handler) UpvoteThread(userId string, thread *pbContext.Thread) (*pbApi.NotifyUser, error) {
 	var (
-		id        = thread.Id
-		pbThread  = new(pbDataFormat.Content)
+		id         = thread.Id
+		pbThread   = new(pbDataFormat.Content)
+		notifyUser *pbApi.NotifyUser
 	)
 
 	err := h.section.contents.Update(func(tx *bolt.Tx) error {
@@ -73,6 +75,14 @@ func (h *handler) UpvoteThread(userId string, thread *pbContext.Thread) (*pbApi.
 		if voted, _ := inSlice(pbThread.VoterIds, userId); voted {
 			return dbmodel.ErrUserNotAllowed
 		}
+		// A downvote must be undone before upvoting.
+		down, err := downvoted(tx, threadContext(thread), userId)
+		if err != nil {
+			return err
+		}
+		if down {
+			return dbmodel.ErrOppositeVote
+		}
 		pbThread.Upvotes++
 		pbThread.VoterIds = append(pbThread.VoterIds, userId)
 		// Increment interactions and calculata new average update time only if
@@ -86,14 +96,15 @@ func (h *handler) UpvoteThread(userId string, thread *pbContext.Thread) (*pbApi.
 			log.Printf("Could not marshal content: %v\n", err)
 			return err
 		}
-		return setThreadBytes(tx, id, threadBytes)
-	})
-	if err != nil {
-		return nil, err
-	}
-	// Set notification and notify user only if the submitter is not the author.
-	toNotify := pbThread.AuthorId
-	if userId != toNotify {
+		if err = setThreadBytes(tx, id, threadBytes); err != nil {
+			return err
+		}
+		// Set notification and notify user only if the submitter is not the
+		// author.
+		toNotify := pbThread.AuthorId
+		if userId == toNotify {
+			return nil
+		}
 		var msg string
 		if int(pbThread.Upvotes) > 1 {
 			msg = fmt.Sprintf("%d users have upvoted your thread", pbThread.Upvotes)
@@ -102,10 +113,13 @@ func (h *handler) UpvoteThread(userId string, thread *pbContext.Thread) (*pbApi.
 		}
 		subj := fmt.Sprintf("On your thread %s", pbThread.Title)
 		notifType := pbDataFormat.Notif_UPVOTE
-		notifyUser := h.notifyInteraction(userId, toNotify, msg, subj, notifType, pbThread)
-		return notifyUser, nil
+		notifyUser, err = h.notifyInteraction(tx, userId, toNotify, msg, subj, notifType, pbThread)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil
+	return notifyUser, nil
 }
 
 // UndoUpvoteThread decreases by one the number of upvotes that the thread has
@@ -161,7 +175,8 @@ func (h *handler) UndoUpvoteThread(userId string, thread *pbContext.Thread) erro
 // on failure.
 //
 // It may return just one *pbApi.NotifyUser if the submitter is the author of
-// either the thread or the comment.
+// either the thread or the comment. Users who downvoted the comment get an
+// ErrOppositeVote.
 func (h *handler) UpvoteComment(userId string, comment *pbContext.Comment) ([]*pbApi.NotifyUser, error) {
 	var (
 		commentId = comment.Id
@@ -212,6 +227,14 @@ func (h *handler) UpvoteComment(userId string, comment *pbContext.Comment) ([]*p
 		if voted, _ := inSlice(pbComment.VoterIds, userId); voted {
 			return dbmodel.ErrUserNotAllowed
 		}
+		// A downvote must be undone before upvoting.
+		down, err := downvoted(tx, commentContext(comment), userId)
+		if err != nil {
+			return err
+		}
+		if down {
+			return dbmodel.ErrOppositeVote
+		}
 		pbComment.Upvotes++
 		pbComment.VoterIds = append(pbComment.VoterIds, userId)
 		// Increment interactions and calculata new average update time only
@@ -225,41 +248,50 @@ func (h *handler) UpvoteComment(userId string, comment *pbContext.Comment) ([]*p
 			log.Printf("Could not marshal content: %v.\n", err)
 			return err
 		}
-		return setCommentBytes(tx, threadId, commentId, commentBytes)
+		if err = setCommentBytes(tx, threadId, commentId, commentBytes); err != nil {
+			return err
+		}
+		// Set notification only if the submitter is not the comment author.
+		toNotify := pbComment.AuthorId
+		if userId != toNotify {
+			// set notification
+			var msg string
+			if pbComment.Upvotes > 1 {
+				msg = fmt.Sprintf("%d users have upvoted your comment", pbComment.Upvotes)
+			} else {
+				msg = "1 user has upvoted your comment"
+			}
+			subj := fmt.Sprintf("On your comment on %s", pbComment.Title)
+			notifType := pbDataFormat.Notif_UPVOTE_COMMENT
+			notifyUser, err := h.notifyInteraction(tx, userId, toNotify, msg, subj, notifType, pbComment)
+			if err != nil {
+				return err
+			}
+			notifs = append(notifs, notifyUser)
+		}
+		// Set notification only if the submitter is not the thread author.
+		toNotify = pbThread.AuthorId
+		if userId != toNotify {
+			// set notification
+			var msg string
+			if pbComment.Upvotes > 1 {
+				msg = fmt.Sprintf("%d users have upvoted a comment on your thread", pbComment.Upvotes)
+			} else {
+				msg = "1 user has upvoted a comment on your thread"
+			}
+			subj := fmt.Sprintf("On your thread %s", pbThread.Title)
+			notifType := pbDataFormat.Notif_UPVOTE_COMMENT
+			notifyUser, err := h.notifyInteraction(tx, userId, toNotify, msg, subj, notifType, pbComment)
+			if err != nil {
+				return err
+			}
+			notifs = append(notifs, notifyUser)
+		}
+		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	// Set notification only if the submitter is not the comment author.
-	toNotify := pbComment.AuthorId
-	if userId != toNotify {
-		// set notification
-		var msg string
-		if pbComment.Upvotes > 1 {
-			msg = fmt.Sprintf("%d users have upvoted your comment", pbComment.Upvotes)
-		} else {
-			msg = "1 user has upvoted your comment"
-		}
-		subj := fmt.Sprintf("On your comment on %s", pbComment.Title)
-		notifType := pbDataFormat.Notif_UPVOTE_COMMENT
-		notifyUser := h.notifyInteraction(userId, toNotify, msg, subj, notifType, pbComment)
-		notifs = append(notifs, notifyUser)
-	}
-	// Set notification only if the submitter is not the thread author.
-	toNotify = pbThread.AuthorId
-	if userId != toNotify {
-		// set notification
-		var msg string
-		if pbComment.Upvotes > 1 {
-			msg = fmt.Sprintf("%d users have upvoted a comment on your thread", pbComment.Upvotes)
-		} else {
-			msg = "1 user has upvoted a comment on your thread"
-		}
-		subj := fmt.Sprintf("On your thread %s", pbThread.Title)
-		notifType := pbDataFormat.Notif_UPVOTE_COMMENT
-		notifyUser := h.notifyInteraction(userId, toNotify, msg, subj, notifType, pbComment)
-		notifs = append(notifs, notifyUser)
-	}
 	return notifs, nil
 }
 
@@ -317,7 +349,8 @@ func (h *handler) UndoUpvoteComment(userId string, comment *pbContext.Comment) e
 // marshal/unmarshal error on failure.
 //
 // It may return just one *pbApi.NotifyUser if the submitter is the author of
-// either the thread, or the subcomment.
+// either the thread, or the subcomment. Users who downvoted the subcomment get
+// an ErrOppositeVote.
 func (h *handler) UpvoteSubcomment(userId string, subcomment *pbContext.Subcomment) ([]*pbApi.NotifyUser, error) {
 	var (
 		notifs       []*pbApi.NotifyUser
@@ -391,6 +424,14 @@ func (h *handler) UpvoteSubcomment(userId string, subcomment *pbContext.Subcomme
 		if voted, _ := inSlice(pbSubcomment.VoterIds, userId); voted {
 			return dbmodel.ErrUserNotAllowed
 		}
+		// A downvote must be undone before upvoting.
+		down, err := downvoted(tx, subcommentContext(subcomment), userId)
+		if err != nil {
+			return err
+		}
+		if down {
+			return dbmodel.ErrOppositeVote
+		}
 		pbSubcomment.Upvotes++
 		pbSubcomment.VoterIds = append(pbSubcomment.VoterIds, userId)
 		// Increment interactions and calculata new average update time only
@@ -404,39 +445,48 @@ func (h *handler) UpvoteSubcomment(userId string, subcomment *pbContext.Subcomme
 			log.Printf("Could not marshal subcomment: %v\n", err)
 			return err
 		}
-		return setSubcommentBytes(tx, threadId, commentId, subcommentId, subcommentBytes)
+		if err = setSubcommentBytes(tx, threadId, commentId, subcommentId, subcommentBytes); err != nil {
+			return err
+		}
+		// Set notification only if the submitter is not the subcomment author.
+		toNotify := pbSubcomment.AuthorId
+		if userId != toNotify {
+			var msg string
+			if pbSubcomment.Upvotes > 1 {
+				msg = fmt.Sprintf("%d users have upvoted your comment", pbSubcomment.Upvotes)
+			} else {
+				msg = "1 user has upvoted your comment"
+			}
+			subj := fmt.Sprintf("On your comment on %s", pbSubcomment.Title)
+			notifType := pbDataFormat.Notif_UPVOTE_SUBCOMMENT
+			notifyUser, err := h.notifyInteraction(tx, userId, toNotify, msg, subj, notifType, pbSubcomment)
+			if err != nil {
+				return err
+			}
+			notifs = append(notifs, notifyUser)
+		}
+		// Set notification only if the submitter is not the thread author.
+		toNotify = pbThread.AuthorId
+		if userId != toNotify {
+			var msg string
+			if pbSubcomment.Upvotes > 1 {
+				msg = fmt.Sprintf("%d users have upvoted a comment in your thread", pbSubcomment.Upvotes)
+			} else {
+				msg = "1 user has upvoted a comment in your thread"
+			}
+			subj := fmt.Sprintf("On your thread %s", pbThread.Title)
+			notifType := pbDataFormat.Notif_UPVOTE_SUBCOMMENT
+			notifyUser, err := h.notifyInteraction(tx, userId, toNotify, msg, subj, notifType, pbSubcomment)
+			if err != nil {
+				return err
+			}
+			notifs = append(notifs, notifyUser)
+		}
+		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	// Set notification only if the submitter is not the subcomment author.
-	toNotify := pbSubcomment.AuthorId
-	if userId != toNotify {
-		var msg string
-		if pbSubcomment.Upvotes > 1 {
-			msg = fmt.Sprintf("%d users have upvoted your comment", pbSubcomment.Upvotes)
-		} else {
-			msg = "1 user has upvoted your comment"
-		}
-		subj := fmt.Sprintf("On your comment on %s", pbSubcomment.Title)
-		notifType := pbDataFormat.Notif_UPVOTE_SUBCOMMENT
-		notifyUser := h.notifyInteraction(userId, toNotify, msg, subj, notifType, pbSubcomment)
-		notifs = append(notifs, notifyUser)
-	}
-	// Set notification only if the submitter is not the thread author.
-	toNotify = pbThread.AuthorId
-	if userId != toNotify {
-		var msg string
-		if pbSubcomment.Upvotes > 1 {
-			msg = fmt.Sprintf("%d users have upvoted a comment in your thread", pbSubcomment.Upvotes)
-		} else {
-			msg = "1 user has upvoted a comment in your thread"
-		}
-		subj := fmt.Sprintf("On your thread %s", pbThread.Title)
-		notifType := pbDataFormat.Notif_UPVOTE_SUBCOMMENT
-		notifyUser := h.notifyInteraction(userId, toNotify, msg, subj, notifType, pbSubcomment)
-		notifs = append(notifs, notifyUser)
-	}
 	return notifs, nil
 }
 
@@ -0,0 +1,181 @@
+package users
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/userapi"
+	bolt "go.etcd.io/bbolt"
+)
+
+// globalBanK is the key of the bans from every section in the bucket of bans
+// of a user. Section ids cannot be "*".
+const globalBanK = "*"
+
+// banKey returns the key of the ban from the section with the given id in the
+// bucket of bans of a user.
+func banKey(sectionId string) []byte {
+	if sectionId == "" {
+		return []byte(globalBanK)
+	}
+	return []byte(sectionId)
+}
+
+// getBan returns the ban from the section with the given key in the given
+// bucket of bans of a user, or nil if there's none, whether it's in force or
+// not.
+func getBan(userBans *bolt.Bucket, key []byte) (*dbmodel.Ban, error) {
+	banBytes := userBans.Get(key)
+	if banBytes == nil {
+		return nil, nil
+	}
+	b := new(dbmodel.Ban)
+	if err := json.Unmarshal(banBytes, b); err != nil {
+		log.Printf("Could not unmarshal ban: %v\n", err)
+		return nil, err
+	}
+	return b, nil
+}
+
+// AddBan saves the given ban, replacing the previous ban of the same user from
+// the same section, or from every section, if any. It returns ErrUserNotFound
+// if the user does not exist.
+func (h *handler) AddBan(b dbmodel.Ban) error {
+	return h.users.Update(func(tx *bolt.Tx) error {
+		usersBucket := tx.Bucket([]byte(usersB))
+		if usersBucket == nil {
+			log.Printf("Bucket %s of users not found\n", usersB)
+			return dbmodel.ErrBucketNotFound
+		}
+		if usersBucket.Get([]byte(b.UserId)) == nil {
+			return dbmodel.ErrUserNotFound
+		}
+		bansBucket := tx.Bucket([]byte(bansB))
+		if bansBucket == nil {
+			log.Printf("Bucket %s of users not found\n", bansB)
+			return dbmodel.ErrBucketNotFound
+		}
+		userBans, err := bansBucket.CreateBucketIfNotExists([]byte(b.UserId))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", b.UserId, err)
+			return err
+		}
+		banBytes, err := json.Marshal(b)
+		if err != nil {
+			log.Printf("Could not marshal ban: %v\n", err)
+			return err
+		}
+		return userBans.Put(banKey(b.SectionId), banBytes)
+	})
+}
+
+// LiftBan removes the ban of the given user from the given section or, if the
+// section id is empty, from every section. It returns ErrBanNotFound if the
+// user has no such ban, even an expired one.
+func (h *handler) LiftBan(userId, sectionId string) error {
+	return h.users.Update(func(tx *bolt.Tx) error {
+		bansBucket := tx.Bucket([]byte(bansB))
+		if bansBucket == nil {
+			log.Printf("Bucket %s of users not found\n", bansB)
+			return dbmodel.ErrBucketNotFound
+		}
+		userBans := bansBucket.Bucket([]byte(userId))
+		if (userBans == nil) || (userBans.Get(banKey(sectionId)) == nil) {
+			return dbmodel.ErrBanNotFound
+		}
+		if err := userBans.Delete(banKey(sectionId)); err != nil {
+			return err
+		}
+		// Drop the bucket of bans of the user along with the last one.
+		if k, _ := userBans.Cursor().First(); k == nil {
+			return bansBucket.DeleteBucket([]byte(userId))
+		}
+		return nil
+	})
+}
+
+// ListBans returns the bans in force of the given user or, if the user id is
+// empty, of every user, sorted by user id, with the bans from every section
+// first. Expired bans are left out.
+func (h *handler) ListBans(userId string) ([]*dbmodel.Ban, error) {
+	var (
+		list []*dbmodel.Ban
+		now  = time.Now().Unix()
+	)
+	err := h.users.View(func(tx *bolt.Tx) error {
+		bansBucket := tx.Bucket([]byte(bansB))
+		if bansBucket == nil {
+			log.Printf("Bucket %s of users not found\n", bansB)
+			return dbmodel.ErrBucketNotFound
+		}
+		listUser := func(userBans *bolt.Bucket) error {
+			return userBans.ForEach(func(k, v []byte) error {
+				b, err := getBan(userBans, k)
+				if err != nil {
+					return err
+				}
+				if b.Active(now) {
+					list = append(list, b)
+				}
+				return nil
+			})
+		}
+		if userId != "" {
+			if userBans := bansBucket.Bucket([]byte(userId)); userBans != nil {
+				return listUser(userBans)
+			}
+			return nil
+		}
+		return bansBucket.ForEach(func(k, v []byte) error {
+			if userBans := bansBucket.Bucket(k); userBans != nil {
+				return listUser(userBans)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ActiveBan returns the ban in force of the given user from every section or,
+// if there's none, from the given section, or nil if the user is not banned.
+// If the section id is empty, only the bans from every section are checked.
+func (h *handler) ActiveBan(userId, sectionId string) (*dbmodel.Ban, error) {
+	var (
+		ban *dbmodel.Ban
+		now = time.Now().Unix()
+	)
+	err := h.users.View(func(tx *bolt.Tx) error {
+		bansBucket := tx.Bucket([]byte(bansB))
+		if bansBucket == nil {
+			log.Printf("Bucket %s of users not found\n", bansB)
+			return dbmodel.ErrBucketNotFound
+		}
+		userBans := bansBucket.Bucket([]byte(userId))
+		if userBans == nil {
+			return nil
+		}
+		keys := [][]byte{banKey("")}
+		if sectionId != "" {
+			keys = append(keys, banKey(sectionId))
+		}
+		for _, k := range keys {
+			b, err := getBan(userBans, k)
+			if err != nil {
+				return err
+			}
+			if (b != nil) && b.Active(now) {
+				ban = b
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ban, nil
+}
@@ -4,9 +4,11 @@
 package users
 
 import (
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	dbmodel "github.com/luisguve/cheroapi/internal/app/userapi"
 	bolt "go.etcd.io/bbolt"
@@ -25,6 +27,11 @@ const (
 	// values.
 	lowercasedEmailsB = "LowercasedEmails"
 	idEmailsB         = "IdEmailMappings"
+	// Store the bans of each user in a bucket under the user id, holding
+	// the bans from each section by section id.
+	bansB = "Bans"
+	// Store the shadowbans by user id.
+	shadowbansB = "Shadowbans"
 )
 
 type handler struct {
@@ -37,6 +44,25 @@ func (h *handler) Close() error {
 	return h.users.Close()
 }
 
+// Snapshot writes a consistent copy of the whole database of users to w in a
+// read-only transaction, so it can be called while serving requests. It
+// returns the number of bytes written.
+func (h *handler) Snapshot(w io.Writer) (int64, error) {
+	var n int64
+	err := h.users.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// DBFile returns the path of the database file of users under the directory
+// specified by path.
+func DBFile(path string) string {
+	return filepath.Join(path, "users", "users.db")
+}
+
 // New returns a dbmodel.Handler with a just open bolt database under a "users"
 // folder in the directory specified by path for all the users. If the "users"
 // folder does not exist, it is created.
@@ -47,8 +73,10 @@ func New(path string) (dbmodel.Handler, error) {
 	if _, err := os.Stat(usersPath); os.IsNotExist(err) {
 		os.MkdirAll(usersPath, os.ModeDir)
 	}
-	usersFile := filepath.Join(usersPath, "users.db")
-	usersDB, err := bolt.Open(usersFile, 0600, nil)
+	usersFile := DBFile(path)
+	// Fail instead of waiting forever if another process, such as a running
+	// users service, holds the database.
+	usersDB, err := bolt.Open(usersFile, 0600, &bolt.Options{Timeout: 5 * time.Second})
 	if err != nil {
 		return nil, err
 	}
@@ -98,6 +126,18 @@ func New(path string) (dbmodel.Handler, error) {
 			log.Printf("Could not create bucket %s: %v\n", idUsernamesB, err)
 			return err
 		}
+		// Create bucket for bans.
+		_, err = tx.CreateBucketIfNotExists([]byte(bansB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", bansB, err)
+			return err
+		}
+		// Create bucket for shadowbans.
+		_, err = tx.CreateBucketIfNotExists([]byte(shadowbansB))
+		if err != nil {
+			log.Printf("Could not create bucket %s: %v\n", shadowbansB, err)
+			return err
+		}
 		return nil
 	})
 	if err != nil {
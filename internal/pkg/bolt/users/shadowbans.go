@@ -0,0 +1,93 @@
+package users
+
+import (
+	"encoding/json"
+	"log"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/userapi"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Shadowban saves the given shadowban, replacing the previous one of the same
+// user, if any. It returns ErrUserNotFound if the user does not exist.
+func (h *handler) Shadowban(s dbmodel.Shadowban) error {
+	return h.users.Update(func(tx *bolt.Tx) error {
+		usersBucket := tx.Bucket([]byte(usersB))
+		if usersBucket == nil {
+			log.Printf("Bucket %s of users not found\n", usersB)
+			return dbmodel.ErrBucketNotFound
+		}
+		if usersBucket.Get([]byte(s.UserId)) == nil {
+			return dbmodel.ErrUserNotFound
+		}
+		shadowbansBucket := tx.Bucket([]byte(shadowbansB))
+		if shadowbansBucket == nil {
+			log.Printf("Bucket %s of users not found\n", shadowbansB)
+			return dbmodel.ErrBucketNotFound
+		}
+		shadowbanBytes, err := json.Marshal(s)
+		if err != nil {
+			log.Printf("Could not marshal shadowban: %v\n", err)
+			return err
+		}
+		return shadowbansBucket.Put([]byte(s.UserId), shadowbanBytes)
+	})
+}
+
+// LiftShadowban removes the shadowban of the given user. It returns
+// ErrNotShadowbanned if the user is not shadowbanned.
+func (h *handler) LiftShadowban(userId string) error {
+	return h.users.Update(func(tx *bolt.Tx) error {
+		shadowbansBucket := tx.Bucket([]byte(shadowbansB))
+		if shadowbansBucket == nil {
+			log.Printf("Bucket %s of users not found\n", shadowbansB)
+			return dbmodel.ErrBucketNotFound
+		}
+		if shadowbansBucket.Get([]byte(userId)) == nil {
+			return dbmodel.ErrNotShadowbanned
+		}
+		return shadowbansBucket.Delete([]byte(userId))
+	})
+}
+
+// ListShadowbans returns the shadowbanned users, sorted by user id.
+func (h *handler) ListShadowbans() ([]*dbmodel.Shadowban, error) {
+	var list []*dbmodel.Shadowban
+
+	err := h.users.View(func(tx *bolt.Tx) error {
+		shadowbansBucket := tx.Bucket([]byte(shadowbansB))
+		if shadowbansBucket == nil {
+			log.Printf("Bucket %s of users not found\n", shadowbansB)
+			return dbmodel.ErrBucketNotFound
+		}
+		return shadowbansBucket.ForEach(func(k, v []byte) error {
+			s := new(dbmodel.Shadowban)
+			if err := json.Unmarshal(v, s); err != nil {
+				log.Printf("Could not unmarshal shadowban: %v\n", err)
+				return err
+			}
+			list = append(list, s)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// IsShadowbanned returns whether the given user is shadowbanned.
+func (h *handler) IsShadowbanned(userId string) (bool, error) {
+	var shadowbanned bool
+
+	err := h.users.View(func(tx *bolt.Tx) error {
+		shadowbansBucket := tx.Bucket([]byte(shadowbansB))
+		if shadowbansBucket == nil {
+			log.Printf("Bucket %s of users not found\n", shadowbansB)
+			return dbmodel.ErrBucketNotFound
+		}
+		shadowbanned = shadowbansBucket.Get([]byte(userId)) != nil
+		return nil
+	})
+	return shadowbanned, err
+}
@@ -0,0 +1,150 @@
+// Package edits provides the Edits gRPC service, which lets the authors of
+// threads, comments and subcomments edit them and returns their previous
+// versions, and its client. The section services implement it.
+//
+// The UpdateContent rpc in cheroproto has no request for a single content yet,
+// so the service is described here by hand and its messages are encoded as
+// JSON by jsoncodec. Clients built by NewClient set the content subtype
+// accordingly.
+
+package edits
+
+import (
+	"context"
+
+	"github.com/luisguve/cheroapi/internal/pkg/jsoncodec"
+	"github.com/luisguve/cheroapi/internal/pkg/reactions"
+	"google.golang.org/grpc"
+)
+
+// EditRequest holds an edit of a content by its author. Text cannot be empty.
+// Title is ignored for comments and subcomments, and both the title and the
+// featured file are kept unless new ones are set. The featured file is dropped
+// if RemoveFtFile is true.
+type EditRequest struct {
+	Content      reactions.ContentId `json:"content"`
+	UserId       string              `json:"user_id"`
+	Title        string              `json:"title,omitempty"`
+	Text         string              `json:"text"`
+	FtFile       string              `json:"ft_file,omitempty"`
+	RemoveFtFile bool                `json:"remove_ft_file,omitempty"`
+}
+
+// EditResponse holds the time of an edit, in seconds since the Unix epoch.
+type EditResponse struct {
+	EditedAt int64 `json:"edited_at"`
+}
+
+// RevisionsRequest asks for the previous versions of a content. If the content
+// was removed by a moderator, only moderators of the section get them.
+type RevisionsRequest struct {
+	Content reactions.ContentId `json:"content"`
+	UserId  string              `json:"user_id,omitempty"`
+}
+
+// RevisionRequest asks for the previous version number Number of a content,
+// starting from 1. If the content was removed by a moderator, only moderators
+// of the section get it.
+type RevisionRequest struct {
+	Content reactions.ContentId `json:"content"`
+	UserId  string              `json:"user_id,omitempty"`
+	Number  int                 `json:"number"`
+}
+
+// Revisions holds the last time a content was edited by its author and its
+// previous versions, from oldest to newest.
+type Revisions struct {
+	Content   reactions.ContentId `json:"content"`
+	EditedAt  int64               `json:"edited_at"`
+	Revisions []Revision          `json:"revisions"`
+}
+
+// Revision holds a previous version of a content, its sequential number and
+// the time it was replaced.
+type Revision struct {
+	Number   int    `json:"number"`
+	EditedAt int64  `json:"edited_at"`
+	Title    string `json:"title,omitempty"`
+	Text     string `json:"text"`
+	FtFile   string `json:"ft_file,omitempty"`
+}
+
+// Server is the server API for the Edits service.
+type Server interface {
+	EditContent(context.Context, *EditRequest) (*EditResponse, error)
+	ContentRevisions(context.Context, *RevisionsRequest) (*Revisions, error)
+	ContentRevision(context.Context, *RevisionRequest) (*Revision, error)
+}
+
+// serviceName is the full name of the service.
+const serviceName = "cheroapi.Edits"
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(serviceName, "EditContent", func() interface{} { return new(EditRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).EditContent(ctx, req.(*EditRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "ContentRevisions", func() interface{} { return new(RevisionsRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).ContentRevisions(ctx, req.(*RevisionsRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "ContentRevision", func() interface{} { return new(RevisionRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).ContentRevision(ctx, req.(*RevisionRequest))
+			}),
+	},
+	Metadata: "edits.go",
+}
+
+// Register registers srv as the Edits service of s.
+func Register(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client is the client API for the Edits service.
+type Client interface {
+	EditContent(ctx context.Context, req *EditRequest, opts ...grpc.CallOption) (*EditResponse, error)
+	ContentRevisions(ctx context.Context, req *RevisionsRequest, opts ...grpc.CallOption) (*Revisions, error)
+	ContentRevision(ctx context.Context, req *RevisionRequest, opts ...grpc.CallOption) (*Revision, error)
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client of the Edits service on the given connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc}
+}
+
+func (c *client) invoke(ctx context.Context, method string, req, res interface{}, opts []grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	return c.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, res, opts...)
+}
+
+func (c *client) EditContent(ctx context.Context, req *EditRequest, opts ...grpc.CallOption) (*EditResponse, error) {
+	res := new(EditResponse)
+	if err := c.invoke(ctx, "EditContent", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) ContentRevisions(ctx context.Context, req *RevisionsRequest, opts ...grpc.CallOption) (*Revisions, error) {
+	res := new(Revisions)
+	if err := c.invoke(ctx, "ContentRevisions", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) ContentRevision(ctx context.Context, req *RevisionRequest, opts ...grpc.CallOption) (*Revision, error) {
+	res := new(Revision)
+	if err := c.invoke(ctx, "ContentRevision", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,56 @@
+// Package jsoncodec registers a gRPC codec that encodes messages as JSON, for
+// the services not defined in cheroproto yet, which are described by hand with
+// plain Go types as messages. Clients of these services must set Name as the
+// content subtype of their calls.
+
+package jsoncodec
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// Name is the content subtype of the messages encoded by the codec.
+const Name = "json"
+
+// codec encodes messages as JSON.
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (codec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (codec) Name() string                               { return Name }
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// UnaryMethod returns the description of the unary method with the given name
+// of the service with the given full name, such as "cheroapi.Polls". Its
+// handler decodes the request into the value returned by newReq and passes it
+// to call along with the implementation of the service, through the
+// interceptor of the gRPC server, if any.
+func UnaryMethod(service, method string, newReq func() interface{},
+	call func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error)) grpc.MethodDesc {
+
+	handler := func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := newReq()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv, ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + service + "/" + method,
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv, ctx, req)
+		}
+		return interceptor(ctx, req, info, handler)
+	}
+	return grpc.MethodDesc{MethodName: method, Handler: handler}
+}
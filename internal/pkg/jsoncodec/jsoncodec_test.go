@@ -0,0 +1,85 @@
+package jsoncodec_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/luisguve/cheroapi/internal/pkg/jsoncodec"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type echoRequest struct {
+	Text string `json:"text"`
+}
+
+type echoServer interface {
+	Echo(context.Context, *echoRequest) (*echoRequest, error)
+}
+
+type echo struct{}
+
+func (echo) Echo(ctx context.Context, req *echoRequest) (*echoRequest, error) {
+	if req.Text == "" {
+		return nil, status.Error(codes.InvalidArgument, "Empty text")
+	}
+	return req, nil
+}
+
+var echoDesc = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*echoServer)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod("test.Echo", "Echo", func() interface{} { return new(echoRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(echoServer).Echo(ctx, req.(*echoRequest))
+			}),
+	},
+}
+
+// Call a method described by UnaryMethod through a gRPC server with an
+// interceptor.
+func TestUnaryMethod(t *testing.T) {
+	var intercepted []string
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		intercepted = append(intercepted, info.FullMethod)
+		return handler(ctx, req)
+	}
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.UnaryInterceptor(interceptor))
+	s.RegisterService(&echoDesc, echo{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	dial := func(context.Context, string) (net.Conn, error) { return lis.Dial() }
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(dial), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Could not dial: %v\n", err)
+	}
+	defer conn.Close()
+	call := func(text string) (*echoRequest, error) {
+		res := new(echoRequest)
+		err := conn.Invoke(context.Background(), "/test.Echo/Echo", &echoRequest{Text: text},
+			res, grpc.CallContentSubtype(jsoncodec.Name))
+		return res, err
+	}
+
+	res, err := call("hello")
+	if err != nil {
+		t.Fatalf("Echo: %v\n", err)
+	}
+	if res.Text != "hello" {
+		t.Errorf("got %q, want %q\n", res.Text, "hello")
+	}
+	if _, err = call(""); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("got error %v, want code %v\n", err, codes.InvalidArgument)
+	}
+	if (len(intercepted) != 2) || (intercepted[0] != "/test.Echo/Echo") {
+		t.Errorf("got intercepted methods %v, want /test.Echo/Echo twice\n", intercepted)
+	}
+}
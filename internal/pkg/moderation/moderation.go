@@ -0,0 +1,475 @@
+// Package moderation provides the Moderation gRPC service, through which the
+// users of a section report its contents, its moderators manage them, review
+// the moderation log and resolve the reports, and its owners manage their
+// roles, and its client. The section services implement it.
+//
+// The protocol in cheroproto does not define moderation rpcs yet, so the
+// service is described here by hand and its messages are encoded as JSON by
+// jsoncodec. Clients built by NewClient set the content subtype accordingly.
+
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/luisguve/cheroapi/internal/pkg/jsoncodec"
+	"github.com/luisguve/cheroapi/internal/pkg/reactions"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ReportReasons are the reason codes a content can be reported for.
+var ReportReasons = []string{
+	"spam",
+	"harassment",
+	"hate",
+	"violence",
+	"sexual",
+	"misinformation",
+	"other",
+}
+
+// ValidReason returns whether the given reason code is one of ReportReasons.
+func ValidReason(reason string) bool {
+	for _, r := range ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxReportText is the maximum length, in bytes, of the free text of a report.
+const MaxReportText = 1000
+
+// MaxQueueItems is the maximum number of items of the moderation queue that can
+// be requested at once.
+const MaxQueueItems = 100
+
+// DefaultMaxPinned is the maximum number of pinned threads of a section, unless
+// a different one is set.
+const DefaultMaxPinned = 3
+
+// PinnedMD is the metadata key under which the section services send, in the
+// header of RecycleContent, the ids of the pinned threads at the start of the
+// feed, from the most recently pinned.
+const PinnedMD = "pinned"
+
+// PinnedFromHeader returns the ids of the pinned threads sent in the given
+// header of RecycleContent, if any.
+func PinnedFromHeader(header metadata.MD) []string {
+	return header.Get(PinnedMD)
+}
+
+// MaxLogActions is the maximum number of actions of the moderation log that
+// can be requested at once.
+const MaxLogActions = 100
+
+// ThreadRequest holds a thread of the section and the user id of the moderator
+// acting on it.
+type ThreadRequest struct {
+	ThreadId string `json:"thread_id"`
+	UserId   string `json:"user_id"`
+}
+
+// ListPinnedRequest asks for the pinned threads of the section.
+type ListPinnedRequest struct{}
+
+// PinnedThreads holds the ids of the pinned threads of the section, from the
+// most recently pinned.
+type PinnedThreads struct {
+	ThreadIds []string `json:"thread_ids"`
+}
+
+// LockRequest holds a thread of the section, the user id of its author or of
+// the moderator locking or unlocking it and the reason, if any.
+type LockRequest struct {
+	ThreadId string `json:"thread_id"`
+	UserId   string `json:"user_id"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// LockState holds whether a thread is locked and, after locking or unlocking
+// it, the notification for its author, if any, as protojson NotifyUser
+// messages.
+type LockState struct {
+	ThreadId string            `json:"thread_id"`
+	Locked   bool              `json:"locked"`
+	Notifs   []json.RawMessage `json:"notifs,omitempty"`
+}
+
+// LogRequest asks for the last Max actions of the moderation log, on behalf of
+// the moderator with the given user id.
+type LogRequest struct {
+	UserId string `json:"user_id"`
+	Max    int    `json:"max"`
+}
+
+// Action is an entry of the moderation log: an action taken by a user on a
+// content or on the role of another user, the role granted, the reason given,
+// if any, and the unix time it was taken at.
+type Action struct {
+	Id           uint64 `json:"id"`
+	Action       string `json:"action"`
+	ThreadId     string `json:"thread_id,omitempty"`
+	CommentId    string `json:"comment_id,omitempty"`
+	SubcommentId string `json:"subcomment_id,omitempty"`
+	TargetUserId string `json:"target_user_id,omitempty"`
+	Role         string `json:"role,omitempty"`
+	UserId       string `json:"user_id"`
+	Reason       string `json:"reason,omitempty"`
+	Time         int64  `json:"time"`
+}
+
+// Log holds actions of the moderation log, from the newest.
+type Log struct {
+	Actions []Action `json:"actions"`
+}
+
+// RemoveRequest holds a thread, comment or subcomment of the section to be
+// removed, the user id of the moderator removing it and the reason.
+type RemoveRequest struct {
+	Content reactions.ContentId `json:"content"`
+	UserId  string              `json:"user_id"`
+	Reason  string              `json:"reason"`
+}
+
+// RemoveResponse is the response to a RemoveRequest.
+type RemoveResponse struct{}
+
+// RoleRequest holds the user id of an owner of the section and the user whose
+// role is being granted or revoked. Role is ignored when revoking it.
+type RoleRequest struct {
+	UserId   string `json:"user_id"`
+	TargetId string `json:"target_id"`
+	Role     string `json:"role,omitempty"`
+}
+
+// ListRolesRequest asks for the roles of the section, on behalf of the
+// moderator with the given user id.
+type ListRolesRequest struct {
+	UserId string `json:"user_id"`
+}
+
+// Role holds the role of a user in the section, who granted it and the unix
+// time it was granted at.
+type Role struct {
+	UserId    string `json:"user_id"`
+	Role      string `json:"role"`
+	GrantedBy string `json:"granted_by"`
+	GrantedAt int64  `json:"granted_at"`
+}
+
+// Roles holds the users with a role in the section, sorted by user id. The
+// admins set in the config file of the section are owners too, but they're not
+// listed.
+type Roles struct {
+	Roles []Role `json:"roles"`
+}
+
+// ReportRequest holds a thread, comment or subcomment of the section being
+// reported, the user id of the reporter, one of ReportReasons and a free text,
+// if any.
+type ReportRequest struct {
+	Content reactions.ContentId `json:"content"`
+	UserId  string              `json:"user_id"`
+	Reason  string              `json:"reason"`
+	Text    string              `json:"text,omitempty"`
+}
+
+// ReportResponse holds the id of the item of the moderation queue the report
+// was added to.
+type ReportResponse struct {
+	ReportId uint64 `json:"report_id"`
+}
+
+// QueueRequest asks for up to Max items of the moderation queue whose ids are
+// greater than After, on behalf of the moderator with the given user id.
+type QueueRequest struct {
+	UserId string `json:"user_id"`
+	After  uint64 `json:"after,omitempty"`
+	Max    int    `json:"max"`
+}
+
+// Report is a report of a user on a content: the reason code, the free text and
+// the unix time it was reported at.
+type Report struct {
+	UserId string `json:"user_id"`
+	Reason string `json:"reason"`
+	Text   string `json:"text,omitempty"`
+	Time   int64  `json:"time"`
+}
+
+// ReportItem is an item of the moderation queue: a content, the reports on it
+// and, once it's resolved, the outcome, the moderator who resolved it, the unix
+// time it was resolved at and the note given, if any.
+type ReportItem struct {
+	Id           uint64   `json:"id"`
+	ThreadId     string   `json:"thread_id"`
+	CommentId    string   `json:"comment_id,omitempty"`
+	SubcommentId string   `json:"subcomment_id,omitempty"`
+	Reports      []Report `json:"reports"`
+	Outcome      string   `json:"outcome,omitempty"`
+	ResolvedBy   string   `json:"resolved_by,omitempty"`
+	ResolvedAt   int64    `json:"resolved_at,omitempty"`
+	Note         string   `json:"note,omitempty"`
+}
+
+// Queue holds items of the moderation queue, from the oldest, and the id to
+// set as After to get the next page, which is 0 if there are no more items.
+type Queue struct {
+	Items []ReportItem `json:"items"`
+	Next  uint64       `json:"next,omitempty"`
+}
+
+// ResolveRequest holds an item of the moderation queue, the user id of the
+// moderator resolving it, the outcome, which is one of "dismiss", "remove" and
+// "lock", and a note, if any.
+type ResolveRequest struct {
+	ReportId uint64 `json:"report_id"`
+	UserId   string `json:"user_id"`
+	Outcome  string `json:"outcome"`
+	Note     string `json:"note,omitempty"`
+}
+
+// ResolveResponse holds the resolved item and, if the thread was locked, the
+// notification for its author, as protojson NotifyUser messages.
+type ResolveResponse struct {
+	Item   ReportItem        `json:"item"`
+	Notifs []json.RawMessage `json:"notifs,omitempty"`
+}
+
+// Server is the server API for the Moderation service.
+type Server interface {
+	PinThread(context.Context, *ThreadRequest) (*PinnedThreads, error)
+	UnpinThread(context.Context, *ThreadRequest) (*PinnedThreads, error)
+	ListPinned(context.Context, *ListPinnedRequest) (*PinnedThreads, error)
+	LockThread(context.Context, *LockRequest) (*LockState, error)
+	UnlockThread(context.Context, *LockRequest) (*LockState, error)
+	GetLock(context.Context, *ThreadRequest) (*LockState, error)
+	ListLog(context.Context, *LogRequest) (*Log, error)
+	RemoveContent(context.Context, *RemoveRequest) (*RemoveResponse, error)
+	SetRole(context.Context, *RoleRequest) (*Roles, error)
+	RemoveRole(context.Context, *RoleRequest) (*Roles, error)
+	ListRoles(context.Context, *ListRolesRequest) (*Roles, error)
+	Report(context.Context, *ReportRequest) (*ReportResponse, error)
+	ListQueue(context.Context, *QueueRequest) (*Queue, error)
+	Resolve(context.Context, *ResolveRequest) (*ResolveResponse, error)
+}
+
+// serviceName is the full name of the service.
+const serviceName = "cheroapi.Moderation"
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(serviceName, "PinThread", func() interface{} { return new(ThreadRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).PinThread(ctx, req.(*ThreadRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "UnpinThread", func() interface{} { return new(ThreadRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).UnpinThread(ctx, req.(*ThreadRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "ListPinned", func() interface{} { return new(ListPinnedRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).ListPinned(ctx, req.(*ListPinnedRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "LockThread", func() interface{} { return new(LockRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).LockThread(ctx, req.(*LockRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "UnlockThread", func() interface{} { return new(LockRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).UnlockThread(ctx, req.(*LockRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "GetLock", func() interface{} { return new(ThreadRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).GetLock(ctx, req.(*ThreadRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "ListLog", func() interface{} { return new(LogRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).ListLog(ctx, req.(*LogRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "RemoveContent", func() interface{} { return new(RemoveRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).RemoveContent(ctx, req.(*RemoveRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "SetRole", func() interface{} { return new(RoleRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).SetRole(ctx, req.(*RoleRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "RemoveRole", func() interface{} { return new(RoleRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).RemoveRole(ctx, req.(*RoleRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "ListRoles", func() interface{} { return new(ListRolesRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).ListRoles(ctx, req.(*ListRolesRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "Report", func() interface{} { return new(ReportRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).Report(ctx, req.(*ReportRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "ListQueue", func() interface{} { return new(QueueRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).ListQueue(ctx, req.(*QueueRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "Resolve", func() interface{} { return new(ResolveRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).Resolve(ctx, req.(*ResolveRequest))
+			}),
+	},
+	Metadata: "moderation.go",
+}
+
+// Register registers srv as the Moderation service of s.
+func Register(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client is the client API for the Moderation service.
+type Client interface {
+	PinThread(ctx context.Context, req *ThreadRequest, opts ...grpc.CallOption) (*PinnedThreads, error)
+	UnpinThread(ctx context.Context, req *ThreadRequest, opts ...grpc.CallOption) (*PinnedThreads, error)
+	ListPinned(ctx context.Context, req *ListPinnedRequest, opts ...grpc.CallOption) (*PinnedThreads, error)
+	LockThread(ctx context.Context, req *LockRequest, opts ...grpc.CallOption) (*LockState, error)
+	UnlockThread(ctx context.Context, req *LockRequest, opts ...grpc.CallOption) (*LockState, error)
+	GetLock(ctx context.Context, req *ThreadRequest, opts ...grpc.CallOption) (*LockState, error)
+	ListLog(ctx context.Context, req *LogRequest, opts ...grpc.CallOption) (*Log, error)
+	RemoveContent(ctx context.Context, req *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error)
+	SetRole(ctx context.Context, req *RoleRequest, opts ...grpc.CallOption) (*Roles, error)
+	RemoveRole(ctx context.Context, req *RoleRequest, opts ...grpc.CallOption) (*Roles, error)
+	ListRoles(ctx context.Context, req *ListRolesRequest, opts ...grpc.CallOption) (*Roles, error)
+	Report(ctx context.Context, req *ReportRequest, opts ...grpc.CallOption) (*ReportResponse, error)
+	ListQueue(ctx context.Context, req *QueueRequest, opts ...grpc.CallOption) (*Queue, error)
+	Resolve(ctx context.Context, req *ResolveRequest, opts ...grpc.CallOption) (*ResolveResponse, error)
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client of the Moderation service on the given connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc}
+}
+
+func (c *client) invoke(ctx context.Context, method string, req, res interface{}, opts []grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	return c.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, res, opts...)
+}
+
+func (c *client) PinThread(ctx context.Context, req *ThreadRequest, opts ...grpc.CallOption) (*PinnedThreads, error) {
+	res := new(PinnedThreads)
+	if err := c.invoke(ctx, "PinThread", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) UnpinThread(ctx context.Context, req *ThreadRequest, opts ...grpc.CallOption) (*PinnedThreads, error) {
+	res := new(PinnedThreads)
+	if err := c.invoke(ctx, "UnpinThread", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) ListPinned(ctx context.Context, req *ListPinnedRequest, opts ...grpc.CallOption) (*PinnedThreads, error) {
+	res := new(PinnedThreads)
+	if err := c.invoke(ctx, "ListPinned", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) LockThread(ctx context.Context, req *LockRequest, opts ...grpc.CallOption) (*LockState, error) {
+	res := new(LockState)
+	if err := c.invoke(ctx, "LockThread", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) UnlockThread(ctx context.Context, req *LockRequest, opts ...grpc.CallOption) (*LockState, error) {
+	res := new(LockState)
+	if err := c.invoke(ctx, "UnlockThread", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) GetLock(ctx context.Context, req *ThreadRequest, opts ...grpc.CallOption) (*LockState, error) {
+	res := new(LockState)
+	if err := c.invoke(ctx, "GetLock", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) ListLog(ctx context.Context, req *LogRequest, opts ...grpc.CallOption) (*Log, error) {
+	res := new(Log)
+	if err := c.invoke(ctx, "ListLog", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) RemoveContent(ctx context.Context, req *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error) {
+	res := new(RemoveResponse)
+	if err := c.invoke(ctx, "RemoveContent", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) SetRole(ctx context.Context, req *RoleRequest, opts ...grpc.CallOption) (*Roles, error) {
+	res := new(Roles)
+	if err := c.invoke(ctx, "SetRole", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) RemoveRole(ctx context.Context, req *RoleRequest, opts ...grpc.CallOption) (*Roles, error) {
+	res := new(Roles)
+	if err := c.invoke(ctx, "RemoveRole", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) ListRoles(ctx context.Context, req *ListRolesRequest, opts ...grpc.CallOption) (*Roles, error) {
+	res := new(Roles)
+	if err := c.invoke(ctx, "ListRoles", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) Report(ctx context.Context, req *ReportRequest, opts ...grpc.CallOption) (*ReportResponse, error) {
+	res := new(ReportResponse)
+	if err := c.invoke(ctx, "Report", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) ListQueue(ctx context.Context, req *QueueRequest, opts ...grpc.CallOption) (*Queue, error) {
+	res := new(Queue)
+	if err := c.invoke(ctx, "ListQueue", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) Resolve(ctx context.Context, req *ResolveRequest, opts ...grpc.CallOption) (*ResolveResponse, error) {
+	res := new(ResolveResponse)
+	if err := c.invoke(ctx, "Resolve", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
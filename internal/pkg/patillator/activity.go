@@ -1,8 +1,6 @@
 package patillator
 
 import (
-	"time"
-
 	pbContext "github.com/luisguve/cheroproto-go/context"
 	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
 	pbMetadata "github.com/luisguve/cheroproto-go/metadata"
@@ -11,24 +9,25 @@ import (
 // ActivityMetadata holds the metadata of a content.
 type ActivityMetadata pbMetadata.Content
 
-// IsRelevant returns true if the number of interactions is greater than 10 and
-// the average update time difference is less than 10 minutes. It does the
-// comparison on the Interactions and AvgUpdateTime fields, respectively.
+// IsRelevant returns whether the underlying content is relevant according to
+// the relevance model. See SetRelevanceModel.
 func (am ActivityMetadata) IsRelevant() bool {
-	// type cast for ease of use
-	metadata := pbMetadata.Content(am)
-	min := 10 * time.Minute
-	return (metadata.Interactions > 10) && (metadata.AvgUpdateTime <= min.Seconds())
+	return am.isRelevant(relevanceModel)
+}
+
+func (am ActivityMetadata) isRelevant(m RelevanceModel) bool {
+	return m.IsRelevant((*pbMetadata.Content)(&am))
 }
 
-// IsLessRelevantThan compares the field Interactions and the field AvgUpdateTime
-// of am and the underlying ActivityMetadata of the argument.
-//
-// It returns true if gc -the local- has less interactions AND an equal or
-// greater average update time difference than other -the argument-, or false
-// if either some of the conditions are false or the underlying type of other
-// is not an ActivityMetadata.
+// IsLessRelevantThan returns whether am -the local- is less relevant than the
+// underlying ActivityMetadata of other -the argument- according to the
+// relevance model, or false if other is not a ThreadActivity, CommentActivity
+// or SubcommentActivity.
 func (am ActivityMetadata) IsLessRelevantThan(other interface{}) bool {
+	return am.isLessRelevantThan(relevanceModel, other)
+}
+
+func (am ActivityMetadata) isLessRelevantThan(m RelevanceModel, other interface{}) bool {
 	var otherAM ActivityMetadata
 	// type switch to get the underlying ActivityMetadata
 	switch act := other.(type) {
@@ -41,8 +40,7 @@ func (am ActivityMetadata) IsLessRelevantThan(other interface{}) bool {
 	default:
 		return false
 	}
-	return (am.Interactions < otherAM.Interactions) &&
-		(am.AvgUpdateTime >= otherAM.AvgUpdateTime)
+	return m.Less((*pbMetadata.Content)(&am), (*pbMetadata.Content)(&otherAM))
 }
 
 // ThreadActivity holds the metadata of a thread as well as its context.
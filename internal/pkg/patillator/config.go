@@ -0,0 +1,75 @@
+package patillator
+
+import "fmt"
+
+// RelevanceConfig holds the settings of the relevance model of a service, as
+// read from the relevance table of its config file.
+type RelevanceConfig struct {
+	Model     string  `toml:"model"` // Either "default" or "hot".
+	Gravity   float64 `toml:"gravity"`
+	Threshold float64 `toml:"threshold"`
+	// Contents with a lower net score are buried. It only applies to contents
+	// with a net score; see ScoredContent.
+	MinScore int `toml:"min_score"`
+}
+
+// Validate returns an error if c does not describe a valid relevance model.
+func (c RelevanceConfig) Validate() error {
+	switch c.Model {
+	case "", "default":
+	case "hot":
+		if c.Gravity <= 0 {
+			return fmt.Errorf("Relevance gravity must be greater than 0.")
+		}
+		if c.Threshold < 0 {
+			return fmt.Errorf("Relevance threshold cannot be negative.")
+		}
+	default:
+		return fmt.Errorf("Unknown relevance model %q.", c.Model)
+	}
+	return nil
+}
+
+// RelevanceModel returns the relevance model described by c: a NetScoreModel
+// on top of either the DefaultModel or a HotModel.
+func (c RelevanceConfig) RelevanceModel() RelevanceModel {
+	var base RelevanceModel = DefaultModel{}
+	if c.Model == "hot" {
+		base = NewHotModel(c.Gravity, c.Threshold)
+	}
+	return NewNetScoreModel(base, c.MinScore)
+}
+
+// FeedConfig holds how contents are fetched out to fill the patterns of the
+// feeds of a service, as read from the feed table of its config file.
+type FeedConfig struct {
+	// Probability of following the pattern, between 0 and 1.
+	FollowProbability float64 `toml:"follow_probability"`
+	// Whether to log the seed used to fill the pattern on each request.
+	LogSeeds bool `toml:"log_seeds"`
+}
+
+// DefaultFeedConfig returns the FeedConfig used unless a config file sets a
+// different one.
+func DefaultFeedConfig() FeedConfig {
+	return FeedConfig{
+		FollowProbability: DefaultFollowProbability,
+	}
+}
+
+// Validate returns an error if the follow probability of c is not greater than
+// 0 and at most 1.
+func (c FeedConfig) Validate() error {
+	if (c.FollowProbability <= 0) || (c.FollowProbability > 1) {
+		return fmt.Errorf("Feed follow probability must be greater than 0 and at most 1.")
+	}
+	return nil
+}
+
+// FillerOptions returns the settings of the Fillers described by c.
+func (c FeedConfig) FillerOptions() FillerOptions {
+	return FillerOptions{
+		FollowProbability: c.FollowProbability,
+		LogSeeds:          c.LogSeeds,
+	}
+}
@@ -1,8 +1,6 @@
 package patillator
 
 import (
-	"time"
-
 	pbContext "github.com/luisguve/cheroproto-go/context"
 	pbMetadata "github.com/luisguve/cheroproto-go/metadata"
 )
@@ -39,34 +37,29 @@ func (c Content) ToDiscard(ids []string) (bool, []string) {
 	return discard, ids
 }
 
-// IsRelevant returns true if the number of interactions is greater than 10 and
-// the average update time difference is less than 10 minutes. It does the
-// comparison on the Interactions and AvgUpdateTime fields, respectively.
+// IsRelevant returns whether the underlying content is relevant according to
+// the relevance model. See SetRelevanceModel.
 func (c Content) IsRelevant() bool {
-	// type cast for ease of use
-	metadata := pbMetadata.Content(c)
-	min := 10 * time.Minute
-	return (metadata.Interactions > 10) && (metadata.AvgUpdateTime <= min.Seconds())
+	return c.isRelevant(relevanceModel)
 }
 
-// IsLessRelevantThan compares the field Interactions and the field AvgUpdateTime
-// of c and the underlying Content of the argument.
-//
-// It returns true if c -the local- has less interactions AND an equal or
-// greater average update time difference than other -the argument-, or false if
-// either some of the conditions are false or the underlying type of other is not
-// a Content.
+func (c Content) isRelevant(m RelevanceModel) bool {
+	return m.IsRelevant((*pbMetadata.Content)(&c))
+}
+
+// IsLessRelevantThan returns whether c -the local- is less relevant than other
+// -the argument- according to the relevance model, or false if the underlying
+// type of other is not a Content.
 func (c Content) IsLessRelevantThan(other interface{}) bool {
-	// type assert to get access to fields Interactions and AvgUpdateTime
+	return c.isLessRelevantThan(relevanceModel, other)
+}
+
+func (c Content) isLessRelevantThan(m RelevanceModel, other interface{}) bool {
 	otherC, ok := other.(Content)
 	if !ok {
 		return false
 	}
-	// type cast for ease of use
-	metadata := pbMetadata.Content(c)
-	otherMetadata := pbMetadata.Content(otherC)
-	return (metadata.Interactions < otherMetadata.Interactions) &&
-		(metadata.AvgUpdateTime >= otherMetadata.AvgUpdateTime)
+	return m.Less((*pbMetadata.Content)(&c), (*pbMetadata.Content)(&otherC))
 }
 
 // Key returns a string containing the field DataKey of c, which represents
@@ -77,6 +70,50 @@ func (c Content) Key() interface{} {
 	return metadata.DataKey
 }
 
+// ScoredContent is a Content along with its net score, the number of upvotes
+// minus the number of downvotes, which is taken into account if the relevance
+// model is a ScoreModel.
+type ScoredContent struct {
+	Content
+	Score int
+}
+
+// IsRelevant returns whether the underlying content is relevant according to
+// the relevance model, with its net score if the model is a ScoreModel.
+func (sc ScoredContent) IsRelevant() bool {
+	return sc.isRelevant(relevanceModel)
+}
+
+func (sc ScoredContent) isRelevant(m RelevanceModel) bool {
+	sm, ok := m.(ScoreModel)
+	if !ok {
+		return sc.Content.isRelevant(m)
+	}
+	return sm.IsRelevantScored(Scored{(*pbMetadata.Content)(&sc.Content), sc.Score})
+}
+
+// IsLessRelevantThan returns whether sc is less relevant than other according
+// to the relevance model, or false if the underlying type of other is neither a
+// ScoredContent nor a Content. Net scores are compared only if both are
+// ScoredContents and the model is a ScoreModel.
+func (sc ScoredContent) IsLessRelevantThan(other interface{}) bool {
+	return sc.isLessRelevantThan(relevanceModel, other)
+}
+
+func (sc ScoredContent) isLessRelevantThan(m RelevanceModel, other interface{}) bool {
+	otherSC, ok := other.(ScoredContent)
+	if !ok {
+		return sc.Content.isLessRelevantThan(m, other)
+	}
+	sm, ok := m.(ScoreModel)
+	if !ok {
+		return sc.Content.isLessRelevantThan(m, otherSC.Content)
+	}
+	a := Scored{(*pbMetadata.Content)(&sc.Content), sc.Score}
+	b := Scored{(*pbMetadata.Content)(&otherSC.Content), otherSC.Score}
+	return sm.LessScored(a, b)
+}
+
 // GeneralContent holds the thread Id as well as the section Id it belongs to.
 type GeneralContent pbMetadata.GeneralContent
 
@@ -108,35 +145,29 @@ func (gc GeneralContent) ToDiscard(ids []string) (bool, []string) {
 	return discard, ids
 }
 
-// IsRelevant returns true if the number of interactions is greater than 10 and
-// the average update time difference is less than 10 minutes. It does the
-// comparison on the Interactions and AvgUpdateTime fields, respectively.
+// IsRelevant returns whether the underlying content is relevant according to
+// the relevance model. See SetRelevanceModel.
 func (gc GeneralContent) IsRelevant() bool {
-	// type cast for ease of use
-	metadata := pbMetadata.GeneralContent(gc)
-	min := 10 * time.Minute
-	return (metadata.Content.Interactions > 10) &&
-		(metadata.Content.AvgUpdateTime <= min.Seconds())
+	return gc.isRelevant(relevanceModel)
 }
 
-// IsLessRelevantThan compares the field Interactions and the field AvgUpdateTime
-// of gc and the underlying GeneralContent of the argument.
-//
-// It returns true if gc -the local- has less interactions AND an equal or
-// greater average update time difference than other -the argument-, or false if
-// either some of the conditions are false or the underlying type of other is not
-// a GeneralContent.
+func (gc GeneralContent) isRelevant(m RelevanceModel) bool {
+	return m.IsRelevant(gc.Content)
+}
+
+// IsLessRelevantThan returns whether gc -the local- is less relevant than other
+// -the argument- according to the relevance model, or false if the underlying
+// type of other is not a GeneralContent.
 func (gc GeneralContent) IsLessRelevantThan(other interface{}) bool {
-	// type assert to get access to fields Contents.Interactions and Contents.AvgUpdateTime
+	return gc.isLessRelevantThan(relevanceModel, other)
+}
+
+func (gc GeneralContent) isLessRelevantThan(m RelevanceModel, other interface{}) bool {
 	otherGC, ok := other.(GeneralContent)
 	if !ok {
 		return false
 	}
-	// type cast for ease of use
-	metadata := pbMetadata.GeneralContent(gc)
-	otherMetadata := pbMetadata.GeneralContent(otherGC)
-	return (metadata.Content.Interactions < otherMetadata.Content.Interactions) &&
-		(metadata.Content.AvgUpdateTime >= otherMetadata.Content.AvgUpdateTime)
+	return m.Less(gc.Content, otherGC.Content)
 }
 
 // Key returns a GeneralId, which holds a thread id and the section it belongs
@@ -150,6 +181,49 @@ func (gc GeneralContent) Key() interface{} {
 	}
 }
 
+// ScoredGeneralContent is a GeneralContent along with its net score, which is
+// taken into account if the relevance model is a ScoreModel; see ScoredContent.
+type ScoredGeneralContent struct {
+	GeneralContent
+	Score int
+}
+
+// IsRelevant returns whether the underlying content is relevant according to
+// the relevance model, with its net score if the model is a ScoreModel.
+func (sgc ScoredGeneralContent) IsRelevant() bool {
+	return sgc.isRelevant(relevanceModel)
+}
+
+func (sgc ScoredGeneralContent) isRelevant(m RelevanceModel) bool {
+	sm, ok := m.(ScoreModel)
+	if !ok {
+		return sgc.GeneralContent.isRelevant(m)
+	}
+	return sm.IsRelevantScored(Scored{sgc.Content, sgc.Score})
+}
+
+// IsLessRelevantThan returns whether sgc is less relevant than other according
+// to the relevance model, or false if the underlying type of other is neither a
+// ScoredGeneralContent nor a GeneralContent. Net scores are compared only if
+// both are ScoredGeneralContents and the model is a ScoreModel.
+func (sgc ScoredGeneralContent) IsLessRelevantThan(other interface{}) bool {
+	return sgc.isLessRelevantThan(relevanceModel, other)
+}
+
+func (sgc ScoredGeneralContent) isLessRelevantThan(m RelevanceModel, other interface{}) bool {
+	otherSGC, ok := other.(ScoredGeneralContent)
+	if !ok {
+		return sgc.GeneralContent.isLessRelevantThan(m, other)
+	}
+	sm, ok := m.(ScoreModel)
+	if !ok {
+		return sgc.GeneralContent.isLessRelevantThan(m, otherSGC.GeneralContent)
+	}
+	a := Scored{sgc.Content, sgc.Score}
+	b := Scored{otherSGC.Content, otherSGC.Score}
+	return sm.LessScored(a, b)
+}
+
 // Id holds information to get a thread from the database: its Id. The caller
 // should know the section it belongs to.
 type Id struct {
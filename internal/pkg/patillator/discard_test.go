@@ -17,24 +17,15 @@ func TestDiscardActivity(t *testing.T) {
 	if len(result.ThreadsCreated) != len(activities.ThreadsCreated) ||
 	len(result.Comments) != len(activities.Comments) ||
 	len(result.Subcomments) != len(activities.Subcomments) {
-		t.Errorf("result should have the same activities, this is the result: %v\n", printActivities(t, result))
+		t.Errorf("result should have the same activities, this is the result: %v\n", printActivities(result))
 	}
 	result = patillator.DiscardActivities(activities, activityIds)
 	if len(result.ThreadsCreated) != 1 || len(result.Comments) != 0 ||
 	len(result.Subcomments) != 0 {
-		t.Errorf("result should have no activities, these were left: %v\n", printActivities(t, result))
+		t.Fatalf("result should have no activities, these were left: %v\n", printActivities(result))
 	}
-	key := result.ThreadsCreated[0].Key()
-	contentCtx, ok := key.(*pbContext.Context)
-	if !ok {
-		t.Fatalf("Failed type assertion to Context: %t\n", key)
-	}
-	contextThreadCtx, ok := contentCtx.Ctx.(*pbContext.Context_ThreadCtx)
-	if !ok {
-		t.Fatalf("Failed type assertion to Context_ThreadCtx: %t\n", contentCtx.Ctx)
-	}
-	if contextThreadCtx.ThreadCtx.Id != "post-02" {
-		t.Errorf("Expected resulting thread id to be post-02, got instead: %v\n", contextThreadCtx.ThreadCtx.Id)
+	if result.ThreadsCreated[0].Id != "post-02" {
+		t.Errorf("Expected resulting thread id to be post-02, got instead: %v\n", result.ThreadsCreated[0].Id)
 	}
 }
 
@@ -72,31 +63,19 @@ func TestDiscardContents(t *testing.T) {
 	}
 }
 
-func printActivities(t *testing.T, result patillator.UserActivity) string {
+func printActivities(result *pbDataFormat.Activity) string {
 	var s string
 	s += "Threads created:\n"
 	for _, tc := range result.ThreadsCreated {
-		ta, ok := tc.(patillator.ThreadActivity)
-		if !ok {
-			t.Errorf("Failed type assertion to thread activitiy: %t\n", tc)
-		}
-		s += fmt.Sprintf("%+v\n", ta.Thread)
+		s += fmt.Sprintf("%+v\n", tc)
 	}
 	s += "Comments:\n"
 	for _, c := range result.Comments {
-		ca, ok := c.(patillator.CommentActivity)
-		if !ok {
-			t.Errorf("Failed type assertion to thread activitiy: %t\n", c)
-		}
-		s += fmt.Sprintf("%+v\n", ca.Comment)
+		s += fmt.Sprintf("%+v\n", c)
 	}
 	s += "Subcomments:\n"
 	for _, sc := range result.Subcomments {
-		sca, ok := sc.(patillator.SubcommentActivity)
-		if !ok {
-			t.Errorf("Failed type assertion to thread activitiy: %t\n", sc)
-		}
-		s += fmt.Sprintf("%+v\n", sca.Subcomment)
+		s += fmt.Sprintf("%+v\n", sc)
 	}
 	return s
 }
@@ -276,44 +255,45 @@ var activityIds = &pbDataFormat.Activity{
 	},
 }
 
-var activities = patillator.UserActivity{
-	ThreadsCreated: []patillator.SegregateFinder{
-		patillator.ThreadActivity{
-			Thread: &pbContext.Thread{
+var activities = &pbDataFormat.Activity{
+	ThreadsCreated: []*pbContext.Thread{
+		&pbContext.Thread{
+			Id: "post-01",
+			SectionCtx: &pbContext.Section{
+				Id: "mylife",
+			},
+		},
+		&pbContext.Thread{
+			Id: "post-02",
+			SectionCtx: &pbContext.Section{
+				Id: "mylife",
+			},
+		},
+	},
+	Comments: []*pbContext.Comment{
+		&pbContext.Comment{
+			Id:        "comment-01",
+			ThreadCtx: &pbContext.Thread{
 				Id: "post-01",
 				SectionCtx: &pbContext.Section{
 					Id: "mylife",
 				},
 			},
-			ActivityMetadata: patillator.ActivityMetadata(pbMetadata.Content{
-				Interactions:  uint32(12),
-				LastUpdated:   &pbTime.Timestamp{
-					Seconds:   time.Now().Add(-5 * time.Minute).Unix(),
-				},
-				AvgUpdateTime: (2 * time.Minute).Seconds(),
-				DataKey:       "post-01",
-			}),
 		},
-		patillator.ThreadActivity{
-			Thread: &pbContext.Thread{
-				Id: "post-02",
+		&pbContext.Comment{
+			Id:        "comment-02",
+			ThreadCtx: &pbContext.Thread{
+				Id: "post-01",
 				SectionCtx: &pbContext.Section{
 					Id: "mylife",
 				},
 			},
-			ActivityMetadata: patillator.ActivityMetadata(pbMetadata.Content{
-				Interactions:  uint32(12),
-				LastUpdated:   &pbTime.Timestamp{
-					Seconds:   time.Now().Add(-5 * time.Minute).Unix(),
-				},
-				AvgUpdateTime: (2 * time.Minute).Seconds(),
-				DataKey:       "post-02",
-			}),
 		},
 	},
-	Comments:       []patillator.SegregateFinder{
-		patillator.CommentActivity{
-			Comment: &pbContext.Comment{
+	Subcomments: []*pbContext.Subcomment{
+		&pbContext.Subcomment{
+			Id: "subcomment-01",
+			CommentCtx: &pbContext.Comment{
 				Id:        "comment-01",
 				ThreadCtx: &pbContext.Thread{
 					Id: "post-01",
@@ -322,18 +302,11 @@ var activities = patillator.UserActivity{
 					},
 				},
 			},
-			ActivityMetadata: patillator.ActivityMetadata(pbMetadata.Content{
-				Interactions:  uint32(12),
-				LastUpdated:   &pbTime.Timestamp{
-					Seconds:   time.Now().Add(-5 * time.Minute).Unix(),
-				},
-				AvgUpdateTime: (2 * time.Minute).Seconds(),
-				DataKey:       "post-01",
-			}),
 		},
-		patillator.CommentActivity{
-			Comment: &pbContext.Comment{
-				Id:        "comment-02",
+		&pbContext.Subcomment{
+			Id: "subcomment-02",
+			CommentCtx: &pbContext.Comment{
+				Id:        "comment-01",
 				ThreadCtx: &pbContext.Thread{
 					Id: "post-01",
 					SectionCtx: &pbContext.Section{
@@ -341,60 +314,6 @@ var activities = patillator.UserActivity{
 					},
 				},
 			},
-			ActivityMetadata: patillator.ActivityMetadata(pbMetadata.Content{
-				Interactions:  uint32(12),
-				LastUpdated:   &pbTime.Timestamp{
-					Seconds:   time.Now().Add(-5 * time.Minute).Unix(),
-				},
-				AvgUpdateTime: (2 * time.Minute).Seconds(),
-				DataKey:       "post-01",
-			}),
-		},
-	},
-	Subcomments:    []patillator.SegregateFinder{
-		patillator.SubcommentActivity{
-			Subcomment: &pbContext.Subcomment{
-				Id: "subcomment-01",
-				CommentCtx: &pbContext.Comment{
-					Id:        "comment-01",
-					ThreadCtx: &pbContext.Thread{
-						Id: "post-01",
-						SectionCtx: &pbContext.Section{
-							Id: "mylife",
-						},
-					},
-				},
-			},
-			ActivityMetadata: patillator.ActivityMetadata(pbMetadata.Content{
-				Interactions:  uint32(12),
-				LastUpdated:   &pbTime.Timestamp{
-					Seconds:   time.Now().Add(-5 * time.Minute).Unix(),
-				},
-				AvgUpdateTime: (2 * time.Minute).Seconds(),
-				DataKey:       "post-01",
-			}),
-		},
-		patillator.SubcommentActivity{
-			Subcomment: &pbContext.Subcomment{
-				Id: "subcomment-02",
-				CommentCtx: &pbContext.Comment{
-					Id:        "comment-01",
-					ThreadCtx: &pbContext.Thread{
-						Id: "post-01",
-						SectionCtx: &pbContext.Section{
-							Id: "mylife",
-						},
-					},
-				},
-			},
-			ActivityMetadata: patillator.ActivityMetadata(pbMetadata.Content{
-				Interactions:  uint32(12),
-				LastUpdated:   &pbTime.Timestamp{
-					Seconds:   time.Now().Add(-5 * time.Minute).Unix(),
-				},
-				AvgUpdateTime: (2 * time.Minute).Seconds(),
-				DataKey:       "post-01",
-			}),
 		},
 	},
 }
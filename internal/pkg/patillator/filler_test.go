@@ -0,0 +1,184 @@
+package patillator_test
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbMetadata "github.com/luisguve/cheroproto-go/metadata"
+)
+
+// fillerPattern is a pattern with every status.
+var fillerPattern = []pbMetadata.ContentStatus{
+	pbMetadata.ContentStatus_NEW,
+	pbMetadata.ContentStatus_REL,
+	pbMetadata.ContentStatus_TOP,
+	pbMetadata.ContentStatus_NEW,
+	pbMetadata.ContentStatus_NEW,
+	pbMetadata.ContentStatus_REL,
+	pbMetadata.ContentStatus_NEW,
+	pbMetadata.ContentStatus_REL,
+	pbMetadata.ContentStatus_NEW,
+	pbMetadata.ContentStatus_REL,
+}
+
+// shuffled returns a copy of the given contents in a random order.
+func shuffled(r *rand.Rand, contents []patillator.SegregateFinder) []patillator.SegregateFinder {
+	s := make([]patillator.SegregateFinder, len(contents))
+	for i, j := range r.Perm(len(contents)) {
+		s[i] = contents[j]
+	}
+	return s
+}
+
+func TestFillerSeed(t *testing.T) {
+	var contents []patillator.SegregateFinder
+	for i := 0; i < 30; i++ {
+		contents = append(contents, patillator.Content{
+			DataKey:      strconv.Itoa(i),
+			Interactions: uint32(i),
+		})
+	}
+	pattern := []pbMetadata.ContentStatus{
+		pbMetadata.ContentStatus_NEW,
+		pbMetadata.ContentStatus_REL,
+		pbMetadata.ContentStatus_TOP,
+		pbMetadata.ContentStatus_NEW,
+		pbMetadata.ContentStatus_NEW,
+		pbMetadata.ContentStatus_REL,
+		pbMetadata.ContentStatus_NEW,
+		pbMetadata.ContentStatus_REL,
+	}
+	ids := patillator.NewFiller(42, 0.8).FillPattern(contents, pattern)
+	if len(ids) != len(pattern) {
+		t.Fatalf("got %d ids, want %d\n", len(ids), len(pattern))
+	}
+	for i := 0; i < 5; i++ {
+		got := patillator.NewFiller(42, 0.8).FillPattern(contents, pattern)
+		if !reflect.DeepEqual(got, ids) {
+			t.Errorf("same seed filled the pattern differently: got %v, want %v\n", got, ids)
+		}
+	}
+	if seed := patillator.NewFiller(42, 0.8).Seed(); seed != 42 {
+		t.Errorf("got seed %d, want 42\n", seed)
+	}
+}
+
+func TestFillerSeedInputOrder(t *testing.T) {
+	var contents []patillator.SegregateFinder
+	for i := 0; i < 30; i++ {
+		contents = append(contents, patillator.Content{
+			DataKey:      strconv.Itoa(i),
+			Interactions: uint32(i % 15),
+		})
+	}
+	r := rand.New(rand.NewSource(1))
+	ids := patillator.NewFiller(42, 0.8).FillPattern(contents, fillerPattern)
+	for i := 0; i < 10; i++ {
+		got := patillator.NewFiller(42, 0.8).FillPattern(shuffled(r, contents), fillerPattern)
+		if !reflect.DeepEqual(got, ids) {
+			t.Errorf("same seed filled the pattern differently with shuffled contents: got %v, want %v\n", got, ids)
+		}
+	}
+}
+
+// generalContents returns threads of three sections, in a random order.
+func generalContents(r *rand.Rand) map[string][]patillator.SegregateFinder {
+	contents := make(map[string][]patillator.SegregateFinder)
+	for _, section := range []string{"mylife", "food", "music"} {
+		var threads []patillator.SegregateFinder
+		for i := 0; i < 10; i++ {
+			threads = append(threads, patillator.GeneralContent{
+				SectionId: section,
+				Content: &pbMetadata.Content{
+					DataKey:      strconv.Itoa(i),
+					Interactions: uint32(i * 3),
+				},
+			})
+		}
+		contents[section] = shuffled(r, threads)
+	}
+	return contents
+}
+
+func TestFillGeneralPatternSeed(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	want := patillator.NewFiller(7, 0.8).FillGeneralPattern(generalContents(r), fillerPattern)
+	var n int
+	for _, ctxs := range want {
+		n += len(ctxs)
+	}
+	if n != len(fillerPattern) {
+		t.Fatalf("got %d contexts, want %d\n", n, len(fillerPattern))
+	}
+	// Maps are iterated in a random order on every fill.
+	for i := 0; i < 10; i++ {
+		got := patillator.NewFiller(7, 0.8).FillGeneralPattern(generalContents(r), fillerPattern)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("same seed filled the general pattern differently: got %v, want %v\n", got, want)
+		}
+	}
+}
+
+// userActivity returns the threads, comments and subcomments of a user in two
+// sections, in a random order.
+func userActivity(r *rand.Rand) map[string]patillator.UserActivity {
+	activity := make(map[string]patillator.UserActivity)
+	for _, section := range []string{"mylife", "food"} {
+		var a patillator.UserActivity
+		for i := 0; i < 5; i++ {
+			thread := &pbContext.Thread{
+				Id:         "thread-" + strconv.Itoa(i),
+				SectionCtx: &pbContext.Section{Id: section},
+			}
+			comment := &pbContext.Comment{
+				Id:        strconv.Itoa(i),
+				ThreadCtx: thread,
+			}
+			a.ThreadsCreated = append(a.ThreadsCreated, patillator.ThreadActivity{
+				SectionId:        section,
+				Thread:           thread,
+				ActivityMetadata: patillator.ActivityMetadata{Interactions: uint32(i * 5)},
+			})
+			a.Comments = append(a.Comments, patillator.CommentActivity{
+				SectionId:        section,
+				Comment:          comment,
+				ActivityMetadata: patillator.ActivityMetadata{Interactions: uint32(i * 4)},
+			})
+			a.Subcomments = append(a.Subcomments, patillator.SubcommentActivity{
+				SectionId: section,
+				Subcomment: &pbContext.Subcomment{
+					Id:         "1",
+					CommentCtx: comment,
+				},
+				ActivityMetadata: patillator.ActivityMetadata{Interactions: uint32(i * 3)},
+			})
+		}
+		a.ThreadsCreated = shuffled(r, a.ThreadsCreated)
+		a.Comments = shuffled(r, a.Comments)
+		a.Subcomments = shuffled(r, a.Subcomments)
+		activity[section] = a
+	}
+	return activity
+}
+
+func TestFillActivityPatternSeed(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	want := patillator.NewFiller(7, 0.8).FillActivityPattern(userActivity(r), fillerPattern)
+	var n int
+	for _, ctxs := range want {
+		n += len(ctxs)
+	}
+	if n != len(fillerPattern) {
+		t.Fatalf("got %d contexts, want %d\n", n, len(fillerPattern))
+	}
+	for i := 0; i < 10; i++ {
+		got := patillator.NewFiller(7, 0.8).FillActivityPattern(userActivity(r), fillerPattern)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("same seed filled the activity pattern differently: got %v, want %v\n", got, want)
+		}
+	}
+}
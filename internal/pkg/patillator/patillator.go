@@ -4,7 +4,10 @@
 package patillator
 
 import (
+	"fmt"
 	"math/rand"
+	"sort"
+	"time"
 
 	pbContext "github.com/luisguve/cheroproto-go/context"
 	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
@@ -84,10 +87,80 @@ type Context struct {
 	Index  int
 }
 
+// DefaultFollowProbability is the probability of following the given pattern
+// when fetching out contents, unless a different one is set.
+const DefaultFollowProbability = 0.8
+
+// Filler fetches out contents to fill patterns in a random fashion, using its
+// own source of randomness. Given the same seed, probability and contents, it
+// always fills patterns the same way, regardless of the order of the contents.
+//
+// A Filler is not safe for concurrent use; a new one should be created for
+// each pattern to fill.
+type Filler struct {
+	rand        *rand.Rand
+	seed        int64
+	probability float64 // Probability of following the pattern.
+}
+
+// NewFiller returns a Filler with a source of randomness seeded with the given
+// seed, which follows the pattern with the given probability, which should be
+// between 0 and 1.
+func NewFiller(seed int64, probability float64) *Filler {
+	return &Filler{
+		rand:        rand.New(rand.NewSource(seed)),
+		seed:        seed,
+		probability: probability,
+	}
+}
+
+// Seed returns the seed of the source of randomness of f.
+func (f *Filler) Seed() int64 {
+	return f.seed
+}
+
+// FillerOptions holds the settings of the Fillers used by a service.
+type FillerOptions struct {
+	// Probability of following the pattern. DefaultFollowProbability is used
+	// if it's 0.
+	FollowProbability float64
+	// Whether the service should log the seed of the Filler used on each
+	// request, in order to reproduce it later.
+	LogSeeds bool
+}
+
+// NewFiller returns a Filler seeded with the current time that follows the
+// pattern with the probability set in o.
+func (o FillerOptions) NewFiller() *Filler {
+	probability := o.FollowProbability
+	if probability == 0 {
+		probability = DefaultFollowProbability
+	}
+	return NewFiller(time.Now().UnixNano(), probability)
+}
+
+// FillActivityPattern calls FillActivityPattern on a Filler seeded with the
+// current time that follows the pattern with DefaultFollowProbability.
+func FillActivityPattern(activity map[string]UserActivity, pattern []pbMetadata.ContentStatus) map[string][]Context {
+	return FillerOptions{}.NewFiller().FillActivityPattern(activity, pattern)
+}
+
+// FillGeneralPattern calls FillGeneralPattern on a Filler seeded with the
+// current time that follows the pattern with DefaultFollowProbability.
+func FillGeneralPattern(generalContents map[string][]SegregateFinder, pattern []pbMetadata.ContentStatus) map[string][]Context {
+	return FillerOptions{}.NewFiller().FillGeneralPattern(generalContents, pattern)
+}
+
+// FillPattern calls FillPattern on a Filler seeded with the current time that
+// follows the pattern with DefaultFollowProbability.
+func FillPattern(contents []SegregateFinder, pattern []pbMetadata.ContentStatus) []Id {
+	return FillerOptions{}.NewFiller().FillPattern(contents, pattern)
+}
+
 // FillActivityPattern merges the fields ThreadsCreated, Comments and
 // Subcomments (type []SegregateFinder) from the given map[string]UserActivity
 // into a single []SegregateFinder, and then fetches out instances of
-// SegregateFinder in a random fashion, with a probability of 80% of following
+// SegregateFinder in a random fashion, with the probability of f of following
 // the given pattern, and returns a map[string][]Context containing the required
 // information to request the contents mapped to their section.
 //
@@ -96,14 +169,14 @@ type Context struct {
 //
 // Each context of each slice of the returned map contains an Index, which
 // determine the position of each content rule in the final slice of contents.
-func FillActivityPattern(activity map[string]UserActivity, pattern []pbMetadata.ContentStatus) map[string][]Context {
+func (f *Filler) FillActivityPattern(activity map[string]UserActivity, pattern []pbMetadata.ContentStatus) map[string][]Context {
 	var activities []SegregateFinder
 	for _, a := range activity {
 		activities = append(activities, a.ThreadsCreated...)
 		activities = append(activities, a.Comments...)
 		activities = append(activities, a.Subcomments...)
 	}
-	segActivities := segregate(activities)
+	segActivities := f.segregate(activities)
 
 	var result = make(map[string][]Context)
 
@@ -115,7 +188,7 @@ FOR:
 	for idx, status := range pattern {
 		switch pbMetadata.ContentStatus_name[int32(status)] {
 		case "NEW":
-			content, segActivities.newContents, segActivities.relContents, empty = fetch(segActivities.newContents,
+			content, segActivities.newContents, segActivities.relContents, empty = f.fetch(segActivities.newContents,
 				segActivities.relContents)
 			if !empty {
 				// check type assertion to ensure there will not be a panic
@@ -133,7 +206,7 @@ FOR:
 			}
 			fallthrough
 		case "REL":
-			content, segActivities.relContents, segActivities.newContents, empty = fetch(segActivities.relContents,
+			content, segActivities.relContents, segActivities.newContents, empty = f.fetch(segActivities.relContents,
 				segActivities.newContents)
 			if !empty {
 				// check type assertion to ensure there will not be a panic
@@ -176,19 +249,19 @@ FOR:
 
 // FillGeneralPattern merges every []SegregateFinder in generalContents into
 // a single []SegregateFinder, then fetches out contents from it in a random
-// fashion, with a probability of 80% of following the given pattern, and returns
+// fashion, with the probability of f of following the given pattern, and returns
 // a []GeneralId containing the ids of the contents along with the section they
 // they belong to, to be retrieved from the database.
 //
 // It may return a smaller list of content contexts than the provided pattern
 // requires, depending upon the availability of contents.
-func FillGeneralPattern(generalContents map[string][]SegregateFinder, pattern []pbMetadata.ContentStatus) map[string][]Context {
+func (f *Filler) FillGeneralPattern(generalContents map[string][]SegregateFinder, pattern []pbMetadata.ContentStatus) map[string][]Context {
 	var contents []SegregateFinder
 	for _, c := range generalContents {
 		contents = append(contents, c...)
 	}
 	// segregated contents
-	segContents := segregate(contents)
+	segContents := f.segregate(contents)
 
 	var result = make(map[string][]Context)
 
@@ -200,7 +273,7 @@ FOR:
 	for idx, status := range pattern {
 		switch pbMetadata.ContentStatus_name[int32(status)] {
 		case "NEW":
-			content, segContents.newContents, segContents.relContents, empty = fetch(segContents.newContents,
+			content, segContents.newContents, segContents.relContents, empty = f.fetch(segContents.newContents,
 				segContents.relContents)
 			if !empty {
 				// check type assertion to ensure there will not be a panic.
@@ -228,7 +301,7 @@ FOR:
 			}
 			fallthrough
 		case "REL":
-			content, segContents.relContents, segContents.newContents, empty = fetch(segContents.relContents,
+			content, segContents.relContents, segContents.newContents, empty = f.fetch(segContents.relContents,
 				segContents.newContents)
 			if !empty {
 				// check type assertion to ensure there will not be a panic.
@@ -290,16 +363,16 @@ FOR:
 }
 
 // FillPattern fetches out contents from the given []SegregateFinder in a
-// random fashion, with a probability of 80% of following the given pattern, and
+// random fashion, with the probability of f of following the given pattern, and
 // returns a []string containing the ids of the contents to be retrieved from
 // the database. The caller must know the context of the contents being fetched
 // out, as only the list of raw content ids will be returned back.
 //
 // It may return a smaller list of content contexts than the provided pattern
 // requires, depending upon the availability of contents.
-func FillPattern(contents []SegregateFinder, pattern []pbMetadata.ContentStatus) []Id {
+func (f *Filler) FillPattern(contents []SegregateFinder, pattern []pbMetadata.ContentStatus) []Id {
 	// segregated contents
-	segContents := segregate(contents)
+	segContents := f.segregate(contents)
 
 	var result []Id
 
@@ -311,7 +384,7 @@ FOR:
 	for _, status := range pattern {
 		switch pbMetadata.ContentStatus_name[int32(status)] {
 		case "NEW":
-			content, segContents.newContents, segContents.relContents, empty = fetch(segContents.newContents,
+			content, segContents.newContents, segContents.relContents, empty = f.fetch(segContents.newContents,
 				segContents.relContents)
 			if !empty {
 				// check type assertion to ensure there will not be a panic
@@ -322,7 +395,7 @@ FOR:
 			}
 			fallthrough
 		case "REL":
-			content, segContents.relContents, segContents.newContents, empty = fetch(segContents.relContents,
+			content, segContents.relContents, segContents.newContents, empty = f.fetch(segContents.relContents,
 				segContents.newContents)
 			if !empty {
 				// check type assertion to ensure there will not be a panic
@@ -349,9 +422,83 @@ FOR:
 	return result
 }
 
+// modelSegregator is implemented by the contents of this package, which can be
+// classified with a given relevance model instead of the one set with
+// SetRelevanceModel.
+type modelSegregator interface {
+	isRelevant(m RelevanceModel) bool
+	isLessRelevantThan(m RelevanceModel, other interface{}) bool
+}
+
+// sortKey returns the given key of a content as a string that identifies it
+// among the contents of every section.
+func sortKey(key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return k
+	case GeneralId:
+		return k.SectionId + "/" + k.Id
+	case *pbContext.Context:
+		switch ctx := k.Ctx.(type) {
+		case *pbContext.Context_ThreadCtx:
+			return k.SectionId + "/" + ctx.ThreadCtx.Id
+		case *pbContext.Context_CommentCtx:
+			c := ctx.CommentCtx
+			if c.ThreadCtx != nil {
+				return k.SectionId + "/" + c.ThreadCtx.Id + "/" + c.Id
+			}
+		case *pbContext.Context_SubcommentCtx:
+			sc := ctx.SubcommentCtx
+			if (sc.CommentCtx != nil) && (sc.CommentCtx.ThreadCtx != nil) {
+				return k.SectionId + "/" + sc.CommentCtx.ThreadCtx.Id + "/" +
+					sc.CommentCtx.Id + "/" + sc.Id
+			}
+		}
+	}
+	return fmt.Sprint(key)
+}
+
+// sortByKey returns a copy of the given contents sorted by their keys, so the
+// contents are fetched out the same way regardless of the order they were
+// gathered in, such as from maps or concurrent requests.
+func sortByKey(contents []SegregateFinder) []SegregateFinder {
+	keys := make([]string, len(contents))
+	idxs := make([]int, len(contents))
+	for i, c := range contents {
+		keys[i] = sortKey(c.Key())
+		idxs[i] = i
+	}
+	sort.SliceStable(idxs, func(i, j int) bool {
+		return keys[idxs[i]] < keys[idxs[j]]
+	})
+	sorted := make([]SegregateFinder, len(contents))
+	for i, idx := range idxs {
+		sorted[i] = contents[idx]
+	}
+	return sorted
+}
+
 // segregate classifies the contents into three categories: new, relevant and
-// top and returns the result into a *segregatedContents instance.
-func segregate(contents []SegregateFinder) *segregatedContents {
+// top and returns the result into a *segregatedContents instance. The contents
+// are sorted by key first, so that, given the same seed, f classifies and
+// fetches them out the same way regardless of their order. Every content is
+// classified and compared at the same time, read once from the relevance
+// model.
+func (f *Filler) segregate(contents []SegregateFinder) *segregatedContents {
+	contents = sortByKey(contents)
+	model := fixedModel()
+	isRelevant := func(c SegregateFinder) bool {
+		if ms, ok := c.(modelSegregator); ok {
+			return ms.isRelevant(model)
+		}
+		return c.IsRelevant()
+	}
+	isLessRelevant := func(c, other SegregateFinder) bool {
+		if ms, ok := c.(modelSegregator); ok {
+			return ms.isLessRelevantThan(model, other)
+		}
+		return c.IsLessRelevantThan(other)
+	}
 	// segregated contents
 	segContents := new(segregatedContents)
 	// List of relevant contents, required to get the most relevant content.
@@ -359,12 +506,9 @@ func segregate(contents []SegregateFinder) *segregatedContents {
 
 	// segregate contents only if there are contents
 	if len(contents) > 0 {
-		// set the first content as the top content.
-		// it will probably change.
-		topContent := contents[0]
 		// set relevant and new contents
 		for _, content := range contents {
-			if content.IsRelevant() {
+			if isRelevant(content) {
 				// add to list of relevant contents
 				segContents.relContents = append(segContents.relContents, ContentFinder(content))
 				relContents = append(relContents, content)
@@ -376,11 +520,14 @@ func segregate(contents []SegregateFinder) *segregatedContents {
 		// Fetch top thread from the list of relevant contents only if there
 		// were found relevant contents.
 		if len(relContents) > 0 {
+			// set the first relevant content as the top content.
+			// it will probably change.
+			topContent := relContents[0]
 			// Top Content Index
 			var TCI int
 			// search for the most top content
 			for idx, content := range relContents {
-				if topContent.IsLessRelevantThan(content) {
+				if isLessRelevant(topContent, content) {
 					// new topContent found
 					topContent = content
 					TCI = idx
@@ -398,11 +545,9 @@ func segregate(contents []SegregateFinder) *segregatedContents {
 			// set the top content.
 			segContents.topContent = ContentFinder(topContent)
 		} else {
-			// at the beginning, the first content was set as the top content.
-			//
 			// since there are no relevant contents, the top content will be
 			// randomly fetched out from the list of new contents.
-			segContents.topContent, segContents.newContents = fetchRandomContent(segContents.newContents)
+			segContents.topContent, segContents.newContents = f.fetchRandomContent(segContents.newContents)
 		}
 	}
 	return segContents
@@ -416,7 +561,7 @@ func segregate(contents []SegregateFinder) *segregatedContents {
 // without the element containing the content just fetched, and a boolean
 // indicating whether or not both the main contents list and the optional contents
 // list have no elements.
-func fetch(mainContents, optContents []ContentFinder) (ContentFinder,
+func (f *Filler) fetch(mainContents, optContents []ContentFinder) (ContentFinder,
 	[]ContentFinder, []ContentFinder, bool) {
 	var content ContentFinder
 	var empty bool
@@ -424,18 +569,18 @@ func fetch(mainContents, optContents []ContentFinder) (ContentFinder,
 	if len(mainContents) > 0 {
 		// check whether to follow the pattern and fetch a random content of the
 		// expected status (i.e. from mainContents)
-		if fetchExpectedType() {
-			content, mainContents = fetchRandomContent(mainContents)
+		if f.fetchExpectedType() {
+			content, mainContents = f.fetchRandomContent(mainContents)
 		} else {
 			// check whether there are contents with the optional status
 			if len(optContents) > 0 {
-				content, optContents = fetchRandomContent(optContents)
+				content, optContents = f.fetchRandomContent(optContents)
 			} else {
-				content, mainContents = fetchRandomContent(mainContents)
+				content, mainContents = f.fetchRandomContent(mainContents)
 			}
 		}
 	} else if len(optContents) > 0 {
-		content, optContents = fetchRandomContent(optContents)
+		content, optContents = f.fetchRandomContent(optContents)
 	} else {
 		// both mainContents and optContents are empty.
 		empty = true
@@ -446,8 +591,8 @@ func fetch(mainContents, optContents []ContentFinder) (ContentFinder,
 // fetchRandomContent fetches out one content from the list of contents in a
 // random fashion and returns the content and the list of contents without the
 // element just fetched out.
-func fetchRandomContent(contents []ContentFinder) (ContentFinder, []ContentFinder) {
-	idx := rand.Intn(len(contents))
+func (f *Filler) fetchRandomContent(contents []ContentFinder) (ContentFinder, []ContentFinder) {
+	idx := f.rand.Intn(len(contents))
 	// copy content at position idx
 	content := contents[idx]
 	// copy the last element from contents into the position at which the
@@ -463,14 +608,8 @@ func fetchRandomContent(contents []ContentFinder) (ContentFinder, []ContentFinde
 	return content, reducedContents
 }
 
-// fetchExpectedType returns true on a probability of 80% and false on a
-// probability of 20%.
-func fetchExpectedType() bool {
-	values := [10]bool{true, true, true, true, true, true, true, true, true, true}
-	i := rand.Intn(10)
-	values[i] = false
-	i = rand.Intn(10)
-	values[i] = false
-	i = rand.Intn(10)
-	return values[i]
+// fetchExpectedType returns true with the probability of f of following the
+// pattern.
+func (f *Filler) fetchExpectedType() bool {
+	return f.rand.Float64() < f.probability
 }
@@ -0,0 +1,231 @@
+package patillator
+
+import (
+	"math"
+	"time"
+
+	pbMetadata "github.com/luisguve/cheroproto-go/metadata"
+)
+
+// RelevanceModel is the set of rules to classify contents as relevant and to
+// rank them. Content, GeneralContent and ActivityMetadata delegate their
+// Segregator methods to the model set with SetRelevanceModel.
+type RelevanceModel interface {
+	// IsRelevant returns whether or not the content described by the given
+	// metadata fulfills the requirements to be relevant.
+	IsRelevant(m *pbMetadata.Content) bool
+	// Less returns whether the content described by a is less relevant than
+	// the content described by b. It must be a strict weak ordering.
+	Less(a, b *pbMetadata.Content) bool
+}
+
+// timedModel is implemented by the relevance models that depend on the current
+// time, such as HotModel.
+type timedModel interface {
+	// fixed returns the model with its current time fixed at the time fixed
+	// is called.
+	fixed() RelevanceModel
+}
+
+// fixedModel returns the relevance model with its current time fixed, if it
+// depends on it, so every content of a ranking pass is classified and compared
+// at the same time and the clock is read only once.
+func fixedModel() RelevanceModel {
+	if tm, ok := relevanceModel.(timedModel); ok {
+		return tm.fixed()
+	}
+	return relevanceModel
+}
+
+// relevanceModel is the model used by every content wrapper. It should only be
+// set on startup, before serving any request.
+var relevanceModel RelevanceModel = DefaultModel{}
+
+// SetRelevanceModel sets the model used to classify and rank contents. It is
+// not safe to call it while contents are being classified, so it should only be
+// called on startup. A nil model sets the DefaultModel.
+func SetRelevanceModel(m RelevanceModel) {
+	if m == nil {
+		m = DefaultModel{}
+	}
+	relevanceModel = m
+}
+
+// DefaultModel considers a content relevant if the number of interactions is
+// greater than 10 and the average update time difference is 10 minutes or
+// less.
+//
+// Contents are ranked by number of interactions, and contents with the same
+// number of interactions are ranked by average update time difference; the
+// shorter, the more relevant.
+type DefaultModel struct{}
+
+// IsRelevant returns true if the number of interactions is greater than 10 and
+// the average update time difference is less than 10 minutes. It does the
+// comparison on the Interactions and AvgUpdateTime fields, respectively.
+func (DefaultModel) IsRelevant(m *pbMetadata.Content) bool {
+	min := 10 * time.Minute
+	return (m.Interactions > 10) && (m.AvgUpdateTime <= min.Seconds())
+}
+
+// Less returns true if a has less interactions than b or, if both have the same
+// number of interactions, a has a greater average update time difference.
+func (DefaultModel) Less(a, b *pbMetadata.Content) bool {
+	if a.Interactions != b.Interactions {
+		return a.Interactions < b.Interactions
+	}
+	return a.AvgUpdateTime > b.AvgUpdateTime
+}
+
+// HotModel ranks contents by a score that grows with the number of
+// interactions and decays with the age of the content:
+//
+//	score = interactions / (age in hours + 2) ^ Gravity
+//
+// The age is measured from the time the content was published, which is the
+// last time it was updated minus the accumulated time difference between its
+// interactions.
+//
+// A content is relevant if its score is Threshold or greater.
+type HotModel struct {
+	Gravity   float64
+	Threshold float64
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+// NewHotModel returns a HotModel with the given gravity and threshold.
+func NewHotModel(gravity, threshold float64) HotModel {
+	return HotModel{
+		Gravity:   gravity,
+		Threshold: threshold,
+	}
+}
+
+// now returns the current time according to hm.
+func (hm HotModel) now() time.Time {
+	if hm.Now != nil {
+		return hm.Now()
+	}
+	return time.Now()
+}
+
+// fixed returns a copy of hm whose current time is always the current time of
+// hm when fixed is called.
+func (hm HotModel) fixed() RelevanceModel {
+	now := hm.now()
+	hm.Now = func() time.Time { return now }
+	return hm
+}
+
+// Score returns the hot score of the content described by the given metadata.
+func (hm HotModel) Score(m *pbMetadata.Content) float64 {
+	return hm.scoreAt(m, hm.now())
+}
+
+// scoreAt returns the hot score of the content described by the given metadata
+// at the given time.
+func (hm HotModel) scoreAt(m *pbMetadata.Content, now time.Time) float64 {
+	var published int64
+	if m.LastUpdated != nil {
+		published = m.LastUpdated.Seconds - m.Diff
+	}
+	age := now.Sub(time.Unix(published, 0)).Hours()
+	if age < 0 {
+		age = 0
+	}
+	return float64(m.Interactions) / math.Pow(age+2, hm.Gravity)
+}
+
+// IsRelevant returns true if the score of the content is equal to or greater
+// than the threshold.
+func (hm HotModel) IsRelevant(m *pbMetadata.Content) bool {
+	return hm.Score(m) >= hm.Threshold
+}
+
+// Less returns true if the score of a is lower than the score of b, both at
+// the same time.
+func (hm HotModel) Less(a, b *pbMetadata.Content) bool {
+	now := hm.now()
+	return hm.scoreAt(a, now) < hm.scoreAt(b, now)
+}
+
+// Scored holds the metadata of a content along with its net score, which is the
+// number of upvotes minus the number of downvotes.
+type Scored struct {
+	*pbMetadata.Content
+	Score int
+}
+
+// ScoreModel is a RelevanceModel that also takes into account the net score of
+// contents. ScoredContent delegates its Segregator methods to the model set
+// with SetRelevanceModel if it's a ScoreModel.
+type ScoreModel interface {
+	RelevanceModel
+	// IsRelevantScored returns whether or not the given content fulfills the
+	// requirements to be relevant.
+	IsRelevantScored(c Scored) bool
+	// LessScored returns whether a is less relevant than b. It must be a
+	// strict weak ordering.
+	LessScored(a, b Scored) bool
+}
+
+// NetScoreModel buries the contents whose net score is lower than MinScore:
+// they're never relevant and they rank below any other content, the lower the
+// net score, the less relevant. Any other content is classified and ranked by
+// Base, which is also used for contents without a net score.
+type NetScoreModel struct {
+	Base     RelevanceModel
+	MinScore int
+}
+
+// NewNetScoreModel returns a NetScoreModel on top of the given model with the
+// given minimum net score. A nil model sets the DefaultModel.
+func NewNetScoreModel(base RelevanceModel, minScore int) NetScoreModel {
+	if base == nil {
+		base = DefaultModel{}
+	}
+	return NetScoreModel{
+		Base:     base,
+		MinScore: minScore,
+	}
+}
+
+// fixed returns a copy of nm whose Base has its current time fixed, if it
+// depends on it.
+func (nm NetScoreModel) fixed() RelevanceModel {
+	if tm, ok := nm.Base.(timedModel); ok {
+		nm.Base = tm.fixed()
+	}
+	return nm
+}
+
+// IsRelevant returns whether the content is relevant according to Base.
+func (nm NetScoreModel) IsRelevant(m *pbMetadata.Content) bool {
+	return nm.Base.IsRelevant(m)
+}
+
+// Less returns whether a is less relevant than b according to Base.
+func (nm NetScoreModel) Less(a, b *pbMetadata.Content) bool {
+	return nm.Base.Less(a, b)
+}
+
+// IsRelevantScored returns true if the net score of the content is MinScore or
+// greater and it's relevant according to Base.
+func (nm NetScoreModel) IsRelevantScored(c Scored) bool {
+	return (c.Score >= nm.MinScore) && nm.Base.IsRelevant(c.Content)
+}
+
+// LessScored returns true if a is buried and b is not, if both are buried and
+// a has a lower net score, or if a is less relevant than b according to Base
+// otherwise.
+func (nm NetScoreModel) LessScored(a, b Scored) bool {
+	aBuried, bBuried := a.Score < nm.MinScore, b.Score < nm.MinScore
+	if aBuried != bBuried {
+		return aBuried
+	}
+	if aBuried && (a.Score != b.Score) {
+		return a.Score < b.Score
+	}
+	return nm.Base.Less(a.Content, b.Content)
+}
@@ -0,0 +1,140 @@
+package patillator_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	pbMetadata "github.com/luisguve/cheroproto-go/metadata"
+)
+
+func TestDefaultModelOrdering(t *testing.T) {
+	model := patillator.DefaultModel{}
+	metadata := []*pbMetadata.Content{
+		{Interactions: 5, AvgUpdateTime: 100},
+		{Interactions: 5, AvgUpdateTime: 50},
+		{Interactions: 20, AvgUpdateTime: 900},
+		{Interactions: 20, AvgUpdateTime: 900},
+		{Interactions: 30, AvgUpdateTime: 10},
+	}
+	for i, a := range metadata {
+		// Irreflexivity.
+		if model.Less(a, a) {
+			t.Errorf("content %d should not be less relevant than itself\n", i)
+		}
+		for j, b := range metadata {
+			// Asymmetry.
+			if model.Less(a, b) && model.Less(b, a) {
+				t.Errorf("contents %d and %d are less relevant than each other\n", i, j)
+			}
+			for k, c := range metadata {
+				// Transitivity.
+				if model.Less(a, b) && model.Less(b, c) && !model.Less(a, c) {
+					t.Errorf("ordering of contents %d, %d and %d is not transitive\n", i, j, k)
+				}
+			}
+		}
+	}
+	if !model.Less(metadata[0], metadata[1]) {
+		t.Errorf("with the same interactions, a longer average update time should be less relevant\n")
+	}
+	if model.IsRelevant(metadata[2]) {
+		t.Errorf("content with an average update time of 15 minutes should not be relevant\n")
+	}
+	if !model.IsRelevant(metadata[4]) {
+		t.Errorf("content with 30 interactions every 10 seconds should be relevant\n")
+	}
+}
+
+func TestHotModelDecay(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	model := patillator.NewHotModel(1.8, 1)
+	model.Now = func() time.Time { return now }
+
+	recent := &pbMetadata.Content{
+		Interactions: 20,
+		LastUpdated:  &pbTime.Timestamp{Seconds: now.Add(-1 * time.Hour).Unix()},
+	}
+	// Same interactions, but published two days ago.
+	old := &pbMetadata.Content{
+		Interactions: 20,
+		LastUpdated:  &pbTime.Timestamp{Seconds: now.Add(-1 * time.Hour).Unix()},
+		Diff:         int64((47 * time.Hour).Seconds()),
+	}
+	if !model.Less(old, recent) {
+		t.Errorf("older content should be less relevant: scores %v and %v\n",
+			model.Score(old), model.Score(recent))
+	}
+	if !model.IsRelevant(recent) {
+		t.Errorf("recent content should be relevant: score %v\n", model.Score(recent))
+	}
+	if model.IsRelevant(old) {
+		t.Errorf("old content should not be relevant: score %v\n", model.Score(old))
+	}
+}
+
+func TestNetScoreModelBuries(t *testing.T) {
+	model := patillator.NewNetScoreModel(patillator.DefaultModel{}, 0)
+	popular := &pbMetadata.Content{Interactions: 30, AvgUpdateTime: 10}
+	quiet := &pbMetadata.Content{Interactions: 2, AvgUpdateTime: 100}
+
+	spam := patillator.Scored{Content: popular, Score: -5}
+	worse := patillator.Scored{Content: popular, Score: -8}
+	good := patillator.Scored{Content: quiet, Score: 3}
+	better := patillator.Scored{Content: popular, Score: 3}
+
+	if model.IsRelevantScored(spam) {
+		t.Errorf("content with a negative net score should not be relevant\n")
+	}
+	if !model.IsRelevantScored(better) {
+		t.Errorf("popular content with a positive net score should be relevant\n")
+	}
+	if !model.LessScored(spam, good) || model.LessScored(good, spam) {
+		t.Errorf("buried content should be less relevant than any other content\n")
+	}
+	if !model.LessScored(worse, spam) {
+		t.Errorf("buried contents should be ranked by net score\n")
+	}
+	if !model.LessScored(good, better) {
+		t.Errorf("contents that are not buried should be ranked by the base model\n")
+	}
+	if model.LessScored(spam, spam) {
+		t.Errorf("content should not be less relevant than itself\n")
+	}
+}
+
+func TestHotModelClockPerPass(t *testing.T) {
+	var reads int
+	now := time.Unix(1600000000, 0)
+	model := patillator.NewHotModel(1.8, 1)
+	model.Now = func() time.Time {
+		reads++
+		return now
+	}
+	patillator.SetRelevanceModel(patillator.NewNetScoreModel(model, 0))
+	defer patillator.SetRelevanceModel(nil)
+
+	var contents []patillator.SegregateFinder
+	for i := 0; i < 50; i++ {
+		contents = append(contents, patillator.Content{
+			DataKey:      strconv.Itoa(i),
+			Interactions: 100,
+			LastUpdated:  &pbTime.Timestamp{Seconds: now.Add(-time.Duration(i) * time.Hour).Unix()},
+		})
+	}
+	pattern := []pbMetadata.ContentStatus{
+		pbMetadata.ContentStatus_TOP,
+		pbMetadata.ContentStatus_REL,
+		pbMetadata.ContentStatus_NEW,
+	}
+	ids := patillator.NewFiller(1, 0.8).FillPattern(contents, pattern)
+	if reads != 1 {
+		t.Errorf("got %d reads of the clock in a single pass, want 1\n", reads)
+	}
+	// With the same interactions, the newest content is on top.
+	if (len(ids) == 0) || (ids[0].Id != "0") {
+		t.Errorf("got ids %v, want content 0 on top\n", ids)
+	}
+}
@@ -0,0 +1,181 @@
+// Package polls provides the rules for the polls attached to threads, the
+// metadata key under which clients send them, and the Polls gRPC service, which
+// submits and changes votes on polls and returns their results, and its client.
+// The section services implement it.
+//
+// The protocol in cheroproto does not have fields for polls yet, so the poll of
+// a new thread is sent as JSON in the binary metadata of CreateThread. The
+// service is described here by hand and its messages are encoded as JSON by
+// jsoncodec. Clients built by NewClient set the content subtype accordingly.
+
+package polls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/luisguve/cheroapi/internal/pkg/jsoncodec"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// PollMD is the metadata key under which clients send the poll of a new thread
+// as a JSON Spec. Being binary metadata, it can hold any text.
+const PollMD = "poll-bin"
+
+// Limits of the options of a poll.
+const (
+	MinOptions   = 2
+	MaxOptions   = 10
+	MaxOptionLen = 100 // In runes.
+)
+
+// These errors are returned on invalid polls.
+var (
+	ErrInvalidPoll    = errors.New("Invalid poll")
+	ErrInvalidOptions = errors.New("Polls must have 2 to 10 options of 1 to 100 characters")
+	ErrCloseTime      = errors.New("The close time of the poll must be in the future")
+)
+
+// Spec is the poll of a new thread. Votes are accepted until ClosesAt, a unix
+// time, unless it's 0. If MultipleChoice is true, users can choose several
+// options.
+type Spec struct {
+	Options        []string `json:"options"`
+	ClosesAt       int64    `json:"closes_at,omitempty"`
+	MultipleChoice bool     `json:"multiple_choice,omitempty"`
+}
+
+// FromContext returns the poll of a new thread sent in the incoming metadata of
+// ctx, with its options trimmed, or nil if there is none. It returns an error
+// if the poll does not follow the rules.
+func FromContext(ctx context.Context) (*Spec, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	values := md.Get(PollMD)
+	if (len(values) == 0) || (values[0] == "") {
+		return nil, nil
+	}
+	spec := new(Spec)
+	if err := json.Unmarshal([]byte(values[0]), spec); err != nil {
+		return nil, ErrInvalidPoll
+	}
+	if (len(spec.Options) < MinOptions) || (len(spec.Options) > MaxOptions) {
+		return nil, ErrInvalidOptions
+	}
+	for i, option := range spec.Options {
+		option = strings.TrimSpace(option)
+		if (option == "") || (utf8.RuneCountInString(option) > MaxOptionLen) {
+			return nil, ErrInvalidOptions
+		}
+		spec.Options[i] = option
+	}
+	if (spec.ClosesAt != 0) && (spec.ClosesAt <= time.Now().Unix()) {
+		return nil, ErrCloseTime
+	}
+	return spec, nil
+}
+
+// VoteRequest holds the indexes of the options of the poll of a thread chosen by
+// a user.
+type VoteRequest struct {
+	ThreadId string `json:"thread_id"`
+	UserId   string `json:"user_id"`
+	Choices  []int  `json:"choices"`
+}
+
+// ResultsRequest asks for the results of the poll of a thread. If UserId is set,
+// the choices of the user are set in the results.
+type ResultsRequest struct {
+	ThreadId string `json:"thread_id"`
+	UserId   string `json:"user_id,omitempty"`
+}
+
+// Results holds a poll, the number of votes for each option, the number of
+// users who voted, whether it's closed and the choices of the user who asked
+// for them, if they voted.
+type Results struct {
+	Spec
+	Votes   []int `json:"votes"`
+	Voters  int   `json:"voters"`
+	Closed  bool  `json:"closed,omitempty"`
+	Choices []int `json:"choices,omitempty"`
+}
+
+// Server is the server API for the Polls service.
+type Server interface {
+	Vote(context.Context, *VoteRequest) (*Results, error)
+	ChangeVote(context.Context, *VoteRequest) (*Results, error)
+	Results(context.Context, *ResultsRequest) (*Results, error)
+}
+
+// serviceName is the full name of the service.
+const serviceName = "cheroapi.Polls"
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(serviceName, "Vote", func() interface{} { return new(VoteRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).Vote(ctx, req.(*VoteRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "ChangeVote", func() interface{} { return new(VoteRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).ChangeVote(ctx, req.(*VoteRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "Results", func() interface{} { return new(ResultsRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).Results(ctx, req.(*ResultsRequest))
+			}),
+	},
+	Metadata: "polls.go",
+}
+
+// Register registers srv as the Polls service of s.
+func Register(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client is the client API for the Polls service.
+type Client interface {
+	Vote(ctx context.Context, req *VoteRequest, opts ...grpc.CallOption) (*Results, error)
+	ChangeVote(ctx context.Context, req *VoteRequest, opts ...grpc.CallOption) (*Results, error)
+	Results(ctx context.Context, req *ResultsRequest, opts ...grpc.CallOption) (*Results, error)
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client of the Polls service on the given connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc}
+}
+
+func (c *client) invoke(ctx context.Context, method string, req interface{}, opts []grpc.CallOption) (*Results, error) {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	res := new(Results)
+	if err := c.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, res, opts...); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) Vote(ctx context.Context, req *VoteRequest, opts ...grpc.CallOption) (*Results, error) {
+	return c.invoke(ctx, "Vote", req, opts)
+}
+
+func (c *client) ChangeVote(ctx context.Context, req *VoteRequest, opts ...grpc.CallOption) (*Results, error) {
+	return c.invoke(ctx, "ChangeVote", req, opts)
+}
+
+func (c *client) Results(ctx context.Context, req *ResultsRequest, opts ...grpc.CallOption) (*Results, error) {
+	return c.invoke(ctx, "Results", req, opts)
+}
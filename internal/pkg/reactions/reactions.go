@@ -0,0 +1,198 @@
+// Package reactions provides the Reactions gRPC service, which adds and
+// removes the reactions of users to threads, comments and subcomments and
+// returns the number of users who added each reaction, and its client. The
+// section services implement it, each with its own set of reactions.
+//
+// The protocol in cheroproto does not define reactions yet, so ContentRules
+// cannot hold their counts and the service is described here by hand. Its
+// messages are encoded as JSON by jsoncodec, with the notifications in
+// protojson. Clients built by NewClient set the content subtype accordingly.
+
+package reactions
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/luisguve/cheroapi/internal/pkg/jsoncodec"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// DefaultTypes is the set of reactions of a section, unless a different one is
+// set.
+var DefaultTypes = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+
+// MaxNameLen is the maximum length of the name of a reaction.
+const MaxNameLen = 32
+
+// MaxContents is the maximum number of contents in a GetRequest.
+const MaxContents = 100
+
+// ValidName returns whether name can be the name of a reaction: 1 to MaxNameLen
+// lowercase ASCII letters, digits, dashes or underscores.
+func ValidName(name string) bool {
+	if (name == "") || (len(name) > MaxNameLen) {
+		return false
+	}
+	for _, r := range name {
+		if !(((r >= 'a') && (r <= 'z')) || ((r >= '0') && (r <= '9')) || (r == '-') || (r == '_')) {
+			return false
+		}
+	}
+	return true
+}
+
+// ContentId identifies a thread, a comment or a subcomment in a section.
+// CommentId is empty for threads and SubcommentId is empty for threads and
+// comments.
+type ContentId struct {
+	ThreadId     string `json:"thread_id"`
+	CommentId    string `json:"comment_id,omitempty"`
+	SubcommentId string `json:"subcomment_id,omitempty"`
+}
+
+// ReactRequest holds a reaction of a user to a content.
+type ReactRequest struct {
+	Content  ContentId `json:"content"`
+	UserId   string    `json:"user_id"`
+	Reaction string    `json:"reaction"`
+}
+
+// ReactResponse holds the reactions to a content after adding or removing a
+// reaction and, after adding it, the notifications for the users to notify,
+// each a NotifyUser as protojson.
+type ReactResponse struct {
+	Reactions Reactions         `json:"reactions"`
+	Notifs    []json.RawMessage `json:"notifs,omitempty"`
+}
+
+// GetRequest asks for the reactions to the given contents and, if UserId is
+// set, the reactions of the user to them.
+type GetRequest struct {
+	Contents []ContentId `json:"contents"`
+	UserId   string      `json:"user_id,omitempty"`
+}
+
+// GetResponse holds the set of reactions of the section and the reactions to
+// each content in the request, in the same order.
+type GetResponse struct {
+	Types     []string    `json:"types"`
+	Reactions []Reactions `json:"reactions"`
+}
+
+// Reactions holds the number of users who added each reaction to a content, by
+// reaction, and the reactions of the user in the request.
+type Reactions struct {
+	Content ContentId      `json:"content"`
+	Counts  map[string]int `json:"counts"`
+	Mine    []string       `json:"mine,omitempty"`
+}
+
+// NewNotifs returns the given notifications as protojson.
+func NewNotifs(notifyUsers []*pbApi.NotifyUser) ([]json.RawMessage, error) {
+	var notifs []json.RawMessage
+	for _, n := range notifyUsers {
+		notif, err := protojson.Marshal(proto.MessageV2(n))
+		if err != nil {
+			return nil, err
+		}
+		notifs = append(notifs, notif)
+	}
+	return notifs, nil
+}
+
+// NotifyUsers returns the notifications held by r.
+func (r *ReactResponse) NotifyUsers() ([]*pbApi.NotifyUser, error) {
+	var notifyUsers []*pbApi.NotifyUser
+	for _, notif := range r.Notifs {
+		n := new(pbApi.NotifyUser)
+		if err := protojson.Unmarshal(notif, proto.MessageV2(n)); err != nil {
+			return nil, err
+		}
+		notifyUsers = append(notifyUsers, n)
+	}
+	return notifyUsers, nil
+}
+
+// Server is the server API for the Reactions service.
+type Server interface {
+	AddReaction(context.Context, *ReactRequest) (*ReactResponse, error)
+	RemoveReaction(context.Context, *ReactRequest) (*ReactResponse, error)
+	GetReactions(context.Context, *GetRequest) (*GetResponse, error)
+}
+
+// serviceName is the full name of the service.
+const serviceName = "cheroapi.Reactions"
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(serviceName, "AddReaction", func() interface{} { return new(ReactRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).AddReaction(ctx, req.(*ReactRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "RemoveReaction", func() interface{} { return new(ReactRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).RemoveReaction(ctx, req.(*ReactRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "GetReactions", func() interface{} { return new(GetRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).GetReactions(ctx, req.(*GetRequest))
+			}),
+	},
+	Metadata: "reactions.go",
+}
+
+// Register registers srv as the Reactions service of s.
+func Register(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client is the client API for the Reactions service.
+type Client interface {
+	AddReaction(ctx context.Context, req *ReactRequest, opts ...grpc.CallOption) (*ReactResponse, error)
+	RemoveReaction(ctx context.Context, req *ReactRequest, opts ...grpc.CallOption) (*ReactResponse, error)
+	GetReactions(ctx context.Context, req *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client of the Reactions service on the given connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc}
+}
+
+func (c *client) invoke(ctx context.Context, method string, req, res interface{}, opts []grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	return c.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, res, opts...)
+}
+
+func (c *client) AddReaction(ctx context.Context, req *ReactRequest, opts ...grpc.CallOption) (*ReactResponse, error) {
+	res := new(ReactResponse)
+	if err := c.invoke(ctx, "AddReaction", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) RemoveReaction(ctx context.Context, req *ReactRequest, opts ...grpc.CallOption) (*ReactResponse, error) {
+	res := new(ReactResponse)
+	if err := c.invoke(ctx, "RemoveReaction", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) GetReactions(ctx context.Context, req *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	res := new(GetResponse)
+	if err := c.invoke(ctx, "GetReactions", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,79 @@
+// Package restore provides the Restore gRPC service, through which authors
+// restore their deleted threads within the grace period of the section and its
+// admins restore any deleted thread, and its client. The section services
+// implement it.
+//
+// The protocol in cheroproto does not define a RestoreThread rpc yet, so the
+// service is described here by hand and its messages are encoded as JSON by
+// jsoncodec. Clients built by NewClient set the content subtype accordingly.
+
+package restore
+
+import (
+	"context"
+
+	"github.com/luisguve/cheroapi/internal/pkg/jsoncodec"
+	"google.golang.org/grpc"
+)
+
+// RestoreRequest holds a deleted thread of the section and the user id of its
+// author or of an admin.
+type RestoreRequest struct {
+	ThreadId string `json:"thread_id"`
+	UserId   string `json:"user_id"`
+}
+
+// RestoreResponse is the response to a RestoreRequest.
+type RestoreResponse struct{}
+
+// Server is the server API for the Restore service.
+type Server interface {
+	RestoreThread(context.Context, *RestoreRequest) (*RestoreResponse, error)
+}
+
+// serviceName is the full name of the service.
+const serviceName = "cheroapi.Restore"
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(serviceName, "RestoreThread", func() interface{} { return new(RestoreRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).RestoreThread(ctx, req.(*RestoreRequest))
+			}),
+	},
+	Metadata: "restore.go",
+}
+
+// Register registers srv as the Restore service of s.
+func Register(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client is the client API for the Restore service.
+type Client interface {
+	RestoreThread(ctx context.Context, req *RestoreRequest, opts ...grpc.CallOption) (*RestoreResponse, error)
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client of the Restore service on the given connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc}
+}
+
+func (c *client) invoke(ctx context.Context, method string, req, res interface{}, opts []grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	return c.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, res, opts...)
+}
+
+func (c *client) RestoreThread(ctx context.Context, req *RestoreRequest, opts ...grpc.CallOption) (*RestoreResponse, error) {
+	res := new(RestoreResponse)
+	if err := c.invoke(ctx, "RestoreThread", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,175 @@
+// Package search provides the Search gRPC service, which streams the contents
+// matching a text query, and its client. Both the section services and the
+// general service implement it.
+//
+// The protocol in cheroproto does not define the service yet, so it's described
+// here by hand and its messages are encoded as JSON by jsoncodec, with the
+// contents in protojson. Clients built by NewClient set the content subtype
+// accordingly.
+
+package search
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/luisguve/cheroapi/internal/pkg/jsoncodec"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Default and maximum number of contents in a page of results.
+const (
+	DefaultLimit = 10
+	MaxLimit     = 50
+)
+
+// Request is a text query and the page of results to return. Cursor is empty
+// for the first page and the NextCursor of the previous page otherwise. If
+// ThreadsOnly is true, comments and subcomments are left out.
+type Request struct {
+	Query       string `json:"query"`
+	Cursor      string `json:"cursor,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+	ThreadsOnly bool   `json:"threads_only,omitempty"`
+}
+
+// Response is a message of the stream of results. A stream holds a Hit for each
+// content in the page, from the most relevant, and then an End.
+type Response struct {
+	Hit *Hit `json:"hit,omitempty"`
+	End *End `json:"end,omitempty"`
+}
+
+// Hit is a content matching a query, its score and the section it belongs to.
+type Hit struct {
+	SectionId string          `json:"section_id"`
+	Score     float64         `json:"score"`
+	Content   json.RawMessage `json:"content"` // ContentRule as protojson.
+}
+
+// End closes a page of results. NextCursor is empty if there are no more
+// results. Errors holds the error returned by each section that could not be
+// searched, by section id; the page holds the results of the rest of them and
+// NextCursor is set, so they're searched again on the next page.
+type End struct {
+	Total      int               `json:"total"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	Errors     map[string]string `json:"errors,omitempty"`
+}
+
+// NewHit returns a Hit holding the given content.
+func NewHit(sectionId string, score float64, rule *pbApi.ContentRule) (*Hit, error) {
+	content, err := protojson.Marshal(proto.MessageV2(rule))
+	if err != nil {
+		return nil, err
+	}
+	return &Hit{
+		SectionId: sectionId,
+		Score:     score,
+		Content:   content,
+	}, nil
+}
+
+// Rule returns the content held by h.
+func (h *Hit) Rule() (*pbApi.ContentRule, error) {
+	rule := new(pbApi.ContentRule)
+	if err := protojson.Unmarshal(h.Content, proto.MessageV2(rule)); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// Server is the server API for the Search service.
+type Server interface {
+	Search(*Request, Stream) error
+}
+
+// Stream is the server side of a stream of results.
+type Stream interface {
+	Send(*Response) error
+	Context() context.Context
+}
+
+type serverStream struct {
+	grpc.ServerStream
+}
+
+func (s *serverStream) Send(r *Response) error {
+	return s.ServerStream.SendMsg(r)
+}
+
+func searchHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := new(Request)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(Server).Search(req, &serverStream{stream})
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "cheroapi.Search",
+	HandlerType: (*Server)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Search",
+			Handler:       searchHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "search.go",
+}
+
+// Register registers srv as the Search service of s.
+func Register(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client is the client API for the Search service.
+type Client interface {
+	Search(ctx context.Context, req *Request, opts ...grpc.CallOption) (ClientStream, error)
+}
+
+// ClientStream is the client side of a stream of results. Recv returns io.EOF
+// after the last message.
+type ClientStream interface {
+	Recv() (*Response, error)
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client of the Search service on the given connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc}
+}
+
+func (c *client) Search(ctx context.Context, req *Request, opts ...grpc.CallOption) (ClientStream, error) {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[0], "/cheroapi.Search/Search", opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	if err = stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &clientStream{stream}, nil
+}
+
+type clientStream struct {
+	grpc.ClientStream
+}
+
+func (s *clientStream) Recv() (*Response, error) {
+	r := new(Response)
+	if err := s.ClientStream.RecvMsg(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,91 @@
+package contents
+
+import (
+	"context"
+	"errors"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/admin"
+	"github.com/luisguve/cheroapi/internal/pkg/snapshots"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkAdmin returns a codes.PermissionDenied error if the given user is not
+// an admin of the server.
+func (s *Server) checkAdmin(userId string) error {
+	if !s.admins[userId] {
+		return status.Error(codes.PermissionDenied, dbmodel.ErrUserNotAllowed.Error())
+	}
+	return nil
+}
+
+// RunQA runs the Quality Assurance on the section database right away, or only
+// reports what it would archive if the request is a dry run. Only admins can
+// run it. If a clean up is already running, it returns a codes.Aborted error.
+func (s *Server) RunQA(ctx context.Context, req *admin.QARequest) (*admin.QAResponse, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkAdmin(req.UserId); err != nil {
+		return nil, err
+	}
+	var (
+		summary string
+		err     error
+	)
+	if req.DryRun {
+		summary, err = s.dbHandler.DryRunQA()
+	} else {
+		summary, err = s.dbHandler.QA()
+	}
+	if err != nil {
+		if errors.Is(err, dbmodel.ErrQARunning) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &admin.QAResponse{Summary: summary}, nil
+}
+
+// GetQAHistory returns the summaries of the last runs of the Quality
+// Assurance, up to admin.MaxSummaries, from the newest. Only admins can get
+// them.
+func (s *Server) GetQAHistory(ctx context.Context, req *admin.HistoryRequest) (*admin.QAHistory, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkAdmin(req.UserId); err != nil {
+		return nil, err
+	}
+	n := req.Max
+	if (n <= 0) || (n > admin.MaxSummaries) {
+		n = admin.MaxSummaries
+	}
+	summaries, err := s.QAHistory(n)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := &admin.QAHistory{
+		Summaries: make([]admin.QASummary, len(summaries)),
+	}
+	for i, qa := range summaries {
+		res.Summaries[i] = admin.QASummary(*qa)
+	}
+	return res, nil
+}
+
+// Snapshot streams a consistent copy of the section database, while serving
+// requests. Only admins can take it.
+func (s *Server) Snapshot(req *snapshots.Request, stream snapshots.Stream) error {
+	if s.dbHandler == nil {
+		return status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkAdmin(req.UserId); err != nil {
+		return err
+	}
+	if _, err := snapshots.Send(stream, s.dbHandler.Snapshot); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
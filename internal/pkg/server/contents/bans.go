@@ -0,0 +1,91 @@
+package contents
+
+import (
+	"context"
+	"log"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
+	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkBan returns a codes.PermissionDenied error telling why and until when
+// the given user is banned if the user is banned from the section or from every
+// section. Bans are not checked if the server has no client of the Bans
+// service.
+func (s *Server) checkBan(ctx context.Context, userId string) error {
+	if s.bansClient == nil {
+		return nil
+	}
+	req := &bans.CheckRequest{
+		UserId:    userId,
+		SectionId: s.sectionId,
+	}
+	res, err := s.bansClient.CheckBan(ctx, req)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Could not check bans: %v", err)
+	}
+	if res.Ban != nil {
+		return bans.Error(*res.Ban)
+	}
+	return nil
+}
+
+// shadowbanned returns the ids of the shadowbanned users, or nil if the server
+// has no client of the Bans service. If they could not be gotten, the error is
+// logged and the last known ones are returned, so feeds are still sent.
+func (s *Server) shadowbanned(ctx context.Context) map[string]bool {
+	if s.shadowbans == nil {
+		return nil
+	}
+	ids, err := s.shadowbans.Shadowbanned(ctx)
+	if err != nil {
+		log.Printf("Could not get shadowbanned users: %v\n", err)
+	}
+	return ids
+}
+
+// hiddenAuthors returns the HiddenFunc that leaves out the contents of the
+// shadowbanned users from the feeds of the viewer sent in the metadata of ctx,
+// who still sees their own contents. It returns nil if no one is shadowbanned.
+func (s *Server) hiddenAuthors(ctx context.Context) dbmodel.HiddenFunc {
+	ids := s.shadowbanned(ctx)
+	if len(ids) == 0 {
+		return nil
+	}
+	viewer := bans.ViewerFromContext(ctx)
+	return func(authorId string) bool {
+		return (authorId != viewer) && ids[authorId]
+	}
+}
+
+// hideThreads returns a patillator.SetSDF that sets threads by calling setSDF
+// and returns nil for those whose author hidden returns true for, so they're
+// left out. It returns setSDF as is if hidden is nil.
+func hideThreads(setSDF patillator.SetSDF, hidden dbmodel.HiddenFunc) patillator.SetSDF {
+	if hidden == nil {
+		return setSDF
+	}
+	return func(c *pbDataFormat.Content) patillator.SegregateDiscarderFinder {
+		if hidden(c.AuthorId) {
+			return nil
+		}
+		return setSDF(c)
+	}
+}
+
+// dropShadowbannedNotifs returns nil if the given user, who triggered the
+// given notifications, is shadowbanned, so no one gets notified of the
+// interactions of shadowbanned users, or the notifications as they are
+// otherwise.
+func (s *Server) dropShadowbannedNotifs(ctx context.Context, userId string,
+	notifyUsers []*pbApi.NotifyUser) []*pbApi.NotifyUser {
+	if s.shadowbanned(ctx)[userId] {
+		return nil
+	}
+	return notifyUsers
+}
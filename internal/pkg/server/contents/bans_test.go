@@ -0,0 +1,158 @@
+package contents_test
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
+	"github.com/luisguve/cheroapi/internal/pkg/polls"
+	"github.com/luisguve/cheroapi/internal/pkg/reactions"
+	"github.com/luisguve/cheroapi/internal/pkg/server/contents"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbMetadata "github.com/luisguve/cheroproto-go/metadata"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Users banned from the section or from every section cannot write to it, vote
+// on its polls nor react to its contents.
+func TestBannedWrites(t *testing.T) {
+	b := fakeBans{
+		banned: map[string]bans.Ban{
+			"banned":    {UserId: "banned", SectionId: testSection, Reason: "Spam"},
+			"everyone":  {UserId: "everyone", Reason: "Spam"},
+			"elsewhere": {UserId: "elsewhere", SectionId: "other", Reason: "Spam"},
+		},
+	}
+	s, h, done := newServer(t, contents.Options{Bans: b})
+	defer done()
+
+	thread := newThread(t, h, "Open thread", "author")
+	poll := &pbApi.Content{
+		Title:       "Open poll",
+		Content:     "Vote, please",
+		PublishDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+	}
+	permalink, err := h.CreateThread(poll, "pollster", dbmodel.NewThread{
+		Poll: &dbmodel.Poll{Options: []string{"Yes", "No"}},
+	})
+	if err != nil {
+		t.Fatalf("Could not create thread with poll: %v\n", err)
+	}
+	for _, userId := range []string{"banned", "everyone", "elsewhere"} {
+		want := codes.PermissionDenied
+		if userId == "elsewhere" {
+			want = codes.OK
+		}
+		req := &pbApi.CreateThreadRequest{
+			Content: &pbApi.Content{
+				Title:       "Thread of " + userId,
+				Content:     "Some content",
+				PublishDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+			},
+			UserId: userId,
+		}
+		if _, err := s.CreateThread(context.Background(), req); status.Code(err) != want {
+			t.Errorf("Got %v creating a thread as %s, want code %v\n", err, userId, want)
+		}
+		comment := &pbApi.CommentRequest{
+			Content: "A comment",
+			UserId:  userId,
+			ContentContext: &pbApi.CommentRequest_ThreadCtx{
+				ThreadCtx: thread,
+			},
+		}
+		err := s.Comment(comment, &notifStream{ctx: context.Background()})
+		if status.Code(err) != want {
+			t.Errorf("Got %v commenting as %s, want code %v\n", err, userId, want)
+		}
+		vote := &polls.VoteRequest{
+			ThreadId: path.Base(permalink),
+			UserId:   userId,
+			Choices:  []int{0},
+		}
+		if _, err = s.Vote(context.Background(), vote); status.Code(err) != want {
+			t.Errorf("Got %v voting as %s, want code %v\n", err, userId, want)
+		}
+		vote.Choices = []int{1}
+		if _, err = s.ChangeVote(context.Background(), vote); status.Code(err) != want {
+			t.Errorf("Got %v changing the vote as %s, want code %v\n", err, userId, want)
+		}
+		react := &reactions.ReactRequest{
+			Content:  reactions.ContentId{ThreadId: thread.Id},
+			UserId:   userId,
+			Reaction: "like",
+		}
+		if _, err = s.AddReaction(context.Background(), react); status.Code(err) != want {
+			t.Errorf("Got %v reacting as %s, want code %v\n", err, userId, want)
+		}
+	}
+}
+
+// Threads of shadowbanned users are left out of the feeds of everyone but
+// themselves, and their comments notify no one.
+func TestShadowbannedAuthor(t *testing.T) {
+	s, h, done := newServer(t, contents.Options{Bans: fakeBans{shadowbanned: []string{"spammer"}}})
+	defer done()
+
+	spam := newThread(t, h, "Spam thread", "spammer")
+	thread := newThread(t, h, "Regular thread", "author")
+	recycle := func(viewer string) []string {
+		t.Helper()
+		req := &pbApi.ContentPattern{
+			Pattern: make([]pbMetadata.ContentStatus, 2),
+			ContentContext: &pbApi.ContentPattern_SectionCtx{
+				SectionCtx: &pbContext.Section{Id: testSection},
+			},
+		}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(bans.ViewerMD, viewer))
+		stream := newStream(ctx)
+		if err := s.RecycleContent(req, stream); err != nil {
+			t.Fatalf("Could not recycle content: %v\n", err)
+		}
+		var ids []string
+		for _, rule := range stream.rules {
+			ids = append(ids, ruleId(rule))
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	if got := recycle("someone"); !reflect.DeepEqual(got, []string{thread.Id}) {
+		t.Errorf("Got threads %v in the feed of another user, want [%s]\n", got, thread.Id)
+	}
+	want := []string{spam.Id, thread.Id}
+	sort.Strings(want)
+	if got := recycle("spammer"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got threads %v in the feed of the shadowbanned user, want %v\n", got, want)
+	}
+
+	// Their comments are saved, but notify no one.
+	for _, userId := range []string{"spammer", "replier"} {
+		comment := &pbApi.CommentRequest{
+			Content: "A comment",
+			UserId:  userId,
+			ContentContext: &pbApi.CommentRequest_ThreadCtx{
+				ThreadCtx: thread,
+			},
+		}
+		stream := &notifStream{ctx: context.Background()}
+		if err := s.Comment(comment, stream); err != nil {
+			t.Fatalf("Could not comment as %s: %v\n", userId, err)
+		}
+		want := 1
+		if userId == "spammer" {
+			want = 0
+		}
+		if len(stream.notifs) != want {
+			t.Errorf("Got %d notifications for a comment of %s, want %d\n", len(stream.notifs), userId, want)
+		}
+	}
+}
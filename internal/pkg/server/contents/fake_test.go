@@ -0,0 +1,219 @@
+package contents_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
+	db "github.com/luisguve/cheroapi/internal/pkg/bolt/contents"
+	"github.com/luisguve/cheroapi/internal/pkg/server/contents"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
+	pbMetadata "github.com/luisguve/cheroproto-go/metadata"
+	pbUsers "github.com/luisguve/cheroproto-go/userapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// testSection is the id of the section of the servers built by newServer.
+const testSection = "mylife"
+
+// fakeUsers is a users service that accepts every operation delivered to it by
+// the outbox of a section.
+type fakeUsers struct {
+	pbUsers.CrudUsersClient
+}
+
+func (fakeUsers) GetUserHeaderData(ctx context.Context, in *pbUsers.GetBasicUserDataRequest, opts ...grpc.CallOption) (*pbUsers.UserHeaderData, error) {
+	return &pbUsers.UserHeaderData{}, nil
+}
+
+func (fakeUsers) GetBasicUserData(ctx context.Context, in *pbUsers.GetBasicUserDataRequest, opts ...grpc.CallOption) (*pbDataFormat.BasicUserData, error) {
+	return &pbDataFormat.BasicUserData{Username: in.UserId}, nil
+}
+
+func (fakeUsers) CreateThread(ctx context.Context, in *pbUsers.CreateThreadRequest, opts ...grpc.CallOption) (*pbUsers.CreateThreadResponse, error) {
+	return &pbUsers.CreateThreadResponse{}, nil
+}
+
+func (fakeUsers) Comment(ctx context.Context, in *pbUsers.CommentRequest, opts ...grpc.CallOption) (*pbUsers.CommentResponse, error) {
+	return &pbUsers.CommentResponse{}, nil
+}
+
+func (fakeUsers) Subcomment(ctx context.Context, in *pbUsers.SubcommentRequest, opts ...grpc.CallOption) (*pbUsers.SubcommentResponse, error) {
+	return &pbUsers.SubcommentResponse{}, nil
+}
+
+func (fakeUsers) SaveThread(ctx context.Context, in *pbUsers.SaveThreadRequest, opts ...grpc.CallOption) (*pbUsers.SaveThreadResponse, error) {
+	return &pbUsers.SaveThreadResponse{}, nil
+}
+
+func (fakeUsers) RemoveSaved(ctx context.Context, in *pbUsers.RemoveSavedRequest, opts ...grpc.CallOption) (*pbUsers.RemoveSavedResponse, error) {
+	return &pbUsers.RemoveSavedResponse{}, nil
+}
+
+func (fakeUsers) DeleteThread(ctx context.Context, in *pbUsers.DeleteThreadRequest, opts ...grpc.CallOption) (*pbUsers.DeleteThreadResponse, error) {
+	return &pbUsers.DeleteThreadResponse{}, nil
+}
+
+func (fakeUsers) DeleteComment(ctx context.Context, in *pbUsers.DeleteCommentRequest, opts ...grpc.CallOption) (*pbUsers.DeleteCommentResponse, error) {
+	return &pbUsers.DeleteCommentResponse{}, nil
+}
+
+func (fakeUsers) DeleteSubcomment(ctx context.Context, in *pbUsers.DeleteSubcommentRequest, opts ...grpc.CallOption) (*pbUsers.DeleteSubcommentResponse, error) {
+	return &pbUsers.DeleteSubcommentResponse{}, nil
+}
+
+func (fakeUsers) OldThread(ctx context.Context, in *pbUsers.OldThreadRequest, opts ...grpc.CallOption) (*pbUsers.OldThreadResponse, error) {
+	return &pbUsers.OldThreadResponse{}, nil
+}
+
+func (fakeUsers) OldComment(ctx context.Context, in *pbUsers.OldCommentRequest, opts ...grpc.CallOption) (*pbUsers.OldCommentResponse, error) {
+	return &pbUsers.OldCommentResponse{}, nil
+}
+
+func (fakeUsers) OldSubcomment(ctx context.Context, in *pbUsers.OldSubcommentRequest, opts ...grpc.CallOption) (*pbUsers.OldSubcommentResponse, error) {
+	return &pbUsers.OldSubcommentResponse{}, nil
+}
+
+func (fakeUsers) SaveNotif(ctx context.Context, in *pbApi.NotifyUser, opts ...grpc.CallOption) (*pbUsers.SaveNotifResponse, error) {
+	return &pbUsers.SaveNotifResponse{}, nil
+}
+
+// fakeBans is a Bans service with the given bans and shadowbanned users. It
+// only answers the rpcs that section services call.
+type fakeBans struct {
+	bans.Client
+	banned       map[string]bans.Ban
+	shadowbanned []string
+}
+
+func (f fakeBans) CheckBan(ctx context.Context, in *bans.CheckRequest, opts ...grpc.CallOption) (*bans.CheckResponse, error) {
+	res := new(bans.CheckResponse)
+	if b, ok := f.banned[in.UserId]; ok && ((b.SectionId == "") || (b.SectionId == in.SectionId)) {
+		res.Ban = &b
+	}
+	return res, nil
+}
+
+func (f fakeBans) ListShadowbans(ctx context.Context, in *bans.ListShadowbansRequest, opts ...grpc.CallOption) (*bans.Shadowbans, error) {
+	res := new(bans.Shadowbans)
+	for _, userId := range f.shadowbanned {
+		res.Shadowbans = append(res.Shadowbans, bans.Shadowban{UserId: userId})
+	}
+	return res, nil
+}
+
+// newServer opens a section database in a temporary directory with a fake
+// users service and returns a Server on it with the given options, along with
+// its handler. The returned function closes the handler and removes the
+// directory.
+func newServer(t *testing.T, opts contents.Options) (*contents.Server, dbmodel.Handler, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "contents")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v\n", err)
+	}
+	h, err := db.New(dir, testSection, "My life", fakeUsers{}, dbmodel.QAThresholds{})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Could not open section: %v\n", err)
+	}
+	opts.SectionId = testSection
+	return contents.New(h, opts), h, func() {
+		h.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// newThread creates a thread with the given title by the given author and
+// returns its context.
+func newThread(t *testing.T, h dbmodel.Handler, title, author string) *pbContext.Thread {
+	t.Helper()
+	content := &pbApi.Content{
+		Title:       title,
+		Content:     "Content of " + title,
+		PublishDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+	}
+	permalink, err := h.CreateThread(content, author, dbmodel.NewThread{})
+	if err != nil {
+		t.Fatalf("Could not create thread %q: %v\n", title, err)
+	}
+	return &pbContext.Thread{
+		Id:         path.Base(permalink),
+		SectionCtx: &pbContext.Section{Id: testSection},
+	}
+}
+
+// fakeStream is the server side of a stream of content rules that records the
+// rules and the header sent through it.
+type fakeStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	header metadata.MD
+	rules  []*pbApi.ContentRule
+}
+
+func newStream(ctx context.Context) *fakeStream {
+	return &fakeStream{ctx: ctx}
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *fakeStream) Send(rule *pbApi.ContentRule) error {
+	s.rules = append(s.rules, rule)
+	return nil
+}
+
+// notifStream is the server side of a stream of notifications that records
+// the notifications sent through it.
+type notifStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	notifs []*pbApi.NotifyUser
+}
+
+func (s *notifStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *notifStream) Send(notif *pbApi.NotifyUser) error {
+	s.notifs = append(s.notifs, notif)
+	return nil
+}
+
+// overviewStream is the server side of a stream of thread metadata that
+// records the metadata and the trailer sent through it.
+type overviewStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	trailer  metadata.MD
+	overview []*pbMetadata.GeneralContent
+}
+
+func (s *overviewStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *overviewStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func (s *overviewStream) Send(gc *pbMetadata.GeneralContent) error {
+	s.overview = append(s.overview, gc)
+	return nil
+}
@@ -0,0 +1,71 @@
+package contents
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// idempotencyKeyMD is the metadata key under which clients may send an
+// idempotency key on write rpcs.
+const idempotencyKeyMD = "idempotency-key"
+
+// maxIdempotencyKeyLen is the maximum length of an idempotency key.
+const maxIdempotencyKeyLen = 128
+
+// claimKey claims the idempotency key sent in the metadata of ctx, if any, for
+// the given rpc and user. Keys are scoped to the rpc and the user, so clients
+// only need them to be unique among their own requests.
+//
+// It returns the scoped key, which is empty if the client did not send one,
+// and the result saved by a previous request with the same key, if any.
+func (s *Server) claimKey(ctx context.Context, rpc, userId string) (string, *dbmodel.IdempotentResult, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", nil, nil
+	}
+	values := md.Get(idempotencyKeyMD)
+	if (len(values) == 0) || (values[0] == "") {
+		return "", nil, nil
+	}
+	if len(values[0]) > maxIdempotencyKeyLen {
+		return "", nil, status.Error(codes.InvalidArgument, "Idempotency key too long")
+	}
+	key := rpc + "/" + userId + "/" + values[0]
+	res, err := s.dbHandler.ClaimIdempotencyKey(key, s.idempotencyTTL, s.idempotencyPending)
+	if err != nil {
+		if errors.Is(err, dbmodel.ErrRequestInProgress) {
+			return "", nil, status.Error(codes.Aborted, err.Error())
+		}
+		return "", nil, status.Error(codes.Internal, err.Error())
+	}
+	return key, res, nil
+}
+
+// settleKey saves the result of the write operation under the given key or, if
+// the operation failed, releases the key so the client can retry. Errors are
+// only logged, since the write operation already finished.
+//
+// The result is saved in a transaction of its own, after the one of the write
+// operation. If the service stops in between, the key is left claimed without
+// a result: retries fail with ABORTED until the pending hold expires, and then
+// they write again.
+func (s *Server) settleKey(key string, res *dbmodel.IdempotentResult, failed bool) {
+	if key == "" {
+		return
+	}
+	var err error
+	if failed {
+		err = s.dbHandler.ReleaseIdempotencyKey(key)
+	} else {
+		err = s.dbHandler.SaveIdempotentResult(key, res)
+	}
+	if err != nil {
+		log.Printf("Could not settle idempotency key %s: %v\n", key, err)
+	}
+}
@@ -11,7 +11,27 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-// Post upvote on thread, comment or subcomment
+// notifSender is a server stream of notifications.
+type notifSender interface {
+	Send(*pbApi.NotifyUser) error
+}
+
+// sendNotifs sends the given notifications through stream.
+func sendNotifs(stream notifSender, notifyUsers []*pbApi.NotifyUser) error {
+	for _, notifyUser := range notifyUsers {
+		if err := stream.Send(notifyUser); err != nil {
+			log.Printf("Could not send NotifyUser: %v\n", err)
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+	return nil
+}
+
+// Post upvote on thread, comment or subcomment. If the client sends an
+// idempotency key, a replay of the request sends the notifications of the first
+// one again. Users banned from the section are rejected with a
+// codes.PermissionDenied error and no notifications are sent for shadowbanned
+// users.
 func (s *Server) Upvote(req *pbApi.UpvoteRequest, stream pbApi.CrudCheropatilla_UpvoteServer) error {
 	if s.dbHandler == nil {
 		return status.Error(codes.Internal, "No database connection")
@@ -19,14 +39,23 @@ func (s *Server) Upvote(req *pbApi.UpvoteRequest, stream pbApi.CrudCheropatilla_
 	var (
 		submitter   = req.UserId
 		notifyUsers []*pbApi.NotifyUser
-		err         error
-		sendErr     error
 	)
+	if err := s.checkBan(stream.Context(), submitter); err != nil {
+		return err
+	}
+	key, res, err := s.claimKey(stream.Context(), "Upvote", submitter)
+	if err != nil {
+		return err
+	}
+	if res != nil {
+		return sendNotifs(stream, res.Notifs)
+	}
 	// call a different upvote method, depending upon the context where the
 	// upvote is being submitted.
 	switch ctx := req.ContentContext.(type) {
 	case *pbApi.UpvoteRequest_ThreadCtx: // THREAD
-		notifyUser, err := s.dbHandler.UpvoteThread(submitter, ctx.ThreadCtx)
+		var notifyUser *pbApi.NotifyUser
+		notifyUser, err = s.dbHandler.UpvoteThread(submitter, ctx.ThreadCtx)
 		if (err == nil) && (notifyUser != nil) {
 			notifyUsers = append(notifyUsers, notifyUser)
 		}
@@ -35,6 +64,8 @@ func (s *Server) Upvote(req *pbApi.UpvoteRequest, stream pbApi.CrudCheropatilla_
 	case *pbApi.UpvoteRequest_SubcommentCtx: // SUBCOMMENT
 		notifyUsers, err = s.dbHandler.UpvoteSubcomment(submitter, ctx.SubcommentCtx)
 	}
+	notifyUsers = s.dropShadowbannedNotifs(stream.Context(), submitter, notifyUsers)
+	s.settleKey(key, &dbmodel.IdempotentResult{Notifs: notifyUsers}, err != nil)
 	if err != nil {
 		if (errors.Is(err, dbmodel.ErrSectionNotFound)) ||
 			(errors.Is(err, dbmodel.ErrThreadNotFound)) ||
@@ -42,15 +73,12 @@ func (s *Server) Upvote(req *pbApi.UpvoteRequest, stream pbApi.CrudCheropatilla_
 			(errors.Is(err, dbmodel.ErrSubcommentNotFound)) {
 			return status.Error(codes.NotFound, err.Error())
 		}
-		return status.Error(codes.Internal, err.Error())
-	}
-	for _, notifyUser := range notifyUsers {
-		if sendErr = stream.Send(notifyUser); sendErr != nil {
-			log.Printf("Could not send NotifyUser: %v\n", sendErr)
-			return status.Error(codes.Internal, sendErr.Error())
+		if errors.Is(err, dbmodel.ErrOppositeVote) {
+			return status.Error(codes.FailedPrecondition, err.Error())
 		}
+		return status.Error(codes.Internal, err.Error())
 	}
-	return nil
+	return sendNotifs(stream, notifyUsers)
 }
 
 // Undo an upvote on a thread, comment or subcomment
@@ -87,16 +115,29 @@ func (s *Server) UndoUpvote(ctx context.Context, req *pbApi.UndoUpvoteRequest) (
 	return &pbApi.UndoUpvoteResponse{}, nil
 }
 
-// Post comment on a thread or in a comment
+// Post comment on a thread or in a comment. If the client sends an idempotency
+// key, a replay of the request sends the notifications of the first one again.
+// Comments on locked threads are rejected with a codes.FailedPrecondition
+// error and comments of users banned from the section with a
+// codes.PermissionDenied error. No notifications are sent for comments of
+// shadowbanned users.
 func (s *Server) Comment(req *pbApi.CommentRequest, stream pbApi.CrudCheropatilla_CommentServer) error {
 	if s.dbHandler == nil {
 		return status.Error(codes.Internal, "No database connection")
 	}
 	var (
 		notifyUsers []*pbApi.NotifyUser
-		err         error
-		sendErr     error
 	)
+	if err := s.checkBan(stream.Context(), req.UserId); err != nil {
+		return err
+	}
+	key, res, err := s.claimKey(stream.Context(), "Comment", req.UserId)
+	if err != nil {
+		return err
+	}
+	if res != nil {
+		return sendNotifs(stream, res.Notifs)
+	}
 	reply := dbmodel.Reply{
 		Content:     req.Content,
 		FtFile:      req.FtFile,
@@ -107,14 +148,20 @@ func (s *Server) Comment(req *pbApi.CommentRequest, stream pbApi.CrudCheropatill
 	// comment is being submitted.
 	switch ctx := req.ContentContext.(type) {
 	case *pbApi.CommentRequest_ThreadCtx: // THREAD
-		notifyUser, err := s.dbHandler.ReplyThread(ctx.ThreadCtx, reply)
+		var notifyUser *pbApi.NotifyUser
+		notifyUser, err = s.dbHandler.ReplyThread(ctx.ThreadCtx, reply)
 		if (err == nil) && (notifyUser != nil) {
 			notifyUsers = append(notifyUsers, notifyUser)
 		}
 	case *pbApi.CommentRequest_CommentCtx: // COMMENT
 		notifyUsers, err = s.dbHandler.ReplyComment(ctx.CommentCtx, reply)
 	}
+	notifyUsers = s.dropShadowbannedNotifs(stream.Context(), req.UserId, notifyUsers)
+	s.settleKey(key, &dbmodel.IdempotentResult{Notifs: notifyUsers}, err != nil)
 	if err != nil {
+		if errors.Is(err, dbmodel.ErrThreadLocked) {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
 		if (errors.Is(err, dbmodel.ErrSectionNotFound)) ||
 			(errors.Is(err, dbmodel.ErrThreadNotFound)) ||
 			(errors.Is(err, dbmodel.ErrCommentNotFound)) ||
@@ -123,11 +170,5 @@ func (s *Server) Comment(req *pbApi.CommentRequest, stream pbApi.CrudCheropatill
 		}
 		return status.Error(codes.Internal, err.Error())
 	}
-	for _, notifyUser := range notifyUsers {
-		if sendErr = stream.Send(notifyUser); sendErr != nil {
-			log.Printf("Could not send NotifyUser: %v\n", sendErr)
-			return status.Error(codes.Internal, sendErr.Error())
-		}
-	}
-	return nil
+	return sendNotifs(stream, notifyUsers)
 }
@@ -0,0 +1,56 @@
+package contents_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luisguve/cheroapi/internal/pkg/moderation"
+	"github.com/luisguve/cheroapi/internal/pkg/server/contents"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCommentLocked(t *testing.T) {
+	s, h, done := newServer(t, contents.Options{Admins: []string{"admin"}})
+	defer done()
+
+	thread := newThread(t, h, "Locked thread", "author")
+	comment := func() error {
+		req := &pbApi.CommentRequest{
+			Content: "A comment",
+			UserId:  "replier",
+			ContentContext: &pbApi.CommentRequest_ThreadCtx{
+				ThreadCtx: thread,
+			},
+		}
+		return s.Comment(req, &notifStream{ctx: context.Background()})
+	}
+	req := &moderation.LockRequest{
+		ThreadId: thread.Id,
+		UserId:   "admin",
+		Reason:   "Off topic",
+	}
+	state, err := s.LockThread(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Could not lock thread: %v\n", err)
+	}
+	if !state.Locked || (len(state.Notifs) != 1) {
+		t.Errorf("Got lock state %+v, want locked with a notification for the author\n", state)
+	}
+	if err = comment(); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Got %v commenting on a locked thread, want code %v\n", err, codes.FailedPrecondition)
+	}
+	// Only the author and moderators can unlock it.
+	req.UserId = "someone"
+	if _, err = s.UnlockThread(context.Background(), req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Got %v unlocking as another user, want code %v\n", err, codes.PermissionDenied)
+	}
+	req.UserId = "author"
+	if _, err = s.UnlockThread(context.Background(), req); err != nil {
+		t.Fatalf("Could not unlock thread: %v\n", err)
+	}
+	if err = comment(); err != nil {
+		t.Errorf("Could not comment on an unlocked thread: %v\n", err)
+	}
+}
@@ -0,0 +1,458 @@
+package contents
+
+import (
+	"context"
+	"errors"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/moderation"
+	"github.com/luisguve/cheroapi/internal/pkg/reactions"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// role returns the role of the given user in the section, which is empty if
+// the user has none. The admins of the server are owners.
+func (s *Server) role(userId string) (string, error) {
+	if userId == "" {
+		return "", nil
+	}
+	if s.admins[userId] {
+		return dbmodel.RoleOwner, nil
+	}
+	role, err := s.dbHandler.GetRole(userId)
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	return role, nil
+}
+
+// isModerator returns whether the given user can moderate the section, that
+// is, whether the user is either a moderator or an owner.
+func (s *Server) isModerator(userId string) (bool, error) {
+	role, err := s.role(userId)
+	return role != "", err
+}
+
+// checkRole returns a codes.PermissionDenied error if the given user cannot
+// moderate the section or, if owner is true, is not an owner.
+func (s *Server) checkRole(userId string, owner bool) error {
+	role, err := s.role(userId)
+	if err != nil {
+		return err
+	}
+	if (role == "") || (owner && (role != dbmodel.RoleOwner)) {
+		return status.Error(codes.PermissionDenied, dbmodel.ErrUserNotAllowed.Error())
+	}
+	return nil
+}
+
+// moderationError converts the given error returned by a moderation operation
+// into a gRPC status error.
+func moderationError(err error) error {
+	switch {
+	case errors.Is(err, dbmodel.ErrThreadNotFound),
+		errors.Is(err, dbmodel.ErrCommentNotFound),
+		errors.Is(err, dbmodel.ErrSubcommentNotFound),
+		errors.Is(err, dbmodel.ErrNoRole),
+		errors.Is(err, dbmodel.ErrReportNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, dbmodel.ErrUserNotAllowed):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, dbmodel.ErrInvalidRole),
+		errors.Is(err, dbmodel.ErrInvalidOutcome):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, dbmodel.ErrAlreadyPinned),
+		errors.Is(err, dbmodel.ErrNotPinned),
+		errors.Is(err, dbmodel.ErrTooManyPinned),
+		errors.Is(err, dbmodel.ErrAlreadyLocked),
+		errors.Is(err, dbmodel.ErrNotLocked),
+		errors.Is(err, dbmodel.ErrContentRemoved),
+		errors.Is(err, dbmodel.ErrAlreadyReported):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// moderatedThread returns the context of the thread in the given request or
+// an error if the user in the request cannot moderate the section.
+func (s *Server) moderatedThread(req *moderation.ThreadRequest) (*pbContext.Thread, error) {
+	if err := s.checkRole(req.UserId, false); err != nil {
+		return nil, err
+	}
+	if req.ThreadId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+	}
+	return s.sectionThread(req.ThreadId), nil
+}
+
+// pinnedThreads returns the pinned threads of the section.
+func (s *Server) pinnedThreads() (*moderation.PinnedThreads, error) {
+	ids, err := s.dbHandler.GetPinnedThreads()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &moderation.PinnedThreads{ThreadIds: ids}, nil
+}
+
+// PinThread pins an active thread to the top of the feeds of the section and
+// returns the pinned threads. Only moderators can pin threads.
+func (s *Server) PinThread(ctx context.Context, req *moderation.ThreadRequest) (*moderation.PinnedThreads, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	thread, err := s.moderatedThread(req)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.dbHandler.PinThread(thread, s.maxPinned); err != nil {
+		return nil, moderationError(err)
+	}
+	return s.pinnedThreads()
+}
+
+// UnpinThread unpins a thread and returns the pinned threads. Only moderators
+// can unpin threads.
+func (s *Server) UnpinThread(ctx context.Context, req *moderation.ThreadRequest) (*moderation.PinnedThreads, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	thread, err := s.moderatedThread(req)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.dbHandler.UnpinThread(thread); err != nil {
+		return nil, moderationError(err)
+	}
+	return s.pinnedThreads()
+}
+
+// ListPinned returns the pinned threads of the section, from the most recently
+// pinned.
+func (s *Server) ListPinned(ctx context.Context, req *moderation.ListPinnedRequest) (*moderation.PinnedThreads, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	return s.pinnedThreads()
+}
+
+// setLock locks or unlocks the thread in the given request, depending upon
+// lock, and returns its lock state along with the notification for its author,
+// if any. Authors can lock and unlock their own threads.
+func (s *Server) setLock(req *moderation.LockRequest, lock bool) (*moderation.LockState, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A user id is required")
+	}
+	if req.ThreadId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+	}
+	moderator, err := s.isModerator(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		thread     = s.sectionThread(req.ThreadId)
+		notifyUser *pbApi.NotifyUser
+	)
+	l := dbmodel.Lock{
+		Submitter: req.UserId,
+		Moderator: moderator,
+		Reason:    req.Reason,
+	}
+	if lock {
+		notifyUser, err = s.dbHandler.LockThread(thread, l)
+	} else {
+		notifyUser, err = s.dbHandler.UnlockThread(thread, l)
+	}
+	if err != nil {
+		return nil, moderationError(err)
+	}
+	res := &moderation.LockState{
+		ThreadId: req.ThreadId,
+		Locked:   lock,
+	}
+	if notifyUser != nil {
+		res.Notifs, err = reactions.NewNotifs([]*pbApi.NotifyUser{notifyUser})
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	return res, nil
+}
+
+// LockThread locks a thread, so it no longer accepts comments, and returns its
+// lock state along with the notification for its author, if any. Moderators
+// and the author of the thread can lock it.
+func (s *Server) LockThread(ctx context.Context, req *moderation.LockRequest) (*moderation.LockState, error) {
+	return s.setLock(req, true)
+}
+
+// UnlockThread unlocks a thread and returns its lock state along with the
+// notification for its author, if any. Moderators and the author of the thread
+// can unlock it.
+func (s *Server) UnlockThread(ctx context.Context, req *moderation.LockRequest) (*moderation.LockState, error) {
+	return s.setLock(req, false)
+}
+
+// GetLock returns whether a thread is locked.
+func (s *Server) GetLock(ctx context.Context, req *moderation.ThreadRequest) (*moderation.LockState, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if req.ThreadId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+	}
+	locked, err := s.dbHandler.IsLocked(s.sectionThread(req.ThreadId))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &moderation.LockState{
+		ThreadId: req.ThreadId,
+		Locked:   locked,
+	}, nil
+}
+
+// ListLog returns the last actions of the moderation log, up to
+// moderation.MaxLogActions, from the newest. Only moderators can list them.
+func (s *Server) ListLog(ctx context.Context, req *moderation.LogRequest) (*moderation.Log, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkRole(req.UserId, false); err != nil {
+		return nil, err
+	}
+	n := req.Max
+	if (n <= 0) || (n > moderation.MaxLogActions) {
+		n = moderation.MaxLogActions
+	}
+	actions, err := s.dbHandler.ModerationLog(n)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := &moderation.Log{
+		Actions: make([]moderation.Action, len(actions)),
+	}
+	for i, a := range actions {
+		res.Actions[i] = moderation.Action(*a)
+	}
+	return res, nil
+}
+
+// RemoveContent replaces the text of a thread, comment or subcomment with
+// dbmodel.RemovedText, so it shows as removed by a moderator instead of
+// disappearing, and records the reason in the moderation log. Only moderators
+// can remove contents.
+func (s *Server) RemoveContent(ctx context.Context, req *moderation.RemoveRequest) (*moderation.RemoveResponse, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkRole(req.UserId, false); err != nil {
+		return nil, err
+	}
+	if req.Reason == "" {
+		return nil, status.Error(codes.InvalidArgument, "A reason is required")
+	}
+	content := s.contentContext(req.Content)
+	if content == nil {
+		return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+	}
+	r := dbmodel.Removal{
+		Submitter: req.UserId,
+		Reason:    req.Reason,
+	}
+	if err := s.dbHandler.RemoveContent(content, r); err != nil {
+		return nil, moderationError(err)
+	}
+	return &moderation.RemoveResponse{}, nil
+}
+
+// roles returns the users with a role in the section.
+func (s *Server) roles() (*moderation.Roles, error) {
+	list, err := s.dbHandler.ListRoles()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := &moderation.Roles{
+		Roles: make([]moderation.Role, len(list)),
+	}
+	for i, r := range list {
+		res.Roles[i] = moderation.Role(*r)
+	}
+	return res, nil
+}
+
+// checkRoleRequest returns an error if the user in the given request is not an
+// owner or the request has no target user.
+func (s *Server) checkRoleRequest(req *moderation.RoleRequest) error {
+	if err := s.checkRole(req.UserId, true); err != nil {
+		return err
+	}
+	if req.TargetId == "" {
+		return status.Error(codes.InvalidArgument, "A target user id is required")
+	}
+	return nil
+}
+
+// SetRole grants a role to a user, either moderator or owner, and returns the
+// roles of the section. Only owners can grant roles.
+func (s *Server) SetRole(ctx context.Context, req *moderation.RoleRequest) (*moderation.Roles, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkRoleRequest(req); err != nil {
+		return nil, err
+	}
+	if err := s.dbHandler.SetRole(req.TargetId, req.Role, req.UserId); err != nil {
+		return nil, moderationError(err)
+	}
+	return s.roles()
+}
+
+// RemoveRole revokes the role of a user and returns the roles of the section.
+// Only owners can revoke roles; the admins of the server keep being owners.
+func (s *Server) RemoveRole(ctx context.Context, req *moderation.RoleRequest) (*moderation.Roles, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkRoleRequest(req); err != nil {
+		return nil, err
+	}
+	if err := s.dbHandler.RemoveRole(req.TargetId, req.UserId); err != nil {
+		return nil, moderationError(err)
+	}
+	return s.roles()
+}
+
+// ListRoles returns the roles of the section. Only moderators can list them.
+func (s *Server) ListRoles(ctx context.Context, req *moderation.ListRolesRequest) (*moderation.Roles, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkRole(req.UserId, false); err != nil {
+		return nil, err
+	}
+	return s.roles()
+}
+
+// reportItem converts the given item of the moderation queue into its
+// moderation counterpart.
+func reportItem(item *dbmodel.ReportItem) moderation.ReportItem {
+	res := moderation.ReportItem{
+		Id:           item.Id,
+		ThreadId:     item.ThreadId,
+		CommentId:    item.CommentId,
+		SubcommentId: item.SubcommentId,
+		Reports:      make([]moderation.Report, len(item.Reports)),
+		Outcome:      item.Outcome,
+		ResolvedBy:   item.ResolvedBy,
+		ResolvedAt:   item.ResolvedAt,
+		Note:         item.Note,
+	}
+	for i, r := range item.Reports {
+		res.Reports[i] = moderation.Report(r)
+	}
+	return res
+}
+
+// Report adds a report of a user on a thread, comment or subcomment to the
+// moderation queue of the section and returns the id of its item. The reason
+// must be one of moderation.ReportReasons. Users can report each content only
+// once.
+func (s *Server) Report(ctx context.Context, req *moderation.ReportRequest) (*moderation.ReportResponse, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A user id is required")
+	}
+	if !moderation.ValidReason(req.Reason) {
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown reason %q", req.Reason)
+	}
+	if len(req.Text) > moderation.MaxReportText {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"The text can have at most %d bytes", moderation.MaxReportText)
+	}
+	content := s.contentContext(req.Content)
+	if content == nil {
+		return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+	}
+	r := dbmodel.Report{
+		UserId: req.UserId,
+		Reason: req.Reason,
+		Text:   req.Text,
+	}
+	id, err := s.dbHandler.ReportContent(content, r)
+	if err != nil {
+		return nil, moderationError(err)
+	}
+	return &moderation.ReportResponse{ReportId: id}, nil
+}
+
+// ListQueue returns the items of the moderation queue of the section whose ids
+// are greater than the one in the request, up to moderation.MaxQueueItems,
+// from the oldest. Only moderators can list them.
+func (s *Server) ListQueue(ctx context.Context, req *moderation.QueueRequest) (*moderation.Queue, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkRole(req.UserId, false); err != nil {
+		return nil, err
+	}
+	n := req.Max
+	if (n <= 0) || (n > moderation.MaxQueueItems) {
+		n = moderation.MaxQueueItems
+	}
+	// Ask for one more item to know whether there's a next page.
+	items, err := s.dbHandler.ReportQueue(req.After, n+1)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := new(moderation.Queue)
+	if len(items) > n {
+		items = items[:n]
+		res.Next = items[n-1].Id
+	}
+	res.Items = make([]moderation.ReportItem, len(items))
+	for i, item := range items {
+		res.Items[i] = reportItem(item)
+	}
+	return res, nil
+}
+
+// Resolve resolves an item of the moderation queue of the section by
+// dismissing its reports, removing the content or locking the thread it
+// belongs to, records the outcome and returns the resolved item along with the
+// notification for the author of a locked thread, if any. Only moderators can
+// resolve reports.
+func (s *Server) Resolve(ctx context.Context, req *moderation.ResolveRequest) (*moderation.ResolveResponse, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkRole(req.UserId, false); err != nil {
+		return nil, err
+	}
+	r := dbmodel.Resolution{
+		Submitter: req.UserId,
+		Outcome:   req.Outcome,
+		Note:      req.Note,
+	}
+	item, notifyUser, err := s.dbHandler.ResolveReport(req.ReportId, r)
+	if err != nil {
+		return nil, moderationError(err)
+	}
+	res := &moderation.ResolveResponse{
+		Item: reportItem(item),
+	}
+	if notifyUser != nil {
+		res.Notifs, err = reactions.NewNotifs([]*pbApi.NotifyUser{notifyUser})
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	return res, nil
+}
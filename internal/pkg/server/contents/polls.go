@@ -0,0 +1,110 @@
+package contents
+
+import (
+	"context"
+	"errors"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/polls"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sectionThread returns the context of the thread with the given id in the
+// section.
+func (s *Server) sectionThread(threadId string) *pbContext.Thread {
+	return &pbContext.Thread{
+		Id: threadId,
+		SectionCtx: &pbContext.Section{
+			Id: s.sectionId,
+		},
+	}
+}
+
+// pollResults converts the given results of a poll to the results sent by the
+// Polls service.
+func pollResults(res *dbmodel.PollResults) *polls.Results {
+	return &polls.Results{
+		Spec: polls.Spec{
+			Options:        res.Options,
+			ClosesAt:       res.ClosesAt,
+			MultipleChoice: res.MultipleChoice,
+		},
+		Votes:   res.Votes,
+		Voters:  res.Voters,
+		Closed:  res.Closed,
+		Choices: res.Choices,
+	}
+}
+
+// pollError converts the given error returned by a poll operation into a gRPC
+// status error.
+func pollError(err error) error {
+	switch {
+	case errors.Is(err, dbmodel.ErrThreadNotFound),
+		errors.Is(err, dbmodel.ErrPollNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, dbmodel.ErrInvalidChoice):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, dbmodel.ErrAlreadyVoted),
+		errors.Is(err, dbmodel.ErrNotVoted),
+		errors.Is(err, dbmodel.ErrPollClosed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// Vote submits the vote of a user on the poll of a thread and returns the
+// results. Each user can vote once on a poll; the first vote counts as an
+// interaction on the thread. Users banned from the section are rejected with a
+// codes.PermissionDenied error.
+func (s *Server) Vote(ctx context.Context, req *polls.VoteRequest) (*polls.Results, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A user id is required")
+	}
+	if err := s.checkBan(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+	res, err := s.dbHandler.VotePoll(s.sectionThread(req.ThreadId), req.UserId, req.Choices)
+	if err != nil {
+		return nil, pollError(err)
+	}
+	return pollResults(res), nil
+}
+
+// ChangeVote replaces the vote of a user on the poll of a thread and returns
+// the results. Users banned from the section are rejected with a
+// codes.PermissionDenied error.
+func (s *Server) ChangeVote(ctx context.Context, req *polls.VoteRequest) (*polls.Results, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A user id is required")
+	}
+	if err := s.checkBan(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+	res, err := s.dbHandler.ChangePollVote(s.sectionThread(req.ThreadId), req.UserId, req.Choices)
+	if err != nil {
+		return nil, pollError(err)
+	}
+	return pollResults(res), nil
+}
+
+// Results returns the results of the poll of a thread, along with the choices
+// of the user in the request, if any.
+func (s *Server) Results(ctx context.Context, req *polls.ResultsRequest) (*polls.Results, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	res, err := s.dbHandler.GetPollResults(s.sectionThread(req.ThreadId), req.UserId)
+	if err != nil {
+		return nil, pollError(err)
+	}
+	return pollResults(res), nil
+}
@@ -0,0 +1,173 @@
+package contents
+
+import (
+	"context"
+	"errors"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/reactions"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// contentContext returns the context of the content with the given id in the
+// section, or nil if the id has no thread id.
+func (s *Server) contentContext(id reactions.ContentId) *pbContext.Context {
+	if id.ThreadId == "" {
+		return nil
+	}
+	thread := &pbContext.Thread{
+		Id: id.ThreadId,
+		SectionCtx: &pbContext.Section{
+			Id: s.sectionId,
+		},
+	}
+	if id.CommentId == "" {
+		return &pbContext.Context{
+			Ctx: &pbContext.Context_ThreadCtx{ThreadCtx: thread},
+		}
+	}
+	comment := &pbContext.Comment{
+		Id:        id.CommentId,
+		ThreadCtx: thread,
+	}
+	if id.SubcommentId == "" {
+		return &pbContext.Context{
+			Ctx: &pbContext.Context_CommentCtx{CommentCtx: comment},
+		}
+	}
+	return &pbContext.Context{
+		Ctx: &pbContext.Context_SubcommentCtx{
+			SubcommentCtx: &pbContext.Subcomment{
+				Id:         id.SubcommentId,
+				CommentCtx: comment,
+			},
+		},
+	}
+}
+
+// reactionError converts the given error returned by a reaction operation into
+// a gRPC status error.
+func reactionError(err error) error {
+	switch {
+	case errors.Is(err, dbmodel.ErrThreadNotFound),
+		errors.Is(err, dbmodel.ErrCommentNotFound),
+		errors.Is(err, dbmodel.ErrSubcommentNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, dbmodel.ErrAlreadyReacted),
+		errors.Is(err, dbmodel.ErrNotReacted):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// checkReaction returns the context of the content in the given request or an
+// InvalidArgument error if the request is not valid.
+func (s *Server) checkReaction(req *reactions.ReactRequest) (*pbContext.Context, error) {
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A user id is required")
+	}
+	if !s.reactionSet[req.Reaction] {
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown reaction %q", req.Reaction)
+	}
+	content := s.contentContext(req.Content)
+	if content == nil {
+		return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+	}
+	return content, nil
+}
+
+// getReactions returns the reactions to the given content, along with the
+// reactions of the given user.
+func (s *Server) getReactions(id reactions.ContentId, content *pbContext.Context,
+	userId string) (reactions.Reactions, error) {
+	r, err := s.dbHandler.GetReactions(content, userId)
+	if err != nil {
+		return reactions.Reactions{}, err
+	}
+	return reactions.Reactions{
+		Content: id,
+		Counts:  r.Counts,
+		Mine:    r.Mine,
+	}, nil
+}
+
+// AddReaction adds a reaction of a user to a thread, comment or subcomment and
+// returns the reactions to it, along with the notifications for its author and,
+// for comments and subcomments, the thread author, unless the user is
+// shadowbanned. Users banned from the section are rejected with a
+// codes.PermissionDenied error.
+func (s *Server) AddReaction(ctx context.Context, req *reactions.ReactRequest) (*reactions.ReactResponse, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	content, err := s.checkReaction(req)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkBan(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+	notifyUsers, err := s.dbHandler.AddReaction(content, req.UserId, req.Reaction)
+	if err != nil {
+		return nil, reactionError(err)
+	}
+	notifyUsers = s.dropShadowbannedNotifs(ctx, req.UserId, notifyUsers)
+	res := new(reactions.ReactResponse)
+	if res.Notifs, err = reactions.NewNotifs(notifyUsers); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if res.Reactions, err = s.getReactions(req.Content, content, req.UserId); err != nil {
+		return nil, reactionError(err)
+	}
+	return res, nil
+}
+
+// RemoveReaction removes a reaction of a user from a thread, comment or
+// subcomment and returns the reactions to it.
+func (s *Server) RemoveReaction(ctx context.Context, req *reactions.ReactRequest) (*reactions.ReactResponse, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	content, err := s.checkReaction(req)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.dbHandler.RemoveReaction(content, req.UserId, req.Reaction); err != nil {
+		return nil, reactionError(err)
+	}
+	res := new(reactions.ReactResponse)
+	if res.Reactions, err = s.getReactions(req.Content, content, req.UserId); err != nil {
+		return nil, reactionError(err)
+	}
+	return res, nil
+}
+
+// GetReactions returns the set of reactions of the section and the reactions to
+// each of the contents in the request, along with the reactions of the user in
+// the request, if any.
+func (s *Server) GetReactions(ctx context.Context, req *reactions.GetRequest) (*reactions.GetResponse, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if len(req.Contents) > reactions.MaxContents {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"At most %d contents can be requested", reactions.MaxContents)
+	}
+	res := &reactions.GetResponse{
+		Types: s.reactions,
+	}
+	for _, id := range req.Contents {
+		content := s.contentContext(id)
+		if content == nil {
+			return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+		}
+		r, err := s.getReactions(id, content, req.UserId)
+		if err != nil {
+			return nil, reactionError(err)
+		}
+		res.Reactions = append(res.Reactions, r)
+	}
+	return res, nil
+}
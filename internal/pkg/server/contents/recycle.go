@@ -3,13 +3,19 @@ package contents
 import (
 	"log"
 	"errors"
+	"strconv"
 
 	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/moderation"
 	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
+	"github.com/luisguve/cheroapi/internal/pkg/votes"
 	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
 	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
 	pbMetadata "github.com/luisguve/cheroproto-go/metadata"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -33,9 +39,19 @@ import (
 // possible to fulfill the Pattern of quality specified by the client, which
 // also depends upon the availability of contents.
 //
+// If the client sends a tag in the metadata, only the active threads tagged
+// with it are considered in the context of a section. The tag is ignored in
+// the context of a thread.
+//
+// Threads and comments of shadowbanned users are left out, unless the client
+// sends their id as the viewer in the metadata.
+//
+// In the context of a section, the pinned threads not in DiscardIds are sent
+// first, from the most recently pinned, and take their place in the Pattern.
+//
 // It may return a codes.InvalidArgument error in case of being passed a
-// request with a nil ContentContext or a codes.Internal error in case of
-// a database querying or network issue.
+// request with a nil ContentContext or an invalid tag or a codes.Internal error
+// in case of a database querying or network issue.
 func (s *Server) RecycleContent(req *pbApi.ContentPattern, stream pbApi.CrudCheropatilla_RecycleContentServer) error {
 	if s.dbHandler == nil {
 		return status.Error(codes.Internal, "No database connection")
@@ -55,8 +71,20 @@ func (s *Server) RecycleContent(req *pbApi.ContentPattern, stream pbApi.CrudCher
 	// - GetCommentsOverview and GetComments in case of a thread
 	switch ctx := req.ContentContext.(type) {
 	case *pbApi.ContentPattern_SectionCtx:
-		// get threads in a section
-		metadata, getErr1 = s.dbHandler.GetActiveThreadsOverview()
+		// get threads in a section, tagged with the given tag if any
+		tag, err := tags.FilterFromContext(stream.Context())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		// leave out threads of shadowbanned users
+		setContent := hideThreads(func(c *pbDataFormat.Content) patillator.SegregateDiscarderFinder {
+			return patillator.Content(*c.Metadata)
+		}, s.hiddenAuthors(stream.Context()))
+		if tag != "" {
+			metadata, getErr1 = s.dbHandler.GetTaggedThreadsOverview(tag, setContent)
+		} else {
+			metadata, getErr1 = s.dbHandler.GetActiveThreadsOverview(setContent)
+		}
 		// return an error only if no content could be gotten
 		if (getErr1 != nil) && (len(metadata) == 0) {
 			if errors.Is(getErr1, dbmodel.ErrSectionNotFound) {
@@ -64,13 +92,29 @@ func (s *Server) RecycleContent(req *pbApi.ContentPattern, stream pbApi.CrudCher
 			}
 			return status.Error(codes.Internal, getErr1.Error())
 		}
+		// pinned threads go first, unless the user has already seen them,
+		// taking up to the whole pattern.
+		pinnedIds, unpinned, err := s.splitPinned(metadata, req.DiscardIds)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		pattern := req.Pattern
+		if len(pinnedIds) > len(pattern) {
+			pinnedIds = pinnedIds[:len(pattern)]
+		}
+		pattern = pattern[len(pinnedIds):]
+		if err = sendPinned(stream, pinnedIds); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
 		// get rid of contents already seen by the user
-		cleanedUp = patillator.DiscardContents(metadata, req.DiscardIds)
-		contentIds = patillator.FillPattern(cleanedUp, req.Pattern)
+		cleanedUp = patillator.DiscardContents(unpinned, req.DiscardIds)
+		contentIds = s.newFiller("RecycleContent").FillPattern(cleanedUp, pattern)
+		contentIds = append(pinnedIds, contentIds...)
 		contentRules, getErr2 = s.dbHandler.GetThreads(contentIds)
 	case *pbApi.ContentPattern_ThreadCtx:
-		// get comments in a thread
-		metadata, getErr1 = s.dbHandler.GetCommentsOverview(ctx.ThreadCtx)
+		// get comments in a thread, except those of shadowbanned users
+		metadata, getErr1 = s.dbHandler.GetCommentsOverview(ctx.ThreadCtx,
+			s.hiddenAuthors(stream.Context()))
 		// return an error only if no content could be gotten
 		if (getErr1 != nil) && (len(metadata) == 0) {
 			if errors.Is(getErr1, dbmodel.ErrSectionNotFound) ||
@@ -81,7 +125,7 @@ func (s *Server) RecycleContent(req *pbApi.ContentPattern, stream pbApi.CrudCher
 		}
 		// get rid of contents already seen by the user
 		cleanedUp = patillator.DiscardContents(metadata, req.DiscardIds)
-		contentIds = patillator.FillPattern(cleanedUp, req.Pattern)
+		contentIds = s.newFiller("RecycleContent").FillPattern(cleanedUp, req.Pattern)
 		contentRules, getErr2 = s.dbHandler.GetComments(ctx.ThreadCtx, contentIds)
 	default:
 		return status.Error(
@@ -115,10 +159,20 @@ func (s *Server) RecycleContent(req *pbApi.ContentPattern, stream pbApi.CrudCher
 	return nil
 }
 
+// Send the metadata of the active threads in the section. If the client sends
+// a tag in the metadata, only the threads tagged with it are sent. Threads of
+// shadowbanned users are sent only to them, as the viewer in the metadata.
+//
+// The net score of each thread sent is set in the trailer, under
+// votes.ScoresMD, in the same order.
 func (s *Server) GetActiveThreadsOverview(req *pbApi.GetActiveThreadsOverviewRequest, stream pbApi.CrudCheropatilla_GetActiveThreadsOverviewServer) error {
 	if s.dbHandler == nil {
 		return status.Error(codes.Internal, "No database connection")
 	}
+	tag, err := tags.FilterFromContext(stream.Context())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 	setContent := func(c *pbDataFormat.Content) patillator.SegregateDiscarderFinder {
 		gc := pbMetadata.GeneralContent{
 			SectionId: c.SectionId,
@@ -126,25 +180,34 @@ func (s *Server) GetActiveThreadsOverview(req *pbApi.GetActiveThreadsOverviewReq
 		}
 		return patillator.GeneralContent(gc)
 	}
-	// Get threads in the section.
-	contents, err := s.dbHandler.GetActiveThreadsOverview(setContent)
+	// Get threads in the section, except those of shadowbanned users.
+	setContent = hideThreads(setContent, s.hiddenAuthors(stream.Context()))
+	var contents []patillator.SegregateDiscarderFinder
+	if tag != "" {
+		contents, err = s.dbHandler.GetTaggedThreadsOverview(tag, setContent)
+	} else {
+		contents, err = s.dbHandler.GetActiveThreadsOverview(setContent)
+	}
 	// Return an error only if no contents could be gotten.
 	if (err != nil) && (len(contents) == 0) {
 		return status.Error(codes.Internal, err.Error())
 	}
 	// Send metadata one by one.
+	var scores []string
 	for _, content := range contents {
-		gc, ok := content.(patillator.GeneralContent)
+		sgc, ok := content.(patillator.ScoredGeneralContent)
 		if !ok {
-			log.Println("GetActiveThreadsOverview: failed type assertion to patillator.GeneralContent.")
+			log.Println("GetActiveThreadsOverview: failed type assertion to patillator.ScoredGeneralContent.")
 			continue
 		}
-		metadata := pbMetadata.GeneralContent(gc)
+		metadata := pbMetadata.GeneralContent(sgc.GeneralContent)
 		if err = stream.Send(&metadata); err != nil {
 			log.Println("Could not send GeneralContent:", err)
 			return status.Error(codes.Internal, err.Error())
 		}
+		scores = append(scores, strconv.Itoa(sgc.Score))
 	}
+	stream.SetTrailer(metadata.MD{votes.ScoresMD: scores})
 
 	return nil
 }
@@ -182,3 +245,60 @@ func (s *Server) GetThreadsOverview(req *pbApi.GetThreadsOverviewRequest, stream
 
 	return nil
 }
+
+// splitPinned takes the pinned threads out of the given active threads and
+// returns their ids, from the most recently pinned, along with the rest of the
+// threads. Pinned threads in discardIds are left out of both. Pinned threads
+// keep their status, either NEW or REL, as sent in the feed.
+func (s *Server) splitPinned(threads []patillator.SegregateDiscarderFinder,
+	discardIds []string) ([]patillator.Id, []patillator.SegregateDiscarderFinder, error) {
+	pinned, err := s.dbHandler.GetPinnedThreads()
+	if (err != nil) || (len(pinned) == 0) {
+		return nil, threads, err
+	}
+	discarded := make(map[string]bool)
+	for _, id := range discardIds {
+		discarded[id] = true
+	}
+	// status of each pinned thread found, by id
+	found := make(map[string]string)
+	var rest []patillator.SegregateDiscarderFinder
+	for _, t := range threads {
+		id, ok := t.Key().(string)
+		if !ok {
+			rest = append(rest, t)
+			continue
+		}
+		isPinned, _ := inSlice(pinned, id)
+		if !isPinned {
+			rest = append(rest, t)
+			continue
+		}
+		found[id] = "NEW"
+		if t.IsRelevant() {
+			found[id] = "REL"
+		}
+	}
+	var ids []patillator.Id
+	for _, id := range pinned {
+		// pinned threads filtered out by a tag are not in threads.
+		if status, ok := found[id]; ok && !discarded[id] {
+			ids = append(ids, patillator.Id{Id: id, Status: status})
+		}
+	}
+	return ids, rest, nil
+}
+
+// sendPinned sends the ids of the given pinned threads in the header of the
+// stream, under moderation.PinnedMD, so clients can tell them apart from the
+// rest of the feed. It does nothing if there are none.
+func sendPinned(stream grpc.ServerStream, pinnedIds []patillator.Id) error {
+	if len(pinnedIds) == 0 {
+		return nil
+	}
+	ids := make([]string, len(pinnedIds))
+	for i, id := range pinnedIds {
+		ids[i] = id.Id
+	}
+	return stream.SetHeader(metadata.MD{moderation.PinnedMD: ids})
+}
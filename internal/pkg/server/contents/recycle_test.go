@@ -0,0 +1,94 @@
+package contents_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/luisguve/cheroapi/internal/pkg/moderation"
+	"github.com/luisguve/cheroapi/internal/pkg/server/contents"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbMetadata "github.com/luisguve/cheroproto-go/metadata"
+)
+
+// ruleId returns the id of the thread of the given content rule.
+func ruleId(rule *pbApi.ContentRule) string {
+	if ctx, ok := rule.ContentContext.(*pbApi.ContentRule_ThreadCtx); ok {
+		return ctx.ThreadCtx.Id
+	}
+	return ""
+}
+
+func TestRecyclePinned(t *testing.T) {
+	s, h, done := newServer(t, contents.Options{})
+	defer done()
+
+	first := newThread(t, h, "First pinned", "author1")
+	second := newThread(t, h, "Second pinned", "author2")
+	newThread(t, h, "Not pinned", "author3")
+	// Pins are recorded by the second.
+	if err := h.PinThread(first, moderation.DefaultMaxPinned); err != nil {
+		t.Fatalf("Could not pin thread: %v\n", err)
+	}
+	time.Sleep(time.Second)
+	if err := h.PinThread(second, moderation.DefaultMaxPinned); err != nil {
+		t.Fatalf("Could not pin thread: %v\n", err)
+	}
+	recycle := func(n int, discardIds []string) *fakeStream {
+		t.Helper()
+		req := &pbApi.ContentPattern{
+			Pattern:    make([]pbMetadata.ContentStatus, n),
+			DiscardIds: discardIds,
+			ContentContext: &pbApi.ContentPattern_SectionCtx{
+				SectionCtx: &pbContext.Section{Id: testSection},
+			},
+		}
+		stream := newStream(context.Background())
+		if err := s.RecycleContent(req, stream); err != nil {
+			t.Fatalf("Could not recycle content: %v\n", err)
+		}
+		return stream
+	}
+
+	// Pinned threads go first, from the most recently pinned, keeping their
+	// status, and their ids are sent in the header.
+	stream := recycle(3, nil)
+	if len(stream.rules) != 3 {
+		t.Fatalf("Got %d threads, want 3\n", len(stream.rules))
+	}
+	want := []string{second.Id, first.Id}
+	got := []string{ruleId(stream.rules[0]), ruleId(stream.rules[1])}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got threads %v first, want the pinned threads %v\n", got, want)
+	}
+	for _, rule := range stream.rules[:2] {
+		if (rule.Status != "NEW") && (rule.Status != "REL") {
+			t.Errorf("Got status %q of pinned thread, want NEW or REL\n", rule.Status)
+		}
+	}
+	if got := moderation.PinnedFromHeader(stream.header); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got pinned ids %v in the header, want %v\n", got, want)
+	}
+
+	// They take up to the length of the pattern.
+	stream = recycle(1, nil)
+	if (len(stream.rules) != 1) || (ruleId(stream.rules[0]) != second.Id) {
+		t.Errorf("Got %d threads for a pattern of 1, want only %s\n", len(stream.rules), second.Id)
+	}
+	if got := moderation.PinnedFromHeader(stream.header); !reflect.DeepEqual(got, []string{second.Id}) {
+		t.Errorf("Got pinned ids %v in the header, want [%s]\n", got, second.Id)
+	}
+
+	// Pinned threads already seen are left out.
+	stream = recycle(3, []string{second.Id})
+	if got := moderation.PinnedFromHeader(stream.header); !reflect.DeepEqual(got, []string{first.Id}) {
+		t.Errorf("Got pinned ids %v in the header, want [%s]\n", got, first.Id)
+	}
+	for _, rule := range stream.rules {
+		if ruleId(rule) == second.Id {
+			t.Errorf("Got discarded pinned thread %s\n", second.Id)
+		}
+	}
+}
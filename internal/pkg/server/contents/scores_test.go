@@ -0,0 +1,111 @@
+package contents_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	"github.com/luisguve/cheroapi/internal/pkg/server/contents"
+	"github.com/luisguve/cheroapi/internal/pkg/votes"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbMetadata "github.com/luisguve/cheroproto-go/metadata"
+)
+
+// newBuried creates a thread with more interactions than the thread returned by
+// newLiked, but buried under a negative net score.
+func newBuried(t *testing.T, h dbmodel.Handler) *pbContext.Thread {
+	t.Helper()
+	buried := newThread(t, h, "Buried thread", "spammer")
+	for _, userId := range []string{"user1", "user2"} {
+		reply := dbmodel.Reply{
+			Content:     "Spam",
+			Submitter:   userId,
+			PublishDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+		}
+		if _, err := h.ReplyThread(buried, reply); err != nil {
+			t.Fatalf("Could not reply thread: %v\n", err)
+		}
+		ctx := &pbContext.Context{
+			Ctx: &pbContext.Context_ThreadCtx{ThreadCtx: buried},
+		}
+		if _, err := h.Downvote(ctx, userId); err != nil {
+			t.Fatalf("Could not downvote thread: %v\n", err)
+		}
+	}
+	return buried
+}
+
+// newLiked creates a thread with a single upvote.
+func newLiked(t *testing.T, h dbmodel.Handler) *pbContext.Thread {
+	t.Helper()
+	liked := newThread(t, h, "Liked thread", "author")
+	if _, err := h.UpvoteThread("user1", liked); err != nil {
+		t.Fatalf("Could not upvote thread: %v\n", err)
+	}
+	return liked
+}
+
+// Buried threads are never relevant, so they do not make it to the top of the
+// feed of a section even with more interactions.
+func TestRecycleBuried(t *testing.T) {
+	patillator.SetRelevanceModel(patillator.NewNetScoreModel(patillator.NewHotModel(1.8, 0), 0))
+	defer patillator.SetRelevanceModel(nil)
+	s, h, done := newServer(t, contents.Options{})
+	defer done()
+
+	buried := newBuried(t, h)
+	liked := newLiked(t, h)
+	req := &pbApi.ContentPattern{
+		Pattern: []pbMetadata.ContentStatus{
+			pbMetadata.ContentStatus_TOP,
+			pbMetadata.ContentStatus_NEW,
+		},
+		ContentContext: &pbApi.ContentPattern_SectionCtx{
+			SectionCtx: &pbContext.Section{Id: testSection},
+		},
+	}
+	stream := newStream(context.Background())
+	if err := s.RecycleContent(req, stream); err != nil {
+		t.Fatalf("Could not recycle content: %v\n", err)
+	}
+	var got [][2]string
+	for _, rule := range stream.rules {
+		got = append(got, [2]string{ruleId(rule), rule.Status})
+	}
+	want := [][2]string{{liked.Id, "TOP"}, {buried.Id, "NEW"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got threads %v, want %v\n", got, want)
+	}
+}
+
+// The net score of each thread in the overview is sent in the trailer, for the
+// general service to rank them.
+func TestOverviewScores(t *testing.T) {
+	s, h, done := newServer(t, contents.Options{})
+	defer done()
+
+	buried := newBuried(t, h)
+	liked := newLiked(t, h)
+	stream := &overviewStream{ctx: context.Background()}
+	err := s.GetActiveThreadsOverview(&pbApi.GetActiveThreadsOverviewRequest{}, stream)
+	if err != nil {
+		t.Fatalf("Could not get threads overview: %v\n", err)
+	}
+	scores := votes.ScoresFromTrailer(stream.trailer, len(stream.overview))
+	if scores == nil {
+		t.Fatalf("Got trailer %v, want %d net scores\n", stream.trailer, len(stream.overview))
+	}
+	got := make(map[string]int)
+	for i, gc := range stream.overview {
+		got[gc.Content.DataKey] = scores[i]
+	}
+	want := map[string]int{buried.Id: -2, liked.Id: 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got net scores %v, want %v\n", got, want)
+	}
+}
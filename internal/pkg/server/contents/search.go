@@ -0,0 +1,62 @@
+package contents
+
+import (
+	"strconv"
+	"strings"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/search"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Search streams a page of the active and archived threads, comments and
+// subcomments of the section matching the given query, from the most relevant,
+// and then the number of contents matching it. Cursors are the number of
+// results already returned.
+func (s *Server) Search(req *search.Request, stream search.Stream) error {
+	if s.dbHandler == nil {
+		return status.Error(codes.Internal, "No database connection")
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return status.Error(codes.InvalidArgument, "Empty query")
+	}
+	var offset int
+	if req.Cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(req.Cursor)
+		if (err != nil) || (offset < 0) {
+			return status.Error(codes.InvalidArgument, "Invalid cursor")
+		}
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = search.DefaultLimit
+	}
+	if limit > search.MaxLimit {
+		limit = search.MaxLimit
+	}
+	res, err := s.dbHandler.Search(dbmodel.SearchQuery{
+		Text:        req.Query,
+		Offset:      offset,
+		Limit:       limit,
+		ThreadsOnly: req.ThreadsOnly,
+	})
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	for _, h := range res.Hits {
+		hit, err := search.NewHit(s.sectionId, h.Score, h.Content)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err = stream.Send(&search.Response{Hit: hit}); err != nil {
+			return err
+		}
+	}
+	end := &search.End{Total: res.Total}
+	if next := offset + limit; next < res.Total {
+		end.NextCursor = strconv.Itoa(next)
+	}
+	return stream.Send(&search.Response{End: end})
+}
@@ -4,19 +4,149 @@
 package contents
 
 import (
+	"log"
+	"time"
+
 	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
+	"github.com/luisguve/cheroapi/internal/pkg/moderation"
+	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	"github.com/luisguve/cheroapi/internal/pkg/reactions"
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
 )
 
-func New(dbh dbmodel.Handler) *Server {
+// Options holds the settings of a Server.
+type Options struct {
+	// Id of the section, set on search results.
+	SectionId string
+	// Settings of the Fillers used to fill the patterns of feeds.
+	Filler patillator.FillerOptions
+	// Ids of the users allowed to restore any deleted thread, who are also
+	// owners of the section.
+	Admins []string
+	// Time since deletion during which authors can restore their threads.
+	RestoreGracePeriod time.Duration
+	// How long deleted and archived contents are kept before being purged.
+	Retention dbmodel.Retention
+	// How long the results of write rpcs sent with an idempotency key are
+	// kept.
+	IdempotencyKeyTTL time.Duration
+	// How long the idempotency key of a write rpc that has not saved its
+	// result is held before a retry with the same key can write again.
+	IdempotencyPending time.Duration
+	// Maximum number of tags of a thread.
+	MaxTags int
+	// Reactions users can add to contents.
+	Reactions []string
+	// Maximum number of pinned threads.
+	MaxPinned int
+	// Client of the Bans service of the users service, which is asked whether
+	// users are banned before they write to the section. If it's nil, bans are
+	// not checked. It's also asked for the shadowbanned users, whose contents
+	// are left out of the feeds of everyone else.
+	Bans bans.Client
+}
+
+// DefaultRestoreGracePeriod is the grace period for authors to restore their
+// deleted threads, unless a different one is set.
+const DefaultRestoreGracePeriod = 24 * time.Hour
+
+// DefaultIdempotencyKeyTTL is how long idempotency keys are kept, unless a
+// different time is set.
+const DefaultIdempotencyKeyTTL = 24 * time.Hour
+
+// DefaultIdempotencyPending is how long the key of an unfinished write rpc is
+// held, unless a different time is set.
+const DefaultIdempotencyPending = time.Minute
+
+func New(dbh dbmodel.Handler, opts Options) *Server {
+	admins := make(map[string]bool)
+	for _, userId := range opts.Admins {
+		admins[userId] = true
+	}
+	if opts.RestoreGracePeriod == 0 {
+		opts.RestoreGracePeriod = DefaultRestoreGracePeriod
+	}
+	if opts.IdempotencyKeyTTL == 0 {
+		opts.IdempotencyKeyTTL = DefaultIdempotencyKeyTTL
+	}
+	if opts.IdempotencyPending == 0 {
+		opts.IdempotencyPending = DefaultIdempotencyPending
+	}
+	if opts.MaxTags == 0 {
+		opts.MaxTags = tags.DefaultMaxTags
+	}
+	if opts.MaxPinned == 0 {
+		opts.MaxPinned = moderation.DefaultMaxPinned
+	}
+	if len(opts.Reactions) == 0 {
+		opts.Reactions = reactions.DefaultTypes
+	}
+	reactionSet := make(map[string]bool)
+	for _, r := range opts.Reactions {
+		reactionSet[r] = true
+	}
+	var shadowbans *bans.ShadowbanCache
+	if opts.Bans != nil {
+		shadowbans = bans.NewShadowbanCache(opts.Bans, 0)
+	}
 	return &Server{
-		dbHandler: dbh,
+		dbHandler:          dbh,
+		sectionId:          opts.SectionId,
+		fillerOpts:         opts.Filler,
+		admins:             admins,
+		restoreGrace:       opts.RestoreGracePeriod,
+		retention:          opts.Retention,
+		idempotencyTTL:     opts.IdempotencyKeyTTL,
+		idempotencyPending: opts.IdempotencyPending,
+		maxTags:            opts.MaxTags,
+		reactions:          opts.Reactions,
+		reactionSet:        reactionSet,
+		maxPinned:          opts.MaxPinned,
+		bansClient:         opts.Bans,
+		shadowbans:         shadowbans,
 	}
 }
 
 type Server struct {
-	dbHandler dbmodel.Handler
+	dbHandler          dbmodel.Handler
+	sectionId          string
+	fillerOpts         patillator.FillerOptions
+	admins             map[string]bool
+	restoreGrace       time.Duration
+	retention          dbmodel.Retention
+	idempotencyTTL     time.Duration
+	idempotencyPending time.Duration
+	maxTags            int
+	reactions          []string
+	reactionSet        map[string]bool
+	maxPinned          int
+	bansClient         bans.Client
+	shadowbans         *bans.ShadowbanCache
+}
+
+// newFiller returns a Filler to fill the pattern of a request to the given
+// rpc, logging its seed if set in the options of the server.
+func (s *Server) newFiller(rpc string) *patillator.Filler {
+	f := s.fillerOpts.NewFiller()
+	if s.fillerOpts.LogSeeds {
+		log.Printf("%s: filling pattern with seed %d\n", rpc, f.Seed())
+	}
+	return f
 }
 
 func (s *Server) QA() (string, error) {
 	return s.dbHandler.QA()
 }
+
+func (s *Server) QAHistory(n int) ([]*dbmodel.QASummary, error) {
+	return s.dbHandler.QAHistory(n)
+}
+
+func (s *Server) Purge() (string, error) {
+	return s.dbHandler.Purge(s.retention)
+}
+
+func (s *Server) PurgeHistory(n int) ([]*dbmodel.PurgeSummary, error) {
+	return s.dbHandler.PurgeHistory(n)
+}
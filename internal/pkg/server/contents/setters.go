@@ -3,27 +3,164 @@ package contents
 import (
 	"context"
 	"errors"
+	"strings"
+	"time"
 
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
 	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/edits"
+	"github.com/luisguve/cheroapi/internal/pkg/polls"
+	"github.com/luisguve/cheroapi/internal/pkg/restore"
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
 	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-// Update a thread, comment or subcomment
-/* func (s *Server) UpdateContent(req *pbApi.UpdateContentRequest, stream pbApi.CrudCheropatilla_UpdateContentServer) error {
+// editError converts the given error returned by an edit into a gRPC status
+// error.
+func editError(err error) error {
+	switch {
+	case errors.Is(err, dbmodel.ErrSectionNotFound),
+		errors.Is(err, dbmodel.ErrThreadNotFound),
+		errors.Is(err, dbmodel.ErrCommentNotFound),
+		errors.Is(err, dbmodel.ErrSubcommentNotFound),
+		errors.Is(err, dbmodel.ErrBucketNotFound),
+		errors.Is(err, dbmodel.ErrCommentsBucketNotFound),
+		errors.Is(err, dbmodel.ErrSubcommentsBucketNotFound),
+		errors.Is(err, dbmodel.ErrRevisionNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, dbmodel.ErrUserNotAllowed):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, dbmodel.ErrEmptyContent):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, dbmodel.ErrContentRemoved):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// formatRevision returns the given revision of a content as an edits.Revision.
+func formatRevision(rev *dbmodel.Revision) edits.Revision {
+	return edits.Revision{
+		Number:   rev.Number,
+		EditedAt: rev.EditedAt,
+		Title:    rev.Content.Title,
+		Text:     rev.Content.Content,
+		FtFile:   rev.Content.FtFile,
+	}
+}
+
+// Edit a thread, comment or subcomment. Only the author can edit it and the
+// previous version of the content is kept as a revision. Contents removed by
+// moderators cannot be edited.
+func (s *Server) EditContent(ctx context.Context, req *edits.EditRequest) (*edits.EditResponse, error) {
 	if s.dbHandler == nil {
-		return status.Error(codes.Internal, "No database connection")
+		return nil, status.Error(codes.Internal, "No database connection")
 	}
-	var (
-		submitter = req.UserId
-		notifyUsers []*pbApi.NotifyUsers
-		err error
-		sendErr error
-	)
-} */
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A user id is required")
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		return nil, status.Error(codes.InvalidArgument, dbmodel.ErrEmptyContent.Error())
+	}
+	content := s.contentContext(req.Content)
+	if content == nil {
+		return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+	}
+	now := time.Now().Unix()
+	e := dbmodel.Edit{
+		Title:        req.Title,
+		Content:      req.Text,
+		FtFile:       req.FtFile,
+		RemoveFtFile: req.RemoveFtFile,
+		Submitter:    req.UserId,
+		EditDate:     &pbTime.Timestamp{Seconds: now},
+	}
+	var err error
+
+	switch ctx := content.Ctx.(type) {
+	case *pbContext.Context_ThreadCtx:
+		err = s.dbHandler.UpdateThread(ctx.ThreadCtx, e)
+	case *pbContext.Context_CommentCtx:
+		err = s.dbHandler.UpdateComment(ctx.CommentCtx, e)
+	case *pbContext.Context_SubcommentCtx:
+		err = s.dbHandler.UpdateSubcomment(ctx.SubcommentCtx, e)
+	}
+	if err != nil {
+		return nil, editError(err)
+	}
+	return &edits.EditResponse{EditedAt: now}, nil
+}
+
+// checkRevisionsAccess returns a codes.PermissionDenied error if the given
+// content was removed by a moderator and the given user is not a moderator of
+// the section, since its previous versions may hold what got it removed.
+func (s *Server) checkRevisionsAccess(content *pbContext.Context, userId string) error {
+	removed, err := s.dbHandler.IsRemoved(content)
+	if err != nil {
+		return editError(err)
+	}
+	if !removed {
+		return nil
+	}
+	return s.checkRole(userId, false)
+}
+
+// Get the last time a thread, comment or subcomment was edited by its author
+// and its previous versions.
+func (s *Server) ContentRevisions(ctx context.Context, req *edits.RevisionsRequest) (*edits.Revisions, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	content := s.contentContext(req.Content)
+	if content == nil {
+		return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+	}
+	if err := s.checkRevisionsAccess(content, req.UserId); err != nil {
+		return nil, err
+	}
+	revisions, err := s.dbHandler.GetRevisions(content)
+	if err != nil {
+		return nil, editError(err)
+	}
+	editedAt, err := s.dbHandler.GetEditTime(content)
+	if err != nil {
+		return nil, editError(err)
+	}
+	res := &edits.Revisions{
+		Content:  req.Content,
+		EditedAt: editedAt,
+	}
+	for _, rev := range revisions {
+		res.Revisions = append(res.Revisions, formatRevision(rev))
+	}
+	return res, nil
+}
 
-// Delete a thread, comment or subcomment
+// Get a single previous version of a thread, comment or subcomment.
+func (s *Server) ContentRevision(ctx context.Context, req *edits.RevisionRequest) (*edits.Revision, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	content := s.contentContext(req.Content)
+	if content == nil {
+		return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+	}
+	if err := s.checkRevisionsAccess(content, req.UserId); err != nil {
+		return nil, err
+	}
+	revision, err := s.dbHandler.GetRevision(content, req.Number)
+	if err != nil {
+		return nil, editError(err)
+	}
+	res := formatRevision(revision)
+	return &res, nil
+}
+
+// Delete a thread, comment or subcomment. Only the author can delete it;
+// moderators remove contents of other users through the Moderation service.
 func (s *Server) DeleteContent(ctx context.Context, req *pbApi.DeleteContentRequest) (*pbApi.DeleteContentResponse, error) {
 	if s.dbHandler == nil {
 		return nil, status.Error(codes.Internal, "No database connection")
@@ -56,7 +193,46 @@ func (s *Server) DeleteContent(ctx context.Context, req *pbApi.DeleteContentRequ
 	return &pbApi.DeleteContentResponse{}, nil
 }
 
-// Post a thread to create
+// Restore a deleted thread. The author can restore it within the grace period
+// of the server, while admins can restore any deleted thread until the next
+// clean up.
+func (s *Server) RestoreThread(ctx context.Context, req *restore.RestoreRequest) (*restore.RestoreResponse, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if req.ThreadId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+	}
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A user id is required")
+	}
+	r := dbmodel.Restore{
+		Submitter:   req.UserId,
+		Admin:       s.admins[req.UserId],
+		GracePeriod: s.restoreGrace,
+		RestoreDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+	}
+	err := s.dbHandler.RestoreThread(s.sectionThread(req.ThreadId), r)
+	if err != nil {
+		if errors.Is(err, dbmodel.ErrDeletedThreadNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, dbmodel.ErrUserNotAllowed) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if errors.Is(err, dbmodel.ErrGracePeriodExpired) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &restore.RestoreResponse{}, nil
+}
+
+// Post a thread to create, along with the tags sent in the metadata, up to the
+// maximum number of tags set in the options of the server, and the poll sent in
+// the metadata, if any. If the client sends an idempotency key, a replay of the
+// request returns the permalink of the thread created by the first one. Users
+// banned from the section are rejected with a codes.PermissionDenied error.
 func (s *Server) CreateThread(ctx context.Context, req *pbApi.CreateThreadRequest) (*pbApi.CreateThreadResponse, error) {
 	if s.dbHandler == nil {
 		return nil, status.Error(codes.Internal, "No database connection")
@@ -65,7 +241,36 @@ func (s *Server) CreateThread(ctx context.Context, req *pbApi.CreateThreadReques
 		submitter = req.UserId
 		content   = req.Content
 	)
-	permalink, err := s.dbHandler.CreateThread(content, submitter)
+	threadTags, err := tags.FromContext(ctx, s.maxTags)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	t := dbmodel.NewThread{Tags: threadTags}
+	poll, err := polls.FromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if poll != nil {
+		t.Poll = &dbmodel.Poll{
+			Options:        poll.Options,
+			ClosesAt:       poll.ClosesAt,
+			MultipleChoice: poll.MultipleChoice,
+		}
+	}
+	if err = s.checkBan(ctx, submitter); err != nil {
+		return nil, err
+	}
+	key, res, err := s.claimKey(ctx, "CreateThread", submitter)
+	if err != nil {
+		return nil, err
+	}
+	if res != nil {
+		return &pbApi.CreateThreadResponse{
+			Permalink: res.Permalink,
+		}, nil
+	}
+	permalink, err := s.dbHandler.CreateThread(content, submitter, t)
+	s.settleKey(key, &dbmodel.IdempotentResult{Permalink: permalink}, err != nil)
 	if err != nil {
 		if errors.Is(err, dbmodel.ErrSectionNotFound) {
 			return nil, status.Error(codes.NotFound, err.Error())
@@ -0,0 +1,31 @@
+package contents
+
+import (
+	"context"
+
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ListTags returns the tags in use in the section and the number of active and
+// archived threads tagged with each of them, from the most used.
+func (s *Server) ListTags(ctx context.Context, req *tags.ListRequest) (*tags.ListResponse, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	counts, err := s.dbHandler.ListTags()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if (req.Limit > 0) && (len(counts) > req.Limit) {
+		counts = counts[:req.Limit]
+	}
+	res := &tags.ListResponse{
+		Tags: make([]tags.Count, len(counts)),
+	}
+	for i, c := range counts {
+		res.Tags[i] = tags.Count{Tag: c.Tag, Threads: c.Threads}
+	}
+	return res, nil
+}
@@ -0,0 +1,106 @@
+package contents_test
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	pbTime "github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/luisguve/cheroapi/internal/pkg/server/contents"
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbMetadata "github.com/luisguve/cheroproto-go/metadata"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTaggedFeed(t *testing.T) {
+	s, _, done := newServer(t, contents.Options{MaxTags: 2})
+	defer done()
+
+	// create posts a thread by the given author with the given tags metadata,
+	// if any, and returns its id.
+	create := func(author, tagsMD string) (string, error) {
+		ctx := context.Background()
+		if tagsMD != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(tags.TagsMD, tagsMD))
+		}
+		req := &pbApi.CreateThreadRequest{
+			Content: &pbApi.Content{
+				Title:       "Thread of " + author,
+				Content:     "Some content",
+				PublishDate: &pbTime.Timestamp{Seconds: time.Now().Unix()},
+			},
+			UserId: author,
+		}
+		res, err := s.CreateThread(ctx, req)
+		if err != nil {
+			return "", err
+		}
+		return path.Base(res.Permalink), nil
+	}
+	tagged, err := create("author1", "Go, news")
+	if err != nil {
+		t.Fatalf("Could not create thread: %v\n", err)
+	}
+	news, err := create("author2", "news")
+	if err != nil {
+		t.Fatalf("Could not create thread: %v\n", err)
+	}
+	if _, err = create("author3", ""); err != nil {
+		t.Fatalf("Could not create thread: %v\n", err)
+	}
+	if _, err = create("author4", "a,b,c"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Got %v creating a thread with too many tags, want code %v\n", err, codes.InvalidArgument)
+	}
+	if _, err = create("author4", "not a tag"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Got %v creating a thread with an invalid tag, want code %v\n", err, codes.InvalidArgument)
+	}
+
+	// recycle returns the ids of the threads of a feed filtered by tag.
+	recycle := func(tag string) []string {
+		t.Helper()
+		req := &pbApi.ContentPattern{
+			Pattern: make([]pbMetadata.ContentStatus, 3),
+			ContentContext: &pbApi.ContentPattern_SectionCtx{
+				SectionCtx: &pbContext.Section{Id: testSection},
+			},
+		}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tags.FilterMD, tag))
+		stream := newStream(ctx)
+		if err := s.RecycleContent(req, stream); err != nil {
+			t.Fatalf("Could not recycle content: %v\n", err)
+		}
+		var ids []string
+		for _, rule := range stream.rules {
+			ids = append(ids, ruleId(rule))
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	want := []string{tagged, news}
+	sort.Strings(want)
+	if got := recycle("NEWS"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got threads %v tagged news, want %v\n", got, want)
+	}
+	if got := recycle("go"); !reflect.DeepEqual(got, []string{tagged}) {
+		t.Errorf("Got threads %v tagged go, want [%s]\n", got, tagged)
+	}
+	if got := recycle("unused"); len(got) != 0 {
+		t.Errorf("Got threads %v tagged with an unused tag, want none\n", got)
+	}
+
+	res, err := s.ListTags(context.Background(), &tags.ListRequest{})
+	if err != nil {
+		t.Fatalf("Could not list tags: %v\n", err)
+	}
+	wantCounts := []tags.Count{{Tag: "news", Threads: 2}, {Tag: "go", Threads: 1}}
+	if !reflect.DeepEqual(res.Tags, wantCounts) {
+		t.Errorf("Got tags %v, want %v\n", res.Tags, wantCounts)
+	}
+}
@@ -0,0 +1,111 @@
+package contents
+
+import (
+	"context"
+	"errors"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/reactions"
+	"github.com/luisguve/cheroapi/internal/pkg/votes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// voteError converts the given error returned by a downvote operation into a
+// gRPC status error.
+func voteError(err error) error {
+	switch {
+	case errors.Is(err, dbmodel.ErrThreadNotFound),
+		errors.Is(err, dbmodel.ErrCommentNotFound),
+		errors.Is(err, dbmodel.ErrSubcommentNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, dbmodel.ErrAlreadyDownvoted),
+		errors.Is(err, dbmodel.ErrNotDownvoted),
+		errors.Is(err, dbmodel.ErrOppositeVote):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// contentVotes converts the given votes of the content with the given id to the
+// votes sent by the Votes service.
+func contentVotes(id reactions.ContentId, v *dbmodel.Votes) *votes.Votes {
+	return &votes.Votes{
+		Content:   id,
+		Upvotes:   v.Upvotes,
+		Downvotes: v.Downvotes,
+		Score:     v.Score,
+		Upvoted:   v.Upvoted,
+		Downvoted: v.Downvoted,
+	}
+}
+
+// Downvote submits the downvote of a user on a thread, comment or subcomment
+// and returns its votes. Users who upvoted the content must undo the upvote
+// first. Users banned from the section are rejected with a
+// codes.PermissionDenied error.
+func (s *Server) Downvote(ctx context.Context, req *votes.VoteRequest) (*votes.Votes, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A user id is required")
+	}
+	content := s.contentContext(req.Content)
+	if content == nil {
+		return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+	}
+	if err := s.checkBan(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+	v, err := s.dbHandler.Downvote(content, req.UserId)
+	if err != nil {
+		return nil, voteError(err)
+	}
+	return contentVotes(req.Content, v), nil
+}
+
+// UndoDownvote removes the downvote of a user from a thread, comment or
+// subcomment and returns its votes.
+func (s *Server) UndoDownvote(ctx context.Context, req *votes.VoteRequest) (*votes.Votes, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A user id is required")
+	}
+	content := s.contentContext(req.Content)
+	if content == nil {
+		return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+	}
+	v, err := s.dbHandler.UndoDownvote(content, req.UserId)
+	if err != nil {
+		return nil, voteError(err)
+	}
+	return contentVotes(req.Content, v), nil
+}
+
+// GetVotes returns the upvotes, downvotes and net score of each of the contents
+// in the request, along with the vote of the user in the request, if any.
+func (s *Server) GetVotes(ctx context.Context, req *votes.GetRequest) (*votes.GetResponse, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if len(req.Contents) > votes.MaxContents {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"At most %d contents can be requested", votes.MaxContents)
+	}
+	res := new(votes.GetResponse)
+	for _, id := range req.Contents {
+		content := s.contentContext(id)
+		if content == nil {
+			return nil, status.Error(codes.InvalidArgument, "A thread id is required")
+		}
+		v, err := s.dbHandler.GetVotes(content, req.UserId)
+		if err != nil {
+			return nil, voteError(err)
+		}
+		res.Votes = append(res.Votes, *contentVotes(id, v))
+	}
+	return res, nil
+}
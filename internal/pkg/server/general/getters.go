@@ -10,15 +10,20 @@ import (
 	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
 	pbUsers "github.com/luisguve/cheroproto-go/userapi"
 	pbContext "github.com/luisguve/cheroproto-go/context"
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
 	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
+	"github.com/luisguve/cheroapi/internal/pkg/votes"
 	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
 )
 
-// Get metadata of all the active threads in every section. It calls
-// GetActiveThreadsOverview for each section in a concurrent fashion and returns
-// a map of section ids to []patillator.SegregateDiscarderFinder and a []error
-// that returns each call to GetActiveThreadsOverview.
-func (s *server) getGeneralThreadsOverview() (map[string][]patillator.SegregateDiscarderFinder, []error) {
+// Get metadata of all the active threads in every section, only those tagged
+// with the given tag if it's not empty. It calls GetActiveThreadsOverview for
+// each section in a concurrent fashion, on behalf of the given viewer, if any,
+// and returns a map of section ids to []patillator.SegregateDiscarderFinder and
+// a []error that returns each call to GetActiveThreadsOverview. Threads are set
+// as patillator.ScoredGeneralContents if their section sent their net scores.
+func (s *server) getGeneralThreadsOverview(tag, viewer string) (map[string][]patillator.SegregateDiscarderFinder, []error) {
 	var (
 		contents map[string][]patillator.SegregateDiscarderFinder
 		errs     []error
@@ -35,7 +40,8 @@ func (s *server) getGeneralThreadsOverview() (map[string][]patillator.SegregateD
 			defer wg.Done()
 			var threadsOverview []patillator.SegregateDiscarderFinder
 
-			stream, err := client.GetActiveThreadsOverview(context.Background(), &pbApi.GetActiveThreadsOverviewRequest{})
+			ctx := bans.WithViewer(tags.WithFilter(context.Background(), tag), viewer)
+			stream, err := client.GetActiveThreadsOverview(ctx, &pbApi.GetActiveThreadsOverviewRequest{})
 			if err != nil {
 				log.Printf("Could not get threads overview: %v\n", err)
 				m.Lock()
@@ -58,6 +64,15 @@ func (s *server) getGeneralThreadsOverview() (map[string][]patillator.SegregateD
 				gc := patillator.GeneralContent(*metadata)
 				threadsOverview = append(threadsOverview, gc)
 			}
+			// Set the net scores of the threads, if the section sent them.
+			if scores := votes.ScoresFromTrailer(stream.Trailer(), len(threadsOverview)); scores != nil {
+				for i, t := range threadsOverview {
+					threadsOverview[i] = patillator.ScoredGeneralContent{
+						GeneralContent: t.(patillator.GeneralContent),
+						Score:          scores[i],
+					}
+				}
+			}
 			// Allocate map (only once) and assign the given metadata.
 			once.Do(func() {
 				contents = make(map[string][]patillator.SegregateDiscarderFinder)
@@ -327,3 +342,23 @@ func (s *server) getContentsByContext(contents map[string][]patillator.Context)
 	wg.Wait()
 	return contentRules, errs
 }
+
+// visibleUsers returns the given users but those shadowbanned, except the given
+// viewer. If the shadowbanned users could not be gotten, the error is logged
+// and the last known ones are left out.
+func (s *server) visibleUsers(ctx context.Context, users []string, viewer string) []string {
+	if s.shadowbans == nil {
+		return users
+	}
+	shadowbanned, err := s.shadowbans.Shadowbanned(ctx)
+	if err != nil {
+		log.Printf("Could not get shadowbanned users: %v\n", err)
+	}
+	var visible []string
+	for _, userId := range users {
+		if (userId == viewer) || !shadowbanned[userId] {
+			visible = append(visible, userId)
+		}
+	}
+	return visible
+}
@@ -7,8 +7,10 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/codes"
 	dbmodel "github.com/luisguve/cheroapi/internal/app/cheroapi"
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
 	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
 	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
 )
 
 // Get new feed of threads in general (from multiple sections).
@@ -26,7 +28,12 @@ import (
 // possible to fulfill the Pattern of quality specified by the client, which
 // also depends upon the availability of contents.
 //
-// It may return a codes.Internal error in case of a database querying or
+// If the client sends a tag in the metadata, only the active threads tagged
+// with it are considered in every section. Threads of shadowbanned users are
+// left out, unless the client sends their id as the viewer in the metadata.
+//
+// It may return a codes.InvalidArgument error in case of being passed an
+// invalid tag or a codes.Internal error in case of a database querying or
 // network issue.
 func (s *server) RecycleGeneral(req *pbApi.GeneralPattern, stream pbApi.CrudGeneral_RecycleGeneralServer) error {
 	var (
@@ -38,8 +45,14 @@ func (s *server) RecycleGeneral(req *pbApi.GeneralPattern, stream pbApi.CrudGene
 		sendErr         error   // stream send
 	)
 
-	// Get threads overview from every section.
-	generalMetadata, getErrs1 = s.getGeneralThreadsOverview()
+	tag, err := tags.FilterFromContext(stream.Context())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	// Get threads overview from every section, on behalf of the viewer so that
+	// the sections leave out the threads of shadowbanned users.
+	viewer := bans.ViewerFromContext(stream.Context())
+	generalMetadata, getErrs1 = s.getGeneralThreadsOverview(tag, viewer)
 	// Return an error only if no content could be gotten.
 	if (getErrs1 != nil) && (generalMetadata == nil) {
 		// Set the first error.
@@ -70,7 +83,7 @@ func (s *server) RecycleGeneral(req *pbApi.GeneralPattern, stream pbApi.CrudGene
 		}
 	}
 
-	contextList := patillator.FillGeneralPattern(cleanedUp, req.Pattern)
+	contextList := s.newFiller("RecycleGeneral").FillGeneralPattern(cleanedUp, req.Pattern)
 	contentRules, getErrs2 = s.getContentsByContext(contextList)
 	// Return an error only if no content rules could be gotten.
 	if (getErrs2 != nil) && (len(contentRules) == 0) {
@@ -129,6 +142,9 @@ func (s *server) RecycleGeneral(req *pbApi.GeneralPattern, stream pbApi.CrudGene
 // possible to fulfill the Pattern of quality specified by the client, which
 // also depends upon the availability of contents.
 //
+// Activity of shadowbanned users is left out, unless the client sends their id
+// as the viewer in the metadata.
+//
 // It may return a codes.Internal error in case of a database querying or
 // network issue.
 func (s *server) RecycleActivity(req *pbApi.ActivityPattern, stream pbApi.CrudGeneral_RecycleActivityServer) error {
@@ -141,7 +157,10 @@ func (s *server) RecycleActivity(req *pbApi.ActivityPattern, stream pbApi.CrudGe
 		sendErr          error   // stream send
 	)
 
-	activityOverview, getErrs1 = s.getActivity(req.Users, req.DiscardIds)
+	// Leave out shadowbanned users, unless they're the viewer.
+	viewer := bans.ViewerFromContext(stream.Context())
+	users := s.visibleUsers(stream.Context(), req.Users, viewer)
+	activityOverview, getErrs1 = s.getActivity(users, req.DiscardIds)
 
 	// Return an error only if it couldn't get any activity.
 	if (getErrs1 != nil) && (activityOverview == nil) {
@@ -154,7 +173,7 @@ func (s *server) RecycleActivity(req *pbApi.ActivityPattern, stream pbApi.CrudGe
 		return status.Error(codes.Internal, errs)
 	}
 
-	contextList := patillator.FillActivityPattern(activityOverview, req.Pattern)
+	contextList := s.newFiller("RecycleActivity").FillActivityPattern(activityOverview, req.Pattern)
 	// Get content of activity from each section.
 	contentRules, getErrs2 = s.getContentsByContext(contextList)
 	// Return an error only if it couldn't get any content.
@@ -255,7 +274,7 @@ func (s *server) RecycleSaved(req *pbApi.SavedPattern, stream pbApi.CrudGeneral_
 		}
 	}
 
-	contextList := patillator.FillGeneralPattern(cleanedUp, req.Pattern)
+	contextList := s.newFiller("RecycleSaved").FillGeneralPattern(cleanedUp, req.Pattern)
 	contentRules, getErrs2 = s.getContentsByContext(contextList)
 	// Return an error only if no content rules could be gotten.
 	if (getErrs2 != nil) && (len(contentRules) == 0) {
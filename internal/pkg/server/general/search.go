@@ -0,0 +1,204 @@
+package general
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luisguve/cheroapi/internal/pkg/search"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sectionSearchTimeout is how long a search waits for each section to answer.
+const sectionSearchTimeout = 5 * time.Second
+
+// errIncompleteResults is returned when the stream of results of a section ends
+// before the end of the page.
+var errIncompleteResults = errors.New("Stream of results ended before the end of the page")
+
+// cursor holds the number of results already returned from each section, by
+// section id. It's encoded as base64 JSON.
+type cursor map[string]int
+
+func decodeCursor(s string) (cursor, error) {
+	c := make(cursor)
+	if s == "" {
+		return c, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	for _, n := range c {
+		if n < 0 {
+			return nil, errors.New("Negative position")
+		}
+	}
+	return c, nil
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sectionResults holds a page of results of a section and the number of
+// contents matching the query in the section.
+type sectionResults struct {
+	hits  []*search.Hit
+	total int
+}
+
+// searchSection returns a page of results of a section.
+func searchSection(ctx context.Context, client search.Client, req *search.Request) (*sectionResults, error) {
+	stream, err := client.Search(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	res := new(sectionResults)
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			return nil, errIncompleteResults
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.Hit != nil {
+			res.hits = append(res.hits, r.Hit)
+		}
+		if r.End != nil {
+			res.total = r.End.Total
+			return res, nil
+		}
+	}
+}
+
+// Search streams a page of the active and archived threads of every section
+// matching the given query, merged by score, and then the number of threads
+// matching it in every section. It calls Search for each section in a
+// concurrent fashion, asking each of them for the next page of results from
+// its position in the cursor, and takes the best of all of them.
+//
+// Sections that fail or do not answer within sectionSearchTimeout are left out
+// of the page, and their errors are set in the end of the page. Their position
+// in the cursor is kept, so they're searched from the same position on the next
+// page, which is always set if any section failed.
+//
+// Each section scores its results with BM25 over its own index, so the inverse
+// document frequencies and average lengths differ from one section to another,
+// and the scores of different sections are only roughly comparable.
+func (s *server) Search(req *search.Request, stream search.Stream) error {
+	if strings.TrimSpace(req.Query) == "" {
+		return status.Error(codes.InvalidArgument, "Empty query")
+	}
+	pos, err := decodeCursor(req.Cursor)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "Invalid cursor")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = search.DefaultLimit
+	}
+	if limit > search.MaxLimit {
+		limit = search.MaxLimit
+	}
+	var (
+		results = make(map[string]*sectionResults)
+		errs    = make(map[string]string)
+		m       sync.Mutex
+		wg      sync.WaitGroup
+	)
+	for sectionId, section := range s.sections {
+		// Query each section client concurrently; use a Mutex to synchronize
+		// write access to results and errs.
+		wg.Add(1)
+		go func(sectionId string, client search.Client) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(stream.Context(), sectionSearchTimeout)
+			defer cancel()
+			sectionReq := &search.Request{
+				Query:       req.Query,
+				Cursor:      strconv.Itoa(pos[sectionId]),
+				Limit:       limit,
+				ThreadsOnly: true,
+			}
+			res, err := searchSection(ctx, client, sectionReq)
+			m.Lock()
+			defer m.Unlock()
+			if err != nil {
+				log.Printf("Could not search section %s: %v\n", sectionId, err)
+				errs[sectionId] = err.Error()
+				return
+			}
+			results[sectionId] = res
+		}(sectionId, section.Search)
+	}
+	wg.Wait()
+
+	// Merge the results by score. Ties are broken by section id, keeping the
+	// order of the results of each section.
+	var (
+		ids   []string
+		hits  []*search.Hit
+		total int
+	)
+	for sectionId := range results {
+		ids = append(ids, sectionId)
+	}
+	sort.Strings(ids)
+	for _, sectionId := range ids {
+		res := results[sectionId]
+		total += res.total
+		for _, hit := range res.hits {
+			hit.SectionId = sectionId
+			hits = append(hits, hit)
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].SectionId < hits[j].SectionId
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	next := make(cursor)
+	for sectionId, n := range pos {
+		next[sectionId] = n
+	}
+	for _, hit := range hits {
+		if err = stream.Send(&search.Response{Hit: hit}); err != nil {
+			log.Printf("Could not send search result: %v\n", err)
+			return status.Error(codes.Internal, err.Error())
+		}
+		next[hit.SectionId]++
+	}
+	end := &search.End{Total: total}
+	for sectionId, res := range results {
+		if next[sectionId] < res.total {
+			end.NextCursor = next.encode()
+			break
+		}
+	}
+	if len(errs) > 0 {
+		// The sections that failed may still have results, from the same
+		// position.
+		end.NextCursor = next.encode()
+		end.Errors = errs
+	}
+	return stream.Send(&search.Response{End: end})
+}
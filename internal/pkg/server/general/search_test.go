@@ -0,0 +1,171 @@
+package general_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	"github.com/luisguve/cheroapi/internal/pkg/search"
+	"github.com/luisguve/cheroapi/internal/pkg/server/general"
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
+	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
+	pbUsers "github.com/luisguve/cheroproto-go/userapi"
+	"google.golang.org/grpc"
+)
+
+// fakeSection is the search service of a section holding contents with the
+// given scores, from the highest. If err is set, every search fails with it.
+type fakeSection struct {
+	scores []float64
+	err    error
+}
+
+func (f fakeSection) Search(ctx context.Context, req *search.Request, opts ...grpc.CallOption) (search.ClientStream, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	from, _ := strconv.Atoi(req.Cursor)
+	to := from + req.Limit
+	if to > len(f.scores) {
+		to = len(f.scores)
+	}
+	var res []*search.Response
+	for _, score := range f.scores[from:to] {
+		res = append(res, &search.Response{Hit: &search.Hit{Score: score}})
+	}
+	res = append(res, &search.Response{End: &search.End{Total: len(f.scores)}})
+	return &fakeResults{res}, nil
+}
+
+type fakeResults struct {
+	res []*search.Response
+}
+
+func (r *fakeResults) Recv() (*search.Response, error) {
+	if len(r.res) == 0 {
+		return nil, io.EOF
+	}
+	next := r.res[0]
+	r.res = r.res[1:]
+	return next, nil
+}
+
+// fakeStream is the server side of a stream of results that records them.
+type fakeStream struct {
+	res []*search.Response
+}
+
+func (s *fakeStream) Send(r *search.Response) error {
+	s.res = append(s.res, r)
+	return nil
+}
+
+func (s *fakeStream) Context() context.Context {
+	return context.Background()
+}
+
+type fakeClient struct {
+	pbApi.CrudCheropatillaClient
+}
+
+type fakeTags struct {
+	tags.Client
+}
+
+type fakeUsers struct {
+	pbUsers.CrudUsersClient
+}
+
+func newSearchServer(sections map[string]fakeSection) search.Server {
+	var list []general.Section
+	for id, s := range sections {
+		list = append(list, general.Section{
+			Client: fakeClient{},
+			Search: s,
+			Tags:   fakeTags{},
+			Id:     id,
+			Name:   id,
+		})
+	}
+	return general.New(list, fakeUsers{}, nil, patillator.FillerOptions{})
+}
+
+// page searches with the given cursor and returns the hits as section:score,
+// along with the end of the page.
+func page(t *testing.T, srv search.Server, cursor string) ([]string, *search.End) {
+	t.Helper()
+	stream := new(fakeStream)
+	req := &search.Request{Query: "query", Cursor: cursor, Limit: 2}
+	if err := srv.Search(req, stream); err != nil {
+		t.Fatalf("Could not search: %v\n", err)
+	}
+	var hits []string
+	var end *search.End
+	for _, r := range stream.res {
+		if r.Hit != nil {
+			hits = append(hits, fmt.Sprintf("%s:%v", r.Hit.SectionId, r.Hit.Score))
+		}
+		if r.End != nil {
+			end = r.End
+		}
+	}
+	if end == nil {
+		t.Fatalf("Got no end of the page\n")
+	}
+	return hits, end
+}
+
+func TestSearchPages(t *testing.T) {
+	srv := newSearchServer(map[string]fakeSection{
+		"a": {scores: []float64{9, 5, 1}},
+		"b": {scores: []float64{8, 7}},
+	})
+	want := [][]string{
+		{"a:9", "b:8"},
+		{"b:7", "a:5"},
+		{"a:1"},
+	}
+	var cursor string
+	for i, w := range want {
+		hits, end := page(t, srv, cursor)
+		if !reflect.DeepEqual(hits, w) {
+			t.Errorf("Got hits %v on page %d, want %v\n", hits, i+1, w)
+		}
+		if end.Total != 5 {
+			t.Errorf("Got total %d on page %d, want 5\n", end.Total, i+1)
+		}
+		last := i == len(want)-1
+		if last != (end.NextCursor == "") {
+			t.Errorf("Got next cursor %q on page %d\n", end.NextCursor, i+1)
+		}
+		cursor = end.NextCursor
+	}
+}
+
+// A section that fails is reported and searched again from the same position
+// on the next page, even if the rest have no more results.
+func TestSearchFailedSection(t *testing.T) {
+	srv := newSearchServer(map[string]fakeSection{
+		"a": {scores: []float64{9}},
+		"b": {err: errors.New("unavailable")},
+	})
+	hits, end := page(t, srv, "")
+	if !reflect.DeepEqual(hits, []string{"a:9"}) {
+		t.Errorf("Got hits %v, want [a:9]\n", hits)
+	}
+	if _, ok := end.Errors["b"]; !ok || (len(end.Errors) != 1) {
+		t.Errorf("Got errors %v, want the error of section b\n", end.Errors)
+	}
+	if end.NextCursor == "" {
+		t.Fatalf("Got no next cursor with a failed section\n")
+	}
+	hits, _ = page(t, srv, end.NextCursor)
+	if len(hits) != 0 {
+		t.Errorf("Got hits %v on the next page, want none\n", hits)
+	}
+}
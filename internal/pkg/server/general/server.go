@@ -8,22 +8,33 @@ import (
 	"fmt"
 
 	"github.com/luisguve/cheroapi/internal/app/general"
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
+	"github.com/luisguve/cheroapi/internal/pkg/patillator"
+	"github.com/luisguve/cheroapi/internal/pkg/search"
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
 	pbApi "github.com/luisguve/cheroproto-go/cheroapi"
 	pbUsers "github.com/luisguve/cheroproto-go/userapi"
 )
 
 type Section struct {
 	Client pbApi.CrudCheropatillaClient
+	Search search.Client
+	Tags   tags.Client
 	Id     string
 	Name   string
 }
 
 type server struct {
-	sections map[string]Section
-	users    pbUsers.CrudUsersClient
+	sections   map[string]Section
+	users      pbUsers.CrudUsersClient
+	shadowbans *bans.ShadowbanCache
+	fillerOpts patillator.FillerOptions
 }
 
-func New(sections []Section, usersClient pbUsers.CrudUsersClient) general.Server {
+// New returns a general.Server that queries the given sections. bansClient is
+// asked for the shadowbanned users, whose activity is left out of the feeds of
+// everyone else; if it's nil, no one is left out.
+func New(sections []Section, usersClient pbUsers.CrudUsersClient, bansClient bans.Client, fillerOpts patillator.FillerOptions) general.Server {
 	if len(sections) == 0 {
 		log.Fatal("There must be at least one section.")
 	}
@@ -31,8 +42,12 @@ func New(sections []Section, usersClient pbUsers.CrudUsersClient) general.Server
 		log.Fatal("Got a nil users client.")
 	}
 	srv := &server{
-		sections: make(map[string]Section),
-		users:    usersClient,
+		sections:   make(map[string]Section),
+		users:      usersClient,
+		fillerOpts: fillerOpts,
+	}
+	if bansClient != nil {
+		srv.shadowbans = bans.NewShadowbanCache(bansClient, 0)
 	}
 	for _, s := range sections {
 		if err := s.preventDefault(); err != nil {
@@ -43,10 +58,26 @@ func New(sections []Section, usersClient pbUsers.CrudUsersClient) general.Server
 	return srv
 }
 
+// newFiller returns a Filler to fill the pattern of a request to the given
+// rpc, logging its seed if set in the options of the server.
+func (s *server) newFiller(rpc string) *patillator.Filler {
+	f := s.fillerOpts.NewFiller()
+	if s.fillerOpts.LogSeeds {
+		log.Printf("%s: filling pattern with seed %d\n", rpc, f.Seed())
+	}
+	return f
+}
+
 func (s Section) preventDefault() error {
 	if s.Client == nil {
 		return fmt.Errorf("Got a nil section client.")
 	}
+	if s.Search == nil {
+		return fmt.Errorf("Got a nil section search client.")
+	}
+	if s.Tags == nil {
+		return fmt.Errorf("Got a nil section tags client.")
+	}
 	if s.Name == "" {
 		return fmt.Errorf("Got an empty section name.")
 	}
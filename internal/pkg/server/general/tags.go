@@ -0,0 +1,78 @@
+package general
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luisguve/cheroapi/internal/pkg/tags"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sectionTagsTimeout is how long ListTags waits for each section to answer.
+const sectionTagsTimeout = 5 * time.Second
+
+// ListTags returns the tags in use in every section and the number of threads
+// tagged with each of them, added up across sections, from the most used. It
+// calls ListTags for each section in a concurrent fashion.
+//
+// Sections that fail or do not answer within sectionTagsTimeout are left out of
+// the counts and their errors are set in the response. It returns a
+// codes.Internal error only if every section failed.
+func (s *server) ListTags(ctx context.Context, req *tags.ListRequest) (*tags.ListResponse, error) {
+	var (
+		counts = make(map[string]int)
+		errs   = make(map[string]string)
+		m      sync.Mutex
+		wg     sync.WaitGroup
+	)
+	for sectionId, section := range s.sections {
+		// Query each section client concurrently; use a Mutex to synchronize
+		// write access to counts and errs.
+		wg.Add(1)
+		go func(sectionId string, client tags.Client) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, sectionTagsTimeout)
+			defer cancel()
+			// Every tag of a section is needed to add them up.
+			res, err := client.ListTags(ctx, &tags.ListRequest{})
+			m.Lock()
+			defer m.Unlock()
+			if err != nil {
+				log.Printf("Could not list tags of section %s: %v\n", sectionId, err)
+				errs[sectionId] = err.Error()
+				return
+			}
+			for _, c := range res.Tags {
+				counts[c.Tag] += c.Threads
+			}
+		}(sectionId, section.Tags)
+	}
+	wg.Wait()
+
+	if len(errs) == len(s.sections) {
+		return nil, status.Error(codes.Internal, "Could not list tags of any section")
+	}
+	res := &tags.ListResponse{
+		Tags: make([]tags.Count, 0, len(counts)),
+	}
+	for tag, n := range counts {
+		res.Tags = append(res.Tags, tags.Count{Tag: tag, Threads: n})
+	}
+	sort.Slice(res.Tags, func(i, j int) bool {
+		if res.Tags[i].Threads != res.Tags[j].Threads {
+			return res.Tags[i].Threads > res.Tags[j].Threads
+		}
+		return res.Tags[i].Tag < res.Tags[j].Tag
+	})
+	if (req.Limit > 0) && (len(res.Tags) > req.Limit) {
+		res.Tags = res.Tags[:req.Limit]
+	}
+	if len(errs) > 0 {
+		res.Errors = errs
+	}
+	return res, nil
+}
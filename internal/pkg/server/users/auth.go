@@ -7,13 +7,15 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	dbmodel "github.com/luisguve/cheroapi/internal/app/userapi"
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
 	pbDataFormat "github.com/luisguve/cheroproto-go/dataformat"
 	pbApi "github.com/luisguve/cheroproto-go/userapi"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-// Validate user credentials to login
+// Validate user credentials to login. Users banned from every section are
+// rejected with a codes.PermissionDenied error telling why and until when.
 func (s *Server) Login(ctx context.Context, req *pbApi.LoginRequest) (*pbApi.LoginResponse, error) {
 	if s.dbHandler == nil {
 		return nil, status.Error(codes.Internal, "No database connection")
@@ -40,6 +42,14 @@ func (s *Server) Login(ctx context.Context, req *pbApi.LoginRequest) (*pbApi.Log
 	if err != nil {
 		return nil, status.Error(codes.PermissionDenied, "Invalid username or password")
 	}
+	// Users banned from every section cannot login until the ban expires.
+	ban, err := s.dbHandler.ActiveBan(string(userId), "")
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if ban != nil {
+		return nil, bans.Error(bans.Ban(*ban))
+	}
 
 	return &pbApi.LoginResponse{
 		UserId: string(userId),
@@ -0,0 +1,194 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	dbmodel "github.com/luisguve/cheroapi/internal/app/userapi"
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkAdmin returns a codes.PermissionDenied error if the given user is not an
+// admin.
+func (s *Server) checkAdmin(userId string) error {
+	if !s.admins[userId] {
+		return status.Error(codes.PermissionDenied, "Only admins can manage bans and take snapshots")
+	}
+	return nil
+}
+
+// listBans returns the bans in force of the given user or, if the user id is
+// empty, of every user.
+func (s *Server) listBans(userId string) (*bans.Bans, error) {
+	list, err := s.dbHandler.ListBans(userId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := &bans.Bans{
+		Bans: make([]bans.Ban, len(list)),
+	}
+	for i, b := range list {
+		res.Bans[i] = bans.Ban(*b)
+	}
+	return res, nil
+}
+
+// AddBan bans a user from a section or, if no section id is set, from every
+// section and from logging in, until the expiry of the ban or forever if it's
+// not set, and returns the bans in force of the user. A previous ban from the
+// same section is replaced. Only admins can ban users.
+func (s *Server) AddBan(ctx context.Context, req *bans.AddRequest) (*bans.Bans, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkAdmin(req.UserId); err != nil {
+		return nil, err
+	}
+	if req.Ban.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A user id to ban is required")
+	}
+	if req.Ban.SectionId == "*" {
+		return nil, status.Error(codes.InvalidArgument, "Invalid section id")
+	}
+	if req.Ban.Reason == "" {
+		return nil, status.Error(codes.InvalidArgument, "A reason is required")
+	}
+	now := time.Now().Unix()
+	if (req.Ban.ExpiresAt != 0) && (req.Ban.ExpiresAt <= now) {
+		return nil, status.Error(codes.InvalidArgument, "The ban must expire in the future")
+	}
+	b := dbmodel.Ban(req.Ban)
+	b.BannedBy = req.UserId
+	b.BannedAt = now
+	if err := s.dbHandler.AddBan(b); err != nil {
+		if errors.Is(err, dbmodel.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return s.listBans(b.UserId)
+}
+
+// LiftBan lifts the ban of a user from a section or from every section and
+// returns the bans in force of the user. Only admins can lift bans.
+func (s *Server) LiftBan(ctx context.Context, req *bans.LiftRequest) (*bans.Bans, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkAdmin(req.UserId); err != nil {
+		return nil, err
+	}
+	if req.TargetId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A target user id is required")
+	}
+	if err := s.dbHandler.LiftBan(req.TargetId, req.SectionId); err != nil {
+		if errors.Is(err, dbmodel.ErrBanNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return s.listBans(req.TargetId)
+}
+
+// ListBans returns the bans in force of a user or, if no target user id is set,
+// of every user. Only admins can list bans.
+func (s *Server) ListBans(ctx context.Context, req *bans.ListRequest) (*bans.Bans, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkAdmin(req.UserId); err != nil {
+		return nil, err
+	}
+	return s.listBans(req.TargetId)
+}
+
+// CheckBan returns the ban in force of a user from every section or from the
+// given section, if any. The section services call it before writes.
+func (s *Server) CheckBan(ctx context.Context, req *bans.CheckRequest) (*bans.CheckResponse, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	b, err := s.dbHandler.ActiveBan(req.UserId, req.SectionId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := new(bans.CheckResponse)
+	if b != nil {
+		ban := bans.Ban(*b)
+		res.Ban = &ban
+	}
+	return res, nil
+}
+
+// listShadowbans returns the shadowbanned users.
+func (s *Server) listShadowbans() (*bans.Shadowbans, error) {
+	list, err := s.dbHandler.ListShadowbans()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := &bans.Shadowbans{
+		Shadowbans: make([]bans.Shadowban, len(list)),
+	}
+	for i, sb := range list {
+		res.Shadowbans[i] = bans.Shadowban(*sb)
+	}
+	return res, nil
+}
+
+// Shadowban shadowbans a user, so the contents of the user are still written
+// but left out of the feeds and notifications of everyone else, and returns the
+// shadowbanned users. Only admins can shadowban users.
+func (s *Server) Shadowban(ctx context.Context, req *bans.ShadowbanRequest) (*bans.Shadowbans, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkAdmin(req.UserId); err != nil {
+		return nil, err
+	}
+	if req.TargetId == "" {
+		return nil, status.Error(codes.InvalidArgument, "A target user id is required")
+	}
+	sb := dbmodel.Shadowban{
+		UserId:   req.TargetId,
+		BannedBy: req.UserId,
+		BannedAt: time.Now().Unix(),
+	}
+	if err := s.dbHandler.Shadowban(sb); err != nil {
+		if errors.Is(err, dbmodel.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return s.listShadowbans()
+}
+
+// LiftShadowban lifts the shadowban of a user and returns the shadowbanned
+// users. Only admins can lift shadowbans.
+func (s *Server) LiftShadowban(ctx context.Context, req *bans.ShadowbanRequest) (*bans.Shadowbans, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkAdmin(req.UserId); err != nil {
+		return nil, err
+	}
+	if err := s.dbHandler.LiftShadowban(req.TargetId); err != nil {
+		if errors.Is(err, dbmodel.ErrNotShadowbanned) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return s.listShadowbans()
+}
+
+// ListShadowbans returns the shadowbanned users. The section services and the
+// general service call it to hide their contents, so it's not restricted to
+// admins.
+func (s *Server) ListShadowbans(ctx context.Context, req *bans.ListShadowbansRequest) (*bans.Shadowbans, error) {
+	if s.dbHandler == nil {
+		return nil, status.Error(codes.Internal, "No database connection")
+	}
+	return s.listShadowbans()
+}
@@ -0,0 +1,101 @@
+package users_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/luisguve/cheroapi/internal/pkg/bans"
+	db "github.com/luisguve/cheroapi/internal/pkg/bolt/users"
+	"github.com/luisguve/cheroapi/internal/pkg/server/users"
+	pbUsers "github.com/luisguve/cheroproto-go/userapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBanLogin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "users")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	h, err := db.New(dir)
+	if err != nil {
+		t.Fatalf("Could not open users database: %v\n", err)
+	}
+	defer h.Close()
+	s := users.New(h, users.Options{Admins: []string{"admin"}})
+	ctx := context.Background()
+
+	reg := &pbUsers.RegisterUserRequest{
+		Email:    "spammer@example.com",
+		Name:     "Spammer",
+		Username: "spammer",
+		Alias:    "Spammer",
+		Password: "a-long-password",
+	}
+	res, err := s.RegisterUser(ctx, reg)
+	if err != nil {
+		t.Fatalf("Could not register user: %v\n", err)
+	}
+	userId := res.UserId
+	login := func() error {
+		_, err := s.Login(ctx, &pbUsers.LoginRequest{Username: "spammer", Password: reg.Password})
+		return err
+	}
+
+	// Only admins can ban users.
+	req := &bans.AddRequest{
+		UserId: "someone",
+		Ban:    bans.Ban{UserId: userId, SectionId: "mylife", Reason: "Spam"},
+	}
+	if _, err = s.AddBan(ctx, req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Got %v banning as another user, want code %v\n", err, codes.PermissionDenied)
+	}
+
+	// A ban from a section keeps the user out of that section only.
+	req.UserId = "admin"
+	if _, err = s.AddBan(ctx, req); err != nil {
+		t.Fatalf("Could not ban user: %v\n", err)
+	}
+	check := func(sectionId string) *bans.Ban {
+		t.Helper()
+		res, err := s.CheckBan(ctx, &bans.CheckRequest{UserId: userId, SectionId: sectionId})
+		if err != nil {
+			t.Fatalf("Could not check ban: %v\n", err)
+		}
+		return res.Ban
+	}
+	if b := check("mylife"); (b == nil) || (b.BannedBy != "admin") {
+		t.Errorf("Got ban %+v from the section, want the ban given by admin\n", b)
+	}
+	if b := check("other"); b != nil {
+		t.Errorf("Got ban %+v from another section, want none\n", b)
+	}
+	if err = login(); err != nil {
+		t.Errorf("Could not login while banned from a section: %v\n", err)
+	}
+
+	// A ban from every section keeps the user from logging in until it's
+	// lifted.
+	req.Ban.SectionId = ""
+	req.Ban.ExpiresAt = time.Now().Add(time.Hour).Unix()
+	if _, err = s.AddBan(ctx, req); err != nil {
+		t.Fatalf("Could not ban user: %v\n", err)
+	}
+	if b := check("other"); (b == nil) || (b.SectionId != "") {
+		t.Errorf("Got ban %+v from another section, want the ban from every section\n", b)
+	}
+	if err = login(); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Got %v logging in while banned, want code %v\n", err, codes.PermissionDenied)
+	}
+	lift := &bans.LiftRequest{UserId: "admin", TargetId: userId}
+	if _, err = s.LiftBan(ctx, lift); err != nil {
+		t.Fatalf("Could not lift ban: %v\n", err)
+	}
+	if err = login(); err != nil {
+		t.Errorf("Could not login after the ban was lifted: %v\n", err)
+	}
+}
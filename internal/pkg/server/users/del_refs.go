@@ -47,9 +47,9 @@ func (s *Server) DeleteThread(ctx context.Context, req *pbApi.DeleteThreadReques
 				for i, t := range pbUser.OldActivity.ThreadsCreated {
 					if (t.SectionCtx.Id == sectionId) && (t.Id == id) {
 						found = true
-						last := len(pbUser.RecentActivity.ThreadsCreated) - 1
-						pbUser.RecentActivity.ThreadsCreated[i] = pbUser.RecentActivity.ThreadsCreated[last]
-						pbUser.RecentActivity.ThreadsCreated = pbUser.RecentActivity.ThreadsCreated[:last]
+						last := len(pbUser.OldActivity.ThreadsCreated) - 1
+						pbUser.OldActivity.ThreadsCreated[i] = pbUser.OldActivity.ThreadsCreated[last]
+						pbUser.OldActivity.ThreadsCreated = pbUser.OldActivity.ThreadsCreated[:last]
 						break
 					}
 				}
@@ -110,9 +110,9 @@ func (s *Server) DeleteComment(ctx context.Context, req *pbApi.DeleteCommentRequ
 						(c.ThreadCtx.Id == threadId) &&
 						(c.Id == id) {
 						found = true
-						last := len(pbUser.RecentActivity.Comments) - 1
-						pbUser.RecentActivity.Comments[i] = pbUser.RecentActivity.Comments[last]
-						pbUser.RecentActivity.Comments = pbUser.RecentActivity.Comments[:last]
+						last := len(pbUser.OldActivity.Comments) - 1
+						pbUser.OldActivity.Comments[i] = pbUser.OldActivity.Comments[last]
+						pbUser.OldActivity.Comments = pbUser.OldActivity.Comments[:last]
 						break
 					}
 				}
@@ -176,9 +176,9 @@ func (s *Server) DeleteSubcomment(ctx context.Context, req *pbApi.DeleteSubcomme
 						(s.CommentCtx.Id == commentId) &&
 						(s.Id == id) {
 						found = true
-						last := len(pbUser.RecentActivity.Subcomments) - 1
-						pbUser.RecentActivity.Subcomments[i] = pbUser.RecentActivity.Subcomments[last]
-						pbUser.RecentActivity.Subcomments = pbUser.RecentActivity.Subcomments[:last]
+						last := len(pbUser.OldActivity.Subcomments) - 1
+						pbUser.OldActivity.Subcomments[i] = pbUser.OldActivity.Subcomments[last]
+						pbUser.OldActivity.Subcomments = pbUser.OldActivity.Subcomments[:last]
 						break
 					}
 				}
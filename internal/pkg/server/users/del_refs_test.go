@@ -0,0 +1,106 @@
+package users_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	db "github.com/luisguve/cheroapi/internal/pkg/bolt/users"
+	"github.com/luisguve/cheroapi/internal/pkg/server/users"
+	pbContext "github.com/luisguve/cheroproto-go/context"
+	pbUsers "github.com/luisguve/cheroproto-go/userapi"
+)
+
+// Purges delete the references to archived contents, which are in the old
+// activity of their authors, without touching their recent activity.
+func TestDeleteOldActivity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "users")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	h, err := db.New(dir)
+	if err != nil {
+		t.Fatalf("Could not open users database: %v\n", err)
+	}
+	defer h.Close()
+	s := users.New(h, users.Options{})
+	ctx := context.Background()
+
+	reg := &pbUsers.RegisterUserRequest{
+		Email:    "author@example.com",
+		Name:     "Author",
+		Username: "author",
+		Alias:    "Author",
+		Password: "a-long-password",
+	}
+	res, err := s.RegisterUser(ctx, reg)
+	if err != nil {
+		t.Fatalf("Could not register user: %v\n", err)
+	}
+	userId := res.UserId
+
+	section := &pbContext.Section{Id: "mylife"}
+	threads := make(map[string]*pbContext.Thread)
+	comments := make(map[string]*pbContext.Comment)
+	subcomments := make(map[string]*pbContext.Subcomment)
+	for _, age := range []string{"old", "recent"} {
+		thread := &pbContext.Thread{Id: age + "-thread", SectionCtx: section}
+		comment := &pbContext.Comment{Id: age + "-comment", ThreadCtx: thread}
+		subcomment := &pbContext.Subcomment{Id: age + "-subcomment", CommentCtx: comment}
+		if _, err = s.CreateThread(ctx, &pbUsers.CreateThreadRequest{UserId: userId, Ctx: thread}); err != nil {
+			t.Fatalf("Could not add thread: %v\n", err)
+		}
+		if _, err = s.Comment(ctx, &pbUsers.CommentRequest{UserId: userId, Ctx: comment}); err != nil {
+			t.Fatalf("Could not add comment: %v\n", err)
+		}
+		if _, err = s.Subcomment(ctx, &pbUsers.SubcommentRequest{UserId: userId, Ctx: subcomment}); err != nil {
+			t.Fatalf("Could not add subcomment: %v\n", err)
+		}
+		threads[age], comments[age], subcomments[age] = thread, comment, subcomment
+	}
+	// Archive the old contents.
+	if _, err = s.OldThread(ctx, &pbUsers.OldThreadRequest{UserId: userId, Ctx: threads["old"]}); err != nil {
+		t.Fatalf("Could not move thread to old activity: %v\n", err)
+	}
+	if _, err = s.OldComment(ctx, &pbUsers.OldCommentRequest{UserId: userId, Ctx: comments["old"]}); err != nil {
+		t.Fatalf("Could not move comment to old activity: %v\n", err)
+	}
+	if _, err = s.OldSubcomment(ctx, &pbUsers.OldSubcommentRequest{UserId: userId, Ctx: subcomments["old"]}); err != nil {
+		t.Fatalf("Could not move subcomment to old activity: %v\n", err)
+	}
+
+	// Purge them.
+	if _, err = s.DeleteThread(ctx, &pbUsers.DeleteThreadRequest{UserId: userId, Ctx: threads["old"]}); err != nil {
+		t.Fatalf("Could not delete thread: %v\n", err)
+	}
+	if _, err = s.DeleteComment(ctx, &pbUsers.DeleteCommentRequest{UserId: userId, Ctx: comments["old"]}); err != nil {
+		t.Fatalf("Could not delete comment: %v\n", err)
+	}
+	if _, err = s.DeleteSubcomment(ctx, &pbUsers.DeleteSubcommentRequest{UserId: userId, Ctx: subcomments["old"]}); err != nil {
+		t.Fatalf("Could not delete subcomment: %v\n", err)
+	}
+
+	pbUser, err := h.User(userId)
+	if err != nil {
+		t.Fatalf("Could not get user: %v\n", err)
+	}
+	old := pbUser.OldActivity
+	if (old != nil) && ((len(old.ThreadsCreated) != 0) || (len(old.Comments) != 0) || (len(old.Subcomments) != 0)) {
+		t.Errorf("Got old activity %v after deleting it, want none\n", old)
+	}
+	recent := pbUser.RecentActivity
+	if recent == nil {
+		t.Fatalf("Got no recent activity, want the recent contents\n")
+	}
+	if (len(recent.ThreadsCreated) != 1) || (recent.ThreadsCreated[0].Id != threads["recent"].Id) {
+		t.Errorf("Got threads %v in recent activity, want only %s\n", recent.ThreadsCreated, threads["recent"].Id)
+	}
+	if (len(recent.Comments) != 1) || (recent.Comments[0].Id != comments["recent"].Id) {
+		t.Errorf("Got comments %v in recent activity, want only %s\n", recent.Comments, comments["recent"].Id)
+	}
+	if (len(recent.Subcomments) != 1) || (recent.Subcomments[0].Id != subcomments["recent"].Id) {
+		t.Errorf("Got subcomments %v in recent activity, want only %s\n", recent.Subcomments, subcomments["recent"].Id)
+	}
+}
@@ -15,7 +15,7 @@ import (
 // SaveNotif updates the given notification if it was already there, or appends
 // it to the list of unread notifications of the given user.
 // If the notification was in the list of read notifications, it removes it from
-// there.
+// there. Notifications about the actions of shadowbanned users are dropped.
 func (s *Server) SaveNotif(ctx context.Context, req *pbContents.NotifyUser) (*pbApi.SaveNotifResponse, error) {
 	if s.dbHandler == nil {
 		return nil, status.Error(codes.Internal, "No database connection")
@@ -24,6 +24,17 @@ func (s *Server) SaveNotif(ctx context.Context, req *pbContents.NotifyUser) (*pb
 		userId = req.UserId
 		notif  = req.Notification
 	)
+	// Notifications about the actions of shadowbanned users are dropped,
+	// unless they're for the users themselves.
+	if (notif.Details != nil) && (notif.Details.LastUserIdInvolved != userId) {
+		shadowbanned, err := s.dbHandler.IsShadowbanned(notif.Details.LastUserIdInvolved)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if shadowbanned {
+			return &pbApi.SaveNotifResponse{}, nil
+		}
+	}
 	err := s.dbHandler.UpdateUser(userId, func(pbUser *pbDataFormat.User) *pbDataFormat.User {
 		// If an unread notification with the same Id was there before, the old
 		// notification will be overriden with the new one; it's just an update.
@@ -11,18 +11,29 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-// Append thread to list of recent activity of the given user.
+// Append thread to list of recent activity of the given user, unless it's
+// already there, so the request can be retried safely.
 func (s *Server) CreateThread(ctx context.Context, req *pbApi.CreateThreadRequest) (*pbApi.CreateThreadResponse, error) {
 	if s.dbHandler == nil {
 		return nil, status.Error(codes.Internal, "No database connection")
 	}
+	thread := req.Ctx
 	err := s.dbHandler.UpdateUser(req.UserId, func(pbUser *pbDataFormat.User) *pbDataFormat.User {
 		if pbUser.RecentActivity == nil {
 			pbUser.RecentActivity = new(pbDataFormat.Activity)
 		}
-		pbUser.RecentActivity.ThreadsCreated = append(pbUser.RecentActivity.ThreadsCreated, req.Ctx)
-		// Update last time created field.
-		pbUser.LastTimeCreated = req.PublishDate
+		for _, t := range pbUser.RecentActivity.ThreadsCreated {
+			if (t.SectionCtx.Id == thread.SectionCtx.Id) && (t.Id == thread.Id) {
+				return nil
+			}
+		}
+		pbUser.RecentActivity.ThreadsCreated = append(pbUser.RecentActivity.ThreadsCreated, thread)
+		// Update last time created field, unless the thread is older, as
+		// restored threads are.
+		if (pbUser.LastTimeCreated == nil) || ((req.PublishDate != nil) &&
+			(req.PublishDate.Seconds > pbUser.LastTimeCreated.Seconds)) {
+			pbUser.LastTimeCreated = req.PublishDate
+		}
 		return pbUser
 	})
 	if err != nil {
@@ -34,16 +45,24 @@ func (s *Server) CreateThread(ctx context.Context, req *pbApi.CreateThreadReques
 	return &pbApi.CreateThreadResponse{}, nil
 }
 
-// Append comment to list of recent activity of user.
+// Append comment to list of recent activity of user, unless it's already there,
+// so the request can be retried safely.
 func (s *Server) Comment(ctx context.Context, req *pbApi.CommentRequest) (*pbApi.CommentResponse, error) {
 	if s.dbHandler == nil {
 		return nil, status.Error(codes.Internal, "No database connection")
 	}
+	comment := req.Ctx
 	err := s.dbHandler.UpdateUser(req.UserId, func(pbUser *pbDataFormat.User) *pbDataFormat.User {
 		if pbUser.RecentActivity == nil {
 			pbUser.RecentActivity = new(pbDataFormat.Activity)
 		}
-		pbUser.RecentActivity.Comments = append(pbUser.RecentActivity.Comments, req.Ctx)
+		for _, c := range pbUser.RecentActivity.Comments {
+			if (c.ThreadCtx.SectionCtx.Id == comment.ThreadCtx.SectionCtx.Id) &&
+				(c.ThreadCtx.Id == comment.ThreadCtx.Id) && (c.Id == comment.Id) {
+				return nil
+			}
+		}
+		pbUser.RecentActivity.Comments = append(pbUser.RecentActivity.Comments, comment)
 		return pbUser
 	})
 	if err != nil {
@@ -55,16 +74,25 @@ func (s *Server) Comment(ctx context.Context, req *pbApi.CommentRequest) (*pbApi
 	return &pbApi.CommentResponse{}, nil
 }
 
-// Append subcomment to list of recent activity of user.
+// Append subcomment to list of recent activity of user, unless it's already
+// there, so the request can be retried safely.
 func (s *Server) Subcomment(ctx context.Context, req *pbApi.SubcommentRequest) (*pbApi.SubcommentResponse, error) {
 	if s.dbHandler == nil {
 		return nil, status.Error(codes.Internal, "No database connection")
 	}
+	subcomment := req.Ctx
 	err := s.dbHandler.UpdateUser(req.UserId, func(pbUser *pbDataFormat.User) *pbDataFormat.User {
 		if pbUser.RecentActivity == nil {
 			pbUser.RecentActivity = new(pbDataFormat.Activity)
 		}
-		pbUser.RecentActivity.Subcomments = append(pbUser.RecentActivity.Subcomments, req.Ctx)
+		for _, sc := range pbUser.RecentActivity.Subcomments {
+			if (sc.CommentCtx.ThreadCtx.SectionCtx.Id == subcomment.CommentCtx.ThreadCtx.SectionCtx.Id) &&
+				(sc.CommentCtx.ThreadCtx.Id == subcomment.CommentCtx.ThreadCtx.Id) &&
+				(sc.CommentCtx.Id == subcomment.CommentCtx.Id) && (sc.Id == subcomment.Id) {
+				return nil
+			}
+		}
+		pbUser.RecentActivity.Subcomments = append(pbUser.RecentActivity.Subcomments, subcomment)
 		return pbUser
 	})
 	if err != nil {
@@ -7,12 +7,24 @@ import (
 	dbmodel "github.com/luisguve/cheroapi/internal/app/userapi"
 )
 
-func New(dbh dbmodel.Handler) *Server {
+// Options holds the settings of a Server.
+type Options struct {
+	// Ids of the users allowed to ban other users.
+	Admins []string
+}
+
+func New(dbh dbmodel.Handler, opts Options) *Server {
+	admins := make(map[string]bool)
+	for _, userId := range opts.Admins {
+		admins[userId] = true
+	}
 	return &Server{
 		dbHandler: dbh,
+		admins:    admins,
 	}
 }
 
 type Server struct {
 	dbHandler dbmodel.Handler
+	admins    map[string]bool
 }
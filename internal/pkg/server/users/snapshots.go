@@ -0,0 +1,22 @@
+package users
+
+import (
+	"github.com/luisguve/cheroapi/internal/pkg/snapshots"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Snapshot streams a consistent copy of the database of users, while serving
+// requests. Only admins can take it.
+func (s *Server) Snapshot(req *snapshots.Request, stream snapshots.Stream) error {
+	if s.dbHandler == nil {
+		return status.Error(codes.Internal, "No database connection")
+	}
+	if err := s.checkAdmin(req.UserId); err != nil {
+		return err
+	}
+	if _, err := snapshots.Send(stream, s.dbHandler.Snapshot); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+// Package snapshots provides the Snapshots gRPC service, which streams a
+// consistent copy of the database of a running service to its admins, and its
+// client. Both the section services and the users service implement it.
+//
+// The protocol in cheroproto does not define the service yet, so it's described
+// here by hand and its messages are encoded as JSON by jsoncodec. Clients built
+// by NewClient set the content subtype accordingly.
+
+package snapshots
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/luisguve/cheroapi/internal/pkg/jsoncodec"
+	"google.golang.org/grpc"
+)
+
+// ChunkSize is the maximum number of bytes of the database in a message of the
+// stream.
+const ChunkSize = 64 * 1024
+
+// Request asks for a snapshot of the database on behalf of an admin.
+type Request struct {
+	UserId string `json:"user_id"`
+}
+
+// Chunk is a message of the stream of a snapshot. A stream holds the database
+// in chunks, in order.
+type Chunk struct {
+	Data []byte `json:"data"`
+}
+
+// Server is the server API for the Snapshots service.
+type Server interface {
+	Snapshot(*Request, Stream) error
+}
+
+// Stream is the server side of the stream of a snapshot.
+type Stream interface {
+	Send(*Chunk) error
+	Context() context.Context
+}
+
+type serverStream struct {
+	grpc.ServerStream
+}
+
+func (s *serverStream) Send(c *Chunk) error {
+	return s.ServerStream.SendMsg(c)
+}
+
+// chunkWriter sends everything written to it in Chunks of up to ChunkSize
+// bytes.
+type chunkWriter struct {
+	stream Stream
+}
+
+func (w chunkWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		size := len(p)
+		if size > ChunkSize {
+			size = ChunkSize
+		}
+		if err := w.stream.Send(&Chunk{Data: p[:size]}); err != nil {
+			return n, err
+		}
+		n += size
+		p = p[size:]
+	}
+	return n, nil
+}
+
+// Send writes the snapshot taken by snapshot to stream, in chunks of up to
+// ChunkSize bytes, and returns the size of the snapshot.
+func Send(stream Stream, snapshot func(io.Writer) (int64, error)) (int64, error) {
+	w := bufio.NewWriterSize(chunkWriter{stream}, ChunkSize)
+	n, err := snapshot(w)
+	if err != nil {
+		return n, err
+	}
+	return n, w.Flush()
+}
+
+func snapshotHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := new(Request)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(Server).Snapshot(req, &serverStream{stream})
+}
+
+// serviceName is the full name of the service.
+const serviceName = "cheroapi.Snapshots"
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Server)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Snapshot",
+			Handler:       snapshotHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "snapshots.go",
+}
+
+// Register registers srv as the Snapshots service of s.
+func Register(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client is the client API for the Snapshots service.
+type Client interface {
+	Snapshot(ctx context.Context, req *Request, opts ...grpc.CallOption) (ClientStream, error)
+}
+
+// ClientStream is the client side of the stream of a snapshot. Recv returns
+// io.EOF after the last chunk.
+type ClientStream interface {
+	Recv() (*Chunk, error)
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client of the Snapshots service on the given connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc}
+}
+
+func (c *client) Snapshot(ctx context.Context, req *Request, opts ...grpc.CallOption) (ClientStream, error) {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[0], "/"+serviceName+"/Snapshot", opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	if err = stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &clientStream{stream}, nil
+}
+
+type clientStream struct {
+	grpc.ClientStream
+}
+
+func (s *clientStream) Recv() (*Chunk, error) {
+	c := new(Chunk)
+	if err := s.ClientStream.RecvMsg(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Receive writes the chunks of stream to w until the end of the stream and
+// returns the number of bytes written.
+func Receive(stream ClientStream, w io.Writer) (int64, error) {
+	var n int64
+	for {
+		c, err := stream.Recv()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		written, err := w.Write(c.Data)
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package snapshots_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/luisguve/cheroapi/internal/pkg/snapshots"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// db takes snapshots of a fake database only to the admin.
+type db struct {
+	data []byte
+}
+
+func (d db) Snapshot(req *snapshots.Request, stream snapshots.Stream) error {
+	if req.UserId != "admin" {
+		return status.Error(codes.PermissionDenied, "Not an admin")
+	}
+	_, err := snapshots.Send(stream, func(w io.Writer) (int64, error) {
+		// Write in pieces of a size unrelated to the chunk size.
+		var n int64
+		for p := d.data; len(p) > 0; {
+			size := 1000
+			if size > len(p) {
+				size = len(p)
+			}
+			written, err := w.Write(p[:size])
+			n += int64(written)
+			if err != nil {
+				return n, err
+			}
+			p = p[size:]
+		}
+		return n, nil
+	})
+	return err
+}
+
+// Stream a database bigger than a chunk and receive it whole.
+func TestSnapshot(t *testing.T) {
+	data := make([]byte, 2*snapshots.ChunkSize+123)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	snapshots.Register(s, db{data})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	dial := func(context.Context, string) (net.Conn, error) { return lis.Dial() }
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(dial), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Could not dial: %v\n", err)
+	}
+	defer conn.Close()
+	c := snapshots.NewClient(conn)
+
+	stream, err := c.Snapshot(context.Background(), &snapshots.Request{UserId: "admin"})
+	if err != nil {
+		t.Fatalf("Snapshot: %v\n", err)
+	}
+	var buf bytes.Buffer
+	n, err := snapshots.Receive(stream, &buf)
+	if err != nil {
+		t.Fatalf("Receive: %v\n", err)
+	}
+	if (n != int64(len(data))) || !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("got %d bytes, want the %d bytes of the database\n", n, len(data))
+	}
+
+	stream, err = c.Snapshot(context.Background(), &snapshots.Request{UserId: "someone"})
+	if err != nil {
+		t.Fatalf("Snapshot: %v\n", err)
+	}
+	if _, err = snapshots.Receive(stream, &buf); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("got error %v, want code %v\n", err, codes.PermissionDenied)
+	}
+}
@@ -0,0 +1,181 @@
+// Package tags provides the rules for the tags of threads, the metadata keys
+// under which clients send them, and the Tags gRPC service, which lists the
+// tags in use and the number of threads tagged with each of them, and its
+// client. Both the section services and the general service implement it.
+//
+// The protocol in cheroproto does not have fields for tags yet, so the tags of
+// a new thread are sent in the metadata of CreateThread and the tag to filter
+// feeds by in the metadata of RecycleContent and RecycleGeneral. The service is
+// described here by hand and its messages are encoded as JSON by jsoncodec.
+// Clients built by NewClient set the content subtype accordingly.
+
+package tags
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/luisguve/cheroapi/internal/pkg/jsoncodec"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys under which clients send the tags of a new thread, either as
+// several values or as a single comma-separated value, and the tag to filter
+// a feed by.
+const (
+	TagsMD   = "tags"
+	FilterMD = "tag"
+)
+
+// MaxLen is the maximum length of a tag.
+const MaxLen = 32
+
+// DefaultMaxTags is the maximum number of tags of a thread, unless a different
+// one is set.
+const DefaultMaxTags = 5
+
+// These errors are returned on invalid tags.
+var (
+	ErrInvalidTag  = errors.New("Tags must be 1 to 32 letters, digits or dashes")
+	ErrTooManyTags = errors.New("Too many tags")
+)
+
+// Normalize returns the given tag in lowercase, without surrounding spaces, or
+// ErrInvalidTag if it's empty, longer than MaxLen or holds anything but ASCII
+// letters, digits and dashes.
+func Normalize(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if (tag == "") || (len(tag) > MaxLen) {
+		return "", ErrInvalidTag
+	}
+	for _, r := range tag {
+		if !(((r >= 'a') && (r <= 'z')) || ((r >= '0') && (r <= '9')) || (r == '-')) {
+			return "", ErrInvalidTag
+		}
+	}
+	return tag, nil
+}
+
+// FromContext returns the normalized tags of a new thread sent in the incoming
+// metadata of ctx, without duplicates. It returns ErrTooManyTags if there are
+// more than max of them.
+func FromContext(ctx context.Context, max int) ([]string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	var (
+		tags []string
+		seen = make(map[string]bool)
+	)
+	for _, value := range md.Get(TagsMD) {
+		for _, tag := range strings.Split(value, ",") {
+			tag, err := Normalize(tag)
+			if err != nil {
+				return nil, err
+			}
+			if seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > max {
+		return nil, ErrTooManyTags
+	}
+	return tags, nil
+}
+
+// FilterFromContext returns the normalized tag to filter a feed by sent in the
+// incoming metadata of ctx, or an empty string if there is none.
+func FilterFromContext(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	values := md.Get(FilterMD)
+	if (len(values) == 0) || (values[0] == "") {
+		return "", nil
+	}
+	return Normalize(values[0])
+}
+
+// WithFilter returns a copy of ctx that sends the given tag to filter a feed by
+// in its outgoing metadata, or ctx itself if tag is empty.
+func WithFilter(ctx context.Context, tag string) context.Context {
+	if tag == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, FilterMD, tag)
+}
+
+// ListRequest asks for the tags in use, the most used first. If Limit is
+// greater than 0, only that many tags are listed.
+type ListRequest struct {
+	Limit int `json:"limit,omitempty"`
+}
+
+// ListResponse holds the tags in use and, on the general service, the error
+// returned by each section that could not be queried, by section id; the counts
+// are then of the rest of them.
+type ListResponse struct {
+	Tags   []Count           `json:"tags"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// Count is a tag and the number of active and archived threads tagged with it.
+type Count struct {
+	Tag     string `json:"tag"`
+	Threads int    `json:"threads"`
+}
+
+// Server is the server API for the Tags service.
+type Server interface {
+	ListTags(context.Context, *ListRequest) (*ListResponse, error)
+}
+
+// serviceName is the full name of the service.
+const serviceName = "cheroapi.Tags"
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(serviceName, "ListTags", func() interface{} { return new(ListRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).ListTags(ctx, req.(*ListRequest))
+			}),
+	},
+	Metadata: "tags.go",
+}
+
+// Register registers srv as the Tags service of s.
+func Register(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client is the client API for the Tags service.
+type Client interface {
+	ListTags(ctx context.Context, req *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client of the Tags service on the given connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc}
+}
+
+func (c *client) ListTags(ctx context.Context, req *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	res := new(ListResponse)
+	if err := c.cc.Invoke(ctx, "/"+serviceName+"/ListTags", req, res, opts...); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
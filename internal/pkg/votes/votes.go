@@ -0,0 +1,158 @@
+// Package votes provides the Votes gRPC service, which submits and undoes the
+// downvotes of users on threads, comments and subcomments and returns their
+// upvotes, downvotes and net score, and its client. The section services
+// implement it. Upvotes are still submitted through the Upvote rpc.
+//
+// The protocol in cheroproto does not define downvotes yet, so the service is
+// described here by hand and its messages are encoded as JSON by jsoncodec.
+// Clients built by NewClient set the content subtype accordingly.
+
+package votes
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/luisguve/cheroapi/internal/pkg/jsoncodec"
+	"github.com/luisguve/cheroapi/internal/pkg/reactions"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// MaxContents is the maximum number of contents in a GetRequest.
+const MaxContents = 100
+
+// ScoresMD is the metadata key under which the section services send, in the
+// trailer of GetActiveThreadsOverview, the net score of each thread sent, in
+// the same order.
+const ScoresMD = "net-scores"
+
+// ScoresFromTrailer returns the net scores of the threads sent in a stream of
+// GetActiveThreadsOverview, given its trailer, or nil if there are not n of
+// them or any of them is not a number.
+func ScoresFromTrailer(trailer metadata.MD, n int) []int {
+	values := trailer.Get(ScoresMD)
+	if len(values) != n {
+		return nil
+	}
+	scores := make([]int, n)
+	for i, v := range values {
+		score, err := strconv.Atoi(v)
+		if err != nil {
+			return nil
+		}
+		scores[i] = score
+	}
+	return scores
+}
+
+// VoteRequest holds the downvote of a user on a content.
+type VoteRequest struct {
+	Content reactions.ContentId `json:"content"`
+	UserId  string              `json:"user_id"`
+}
+
+// GetRequest asks for the votes of the given contents and, if UserId is set,
+// the vote of the user on them.
+type GetRequest struct {
+	Contents []reactions.ContentId `json:"contents"`
+	UserId   string                `json:"user_id,omitempty"`
+}
+
+// GetResponse holds the votes of each content in the request, in the same
+// order.
+type GetResponse struct {
+	Votes []Votes `json:"votes"`
+}
+
+// Votes holds the number of upvotes and downvotes of a content, its net score,
+// which is the upvotes minus the downvotes, and whether the user in the request
+// upvoted or downvoted it.
+type Votes struct {
+	Content   reactions.ContentId `json:"content"`
+	Upvotes   int                 `json:"upvotes"`
+	Downvotes int                 `json:"downvotes"`
+	Score     int                 `json:"score"`
+	Upvoted   bool                `json:"upvoted,omitempty"`
+	Downvoted bool                `json:"downvoted,omitempty"`
+}
+
+// Server is the server API for the Votes service.
+type Server interface {
+	Downvote(context.Context, *VoteRequest) (*Votes, error)
+	UndoDownvote(context.Context, *VoteRequest) (*Votes, error)
+	GetVotes(context.Context, *GetRequest) (*GetResponse, error)
+}
+
+// serviceName is the full name of the service.
+const serviceName = "cheroapi.Votes"
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(serviceName, "Downvote", func() interface{} { return new(VoteRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).Downvote(ctx, req.(*VoteRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "UndoDownvote", func() interface{} { return new(VoteRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).UndoDownvote(ctx, req.(*VoteRequest))
+			}),
+		jsoncodec.UnaryMethod(serviceName, "GetVotes", func() interface{} { return new(GetRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(Server).GetVotes(ctx, req.(*GetRequest))
+			}),
+	},
+	Metadata: "votes.go",
+}
+
+// Register registers srv as the Votes service of s.
+func Register(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client is the client API for the Votes service.
+type Client interface {
+	Downvote(ctx context.Context, req *VoteRequest, opts ...grpc.CallOption) (*Votes, error)
+	UndoDownvote(ctx context.Context, req *VoteRequest, opts ...grpc.CallOption) (*Votes, error)
+	GetVotes(ctx context.Context, req *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+}
+
+type client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client of the Votes service on the given connection.
+func NewClient(cc grpc.ClientConnInterface) Client {
+	return &client{cc}
+}
+
+func (c *client) invoke(ctx context.Context, method string, req, res interface{}, opts []grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(jsoncodec.Name)}, opts...)
+	return c.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, res, opts...)
+}
+
+func (c *client) Downvote(ctx context.Context, req *VoteRequest, opts ...grpc.CallOption) (*Votes, error) {
+	res := new(Votes)
+	if err := c.invoke(ctx, "Downvote", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) UndoDownvote(ctx context.Context, req *VoteRequest, opts ...grpc.CallOption) (*Votes, error) {
+	res := new(Votes)
+	if err := c.invoke(ctx, "UndoDownvote", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *client) GetVotes(ctx context.Context, req *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	res := new(GetResponse)
+	if err := c.invoke(ctx, "GetVotes", req, res, opts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}